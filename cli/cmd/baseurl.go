@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+)
+
+// normalizeBaseURL checks that s is an absolute http(s) or
+// protocol-relative ("//cdn.example.com/") URL and gives it the trailing
+// slash variant paths are appended to.
+func normalizeBaseURL(s string) (string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL %q: %w", s, err)
+	}
+	if u.Host == "" || (u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("invalid base URL %q: want https://host/path/ or //host/path/", s)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid base URL %q: query and fragment are not allowed", s)
+	}
+	if !strings.HasSuffix(s, "/") {
+		s += "/"
+	}
+	return s, nil
+}
+
+// srcSet builds the srcset for one format the way the runtime does:
+// widths ascending, base + path, "w" descriptors or "x" densities.
+// Copied-through originals and crops are never included. Returns "" if the
+// format has no variants.
+func srcSet(variants []manifest.Variant, format, base, descriptor string) string {
+	var candidates []manifest.Variant
+	for _, v := range variants {
+		if v.Format == format && v.Responsive() {
+			candidates = append(candidates, v)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Width < candidates[j].Width })
+
+	entries := make([]string, len(candidates))
+	for i, v := range candidates {
+		if descriptor == "x" && v.Density > 0 {
+			entries[i] = fmt.Sprintf("%s%s %gx", base, v.Path, v.Density)
+		} else {
+			entries[i] = fmt.Sprintf("%s%s %dw", base, v.Path, v.Width)
+		}
+	}
+	return strings.Join(entries, ", ")
+}
@@ -1,17 +1,24 @@
 package cmd
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/AnyUserName/tgimg-cli/internal/cache"
+	"github.com/AnyUserName/tgimg-cli/internal/encoder"
+	"github.com/AnyUserName/tgimg-cli/internal/imgcdn"
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
 	"github.com/AnyUserName/tgimg-cli/internal/manifest"
 	"github.com/AnyUserName/tgimg-cli/internal/pipeline"
 	"github.com/AnyUserName/tgimg-cli/internal/profile"
+	"github.com/AnyUserName/tgimg-cli/internal/telegram"
 	"github.com/spf13/cobra"
 )
 
@@ -19,99 +26,589 @@ var (
 	buildOutDir       string
 	buildProfile      string
 	buildWorkers      int
+	buildEncoderProcs int
 	buildWidths       []int
+	buildDPRs         []float64
 	buildQuality      int
 	buildNoRegress    bool
+	buildCopyOriginal bool
+	buildAliases      map[string]string
+	buildDataURI      bool
+	buildEmitNext     bool
+	buildEmitHeaders  []string
+	buildDescriptor   string
+	buildCompact      bool
+	buildFormats      []string
+	buildBasePath     string
+	buildBaseURL      string
+	buildIgnore       []string
+	buildReportJSON   string
+	buildCacheDir     string
+	buildNoCache      bool
+	buildRemoteCache  string
+	buildRemoteRO     bool
+	buildForce        bool
+	buildMmap         bool
+	buildUnicodeKeys  string
+	buildMaxWidth     int
+	buildMinWidth     int
+	buildEffort       string
+	buildChangedSince string
+	buildOnlyFormats  []string
+	buildSkipFormats  []string
+	buildCheckpoint   time.Duration
+	buildCDN          string
+	buildCDNURL       string
+	buildCDNSource    string
+	buildBucket       bucketOptions
+	buildTelegram     telegramOptions
 )
 
 var buildCmd = &cobra.Command{
-	Use:   "build <input_dir>",
+	Use:   "build [input_dir]",
 	Short: "Process images and generate optimized variants + manifest",
 	Long: `Scans input directory for images (png, jpg, jpeg, webp, gif),
 generates resized variants in multiple formats (AVIF, WebP, JPEG/PNG),
 computes thumbhash placeholders, and writes a manifest file.
 
-Output filenames are content-addressed: <key>.<w>.<h>.<hash>.ext`,
-	Args: cobra.ExactArgs(1),
+Output filenames are content-addressed: <key>.<w>.<h>.<hash>.ext
+
+Aliases map stable logical names to asset keys. They are read from
+tgimg.aliases.json in the input directory ({"hero": "banners/spring-2025"})
+and from --alias flags, which take precedence.
+
+Profiles with crop boxes cut each source around its focal point from
+tgimg.focus.json ({"covers/spring": [0.5, 0.3]}, fractions of the source
+size from the top-left), or else around the profile's gravity.
+
+The input may also be a .zip, .tar or .tar.gz archive, read in memory
+without extracting it, or s3://bucket/prefix or gs://bucket/prefix: the
+objects under the prefix are listed and streamed, keyed by their path
+below it, and sidecars such as tgimg.focus.json are read from the prefix.
+Credentials come from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY (HMAC
+keys for Google Cloud Storage); --endpoint selects R2, MinIO and the like.
+
+tg://<file_id>[,<file_id>...] builds files a bot received, such as
+user-submitted photos: each is resolved with the Bot API's getFile
+(files up to 20 MB) and keyed by its file_unique_id. The bot token comes
+from --telegram-token or TGIMG_TOKEN.
+
+Settings (including <input_dir>) default to tgimg.config.json when present;
+see "tgimg init".`,
+	Args: cobra.RangeArgs(0, 1),
 	RunE: runBuild,
 }
 
 func init() {
 	buildCmd.Flags().StringVarP(&buildOutDir, "out", "o", "./tgimg_out", "output directory")
-	buildCmd.Flags().StringVarP(&buildProfile, "profile", "p", "telegram-webview", "processing profile")
-	buildCmd.Flags().IntVarP(&buildWorkers, "workers", "w", 0, "parallel workers (0 = NumCPU)")
+	buildCmd.Flags().StringVarP(&buildProfile, "profile", "p", "telegram-webview", "processing profile; several comma-separated build into <out>/<profile>/ each")
+	buildCmd.Flags().IntVarP(&buildWorkers, "workers", "w", 0, "parallel workers (0 = NumCPU, fewer when memory is short)")
+	buildCmd.Flags().IntVar(&buildEncoderProcs, "encoder-concurrency", 0, "max concurrent cwebp/avifenc processes (0 = no limit beyond --workers)")
 	buildCmd.Flags().IntSliceVar(&buildWidths, "widths", nil, "custom widths (overrides profile)")
+	buildCmd.Flags().Float64SliceVar(&buildDPRs, "dprs", nil, "device pixel ratios generated per width, e.g. 1,2,3 (overrides profile)")
+	buildCmd.Flags().IntVar(&buildMaxWidth, "max-width", 0, "clamp every generated width, high-DPR ones included, to this maximum (0 = no cap)")
+	buildCmd.Flags().IntVar(&buildMinWidth, "min-width", 0, "sources narrower than this get one variant at their own width (0 = profile default)")
 	buildCmd.Flags().IntVarP(&buildQuality, "quality", "q", 0, "quality 1-100 (0 = profile default)")
+	buildCmd.Flags().StringVar(&buildEffort, "effort", "", "encoding effort: fast (dev builds), balanced or max (release builds); default from profile")
+	buildCmd.Flags().StringSliceVar(&buildFormats, "formats", nil, "output formats in priority order (overrides profile)")
+	buildCmd.Flags().StringSliceVar(&buildOnlyFormats, "only-formats", nil, "encode only these of the profile's formats; other formats are kept from the previous build")
+	buildCmd.Flags().StringSliceVar(&buildSkipFormats, "skip-formats", nil, "skip these of the profile's formats; they are kept from the previous build")
+	buildCmd.Flags().StringVar(&buildBasePath, "base-path", "", "manifest base_path, the URL prefix for variant paths (default \"./\")")
+	buildCmd.Flags().StringVar(&buildBaseURL, "base-url", "", "absolute CDN origin for variant URLs (e.g. https://cdn.example.com/img/); sets base_path and wins over --base-path")
+	buildCmd.Flags().StringSliceVar(&buildIgnore, "ignore", nil, "glob patterns of input paths to skip (repeatable)")
 	buildCmd.Flags().BoolVar(&buildNoRegress, "no-regress-size", true, "skip variants larger than original file")
+	buildCmd.Flags().BoolVar(&buildCopyOriginal, "copy-original", false, "copy untouched originals into the output as \"original\" variants")
+	buildCmd.Flags().StringToStringVar(&buildAliases, "alias", nil, "asset alias name=key (repeatable)")
+	buildCmd.Flags().BoolVar(&buildDataURI, "emit-placeholder-datauri", false, "store each decoded thumbhash as a small PNG data URI in the manifest")
+	buildCmd.Flags().BoolVar(&buildEmitNext, "emit-nextjs", false, "also write "+nextMapName+" and "+nextLoaderName+" for next/image (loader map and blurDataURL)")
+	buildCmd.Flags().StringSliceVar(&buildEmitHeaders, "emit-headers", nil, "also write cache header config for hosts: netlify or cloudflare (_headers), htaccess, nginx")
+	buildCmd.Flags().StringVar(&buildDescriptor, "descriptor", "", "srcset descriptor: w (width) or x (density); default from profile")
+	buildCmd.Flags().BoolVar(&buildCompact, "manifest-compact", false, "write a minified manifest without diagnostics fields")
+	buildCmd.Flags().StringVar(&buildReportJSON, "report-json", "", "write a JSON build report (timings, skipped variants, errors, savings); bare flag writes <out>/"+buildReportName)
+	buildCmd.Flags().Lookup("report-json").NoOptDefVal = buildReportName
+	buildCmd.Flags().StringVar(&buildCacheDir, "cache-dir", "", "encode cache directory (default <user cache dir>/tgimg)")
+	buildCmd.Flags().BoolVar(&buildNoCache, "no-cache", false, "encode every variant, bypassing the encode cache")
+	buildCmd.Flags().StringVar(&buildRemoteCache, "remote-cache", os.Getenv("TGIMG_REMOTE_CACHE"), "shared encode cache consulted on local misses: s3://bucket/prefix, gs://bucket/prefix or redis://host:port/db ($TGIMG_REMOTE_CACHE)")
+	buildCmd.Flags().BoolVar(&buildRemoteRO, "remote-cache-read-only", false, "fetch from --remote-cache without writing new entries to it")
+	buildCmd.Flags().StringVar(&buildChangedSince, "changed-since", "", "only process sources changed since this git ref, merging into the existing manifest and deleting the variant files of deleted sources")
+	buildCmd.Flags().DurationVar(&buildCheckpoint, "checkpoint-interval", 30*time.Second, "save progress to the output dir this often so an interrupted build resumes (0 = off)")
+	buildCmd.Flags().BoolVar(&buildForce, "force", false, "re-encode every variant and overwrite its cache entry (e.g. after an encoder upgrade)")
+	buildCmd.Flags().StringVar(&buildUnicodeKeys, "unicode-keys", "nfc", "Unicode form of asset keys: nfc (same keys for files named on macOS and Linux) or none (keep the file names' form)")
+	buildCmd.Flags().BoolVar(&buildMmap, "mmap", false, "memory-map local sources of 4 MB or more instead of reading them (unix; the files must not change during the build)")
+	buildCmd.Flags().StringVar(&buildCDN, "cdn", "", "skip encoding and write variants as imgproxy or cloudflare transformation URLs")
+	buildCmd.Flags().StringVar(&buildCDNURL, "cdn-url", "", "CDN endpoint for --cdn, e.g. https://img.example.com or https://imagedelivery.net/<account hash>")
+	buildCmd.Flags().StringVar(&buildCDNSource, "cdn-source", "", "prefix turning input paths into CDN sources: the imgproxy source URL (s3://bucket/images/) or a Cloudflare image ID prefix")
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	buildCmd.Flags().StringVar(&buildBucket.endpoint, "endpoint", os.Getenv("AWS_ENDPOINT_URL"), "S3-compatible endpoint URL for an s3:// input or remote cache (default AWS; $AWS_ENDPOINT_URL)")
+	buildCmd.Flags().StringVar(&buildBucket.region, "region", region, "bucket region for an s3:// input or remote cache (default $AWS_REGION)")
+	buildCmd.Flags().BoolVar(&buildBucket.pathStyle, "path-style", false, "use path-style bucket addressing for an s3:// input or remote cache")
+	buildCmd.Flags().StringVar(&buildTelegram.token, "telegram-token", os.Getenv("TGIMG_TOKEN"), "bot token for a tg:// input (default $TGIMG_TOKEN)")
+	buildCmd.Flags().StringVar(&buildTelegram.apiURL, "telegram-api-url", telegram.DefaultAPIURL, "Bot API server URL for a tg:// input")
+	registerCompletions(buildCmd, buildFlagCompletions)
 	rootCmd.AddCommand(buildCmd)
 }
 
 func runBuild(cmd *cobra.Command, args []string) error {
-	inputDir := args[0]
+	inputDir, err := inputDirArg(args)
+	if err != nil {
+		return err
+	}
 	start := time.Now()
 
 	// Resolve absolute paths.
-	absInput, err := filepath.Abs(inputDir)
+	in, absInput, err := openInput(cmd.Context(), inputDir, buildBucket, buildTelegram)
 	if err != nil {
-		return fmt.Errorf("resolve input path: %w", err)
+		return err
+	}
+	if c, ok := in.(io.Closer); ok {
+		defer c.Close()
+	}
+	if _, local := in.(pipeline.Dir); !local && buildChangedSince != "" {
+		return withExitCode(ExitUsage, fmt.Errorf("--changed-since needs a git checkout; it cannot be used with a bucket, archive or tg:// input"))
 	}
 	absOutput, err := filepath.Abs(buildOutDir)
 	if err != nil {
 		return fmt.Errorf("resolve output path: %w", err)
 	}
+	if d, local := in.(pipeline.Dir); local {
+		if in, err = outputInsideInput(d, absOutput); err != nil {
+			return withExitCode(ExitUsage, fmt.Errorf("--out %w", err))
+		}
+	}
 
-	// Load profile.
-	prof := profile.Get(buildProfile)
-	if buildWidths != nil {
-		prof.Widths = buildWidths
+	if buildBaseURL != "" {
+		if buildBasePath, err = normalizeBaseURL(buildBaseURL); err != nil {
+			return withExitCode(ExitUsage, err)
+		}
 	}
-	if buildQuality > 0 {
-		prof.Quality = buildQuality
+
+	var cdn imgcdn.Provider
+	if buildCDN != "" {
+		if cdn, err = imgcdn.New(buildCDN, buildCDNURL, buildCDNSource); err != nil {
+			return withExitCode(ExitUsage, fmt.Errorf("--cdn %w", err))
+		}
+		switch {
+		case buildCopyOriginal:
+			return withExitCode(ExitUsage, fmt.Errorf("--copy-original needs local files; it cannot be used with --cdn"))
+		case len(buildOnlyFormats) > 0 || len(buildSkipFormats) > 0:
+			return withExitCode(ExitUsage, fmt.Errorf("--only-formats and --skip-formats cannot be used with --cdn"))
+		case buildChangedSince != "":
+			return withExitCode(ExitUsage, fmt.Errorf("--changed-since cannot be used with --cdn"))
+		case len(buildEmitHeaders) > 0:
+			return withExitCode(ExitUsage, fmt.Errorf("--emit-headers needs local files; it cannot be used with --cdn"))
+		}
+	}
+	if err := checkHeaderTargets(buildEmitHeaders); err != nil {
+		return withExitCode(ExitUsage, err)
 	}
 
-	logVerbose("input:   %s", absInput)
-	logVerbose("output:  %s", absOutput)
-	logVerbose("profile: %s (widths=%v, quality=%d)", prof.Name, prof.Widths, prof.Quality)
+	names, err := splitProfileNames(buildProfile)
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+	multi := len(names) > 1
+	if multi && buildReportJSON != "" && buildReportJSON != buildReportName {
+		return withExitCode(ExitUsage, fmt.Errorf("--report-json with a path takes one profile; pass it bare to write a report per profile"))
+	}
+	if buildMaxWidth < 0 {
+		return withExitCode(ExitUsage, fmt.Errorf("invalid --max-width %d", buildMaxWidth))
+	}
+	if buildMinWidth < 0 {
+		return withExitCode(ExitUsage, fmt.Errorf("invalid --min-width %d", buildMinWidth))
+	}
+	unicodeKeys, err := pipeline.ParseUnicodeKeys(buildUnicodeKeys)
+	if err != nil {
+		return withExitCode(ExitUsage, fmt.Errorf("invalid --unicode-keys: %w", err))
+	}
+	var effort encoder.Effort
+	if buildEffort != "" {
+		if effort, err = encoder.ParseEffort(buildEffort); err != nil {
+			return withExitCode(ExitUsage, fmt.Errorf("invalid --effort: %w", err))
+		}
+	}
 
-	// Create output dir.
-	if err := os.MkdirAll(absOutput, 0o755); err != nil {
-		return fmt.Errorf("create output dir: %w", err)
+	overrides := configOverrides()
+	allOverrides := configOverrides()
+	overrideExcluded, err := filterOverrideFormats(overrides, buildOnlyFormats, buildSkipFormats)
+	if err != nil {
+		return withExitCode(ExitUsage, err)
 	}
 
-	// Run pipeline.
-	p := pipeline.New(pipeline.Config{
-		InputDir:      absInput,
-		OutputDir:     absOutput,
-		Profile:       prof,
-		Workers:       buildWorkers,
-		Verbose:       verbose,
-		NoRegressSize: buildNoRegress,
-	})
+	// Load profiles. With several, each writes to its own subdirectory.
+	targets := make([]*buildTarget, len(names))
+	for i, name := range names {
+		t := &buildTarget{outDir: absOutput}
+		if multi {
+			t.outDir = filepath.Join(absOutput, name)
+		}
+		if t.prof, err = resolveProfile(name, buildWidths, buildDPRs, buildFormats, buildQuality, buildDescriptor); err != nil {
+			return withExitCode(ExitUsage, err)
+		}
+		t.prof.MaxWidth = buildMaxWidth
+		if buildMinWidth > 0 {
+			t.prof.MinWidth = buildMinWidth
+		}
+		if effort != "" {
+			t.prof.Effort = effort
+		}
+
+		t.allFormats = t.prof.Formats
+		if len(buildOnlyFormats) > 0 || len(buildSkipFormats) > 0 {
+			if t.prof.Formats, t.excludedFormats, err = filterFormats(t.prof.Formats, buildOnlyFormats, buildSkipFormats); err != nil {
+				if multi {
+					err = fmt.Errorf("profile %s: %w", name, err)
+				}
+				return withExitCode(ExitUsage, err)
+			}
+		}
+		for _, f := range overrideExcluded {
+			if !containsString(t.excludedFormats, f) {
+				t.excludedFormats = append(t.excludedFormats, f)
+			}
+		}
 
-	m, err := p.Run()
+		lintBuildProfile(t.prof, overrides)
+		targets[i] = t
+	}
+
+	logging.Debugf("input:   %s", absInput)
+	logging.Debugf("output:  %s", absOutput)
+	for _, t := range targets {
+		logging.Debugf("profile: %s (widths=%v, quality=%d, effort=%s)", t.prof.Name, t.prof.Widths, t.prof.Quality, encoder.EffectiveEffort(t.prof.Effort))
+	}
+
+	aliases, err := pipeline.LoadAliases(in)
+	if err != nil {
+		return fmt.Errorf("load aliases: %w", err)
+	}
+	for name, key := range buildAliases {
+		aliases[name] = key
+	}
+	focus, err := pipeline.LoadFocus(in)
+	if err != nil {
+		return fmt.Errorf("load focal points: %w", err)
+	}
+	recolor, err := pipeline.LoadRecolor(in)
+	if err != nil {
+		return fmt.Errorf("load recolor rules: %w", err)
+	}
+	if cdn != nil && len(recolor) > 0 {
+		return withExitCode(ExitUsage, fmt.Errorf("%s cannot be used with --cdn: the CDN renders from the original pixels", pipeline.RecolorFile))
+	}
+
+	var encCache *cache.Cache
+	if !buildNoCache && cdn == nil {
+		if encCache, err = openCache(buildCacheDir); err != nil {
+			return err
+		}
+		logging.Debugf("cache:   %s", encCache.Dir())
+		if buildRemoteCache != "" {
+			remote, err := openRemoteCache(buildRemoteCache, buildBucket)
+			if err != nil {
+				return fmt.Errorf("--remote-cache: %w", err)
+			}
+			encCache.SetRemote(remote, buildRemoteRO)
+			logging.Debugf("remote:  %s", remote)
+		}
+	}
+
+	checkpoint := buildCheckpoint
+	if cdn != nil {
+		checkpoint = 0 // nothing is encoded, so there is little to resume
+	}
+	pipes := make([]*pipeline.Pipeline, len(targets))
+	for i, t := range targets {
+		// Create output dir.
+		if err := os.MkdirAll(t.outDir, 0o755); err != nil {
+			return fmt.Errorf("create output dir: %w", err)
+		}
+
+		var changed []string
+		var previous *manifest.Manifest
+		if buildChangedSince != "" {
+			if changed, previous, err = changedSince(absInput, t.outDir, buildChangedSince); err != nil {
+				return err
+			}
+		}
+
+		t.previous = previous
+		t.pipe = pipeline.New(pipeline.Config{
+			InputDir:           absInput,
+			Input:              in,
+			OutputDir:          t.outDir,
+			Profile:            t.prof,
+			Workers:            buildWorkers,
+			EncoderConcurrency: buildEncoderProcs,
+			NoRegressSize:      buildNoRegress,
+			CopyOriginal:       buildCopyOriginal,
+			Aliases:            aliases,
+			Focus:              focus,
+			Recolor:            recolor,
+			Overrides:          overrides,
+			EmitDataURI:        buildDataURI,
+			BasePath:           buildBasePath,
+			Ignore:             buildIgnore,
+			Cache:              encCache,
+			Force:              buildForce,
+			Mmap:               buildMmap,
+			UnicodeKeys:        unicodeKeys,
+			Changed:            changed,
+			Previous:           previous,
+			CheckpointInterval: checkpoint,
+			CDN:                cdn,
+		})
+		pipes[i] = t.pipe
+	}
+
+	// Run pipelines: one scan and one decode per source for all profiles.
+	ms, err := pipeline.RunAll(pipes)
+	if encCache != nil {
+		hits, misses := encCache.Counts()
+		remoteHits, remoteErrs, remoteErr := encCache.RemoteCounts()
+		logging.Debugf("cache:   %d hits (%d remote), %d misses", hits, remoteHits, misses)
+		if remoteErrs > 0 {
+			logging.Warnf("remote cache: %d failed request(s); last: %v", remoteErrs, remoteErr)
+		}
+		if err := encCache.Flush(); err != nil {
+			logging.Warnf("cache stats: %v", err)
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("pipeline: %w", err)
 	}
+	elapsed := time.Since(start)
+
+	if !quiet {
+		printBuildBanner()
+	}
+	var failed int
+	for i, t := range targets {
+		if err := t.finish(ms[i], allOverrides, absInput, elapsed, multi); err != nil {
+			return err
+		}
+		failed += len(t.pipe.Report().Errors)
+	}
+
+	if failed > 0 {
+		return withExitCode(ExitPartial, fmt.Errorf("%d images failed; manifest written without them", failed))
+	}
+	return nil
+}
+
+// buildTarget is one profile of a build and the directory it writes to.
+type buildTarget struct {
+	prof            profile.Profile
+	outDir          string
+	allFormats      []string           // the profile's formats before --only/--skip-formats
+	excludedFormats []string           // formats kept from the previous build
+	previous        *manifest.Manifest // merged into by --changed-since, if any
+	pipe            *pipeline.Pipeline
+}
+
+// finish completes the target's manifest, writes it with the build report
+// and prints the summary. manifestName shows the profile subdirectory when
+// the build has several.
+func (t *buildTarget) finish(m *manifest.Manifest, allOverrides []pipeline.ProfileOverride, absInput string, elapsed time.Duration, multi bool) error {
+	m.BuildInfo.ToolVersion = version
+
+	// Keep the formats this build skipped from the previous manifest.
+	if len(t.excludedFormats) > 0 {
+		carried, err := carryOverFormats(m, t.outDir, t.excludedFormats, t.allFormats)
+		if err != nil {
+			return err
+		}
+		logging.Debugf("kept %d %s variants from the previous build", carried, strings.Join(t.excludedFormats, "/"))
+		if carried > 0 {
+			m.Config.Formats = append([]string(nil), t.allFormats...)
+			for _, o := range allOverrides {
+				if ov, ok := m.Config.Overrides[o.Pattern]; ok {
+					ov.Formats = o.Formats
+					m.Config.Overrides[o.Pattern] = ov
+				}
+			}
+			m.Config.ComputeFingerprint()
+		}
+	}
 
 	// Write manifest.
-	manifestPath := filepath.Join(absOutput, "tgimg.manifest.json")
-	if err := manifest.WriteJSON(m, manifestPath); err != nil {
+	manifestPath := filepath.Join(t.outDir, manifestFileName)
+	data, err := manifest.Marshal(m, manifest.WriteOptions{Compact: buildCompact})
+	if err != nil {
+		return fmt.Errorf("encode manifest: %w", err)
+	}
+	if err := manifest.WriteFile(manifestPath, data); err != nil {
 		return fmt.Errorf("write manifest: %w", err)
 	}
+	if err := os.Remove(filepath.Join(t.outDir, pipeline.CheckpointFileName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logging.Warnf("remove checkpoint: %v", err)
+	}
+	if t.previous != nil {
+		pruneDeleted(t.previous, m, t.outDir)
+	}
 
-	elapsed := time.Since(start)
+	if buildReportJSON != "" {
+		reportPath := buildReportJSON
+		if reportPath == buildReportName {
+			reportPath = filepath.Join(t.outDir, buildReportName)
+		}
+		r := newBuildReport(m, t.pipe.Report(), absInput, t.outDir, manifestPath, int64(len(data)), elapsed)
+		if err := r.write(reportPath); err != nil {
+			return fmt.Errorf("write build report: %w", err)
+		}
+		logging.Debugf("report:  %s", reportPath)
+	}
 
-	// Print report.
-	printBuildReport(m, elapsed)
+	if buildEmitNext {
+		if err := writeNextJS(m, t.outDir); err != nil {
+			return fmt.Errorf("write next.js loader: %w", err)
+		}
+		logging.Debugf("next.js: %s", filepath.Join(t.outDir, nextLoaderName))
+	}
+	if len(buildEmitHeaders) > 0 {
+		if err := writeHeaders(m, t.outDir, buildEmitHeaders); err != nil {
+			return fmt.Errorf("write cache headers: %w", err)
+		}
+	}
 
+	// Print report.
+	if !quiet {
+		manifestName := manifestFileName
+		if multi {
+			manifestName = filepath.Join(t.prof.Name, manifestFileName)
+		}
+		printBuildReport(m, elapsed, manifestName, int64(len(data)))
+	}
 	return nil
 }
 
-func printBuildReport(m *manifest.Manifest, elapsed time.Duration) {
+// splitProfileNames splits a comma-separated --profile value.
+func splitProfileNames(s string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("invalid --profile %q: empty profile name", s)
+		}
+		if containsString(names, name) {
+			return nil, fmt.Errorf("invalid --profile %q: %s listed twice", s, name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// pruneDeleted deletes the variant files of the assets in prev that m no
+// longer has because their sources were deleted, as "tgimg unused
+// --prune" does. Assets m records an error for keep their files.
+func pruneDeleted(prev, m *manifest.Manifest, outDir string) {
+	var gone []string
+	for key := range prev.Assets {
+		if _, ok := m.Assets[key]; ok {
+			continue
+		}
+		if _, failed := m.Errors[key]; failed {
+			continue
+		}
+		gone = append(gone, key)
+	}
+	if len(gone) == 0 {
+		return
+	}
+	sort.Strings(gone)
+	removed := pruneAssets(prev, gone, outDir)
+	logging.Infof("removed %d variant files of %d deleted sources", removed, len(gone))
+}
+
+// changedSince lists the input files changed since ref and loads the
+// manifest they are merged into. Without a previous manifest it returns
+// nil for both, and the build processes everything.
+func changedSince(inputDir, outputDir, ref string) ([]string, *manifest.Manifest, error) {
+	prev, err := loadManifest(filepath.Join(outputDir, manifestFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		logging.Warnf("--changed-since: no manifest in %s yet; processing every image", outputDir)
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := gitChangedFiles(inputDir, ref)
+	if err != nil {
+		return nil, nil, withExitCode(ExitUsage, fmt.Errorf("--changed-since: %w", err))
+	}
+	logging.Debugf("changed: %d files since %s", len(files), ref)
+	return files, prev, nil
+}
+
+// lintBuildProfile logs lint warnings for the build's profile and the
+// ones each override adds to it. Errors are left to the pipeline.
+func lintBuildProfile(prof profile.Profile, overrides []pipeline.ProfileOverride) {
+	warn := func(name string, issues []profile.Issue) {
+		for _, issue := range issues {
+			if issue.Severity == profile.LintWarning {
+				logging.Warnf("%s: %s", name, issue.Message)
+			}
+		}
+	}
+	warn(fmt.Sprintf("profile %q", prof.Name), prof.Lint())
+	for _, o := range overrides {
+		if merged, err := o.Apply(prof); err == nil {
+			warn(fmt.Sprintf("override %q", o.Pattern), overrideIssues(prof, merged))
+		}
+	}
+}
+
+// resolveProfile loads a named profile and applies flag overrides.
+func resolveProfile(name string, widths []int, dprs []float64, formats []string, quality int, descriptor string) (profile.Profile, error) {
+	prof := profile.Get(name)
+	if widths != nil {
+		prof = prof.WithWidths(widths)
+	}
+	if dprs != nil {
+		if err := profile.ValidateDPRs(dprs); err != nil {
+			return prof, fmt.Errorf("invalid --dprs: %w", err)
+		}
+		prof.DPRs = dprs
+	}
+	if formats != nil {
+		for _, f := range formats {
+			switch f {
+			case "avif", "webp", "jpeg", "png":
+			default:
+				return prof, fmt.Errorf("invalid format %q: want avif, webp, jpeg or png", f)
+			}
+		}
+		prof.Formats = formats
+	}
+	if quality > 0 {
+		prof.Quality = quality
+	}
+	switch descriptor {
+	case "":
+	case profile.DescriptorWidth, profile.DescriptorDensity:
+		prof.Descriptor = descriptor
+	default:
+		return prof, fmt.Errorf("invalid --descriptor %q: want %q or %q",
+			descriptor, profile.DescriptorWidth, profile.DescriptorDensity)
+	}
+	return prof, nil
+}
+
+func printBuildBanner() {
 	fmt.Println()
-	fmt.Println("╔══════════════════════════════════════════════════╗")
-	fmt.Println("║              tgimg build complete                ║")
-	fmt.Println("╚══════════════════════════════════════════════════╝")
+	if logging.ColorEnabled(os.Stdout) {
+		fmt.Println("╔══════════════════════════════════════════════════╗")
+		fmt.Println("║              tgimg build complete                ║")
+		fmt.Println("╚══════════════════════════════════════════════════╝")
+	} else {
+		// Plain banner for pipes, CI logs and NO_COLOR.
+		fmt.Println("== tgimg build complete ==")
+	}
+}
+
+func printBuildReport(m *manifest.Manifest, elapsed time.Duration, manifestName string, manifestSize int64) {
 	fmt.Println()
 
 	stats := m.Stats
@@ -120,11 +617,21 @@ func printBuildReport(m *manifest.Manifest, elapsed time.Duration) {
 		ratio = float64(stats.TotalOutputBytes) / float64(stats.TotalInputBytes) * 100
 	}
 
+	fmt.Printf("  Profile:     %s\n", m.Profile)
 	fmt.Printf("  Assets:      %d\n", stats.TotalAssets)
 	fmt.Printf("  Variants:    %d\n", stats.TotalVariants)
 	fmt.Printf("  Input size:  %s\n", formatBytes(stats.TotalInputBytes))
-	fmt.Printf("  Output size: %s\n", formatBytes(stats.TotalOutputBytes))
-	fmt.Printf("  Ratio:       %.1f%% of original\n", ratio)
+	// --cdn builds encode nothing, so there are no output sizes to report.
+	cdn := ""
+	if m.Config != nil {
+		cdn = m.Config.CDN
+	}
+	if cdn != "" {
+		fmt.Printf("  Output:      %s URLs\n", cdn)
+	} else {
+		fmt.Printf("  Output size: %s\n", formatBytes(stats.TotalOutputBytes))
+		fmt.Printf("  Ratio:       %.1f%% of original\n", ratio)
+	}
 	if stats.SkippedRegress > 0 {
 		fmt.Printf("  Skipped:     %d variants (larger than original)\n", stats.SkippedRegress)
 	}
@@ -137,7 +644,7 @@ func printBuildReport(m *manifest.Manifest, elapsed time.Duration) {
 	fmt.Println()
 
 	// Top 10 heaviest assets.
-	if len(m.Assets) > 0 {
+	if len(m.Assets) > 0 && cdn == "" {
 		type assetSize struct {
 			key        string
 			inputSize  int64
@@ -146,10 +653,17 @@ func printBuildReport(m *manifest.Manifest, elapsed time.Duration) {
 		var items []assetSize
 		for key, a := range m.Assets {
 			var outSum int64
-			for _, v := range a.Variants {
+			for _, v := range a.AllVariants() {
+				if v.Original {
+					continue // copy-through, not an optimized output
+				}
 				outSum += v.Size
 			}
-			items = append(items, assetSize{key, a.Original.Size, outSum})
+			inSum := a.Original.Size
+			for _, t := range a.Themes {
+				inSum += t.Original.Size
+			}
+			items = append(items, assetSize{key, inSum, outSum})
 		}
 		sort.Slice(items, func(i, j int) bool {
 			return items[i].inputSize > items[j].inputSize
@@ -180,15 +694,14 @@ func printBuildReport(m *manifest.Manifest, elapsed time.Duration) {
 	fmt.Println()
 
 	// Manifest path.
-	data, _ := json.Marshal(m)
-	fmt.Printf("  Manifest:    tgimg.manifest.json (%s)\n", formatBytes(int64(len(data))))
+	fmt.Printf("  Manifest:    %s (%s)\n", manifestName, formatBytes(manifestSize))
 	fmt.Println()
 }
 
 func detectOutputFormats(m *manifest.Manifest) []string {
 	set := map[string]bool{}
 	for _, a := range m.Assets {
-		for _, v := range a.Variants {
+		for _, v := range a.AllVariants() {
 			set[v.Format] = true
 		}
 	}
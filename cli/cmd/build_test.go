@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+)
+
+// TestBuildWritesManifestPerProfile builds with two profiles and checks
+// that each gets its own subdirectory with a manifest.
+func TestBuildWritesManifestPerProfile(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	f, err := os.Create(filepath.Join(in, "a.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 800, 600)))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(profile, outDir string, formats []string, noCache, q bool) {
+		buildProfile, buildOutDir, buildFormats, buildNoCache, quiet = profile, outDir, formats, noCache, q
+	}(buildProfile, buildOutDir, buildFormats, buildNoCache, quiet)
+	buildProfile, buildOutDir, buildFormats, buildNoCache, quiet = "minimal,telegram-webview", out, []string{"png"}, true, true
+	if err := runBuild(buildCmd, []string{in}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"minimal", "telegram-webview"} {
+		m, err := loadManifest(filepath.Join(out, name, manifestFileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Profile != name || len(m.Assets) != 1 {
+			t.Errorf("%s: manifest of profile %s with %d assets", name, m.Profile, len(m.Assets))
+		}
+		for _, v := range m.Assets["a"].Variants {
+			if _, err := os.Stat(filepath.Join(out, name, v.Path)); err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(out, manifestFileName)); !os.IsNotExist(err) {
+		t.Errorf("manifest at the top of --out: %v", err)
+	}
+}
+
+// TestPruneDeleted checks that --changed-since deletes the variant files
+// of sources that are gone, and keeps those of sources that failed.
+func TestPruneDeleted(t *testing.T) {
+	out := t.TempDir()
+	prev := unusedManifestFixture(t, out)
+	m := manifest.New("test")
+	m.Assets["photo"] = prev.Assets["photo"]
+	m.Errors = map[string]manifest.AssetError{"logo": {Source: "logo.png", Error: "decode"}}
+
+	pruneDeleted(prev, m, out)
+	for path, want := range map[string]bool{
+		"photo.320.240.png":  true,
+		"logo.320.240.png":   true,
+		"banner.320.240.png": false,
+		"old.320.240.png":    false,
+	} {
+		_, err := os.Stat(filepath.Join(out, path))
+		if kept := err == nil; kept != want {
+			t.Errorf("%s kept = %v, want %v", path, kept, want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AnyUserName/tgimg-cli/internal/cache"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cacheDir    string
+	cacheMaxSz  string
+	cacheMaxAge time.Duration
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and manage the local encode cache",
+	Long: `tgimg build stores every encoded variant in a local cache keyed by the
+source bytes and encoder settings, so unchanged images are not re-encoded
+on the next build. These commands inspect and bound that cache; a shared
+--remote-cache is managed by its own storage (lifecycle rules, TTLs).`,
+}
+
+var cacheStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show cache size, entry count and hit rate",
+	Args:  cobra.NoArgs,
+	RunE:  runCacheStatus,
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove every cache entry",
+	Args:  cobra.NoArgs,
+	RunE:  runCacheClear,
+}
+
+var cacheGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Evict stale entries and bound cache disk usage",
+	Long: `Evicts entries unused for longer than --max-age, then the least recently
+used entries until the cache fits in --max-size.`,
+	Example: "  tgimg cache gc --max-size 2GB\n  tgimg cache gc --max-age 720h",
+	Args:    cobra.NoArgs,
+	RunE:    runCacheGC,
+}
+
+func init() {
+	cacheCmd.PersistentFlags().StringVar(&cacheDir, "cache-dir", "", "encode cache directory (default <user cache dir>/tgimg)")
+	cacheGCCmd.Flags().StringVar(&cacheMaxSz, "max-size", "", "evict least recently used entries above this size (e.g. 500MB, 2GB)")
+	cacheGCCmd.Flags().DurationVar(&cacheMaxAge, "max-age", 0, "evict entries unused for longer than this (e.g. 720h)")
+	cacheCmd.AddCommand(cacheStatusCmd, cacheClearCmd, cacheGCCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
+
+// openRemoteCache resolves a --remote-cache URL: s3://bucket/prefix or
+// gs://bucket/prefix, whose client takes opts, or redis://host:port/db
+// (rediss:// for TLS).
+func openRemoteCache(arg string, opts bucketOptions) (cache.Remote, error) {
+	scheme, rest, _ := strings.Cut(arg, "://")
+	switch scheme {
+	case "s3", "gs":
+		client, prefix, err := bucketClient(arg, scheme, rest, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &cache.S3Remote{Client: client, Prefix: prefix, URL: scheme + "://" + client.Bucket + "/" + prefix}, nil
+	case "redis", "rediss":
+		return cache.ParseRedisURL(arg)
+	default:
+		return nil, withExitCode(ExitUsage, fmt.Errorf("unsupported remote cache %q: want s3://bucket/prefix, gs://bucket/prefix or redis://host:port", arg))
+	}
+}
+
+// openCache opens dir, or the default per-user cache when dir is empty.
+func openCache(dir string) (*cache.Cache, error) {
+	if dir == "" {
+		var err error
+		if dir, err = cache.DefaultDir(); err != nil {
+			return nil, fmt.Errorf("locate cache dir (set --cache-dir): %w", err)
+		}
+	}
+	return cache.Open(dir)
+}
+
+func runCacheStatus(_ *cobra.Command, _ []string) error {
+	c, err := openCache(cacheDir)
+	if err != nil {
+		return err
+	}
+	entries, err := c.Entries()
+	if err != nil {
+		return err
+	}
+	stats, err := c.ReadStats()
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	for _, e := range entries {
+		size += e.Size
+	}
+
+	fmt.Println()
+	fmt.Printf("  Cache dir:   %s\n", c.Dir())
+	fmt.Printf("  Entries:     %d\n", len(entries))
+	fmt.Printf("  Size:        %s\n", formatBytes(size))
+	if len(entries) > 0 {
+		fmt.Printf("  Last used:   %s (oldest %s)\n",
+			entries[len(entries)-1].ModTime.Format(time.RFC3339), entries[0].ModTime.Format(time.RFC3339))
+	}
+	fmt.Println()
+	fmt.Printf("  Builds:      %d\n", stats.Builds)
+	if stats.LastBuild != "" {
+		fmt.Printf("  Last build:  %s\n", stats.LastBuild)
+	}
+	fmt.Printf("  Hits:        %d\n", stats.Hits)
+	if stats.RemoteHits > 0 {
+		fmt.Printf("  Remote hits: %d\n", stats.RemoteHits)
+	}
+	fmt.Printf("  Misses:      %d\n", stats.Misses)
+	fmt.Printf("  Hit rate:    %.1f%%\n", stats.HitRate()*100)
+	fmt.Println()
+	return nil
+}
+
+func runCacheClear(_ *cobra.Command, _ []string) error {
+	c, err := openCache(cacheDir)
+	if err != nil {
+		return err
+	}
+	entries, err := c.Entries()
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, e := range entries {
+		size += e.Size
+	}
+	if err := c.Clear(); err != nil {
+		return err
+	}
+	fmt.Printf("  ✓ Removed %d entries (%s) from %s\n", len(entries), formatBytes(size), c.Dir())
+	return nil
+}
+
+func runCacheGC(_ *cobra.Command, _ []string) error {
+	var maxSize int64
+	if cacheMaxSz != "" {
+		var err error
+		if maxSize, err = parseByteSize(cacheMaxSz); err != nil {
+			return fmt.Errorf("invalid --max-size: %w", err)
+		}
+	}
+	if maxSize <= 0 && cacheMaxAge <= 0 {
+		return fmt.Errorf("set --max-size and/or --max-age")
+	}
+
+	c, err := openCache(cacheDir)
+	if err != nil {
+		return err
+	}
+	r, err := c.GC(maxSize, cacheMaxAge)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("  ✓ Evicted %d entries (%s); %d entries (%s) kept\n",
+		r.Removed, formatBytes(r.RemovedBytes), r.Kept, formatBytes(r.KeptBytes))
+	return nil
+}
+
+// parseByteSize parses sizes like "2GB", "500 MB", "64k" or "1048576".
+// Units are binary (1 KB = 1024 bytes), matching formatBytes.
+func parseByteSize(s string) (int64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+	} {
+		if strings.HasSuffix(t, u.suffix) {
+			t, mult = strings.TrimSpace(strings.TrimSuffix(t, u.suffix)), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(t, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a size", s)
+	}
+	return int64(n * float64(mult)), nil
+}
@@ -0,0 +1,334 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AnyUserName/tgimg-cli/internal/colorspace"
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/AnyUserName/tgimg-cli/internal/metrics"
+	"github.com/AnyUserName/tgimg-cli/internal/pipeline"
+	"github.com/AnyUserName/tgimg-cli/internal/tempfile"
+	"github.com/spf13/cobra"
+)
+
+var (
+	compareInput       string
+	compareAll         bool
+	compareButteraugli bool
+)
+
+var compareCmd = &cobra.Command{
+	Use:   "compare [out_dir_or_manifest]",
+	Short: "Measure SSIM/PSNR of every variant against its original",
+	Long: `Decodes each variant, resizes the original source to the same size with
+the filter the build uses, and reports PSNR (dB, RGB) and SSIM (luma),
+so only encoding loss is measured. Transparent pixels are compared over
+a white background. Results are summarized per format; --all lists
+every variant.
+
+--butteraugli also runs the external "butteraugli" tool (lower is better,
+< 1.0 is visually lossless). AVIF variants need "avifdec" on PATH.`,
+	Args: cobra.RangeArgs(0, 1),
+	RunE: runCompare,
+}
+
+func init() {
+	compareCmd.Flags().StringVarP(&compareInput, "input", "i", "", "source image directory the manifest was built from")
+	compareCmd.Flags().BoolVar(&compareAll, "all", false, "print a row for every variant")
+	compareCmd.Flags().BoolVar(&compareButteraugli, "butteraugli", false, "also compute butteraugli distance (needs butteraugli on PATH)")
+	rootCmd.AddCommand(compareCmd)
+}
+
+// psnrCap bounds PSNR for identical images so averages stay finite.
+const psnrCap = 100.0
+
+// variantScore is the quality of one variant relative to its source.
+type variantScore struct {
+	key         string
+	variant     manifest.Variant
+	psnr        float64
+	ssim        float64
+	butteraugli float64 // NaN when not computed
+}
+
+func runCompare(_ *cobra.Command, args []string) error {
+	path, err := outputDirArg(args)
+	if err != nil {
+		return err
+	}
+	manifestPath, err := resolveManifestPath(path)
+	if err != nil {
+		return err
+	}
+	m, err := loadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	inputDir := compareInput
+	if inputDir == "" {
+		return fmt.Errorf("missing --input (the source directory used for the build)")
+	}
+
+	var butteraugliPath string
+	if compareButteraugli {
+		if butteraugliPath, err = exec.LookPath("butteraugli"); err != nil {
+			return fmt.Errorf("butteraugli not found in PATH")
+		}
+	}
+
+	baseDir := filepath.Dir(manifestPath)
+	sources, err := pipeline.Dir(inputDir).Without(baseDir).Scan(nil)
+	if err != nil {
+		return fmt.Errorf("scan input: %w", err)
+	}
+	pipeline.NormalizeKeys(sources, manifestUnicodeKeys(m))
+	bySource := make(map[string]pipeline.Source, len(sources))
+	for _, s := range sources {
+		bySource[s.Key+"@"+s.Theme] = s
+	}
+
+	keys := make([]string, 0, len(m.Assets))
+	for k := range m.Assets {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var scores []variantScore
+	var skipped []string
+	score := func(label string, src pipeline.Source, variants []manifest.Variant) {
+		orig, err := decodeSourceFile(src.AbsPath)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", label, err))
+			return
+		}
+		resized := map[string]image.Image{}
+		for _, v := range variants {
+			if v.Original || v.Remote() {
+				continue
+			}
+			got, err := decodeImageFile(filepath.Join(baseDir, v.Path))
+			if err != nil {
+				skipped = append(skipped, fmt.Sprintf("%s: %s: %v", label, v.Path, err))
+				continue
+			}
+			dims := fmt.Sprintf("%dx%d", v.Width, v.Height)
+			var crop image.Rectangle
+			var margin float64
+			if v.Crop != nil {
+				crop, margin = v.Crop.Rect(), v.Crop.Margin
+				dims += fmt.Sprintf("@%s+%g", crop, margin)
+			}
+			ref, ok := resized[dims]
+			if !ok {
+				ref = pipeline.RenderVariant(orig, crop, v.Width, v.Height, margin)
+				resized[dims] = ref
+			}
+			psnr, ssim, err := metrics.Compare(ref, got)
+			if err != nil {
+				skipped = append(skipped, fmt.Sprintf("%s: %s: %v", label, v.Path, err))
+				continue
+			}
+			s := variantScore{key: label, variant: v, psnr: math.Min(psnr, psnrCap), ssim: ssim, butteraugli: math.NaN()}
+			if butteraugliPath != "" {
+				if s.butteraugli, err = runButteraugli(butteraugliPath, ref, got); err != nil {
+					skipped = append(skipped, fmt.Sprintf("%s: %s: butteraugli: %v", label, v.Path, err))
+				}
+			}
+			logging.Debugf("%s %s: ssim=%.4f psnr=%.2f", label, v.Path, s.ssim, s.psnr)
+			scores = append(scores, s)
+		}
+	}
+	for _, k := range keys {
+		a := m.Assets[k]
+		if src, ok := bySource[k+"@"]; ok {
+			score(k, src, a.Variants)
+		} else if src, ok := bySource[k+"@light"]; ok && a.Themes["light"].Original.Width == 0 {
+			// A light rendition promoted to the base asset.
+			score(k, src, a.Variants)
+		} else {
+			skipped = append(skipped, fmt.Sprintf("%s: source not found in %s", k, inputDir))
+		}
+		for _, theme := range sortedThemes(a) {
+			if src, ok := bySource[k+"@"+theme]; ok {
+				score(k+"@"+theme, src, a.Themes[theme].Variants)
+			}
+		}
+	}
+
+	printCompare(scores, compareButteraugli)
+	if len(skipped) > 0 {
+		fmt.Printf("  Skipped (%d):\n", len(skipped))
+		for _, s := range skipped {
+			fmt.Printf("    • %s\n", s)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func sortedThemes(a manifest.Asset) []string {
+	themes := make([]string, 0, len(a.Themes))
+	for t := range a.Themes {
+		themes = append(themes, t)
+	}
+	sort.Strings(themes)
+	return themes
+}
+
+func printCompare(scores []variantScore, withButteraugli bool) {
+	fmt.Println()
+	if compareAll {
+		fmt.Printf("    %-28s %-5s %6s %8s %8s", "ASSET", "FMT", "WIDTH", "SSIM", "PSNR")
+		if withButteraugli {
+			fmt.Printf(" %8s", "BUTTER")
+		}
+		fmt.Printf(" %9s\n", "SIZE")
+		for _, s := range scores {
+			fmt.Printf("    %-28s %-5s %6d %8.4f %8.2f", s.key, s.variant.Format, s.variant.Width, s.ssim, s.psnr)
+			if withButteraugli {
+				fmt.Printf(" %8.3f", s.butteraugli)
+			}
+			fmt.Printf(" %9s\n", formatBytes(s.variant.Size))
+		}
+		fmt.Println()
+	}
+
+	type agg struct {
+		n                         int
+		ssimSum, ssimMin, psnrSum float64
+		butterSum, butterMax      float64
+		butterN                   int
+		bytes                     int64
+	}
+	byFormat := map[string]*agg{}
+	for _, s := range scores {
+		a := byFormat[s.variant.Format]
+		if a == nil {
+			a = &agg{ssimMin: 1}
+			byFormat[s.variant.Format] = a
+		}
+		a.n++
+		a.ssimSum += s.ssim
+		a.ssimMin = math.Min(a.ssimMin, s.ssim)
+		a.psnrSum += s.psnr
+		a.bytes += s.variant.Size
+		if !math.IsNaN(s.butteraugli) {
+			a.butterN++
+			a.butterSum += s.butteraugli
+			a.butterMax = math.Max(a.butterMax, s.butteraugli)
+		}
+	}
+	formats := make([]string, 0, len(byFormat))
+	for f := range byFormat {
+		formats = append(formats, f)
+	}
+	sort.Strings(formats)
+
+	fmt.Printf("  Quality vs. original (%d variants):\n", len(scores))
+	fmt.Printf("    %-6s %8s %10s %9s %10s", "FORMAT", "VARIANTS", "SSIM mean", "SSIM min", "PSNR mean")
+	if withButteraugli {
+		fmt.Printf(" %11s %10s", "BUTTER mean", "BUTTER max")
+	}
+	fmt.Printf(" %10s\n", "TOTAL")
+	for _, f := range formats {
+		a := byFormat[f]
+		fmt.Printf("    %-6s %8d %10.4f %9.4f %10.2f", f, a.n, a.ssimSum/float64(a.n), a.ssimMin, a.psnrSum/float64(a.n))
+		if withButteraugli && a.butterN > 0 {
+			fmt.Printf(" %11.3f %10.3f", a.butterSum/float64(a.butterN), a.butterMax)
+		} else if withButteraugli {
+			fmt.Printf(" %11s %10s", "—", "—")
+		}
+		fmt.Printf(" %10s\n", formatBytes(a.bytes))
+	}
+	fmt.Println()
+}
+
+// decodeSourceFile decodes a source image and, as the build does,
+// converts it to sRGB if it is tagged with a wide-gamut color space.
+func decodeSourceFile(path string) (image.Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if t, _ := colorspace.FromHeader(data); t != nil {
+		img = t.Convert(img)
+	}
+	return img, nil
+}
+
+// decodeImageFile decodes an image file. AVIF goes through avifdec,
+// since there is no pure-Go AVIF decoder.
+func decodeImageFile(path string) (image.Image, error) {
+	if strings.EqualFold(filepath.Ext(path), ".avif") {
+		return decodeAVIF(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+func decodeAVIF(path string) (image.Image, error) {
+	avifdec, err := exec.LookPath("avifdec")
+	if err != nil {
+		return nil, fmt.Errorf("avifdec not found in PATH")
+	}
+	tmp, err := tempfile.Create("tgimg_compare_*.png")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if out, err := exec.Command(avifdec, path, tmp.Name()).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("avifdec: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return decodeImageFile(tmp.Name())
+}
+
+// runButteraugli writes both images as PNG and returns the distance the
+// butteraugli tool prints on its first output line.
+func runButteraugli(bin string, ref, got image.Image) (float64, error) {
+	var paths [2]string
+	for i, img := range []image.Image{ref, got} {
+		f, err := tempfile.Create("tgimg_butteraugli_*.png")
+		if err != nil {
+			return 0, err
+		}
+		paths[i] = f.Name()
+		defer os.Remove(f.Name())
+		err = png.Encode(f, img)
+		f.Close()
+		if err != nil {
+			return 0, err
+		}
+	}
+	out, err := exec.Command(bin, paths[0], paths[1]).Output()
+	if err != nil {
+		return 0, err
+	}
+	line, _, _ := bufio.NewReader(bytes.NewReader(out)).ReadLine()
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected output %q", out)
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/AnyUserName/tgimg-cli/internal/encoder"
+	"github.com/AnyUserName/tgimg-cli/internal/imgcdn"
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+// Shell completion. Cobra's built-in "completion" command generates the
+// bash/zsh/fish/powershell scripts; the functions here make flag values
+// and keys complete from the live profile registry and manifest.
+//
+// Completion runs without PersistentPreRunE, so helpers that need the
+// project config load it themselves via loadCompletionConfig.
+
+// allFormats lists every output format in priority order.
+var allFormats = []string{"avif", "webp", "jpeg", "png"}
+
+// loadCompletionConfig loads the project config (registering its
+// profiles) at most once, ignoring errors: completion must never fail
+// loudly.
+func loadCompletionConfig() {
+	if projectConfig == nil {
+		settingsLayers()
+	}
+}
+
+// completeProfiles completes profile names, built-in and config-defined.
+func completeProfiles(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	loadCompletionConfig()
+	return profile.Names(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeFormats completes a comma-separated format list, offering only
+// formats not already typed.
+func completeFormats(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	done := strings.Split(toComplete, ",")
+	prefix := strings.Join(done[:len(done)-1], ",")
+	if prefix != "" {
+		prefix += ","
+	}
+	var out []string
+	for _, f := range allFormats {
+		if !containsString(done, f) {
+			out = append(out, prefix+f)
+		}
+	}
+	return out, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// completeValues completes one of a fixed set of values.
+func completeValues(values ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return values, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// registerCompletions attaches completion functions to the named flags
+// of cmd that exist. Unknown names are skipped so commands can share one
+// table.
+func registerCompletions(cmd *cobra.Command, funcs map[string]func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective)) {
+	for name, fn := range funcs {
+		if cmd.Flags().Lookup(name) == nil {
+			continue
+		}
+		if err := cmd.RegisterFlagCompletionFunc(name, fn); err != nil {
+			logging.Debugf("completion for --%s: %v", name, err)
+		}
+	}
+}
+
+// buildFlagCompletions covers the flags shared by build and serve.
+var buildFlagCompletions = map[string]func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective){
+	"profile":      completeProfiles,
+	"formats":      completeFormats,
+	"only-formats": completeFormats,
+	"skip-formats": completeFormats,
+	"descriptor":   completeValues(profile.DescriptorWidth, profile.DescriptorDensity),
+	"effort":       completeValues(string(encoder.EffortFast), string(encoder.EffortBalanced), string(encoder.EffortMax)),
+	"cdn":          completeValues(imgcdn.Providers...),
+	"emit-headers": completeValues(headerTargetNames...),
+	"unicode-keys": completeValues("nfc", "none"),
+}
+
+// completeManifestKeys completes asset keys and aliases from the manifest
+// in dir, or, when dir is empty, from the config's output directory,
+// ./tgimg_out or the current directory.
+func completeManifestKeys(dir, toComplete string) []string {
+	var candidates []string
+	if dir != "" {
+		candidates = []string{dir}
+	} else {
+		loadCompletionConfig()
+		if projectConfig != nil && projectConfig.Output != "" {
+			candidates = append(candidates, projectConfig.Resolve(projectConfig.Output))
+		}
+		candidates = append(candidates, "tgimg_out", ".")
+	}
+
+	for _, c := range candidates {
+		path := c
+		if info, err := os.Stat(c); err == nil && info.IsDir() {
+			path = filepath.Join(c, manifestFileName)
+		}
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		m, err := loadManifest(path)
+		if err != nil {
+			return nil
+		}
+		var keys []string
+		for k := range m.Assets {
+			if strings.HasPrefix(k, toComplete) {
+				keys = append(keys, k)
+			}
+		}
+		for k := range m.Aliases {
+			if strings.HasPrefix(k, toComplete) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AnyUserName/tgimg-cli/internal/config"
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+	"github.com/AnyUserName/tgimg-cli/internal/pipeline"
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	configPath    string
+	projectConfig *config.Config // nil when no config file is in use
+)
+
+// settingsLayer supplies flag values by flag name.
+type settingsLayer struct {
+	name   string
+	lookup func(flag string) (string, bool)
+	source func(flag string) string // names the setting in errors
+}
+
+// resolveSettings fills every flag of cmd that was not set on the command
+// line from the settings layers. This is the single place where precedence
+// is decided:
+//
+//	command-line flags > TGIMG_* environment > config file > profile defaults
+//
+// Profile defaults are the lowest layer: they apply later, in
+// resolveProfile, to whatever is still unset.
+func resolveSettings(cmd *cobra.Command) error {
+	layers, err := settingsLayers()
+	if err != nil {
+		return err
+	}
+
+	var setErr error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if setErr != nil || f.Changed {
+			return
+		}
+		for _, l := range layers {
+			v, ok := l.lookup(f.Name)
+			if !ok {
+				continue
+			}
+			if err := cmd.Flags().Set(f.Name, v); err != nil {
+				setErr = fmt.Errorf("%s: %w", l.source(f.Name), err)
+			}
+			logging.Debugf("%-8s --%s=%s", l.name+":", f.Name, v)
+			return
+		}
+	})
+	return setErr
+}
+
+// envPrefix prefixes the environment variable bound to every flag:
+// --workers is TGIMG_WORKERS, --no-regress-size is TGIMG_NO_REGRESS_SIZE.
+const envPrefix = "TGIMG_"
+
+// envName returns the environment variable bound to a flag.
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// settingsLayers returns the layers below command-line flags, highest
+// precedence first.
+func settingsLayers() ([]settingsLayer, error) {
+	layers := []settingsLayer{{
+		name: "env",
+		lookup: func(flag string) (string, bool) {
+			if flag == "help" {
+				return "", false
+			}
+			return os.LookupEnv(envName(flag))
+		},
+		source: envName,
+	}}
+
+	path := configPath
+	if path == "" {
+		path = os.Getenv(envName("config"))
+	}
+	if path == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		path = config.Find(wd)
+	}
+	if path != "" {
+		c, err := config.Load(path)
+		if err != nil {
+			return nil, fmt.Errorf("load config: %w", err)
+		}
+		projectConfig = c
+		logging.Debugf("config:  %s", path)
+		if err := registerProfiles(c); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		values := configValues(c)
+		layers = append(layers, settingsLayer{
+			name: filepath.Base(path),
+			lookup: func(flag string) (string, bool) {
+				v, ok := values[flag]
+				return v, ok && v != ""
+			},
+			source: func(flag string) string {
+				return fmt.Sprintf("%s (--%s)", path, flag)
+			},
+		})
+	}
+	return layers, nil
+}
+
+// registerProfiles makes the config's profiles available by name.
+// Profiles are registered after the profiles they extend, so each one
+// starts from its base's final values.
+func registerProfiles(c *config.Config) error {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	done := map[string]bool{}
+	var register func(name string) error
+	register = func(name string) error {
+		if done[name] {
+			return nil
+		}
+		done[name] = true // config.Load rejects extends cycles
+		p := c.Profiles[name]
+		if _, ok := c.Profiles[p.Extends]; ok && p.Extends != name {
+			if err := register(p.Extends); err != nil {
+				return err
+			}
+		}
+		resolved, err := configProfile(name, p)
+		if err != nil {
+			return fmt.Errorf("profile %q: %w", name, err)
+		}
+		if err := profile.Register(resolved); err != nil {
+			return err
+		}
+		if p.Extends != "" {
+			logging.Debugf("profile: %s (from config, extends %s)", name, p.Extends)
+		} else {
+			logging.Debugf("profile: %s (from config)", name)
+		}
+		return nil
+	}
+	for _, name := range names {
+		if err := register(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configProfile turns a config profile into a registry profile, merging
+// it onto the profile it extends.
+func configProfile(name string, p config.Profile) (profile.Profile, error) {
+	o, err := p.Override()
+	if err != nil {
+		return profile.Profile{}, err
+	}
+	if p.Extends != "" {
+		resolved, err := o.Apply(profile.Profile{})
+		resolved.Name = name
+		return resolved, err
+	}
+	return profile.Profile{
+		Name:        name,
+		Widths:      p.EffectiveWidths(),
+		Formats:     o.Formats,
+		Quality:     o.Quality,
+		DPRs:        o.DPRs,
+		Descriptor:  o.Descriptor,
+		MinWidth:    o.MinWidth,
+		Heights:     o.Heights,
+		Crops:       o.Crops,
+		Gravity:     o.Gravity,
+		Margin:      o.Margin,
+		Breakpoints: o.Breakpoints,
+
+		FormatMinWidths: o.FormatMinWidths,
+		Effort:          o.Effort,
+	}, nil
+}
+
+// configOverrides returns the config's per-glob profile overrides, in
+// pattern order.
+func configOverrides() []pipeline.ProfileOverride {
+	if projectConfig == nil {
+		return nil
+	}
+	patterns := make([]string, 0, len(projectConfig.Overrides))
+	for pattern := range projectConfig.Overrides {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	var out []pipeline.ProfileOverride
+	for _, pattern := range patterns {
+		o, _ := projectConfig.Overrides[pattern].ProfileOverride() // checked by config.Load
+		out = append(out, pipeline.ProfileOverride{Pattern: pattern, Override: o})
+	}
+	return out
+}
+
+// configValues maps config fields to the flags they default. Commands
+// without a matching flag ignore the field, so one config file serves
+// every command.
+func configValues(c *config.Config) map[string]string {
+	values := map[string]string{
+		"input":     c.Resolve(c.Input),
+		"out":       c.Resolve(c.Output),
+		"manifest":  c.Resolve(c.Output),
+		"profile":   c.Profile,
+		"base-path": c.BasePath,
+	}
+	if c.Quality > 0 {
+		values["quality"] = strconv.Itoa(c.Quality)
+	}
+	if c.Effort != "" {
+		values["effort"] = c.Effort
+	}
+	if c.UnicodeKeys != "" {
+		values["unicode-keys"] = c.UnicodeKeys
+	}
+	if c.TempDir != "" {
+		values["temp-dir"] = c.Resolve(c.TempDir)
+	}
+	if c.EncoderConcurrency > 0 {
+		values["encoder-concurrency"] = strconv.Itoa(c.EncoderConcurrency)
+	}
+	if len(c.Widths) > 0 {
+		values["widths"] = joinInts(c.Widths)
+	}
+	if len(c.DPRs) > 0 {
+		values["dprs"] = joinFloats(c.DPRs)
+	}
+	if len(c.Formats) > 0 {
+		values["formats"] = strings.Join(c.Formats, ",")
+	}
+	if len(c.Ignore) > 0 {
+		values["ignore"] = strings.Join(c.Ignore, ",")
+	}
+	return values
+}
+
+// inputDirArg returns the input directory from args, falling back to the
+// config file's "input".
+func inputDirArg(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	if projectConfig != nil && projectConfig.Input != "" {
+		return projectConfig.Resolve(projectConfig.Input), nil
+	}
+	return "", fmt.Errorf("missing <input_dir> (pass it or set \"input\" in %s)", config.FileName)
+}
+
+// outputDirArg returns the output directory or manifest path from args,
+// falling back to the config file's "output".
+func outputDirArg(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	if projectConfig != nil && projectConfig.Output != "" {
+		return projectConfig.Resolve(projectConfig.Output), nil
+	}
+	return "", fmt.Errorf("missing output directory or manifest (pass it or set \"output\" in %s)", config.FileName)
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+)
+
+// Deep validation levels for `validate --deep`.
+const (
+	deepHeader = "header" // parse the image header: format and dimensions
+	deepFull   = "full"   // decode every pixel
+)
+
+// deepValidate decodes every variant under baseDir and reports files that
+// exist but are not valid images of the recorded format and size. It
+// returns the errors and how many AVIF files could only be header-checked
+// because avifdec is not installed.
+func deepValidate(m *manifest.Manifest, baseDir, level string) (errs []string, headerOnly int) {
+	targets := verifyTargets(m)
+	problems := make([]string, len(targets))
+	partial := make([]bool, len(targets))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, runtime.NumCPU())
+	for i, t := range targets {
+		wg.Add(1)
+		go func(idx int, t verifyTarget) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			problems[idx], partial[idx] = decodeCheck(filepath.Join(baseDir, t.v.Path), t.v, level)
+		}(i, t)
+	}
+	wg.Wait()
+
+	for i, p := range problems {
+		if p != "" {
+			errs = append(errs, fmt.Sprintf("%s (%s): %s", targets[i].v.Path, targets[i].label, p))
+		}
+		if partial[i] {
+			headerOnly++
+		}
+	}
+	return errs, headerOnly
+}
+
+// decodeCheck decodes the file at path and returns a description of how
+// it disagrees with v, or "" if it is a valid image of v's format and
+// dimensions. headerOnly is set when a full decode was asked for but only
+// the header could be checked.
+func decodeCheck(path string, v manifest.Variant, level string) (problem string, headerOnly bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false // missing files are reported by the regular checks
+	}
+
+	var format string
+	var w, h int
+	if isAVIF(data) {
+		format = "avif"
+		if w, h, err = avifDimensions(data); err != nil {
+			return "corrupt: " + err.Error(), false
+		}
+		if level == deepFull {
+			if _, lookErr := exec.LookPath("avifdec"); lookErr != nil {
+				headerOnly = true
+			} else if _, err := decodeAVIF(path); err != nil {
+				return "corrupt: " + err.Error(), false
+			}
+		}
+	} else {
+		cfg, f, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return "corrupt: " + err.Error(), false
+		}
+		format, w, h = f, cfg.Width, cfg.Height
+		if level == deepFull {
+			if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+				return "corrupt: " + err.Error(), false
+			}
+		}
+	}
+
+	if !v.Original && format != v.Format {
+		return fmt.Sprintf("decodes as %s, manifest says %s", format, v.Format), headerOnly
+	}
+	// Originals may carry an EXIF rotation, so either orientation matches.
+	sameSize := w == v.Width && h == v.Height || v.Original && w == v.Height && h == v.Width
+	if !sameSize {
+		return fmt.Sprintf("decodes as %dx%d, manifest says %dx%d", w, h, v.Width, v.Height), headerOnly
+	}
+	return "", headerOnly
+}
+
+// isAVIF reports whether data starts with an ISO-BMFF ftyp box of an AVIF
+// brand. Go's image package has no AVIF decoder.
+func isAVIF(data []byte) bool {
+	if len(data) < 12 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+	brand := string(data[8:12])
+	return brand == "avif" || brand == "avis"
+}
+
+// avifDimensions returns the size from the first image spatial extents
+// ("ispe") property, which is the primary image's in avifenc output.
+func avifDimensions(data []byte) (int, int, error) {
+	i := bytes.Index(data, []byte("ispe"))
+	// ispe payload: version/flags (4), width (4), height (4).
+	if i < 4 || i+16 > len(data) {
+		return 0, 0, fmt.Errorf("avif: no image size (ispe) box")
+	}
+	w := binary.BigEndian.Uint32(data[i+8:])
+	h := binary.BigEndian.Uint32(data[i+12:])
+	if w == 0 || h == 0 {
+		return 0, 0, fmt.Errorf("avif: invalid dimensions %dx%d", w, h)
+	}
+	return int(w), int(h), nil
+}
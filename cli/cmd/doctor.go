@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/AnyUserName/tgimg-cli/internal/tools"
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check for cwebp and avifenc",
+	Long: `Reports where the external encoders tgimg uses for WebP (cwebp) and AVIF
+(avifenc) were found: on PATH, in the tools directory, or not at all.
+Without them, builds fall back to JPEG and PNG only.
+
+The tools directory ($TGIMG_TOOLS_DIR, default tgimg-tools in the user
+cache directory) is searched after PATH by every command, for machines
+where the encoders cannot be installed system-wide: copy the binaries
+there. Missing tools are reported with package manager hints.`,
+	Args: cobra.NoArgs,
+	RunE: runDoctor,
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// toolHints are the package manager commands printed for missing tools.
+var toolHints = map[string]string{
+	"cwebp":   "brew install webp / apt install webp",
+	"avifenc": "brew install libavif / apt install libavif-bin",
+}
+
+func runDoctor(_ *cobra.Command, _ []string) error {
+	dir, err := tools.Dir()
+	if err != nil {
+		return err
+	}
+
+	var missing int
+	for _, tool := range tools.Names {
+		if p, err := exec.LookPath(tool); err == nil {
+			fmt.Printf("  ✓ %-8s %s\n", tool, p)
+			continue
+		}
+		if p, ok := tools.Installed(tool); ok {
+			fmt.Printf("  ✓ %-8s %s (tools directory)\n", tool, p)
+			continue
+		}
+		fmt.Printf("  ✗ %-8s not found; install with: %s, or copy it into %s\n", tool, toolHints[tool], dir)
+		missing++
+	}
+	if missing > 0 {
+		return fmt.Errorf("%d encoders missing; WebP/AVIF variants will be skipped", missing)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/AnyUserName/tgimg-cli/internal/pipeline"
+)
+
+// Exit codes. CI pipelines can branch on these instead of parsing stderr;
+// they are part of the CLI's public interface, so never renumber them.
+const (
+	ExitOK         = 0 // success
+	ExitError      = 1 // any other failure (I/O, encoder, network, ...)
+	ExitUsage      = 2 // bad flags, arguments, settings or config file
+	ExitNoInputs   = 3 // the input directory has no images
+	ExitPartial    = 4 // build finished, but some images failed
+	ExitAllFailed  = 5 // every image failed; no manifest written
+	ExitValidation = 6 // validate or verify found problems
+)
+
+// exitError attaches an exit code to an error.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// withExitCode wraps err so that the process exits with code. A nil err
+// stays nil.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// ExitCode maps an error returned by Execute to the process exit code.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	switch {
+	case errors.Is(err, pipeline.ErrNoImages):
+		return ExitNoInputs
+	case errors.Is(err, pipeline.ErrAllFailed):
+		return ExitAllFailed
+	}
+	return ExitError
+}
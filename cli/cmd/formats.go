@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/AnyUserName/tgimg-cli/internal/pipeline"
+)
+
+// filterFormats applies --only-formats / --skip-formats to a profile's
+// formats. It returns the formats to encode and the profile formats left
+// out; naming a format the profile does not produce is an error.
+func filterFormats(formats, only, skip []string) (kept, excluded []string, err error) {
+	if len(only) > 0 && len(skip) > 0 {
+		return nil, nil, fmt.Errorf("--only-formats and --skip-formats are mutually exclusive")
+	}
+	for _, f := range append(append([]string(nil), only...), skip...) {
+		if !containsString(formats, f) {
+			return nil, nil, fmt.Errorf("format %q is not produced by this profile (%s)", f, strings.Join(formats, ", "))
+		}
+	}
+	for _, f := range formats {
+		drop := len(only) > 0 && !containsString(only, f) || containsString(skip, f)
+		if drop {
+			excluded = append(excluded, f)
+		} else {
+			kept = append(kept, f)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, nil, fmt.Errorf("no formats left to build")
+	}
+	return kept, excluded, nil
+}
+
+// filterOverrideFormats applies --only-formats / --skip-formats to the
+// formats set by profile overrides and returns the formats it dropped.
+// Unlike filterFormats, naming a format an override lacks is not an error.
+func filterOverrideFormats(overrides []pipeline.ProfileOverride, only, skip []string) (excluded []string, err error) {
+	if len(only) == 0 && len(skip) == 0 {
+		return nil, nil
+	}
+	for i, o := range overrides {
+		if o.Formats == nil {
+			continue
+		}
+		var kept []string
+		for _, f := range o.Formats {
+			if len(only) > 0 && !containsString(only, f) || containsString(skip, f) {
+				if !containsString(excluded, f) {
+					excluded = append(excluded, f)
+				}
+			} else {
+				kept = append(kept, f)
+			}
+		}
+		if len(kept) == 0 {
+			return nil, fmt.Errorf("override %q: no formats left to build", o.Pattern)
+		}
+		overrides[i].Formats = kept
+	}
+	return excluded, nil
+}
+
+// carryOverFormats copies variants of the excluded formats from the
+// previous manifest in outDir into m, so a partial-format build still
+// writes a complete manifest. Variants are carried only when the asset's
+// source is unchanged (same size and thumbhash) and the file still exists.
+// It returns the number of variants carried over.
+func carryOverFormats(m *manifest.Manifest, outDir string, excluded, order []string) (int, error) {
+	prev, err := loadManifest(filepath.Join(outDir, manifestFileName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("previous manifest: %w", err)
+	}
+
+	carried := 0
+	carry := func(dst []manifest.Variant, src []manifest.Variant) []manifest.Variant {
+		for _, v := range src {
+			if v.Original || !containsString(excluded, v.Format) {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(outDir, v.Path)); err != nil {
+				continue
+			}
+			dst = append(dst, v)
+			carried++
+		}
+		sortVariants(dst, order)
+		return dst
+	}
+	sameSource := func(a, b manifest.OriginalInfo, ha, hb string) bool {
+		return a.Size == b.Size && a.Width == b.Width && a.Height == b.Height && ha == hb
+	}
+
+	for key, a := range m.Assets {
+		old, ok := prev.Assets[key]
+		if !ok {
+			continue
+		}
+		if sameSource(a.Original, old.Original, a.ThumbHash, old.ThumbHash) {
+			a.Variants = carry(a.Variants, old.Variants)
+		}
+		for theme, t := range a.Themes {
+			ot, ok := old.Themes[theme]
+			if ok && sameSource(t.Original, ot.Original, t.ThumbHash, ot.ThumbHash) {
+				t.Variants = carry(t.Variants, ot.Variants)
+				a.Themes[theme] = t
+			}
+		}
+		m.Assets[key] = a
+	}
+	return carried, nil
+}
+
+// sortVariants orders variants the way the pipeline emits them: by width,
+// then by format priority, with copied originals last.
+func sortVariants(vs []manifest.Variant, order []string) {
+	rank := func(f string) int {
+		for i, o := range order {
+			if o == f {
+				return i
+			}
+		}
+		return len(order)
+	}
+	sort.SliceStable(vs, func(i, j int) bool {
+		a, b := vs[i], vs[j]
+		if a.Original != b.Original {
+			return !a.Original
+		}
+		if a.Width != b.Width {
+			return a.Width < b.Width
+		}
+		return rank(a.Format) < rank(b.Format)
+	})
+}
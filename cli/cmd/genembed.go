@@ -0,0 +1,338 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	embedPackage string
+	embedFile    string
+)
+
+var genEmbedCmd = &cobra.Command{
+	Use:   "gen-embed [out_dir]",
+	Short: "Generate a Go package embedding the variants and manifest",
+	Long: `Writes a Go source file into the output directory that turns it into a
+package: //go:embed directives for the manifest and every variant, plus
+typed accessors, so Go servers can serve the assets from their binary.
+
+	tgimg build ./images --out ./internal/webassets
+	tgimg gen-embed ./internal/webassets --package webassets
+
+The generated file declares Asset and Variant types, one exported
+variable per asset key (promo/hero-banner becomes PromoHeroBanner),
+Lookup for keys and aliases, and Handler, an http.Handler serving the
+files at their manifest paths. Regenerate it after every build.
+
+Variants rendered by an image CDN (--cdn) have no file and are skipped.`,
+	Args: cobra.RangeArgs(0, 1),
+	RunE: runGenEmbed,
+}
+
+func init() {
+	genEmbedCmd.Flags().StringVar(&embedPackage, "package", "webassets", "Go package name")
+	genEmbedCmd.Flags().StringVar(&embedFile, "file", "tgimg_embed.go", "name of the generated file in the output directory")
+	rootCmd.AddCommand(genEmbedCmd)
+}
+
+func runGenEmbed(_ *cobra.Command, args []string) error {
+	dir, err := outputDirArg(args)
+	if err != nil {
+		return err
+	}
+	manifestPath, err := resolveManifestPath(dir)
+	if err != nil {
+		return err
+	}
+	m, err := loadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	if !token.IsIdentifier(embedPackage) || embedPackage == "_" {
+		return withExitCode(ExitUsage, fmt.Errorf("--package %q is not a valid Go package name", embedPackage))
+	}
+	if filepath.Base(embedFile) != embedFile || !strings.HasSuffix(embedFile, ".go") {
+		return withExitCode(ExitUsage, fmt.Errorf("--file %q must be a .go file name without directories", embedFile))
+	}
+
+	src, err := genEmbed(m, filepath.Base(manifestPath), embedPackage)
+	if err != nil {
+		return err
+	}
+	out := filepath.Join(filepath.Dir(manifestPath), embedFile)
+	if err := os.WriteFile(out, src, 0o644); err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Printf("  ✓ Wrote %s (package %s, %d assets)\n", out, embedPackage, len(m.Assets))
+	}
+	return nil
+}
+
+// embedAsset is one asset as rendered into the generated file.
+type embedAsset struct {
+	Key    string
+	Ident  string // exported variable name
+	Asset  manifest.Asset
+	Themes []embedTheme // by theme name
+}
+
+type embedTheme struct {
+	Name  string
+	Asset manifest.ThemedAsset
+}
+
+// genEmbed renders the Go source of the embed package for m, whose
+// manifest file is manifestName next to the variants.
+func genEmbed(m *manifest.Manifest, manifestName, pkg string) ([]byte, error) {
+	files := []string{manifestName}
+	seen := map[string]bool{manifestName: true}
+	for _, a := range m.Assets {
+		for _, v := range a.AllVariants() {
+			if v.Remote() || seen[v.Path] {
+				continue
+			}
+			if strings.ContainsAny(v.Path, "*?[\\") {
+				return nil, fmt.Errorf("variant %s: go:embed cannot name paths with glob characters", v.Path)
+			}
+			seen[v.Path] = true
+			files = append(files, v.Path)
+		}
+	}
+	sort.Strings(files[1:])
+
+	keys := make([]string, 0, len(m.Assets))
+	for key := range m.Assets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	used := map[string]bool{}
+	for _, name := range embedReserved {
+		used[name] = true
+	}
+	assets := make([]embedAsset, 0, len(keys))
+	for _, key := range keys {
+		a := m.Assets[key]
+		ea := embedAsset{Key: key, Ident: embedIdent(key, used), Asset: a}
+		for name, t := range a.Themes {
+			ea.Themes = append(ea.Themes, embedTheme{Name: name, Asset: t})
+		}
+		sort.Slice(ea.Themes, func(i, j int) bool { return ea.Themes[i].Name < ea.Themes[j].Name })
+		assets = append(assets, ea)
+	}
+
+	aliases := make([]string, 0, len(m.Aliases))
+	for name := range m.Aliases {
+		aliases = append(aliases, name)
+	}
+	sort.Strings(aliases)
+
+	var buf bytes.Buffer
+	err := embedTemplate.Execute(&buf, map[string]any{
+		"Package":  pkg,
+		"Manifest": manifestName,
+		"Files":    files,
+		"Assets":   assets,
+		"Aliases":  aliases,
+		"AliasMap": m.Aliases,
+		"BasePath": m.BasePath,
+	})
+	if err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w", err)
+	}
+	return src, nil
+}
+
+// embedReserved are the identifiers the generated file declares itself.
+var embedReserved = []string{"Asset", "Variant", "Theme", "Assets", "Aliases", "Lookup", "Handler", "FS", "ManifestPath", "BasePath"}
+
+// embedIdent turns an asset key into an unused exported Go identifier:
+// "promo/hero-banner" → PromoHeroBanner. Keys that collide get a numeric
+// suffix.
+func embedIdent(key string, used map[string]bool) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	ident := b.String()
+	if ident == "" || !unicode.IsUpper([]rune(ident)[0]) {
+		ident = "Asset" + ident
+	}
+	name := ident
+	for i := 2; used[name]; i++ {
+		name = ident + strconv.Itoa(i)
+	}
+	used[name] = true
+	return name
+}
+
+// embedDirective quotes path for a //go:embed line when it contains
+// spaces or quotes.
+func embedDirective(path string) string {
+	if strings.ContainsAny(path, " \t\"'`") {
+		return strconv.Quote(path)
+	}
+	return path
+}
+
+var embedTemplate = template.Must(template.New("embed").Funcs(template.FuncMap{
+	"quote":     strconv.Quote,
+	"directive": embedDirective,
+}).Parse(`// Code generated by "tgimg gen-embed"; DO NOT EDIT.
+
+// Package {{.Package}} embeds the tgimg build output of this directory:
+// the manifest and every variant, with typed accessors by asset key.
+package {{.Package}}
+
+import (
+	"embed"
+	"net/http"
+)
+
+{{range .Files}}//go:embed {{directive .}}
+{{end}}var FS embed.FS
+
+// ManifestPath is the manifest's path in FS.
+const ManifestPath = {{quote .Manifest}}
+
+// BasePath is the manifest's base_path, the URL prefix of variant paths.
+const BasePath = {{quote .BasePath}}
+
+// Variant is one encoded rendition of an asset.
+type Variant struct {
+	Path   string // in FS, relative to BasePath
+	Format string
+	Width  int
+	Height int
+	Size   int64
+	Hash   string
+
+	Density    float64
+	Breakpoint string
+	Original   bool // copied source file, not for responsive display
+	Crop       bool // fixed-size crop, not for responsive display
+}
+
+// Bytes returns the variant's file contents.
+func (v Variant) Bytes() []byte {
+	data, _ := FS.ReadFile(v.Path)
+	return data
+}
+
+// Theme is a color-scheme rendition of an asset.
+type Theme struct {
+	Width       int
+	Height      int
+	ThumbHash   string
+	AspectRatio float64
+	Variants    []Variant
+}
+
+// Asset is one source image and its variants.
+type Asset struct {
+	Key         string
+	Width       int
+	Height      int
+	HasAlpha    bool
+	ThumbHash   string
+	AspectRatio float64
+	Variants    []Variant
+	Themes      map[string]Theme
+}
+
+{{define "variants"}}[]Variant{
+{{- range .}}
+		{Path: {{quote .Path}}, Format: {{quote .Format}}, Width: {{.Width}}, Height: {{.Height}}, Size: {{.Size}}, Hash: {{quote .Hash}}
+		{{- if .Density}}, Density: {{.Density}}{{end}}
+		{{- if .Breakpoint}}, Breakpoint: {{quote .Breakpoint}}{{end}}
+		{{- if .Original}}, Original: true{{end}}
+		{{- if .Crop}}, Crop: true{{end}}},
+{{- end}}
+	}{{end}}
+{{range .Assets}}
+// {{.Ident}} is the asset {{quote .Key}}.
+var {{.Ident}} = &Asset{
+	Key:         {{quote .Key}},
+	Width:       {{.Asset.Original.Width}},
+	Height:      {{.Asset.Original.Height}},
+	HasAlpha:    {{.Asset.Original.HasAlpha}},
+	ThumbHash:   {{quote .Asset.ThumbHash}},
+	AspectRatio: {{.Asset.AspectRatio}},
+	Variants:    {{template "variants" .Asset.Variants}},
+{{- if .Themes}}
+	Themes: map[string]Theme{
+{{- range .Themes}}
+		{{quote .Name}}: {
+			Width:       {{.Asset.Original.Width}},
+			Height:      {{.Asset.Original.Height}},
+			ThumbHash:   {{quote .Asset.ThumbHash}},
+			AspectRatio: {{.Asset.AspectRatio}},
+			Variants:    {{template "variants" .Asset.Variants}},
+		},
+{{- end}}
+	},
+{{- end}}
+}
+{{end}}
+// Assets holds every asset by key.
+var Assets = map[string]*Asset{
+{{- range .Assets}}
+	{{quote .Key}}: {{.Ident}},
+{{- end}}
+}
+
+// Aliases maps logical names to asset keys.
+var Aliases = map[string]string{
+{{- $aliases := .AliasMap}}{{range .Aliases}}
+	{{quote .}}: {{quote (index $aliases .)}},
+{{- end}}
+}
+
+// Lookup returns the asset with the given key or alias.
+func Lookup(key string) (*Asset, bool) {
+	if a, ok := Assets[key]; ok {
+		return a, true
+	}
+	a, ok := Assets[Aliases[key]]
+	return a, ok
+}
+
+// Handler serves the manifest and variants at their paths in FS. Mount
+// it under BasePath with http.StripPrefix; names are content-addressed,
+// so responses are cacheable forever.
+func Handler() http.Handler {
+	files := http.FileServer(http.FS(FS))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+ManifestPath {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+`))
@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	getJSON    bool
+	getBaseURL string
+)
+
+var getCmd = &cobra.Command{
+	Use:   "get [out_dir_or_manifest] <key>[@breakpoint]",
+	Short: "Print one asset's variants, thumbhash and dimensions",
+	Long: `Looks up a single asset (or alias) in a manifest and prints its
+original info, thumbhash, aspect ratio and every variant with its path.
+With key@breakpoint (hero@md), also prints the variants at that profile
+breakpoint's width.
+
+With a single argument, the manifest is read from the "output" directory
+of tgimg.config.json.
+
+Srcsets are printed with the manifest's base_path prepended, or with
+--base-url to preview URLs for a specific CDN origin.
+
+Use --json for machine-readable output.`,
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: completeGetArgs,
+	RunE:              runGet,
+}
+
+func init() {
+	getCmd.Flags().BoolVar(&getJSON, "json", false, "print the asset as JSON")
+	getCmd.Flags().StringVar(&getBaseURL, "base-url", "", "URL prefix for printed srcsets (default: manifest base_path)")
+	rootCmd.AddCommand(getCmd)
+}
+
+func runGet(_ *cobra.Command, args []string) error {
+	ref := args[len(args)-1]
+	path, err := outputDirArg(args[:len(args)-1])
+	if err != nil {
+		return err
+	}
+	m, err := loadManifest(path)
+	if err != nil {
+		return err
+	}
+
+	key, breakpoint, asset, ok := m.LookupRef(ref)
+	if !ok {
+		return fmt.Errorf("asset %q not found", ref)
+	}
+	var bpWidth int
+	if breakpoint != "" {
+		if bpWidth, ok = asset.BreakpointWidth(breakpoint); !ok {
+			if m.Config == nil || m.Config.Breakpoints[breakpoint] == 0 {
+				return fmt.Errorf("asset %q has no breakpoint %q", key, breakpoint)
+			}
+			logging.Warnf("%s: source is narrower than breakpoint %s; using the widest variant", key, breakpoint)
+			bpWidth = widestVariant(asset.Variants)
+		}
+	}
+	resolved := key
+	if target, isAlias := m.Aliases[key]; isAlias {
+		if _, direct := m.Assets[key]; !direct {
+			resolved = target
+		}
+	}
+
+	base := m.BasePath
+	if getBaseURL != "" {
+		if base, err = normalizeBaseURL(getBaseURL); err != nil {
+			return err
+		}
+	}
+
+	if getJSON {
+		out := struct {
+			Key        string            `json:"key"`
+			Alias      string            `json:"alias,omitempty"`
+			Breakpoint *breakpointRef    `json:"breakpoint,omitempty"`
+			Asset      manifest.Asset    `json:"asset"`
+			SrcSet     map[string]string `json:"srcset,omitempty"` // by format
+		}{Key: resolved, Asset: asset, SrcSet: map[string]string{}}
+		if breakpoint != "" {
+			out.Breakpoint = &breakpointRef{Name: breakpoint, Width: bpWidth, Paths: map[string]string{}}
+			for _, v := range breakpointVariants(asset.Variants, bpWidth) {
+				out.Breakpoint.Paths[v.Format] = v.Path
+			}
+		}
+		for _, f := range variantFormats(asset.Variants) {
+			out.SrcSet[f] = srcSet(asset.Variants, f, base, asset.Descriptor)
+		}
+		if resolved != key {
+			out.Alias = key
+		}
+		data, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(append(data, '\n'))
+		return err
+	}
+
+	fmt.Println()
+	if resolved != key {
+		fmt.Printf("  Key:          %s → %s (alias)\n", key, resolved)
+	} else {
+		fmt.Printf("  Key:          %s\n", key)
+	}
+	o := asset.Original
+	fmt.Printf("  Original:     %d×%d %s, %s, alpha=%v\n",
+		o.Width, o.Height, o.Format, formatBytes(o.Size), o.HasAlpha)
+	fmt.Printf("  Aspect ratio: %.4f\n", asset.AspectRatio)
+	fmt.Printf("  ThumbHash:    %s\n", asset.ThumbHash)
+	if asset.AvgColor != nil {
+		c := asset.AvgColor
+		fmt.Printf("  Avg color:    #%02x%02x%02x\n", c[0], c[1], c[2])
+	}
+	fmt.Println()
+
+	printVariantTable("Variants", asset.Variants)
+	printSrcSets(asset.Variants, base, asset.Descriptor)
+	if breakpoint != "" {
+		fmt.Printf("  Breakpoint %s (%dpx):\n", breakpoint, bpWidth)
+		for _, v := range breakpointVariants(asset.Variants, bpWidth) {
+			fmt.Printf("    %-6s %s%s\n", v.Format, base, v.Path)
+		}
+		fmt.Println()
+	}
+
+	themes := make([]string, 0, len(asset.Themes))
+	for name := range asset.Themes {
+		themes = append(themes, name)
+	}
+	sort.Strings(themes)
+	for _, name := range themes {
+		t := asset.Themes[name]
+		fmt.Printf("  Theme %s:  %d×%d %s, thumbhash %s\n",
+			name, t.Original.Width, t.Original.Height, t.Original.Format, t.ThumbHash)
+		printVariantTable("Variants", t.Variants)
+		printSrcSets(t.Variants, base, asset.Descriptor)
+	}
+	return nil
+}
+
+// completeGetArgs completes <key> from the default manifest, or from the
+// directory given as the first argument. With no keys to offer, the first
+// argument falls back to file completion.
+func completeGetArgs(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	switch len(args) {
+	case 0:
+		if keys := completeManifestKeys("", toComplete); len(keys) > 0 {
+			return keys, cobra.ShellCompDirectiveNoFileComp
+		}
+		return nil, cobra.ShellCompDirectiveDefault
+	case 1:
+		return completeManifestKeys(args[0], toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
+
+// breakpointRef is the resolved breakpoint of `tgimg get key@name --json`.
+type breakpointRef struct {
+	Name  string            `json:"name"`
+	Width int               `json:"width"`
+	Paths map[string]string `json:"paths"` // by format
+}
+
+// breakpointVariants returns the responsive variants of width w.
+func breakpointVariants(variants []manifest.Variant, w int) []manifest.Variant {
+	var out []manifest.Variant
+	for _, v := range variants {
+		if v.Responsive() && v.Width == w {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// widestVariant returns the largest responsive variant width.
+func widestVariant(variants []manifest.Variant) int {
+	w := 0
+	for _, v := range variants {
+		if v.Responsive() {
+			w = max(w, v.Width)
+		}
+	}
+	return w
+}
+
+// variantFormats lists the formats present in variants, in first-seen order.
+func variantFormats(variants []manifest.Variant) []string {
+	var formats []string
+	for _, v := range variants {
+		if !v.Original && !containsString(formats, v.Format) {
+			formats = append(formats, v.Format)
+		}
+	}
+	return formats
+}
+
+func printSrcSets(variants []manifest.Variant, base, descriptor string) {
+	formats := variantFormats(variants)
+	if len(formats) == 0 {
+		return
+	}
+	fmt.Println("  Srcset:")
+	for _, f := range formats {
+		fmt.Printf("    %-6s %s\n", f, srcSet(variants, f, base, descriptor))
+	}
+	fmt.Println()
+}
+
+func printVariantTable(title string, variants []manifest.Variant) {
+	fmt.Printf("  %s (%d):\n", title, len(variants))
+	fmt.Printf("    %-6s %6s %6s %9s  %s\n", "FORMAT", "WIDTH", "HEIGHT", "SIZE", "PATH")
+	for _, v := range variants {
+		path := v.Path
+		if v.Original {
+			path += "  (original)"
+		}
+		if v.Crop != nil {
+			path += "  (crop " + v.Crop.Box + ")"
+		}
+		if v.Breakpoint != "" {
+			path += "  (" + v.Breakpoint + ")"
+		}
+		fmt.Printf("    %-6s %6d %6d %9s  %s\n",
+			v.Format, v.Width, v.Height, formatBytes(v.Size), path)
+	}
+	fmt.Println()
+}
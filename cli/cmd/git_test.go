@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestGitChangedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	write := func(rel, data string) {
+		t.Helper()
+		path := filepath.Join(repo, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git := func(args ...string) {
+		t.Helper()
+		if _, err := runGit(repo, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q")
+	git("config", "user.email", "test@example.com")
+	git("config", "user.name", "test")
+	write("assets/img/logo.png", "logo")
+	write("assets/img/icons/star.png", "star")
+	write("assets/img/gone.png", "gone")
+	write("README.md", "readme")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+
+	write("assets/img/logo.png", "logo v2")
+	write("assets/img/new.png", "new")
+	write("assets/img/icons/heart.png", "heart")
+	write("README.md", "readme v2")
+	if err := os.Remove(filepath.Join(repo, "assets", "img", "gone.png")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := gitChangedFiles(filepath.Join(repo, "assets", "img"), "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(got)
+	want := []string{"gone.png", "icons/heart.png", "logo.png", "new.png"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changed files = %v, want %v", got, want)
+	}
+
+	git("add", ".")
+	git("commit", "-q", "-m", "second")
+	got, err = gitChangedFiles(filepath.Join(repo, "assets", "img"), "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || len(got) != 0 {
+		t.Errorf("changed files after commit = %#v, want empty", got)
+	}
+
+	if _, err := gitChangedFiles(repo, "no-such-ref"); err == nil {
+		t.Error("unknown ref accepted")
+	}
+}
@@ -0,0 +1,374 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/AnyUserName/tgimg-cli/internal/pipeline"
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+	"github.com/AnyUserName/tgimg-cli/internal/uploads"
+	tgimgv1 "github.com/AnyUserName/tgimg-cli/proto/tgimg/v1"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	grpcListen       string
+	grpcOutDir       string
+	grpcProfile      string
+	grpcWorkers      int
+	grpcEncoderProcs int
+	grpcWidths       []int
+	grpcDPRs         []float64
+	grpcQuality      int
+	grpcFormats      []string
+	grpcBasePath     string
+	grpcMaxUpload    int
+	grpcBuildRoot    string
+	grpcFreeMemory   bool
+)
+
+var grpcCmd = &cobra.Command{
+	Use:   "grpc",
+	Short: "Run a gRPC API for the build pipeline",
+	Long: `Starts a gRPC server (service tgimg.v1.Tgimg, defined in
+proto/tgimg/v1/tgimg.proto) for backends that prefer typed RPC over
+shelling out to the CLI.
+
+  ProcessImage     process one image into --out, like POST /v1/images
+                   of "tgimg server", and merge it into its manifest
+  GetAsset         an asset of the --out manifest, by key or alias
+  BuildDirectory   build a directory on this host, streaming progress
+
+ProcessImage and GetAsset share the storage of "tgimg server": both
+commands can run against the same --out, though not at once.
+
+BuildDirectory runs "tgimg build" with its default settings and the
+requested profile. Its directories are resolved inside --build-root and
+may not leave it, not even through a symbolic link; without --build-root
+the method is disabled. Builds run one at a time.
+
+The server registers gRPC reflection, so grpcurl works without the proto.`,
+	Args: cobra.NoArgs,
+	RunE: runGRPC,
+}
+
+func init() {
+	grpcCmd.Flags().StringVar(&grpcListen, "listen", ":9090", "listen address")
+	grpcCmd.Flags().StringVarP(&grpcOutDir, "out", "o", "./tgimg_out", "output directory for processed images and the manifest")
+	grpcCmd.Flags().StringVarP(&grpcProfile, "profile", "p", "telegram-webview", "processing profile")
+	grpcCmd.Flags().IntVarP(&grpcWorkers, "workers", "w", 0, "images processed at once (0 = NumCPU, fewer when memory is short)")
+	grpcCmd.Flags().IntVar(&grpcEncoderProcs, "encoder-concurrency", 0, "max concurrent cwebp/avifenc processes (0 = no limit)")
+	grpcCmd.Flags().IntSliceVar(&grpcWidths, "widths", nil, "custom widths (overrides profile)")
+	grpcCmd.Flags().Float64SliceVar(&grpcDPRs, "dprs", nil, "device pixel ratios generated per width, e.g. 1,2,3 (overrides profile)")
+	grpcCmd.Flags().IntVarP(&grpcQuality, "quality", "q", 0, "quality 1-100 (0 = profile default)")
+	grpcCmd.Flags().StringSliceVar(&grpcFormats, "formats", nil, "output formats in priority order (overrides profile)")
+	grpcCmd.Flags().StringVar(&grpcBasePath, "base-path", "", "URL prefix for variant paths (default: the manifest's, or \"/\" for a new one)")
+	grpcCmd.Flags().IntVar(&grpcMaxUpload, "max-upload", 20<<20, "largest accepted ProcessImage image in bytes")
+	grpcCmd.Flags().StringVar(&grpcBuildRoot, "build-root", "", "directory BuildDirectory may read and write in (empty = BuildDirectory disabled)")
+	grpcCmd.Flags().BoolVar(&grpcFreeMemory, "free-memory", false, "return pooled buffers to the OS after each BuildDirectory build")
+	registerCompletions(grpcCmd, buildFlagCompletions)
+	rootCmd.AddCommand(grpcCmd)
+}
+
+func runGRPC(_ *cobra.Command, _ []string) error {
+	prof, err := resolveProfile(grpcProfile, grpcWidths, grpcDPRs, grpcFormats, grpcQuality, "")
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+	if grpcMaxUpload <= 0 {
+		return withExitCode(ExitUsage, fmt.Errorf("invalid --max-upload %d", grpcMaxUpload))
+	}
+	var buildRoot string
+	if grpcBuildRoot != "" {
+		if buildRoot, err = filepath.Abs(grpcBuildRoot); err != nil {
+			return fmt.Errorf("resolve build root: %w", err)
+		}
+		if info, err := os.Stat(buildRoot); err != nil || !info.IsDir() {
+			return withExitCode(ExitUsage, fmt.Errorf("--build-root %s is not a directory", grpcBuildRoot))
+		}
+		// rootPath compares requests against the root's real path.
+		if buildRoot, err = filepath.EvalSymlinks(buildRoot); err != nil {
+			return fmt.Errorf("resolve build root: %w", err)
+		}
+	}
+	store, absOutput, err := openUploadStore(grpcOutDir, prof, grpcBasePath, grpcWorkers, grpcEncoderProcs, nil)
+	if err != nil {
+		return err
+	}
+
+	lis, err := net.Listen("tcp", grpcListen)
+	if err != nil {
+		return err
+	}
+	// Leave room for the other request fields around the image.
+	srv := grpc.NewServer(grpc.MaxRecvMsgSize(grpcMaxUpload + 64<<10))
+	tgimgv1.RegisterTgimgServer(srv, &grpcServer{store: store, prof: prof, maxUpload: grpcMaxUpload, buildRoot: buildRoot})
+	reflection.Register(srv)
+
+	fmt.Printf("  tgimg grpc: %s (tgimg.v1.Tgimg)\n", lis.Addr())
+	fmt.Printf("  storing in %s (%d assets, profile %s)\n", absOutput, store.Len(), prof.Name)
+	if buildRoot != "" {
+		fmt.Printf("  BuildDirectory root: %s\n", buildRoot)
+	}
+	return srv.Serve(lis)
+}
+
+// grpcServer implements tgimg.v1.Tgimg over an upload store. buildMu
+// serializes BuildDirectory calls.
+type grpcServer struct {
+	tgimgv1.UnimplementedTgimgServer
+
+	store     *uploads.Store
+	prof      profile.Profile // the server's profile, with flag overrides
+	maxUpload int             // largest ProcessImage image in bytes
+	buildRoot string          // real path; empty disables BuildDirectory
+	buildMu   sync.Mutex
+}
+
+func (s *grpcServer) ProcessImage(_ context.Context, req *tgimgv1.ProcessImageRequest) (*tgimgv1.AssetResult, error) {
+	if len(req.Image) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "empty image")
+	}
+	if len(req.Image) > s.maxUpload {
+		return nil, status.Errorf(codes.ResourceExhausted, "image exceeds %d bytes", s.maxUpload)
+	}
+	res, err := s.store.Add(req.Image, req.Key)
+	switch {
+	case errors.Is(err, uploads.ErrInvalidKey), errors.Is(err, uploads.ErrUnprocessable):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return resultProto(res), nil
+}
+
+func (s *grpcServer) GetAsset(_ context.Context, req *tgimgv1.GetAssetRequest) (*tgimgv1.AssetResult, error) {
+	res, ok := s.store.Lookup(req.Ref)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "asset %q not found", req.Ref)
+	}
+	return resultProto(res), nil
+}
+
+func (s *grpcServer) BuildDirectory(req *tgimgv1.BuildDirectoryRequest, stream tgimgv1.Tgimg_BuildDirectoryServer) error {
+	if s.buildRoot == "" {
+		return status.Error(codes.PermissionDenied, "BuildDirectory is disabled; start the server with --build-root")
+	}
+	absInput, err := s.rootPath("input_dir", req.InputDir)
+	if err != nil {
+		return err
+	}
+	absOutput, err := s.rootPath("output_dir", req.OutputDir)
+	if err != nil {
+		return err
+	}
+	// The pipeline leaves an output_dir inside input_dir out of its scan.
+	if _, err := outputInsideInput(pipeline.Dir(absInput), absOutput); err != nil {
+		return status.Errorf(codes.InvalidArgument, "output_dir %v", err)
+	}
+	prof := s.prof
+	if req.Profile != "" && req.Profile != prof.Name {
+		if !containsString(profile.Names(), req.Profile) {
+			return status.Errorf(codes.InvalidArgument, "unknown profile %q", req.Profile)
+		}
+		prof = profile.Get(req.Profile)
+	}
+
+	aliases, err := pipeline.LoadAliases(pipeline.Dir(absInput))
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "load aliases: %v", err)
+	}
+	focus, err := pipeline.LoadFocus(pipeline.Dir(absInput))
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "load focal points: %v", err)
+	}
+	recolor, err := pipeline.LoadRecolor(pipeline.Dir(absInput))
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "load recolor rules: %v", err)
+	}
+
+	s.buildMu.Lock()
+	defer s.buildMu.Unlock()
+	if err := os.MkdirAll(absOutput, 0o755); err != nil {
+		return status.Errorf(codes.Internal, "create output dir: %v", err)
+	}
+
+	// Progress runs on the workers; a stream allows one sender at a time.
+	// Send errors mean the client left, and the build finishes regardless.
+	var sendMu sync.Mutex
+	var done, total int32
+	workers := grpcWorkers
+	if workers <= 0 {
+		workers = pipeline.AutoWorkers(prof)
+	}
+	p := pipeline.New(pipeline.Config{
+		InputDir:           absInput,
+		OutputDir:          absOutput,
+		Profile:            prof,
+		Workers:            workers,
+		EncoderConcurrency: grpcEncoderProcs,
+		NoRegressSize:      true,
+		Aliases:            aliases,
+		Focus:              focus,
+		Recolor:            recolor,
+		Overrides:          configOverrides(),
+		FreeMemory:         grpcFreeMemory,
+		Progress: func(n, of int, source string, err error) {
+			msg := &tgimgv1.BuildProgress{Done: int32(n), Total: int32(of), Source: source}
+			if err != nil {
+				msg.Error = err.Error()
+			}
+			sendMu.Lock()
+			defer sendMu.Unlock()
+			done, total = max(done, msg.Done), msg.Total
+			stream.Send(msg)
+		},
+	})
+	m, err := p.Run()
+	if errors.Is(err, pipeline.ErrNoImages) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "pipeline: %v", err)
+	}
+	m.BuildInfo.ToolVersion = version
+
+	manifestPath := filepath.Join(absOutput, manifestFileName)
+	data, err := manifest.Marshal(m, manifest.WriteOptions{})
+	if err == nil {
+		err = manifest.WriteFile(manifestPath, data)
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "write manifest: %v", err)
+	}
+	rel, _ := filepath.Rel(s.buildRoot, manifestPath)
+
+	sendMu.Lock()
+	defer sendMu.Unlock()
+	return stream.Send(&tgimgv1.BuildProgress{
+		Done:  done,
+		Total: total,
+		Result: &tgimgv1.BuildResult{
+			ManifestPath: filepath.ToSlash(rel),
+			Stats:        statsProto(m.Stats),
+			Failed:       int32(len(p.Report().Errors)),
+		},
+	})
+}
+
+// rootPath resolves the relative path dir inside the build root. Symbolic
+// links are followed, so a link inside the root that points out of it is
+// rejected; the returned path has them resolved.
+func (s *grpcServer) rootPath(field, dir string) (string, error) {
+	if dir == "" {
+		return "", status.Errorf(codes.InvalidArgument, "%s is required", field)
+	}
+	if !filepath.IsLocal(dir) {
+		return "", status.Errorf(codes.InvalidArgument, "%s %q must be a relative path inside the build root", field, dir)
+	}
+	rel, ok := pipeline.NestedDir(s.buildRoot, filepath.Join(s.buildRoot, dir))
+	if !ok {
+		return "", status.Errorf(codes.InvalidArgument, "%s %q leaves the build root through a symbolic link", field, dir)
+	}
+	return filepath.Join(s.buildRoot, filepath.FromSlash(rel)), nil
+}
+
+func resultProto(r uploads.Result) *tgimgv1.AssetResult {
+	out := &tgimgv1.AssetResult{Key: r.Key, Asset: assetProto(r.Asset), Urls: r.URLs}
+	for _, sv := range r.Skipped {
+		out.Skipped = append(out.Skipped, &tgimgv1.SkippedVariant{
+			Theme:         sv.Theme,
+			Format:        sv.Format,
+			Width:         int32(sv.Width),
+			Height:        int32(sv.Height),
+			Reason:        sv.Reason,
+			EncodedBytes:  sv.EncodedBytes,
+			OriginalBytes: sv.OriginalBytes,
+		})
+	}
+	return out
+}
+
+func assetProto(a manifest.Asset) *tgimgv1.Asset {
+	out := themedProto(a.Themed())
+	out.Descriptor_ = a.Descriptor
+	for name, t := range a.Themes {
+		if out.Themes == nil {
+			out.Themes = map[string]*tgimgv1.Asset{}
+		}
+		out.Themes[name] = themedProto(t)
+	}
+	return out
+}
+
+func themedProto(t manifest.ThemedAsset) *tgimgv1.Asset {
+	out := &tgimgv1.Asset{
+		Original: &tgimgv1.OriginalInfo{
+			Width:    int32(t.Original.Width),
+			Height:   int32(t.Original.Height),
+			Format:   t.Original.Format,
+			Size:     t.Original.Size,
+			HasAlpha: t.Original.HasAlpha,
+		},
+		Thumbhash:   t.ThumbHash,
+		AspectRatio: t.AspectRatio,
+		Placeholder: t.Placeholder,
+	}
+	if t.AvgColor != nil {
+		out.AvgColor = []uint32{uint32(t.AvgColor[0]), uint32(t.AvgColor[1]), uint32(t.AvgColor[2])}
+	}
+	for _, v := range t.Variants {
+		out.Variants = append(out.Variants, variantProto(v))
+	}
+	return out
+}
+
+func variantProto(v manifest.Variant) *tgimgv1.Variant {
+	out := &tgimgv1.Variant{
+		Format:     v.Format,
+		Width:      int32(v.Width),
+		Height:     int32(v.Height),
+		Size:       v.Size,
+		Hash:       v.Hash,
+		Path:       v.Path,
+		EncodeMs:   v.EncodeMS,
+		Quality:    int32(v.Quality),
+		Density:    v.Density,
+		Breakpoint: v.Breakpoint,
+		Original:   v.Original,
+	}
+	if c := v.Crop; c != nil {
+		out.Crop = &tgimgv1.Crop{
+			Box:    c.Box,
+			X:      int32(c.X),
+			Y:      int32(c.Y),
+			Width:  int32(c.Width),
+			Height: int32(c.Height),
+			Margin: c.Margin,
+		}
+	}
+	if t := v.Telegram; t != nil {
+		out.Telegram = &tgimgv1.TelegramFile{FileId: t.FileID, FileUniqueId: t.FileUniqueID, Kind: t.Kind}
+	}
+	return out
+}
+
+func statsProto(st manifest.Stats) *tgimgv1.Stats {
+	return &tgimgv1.Stats{
+		TotalInputBytes:  st.TotalInputBytes,
+		TotalOutputBytes: st.TotalOutputBytes,
+		TotalAssets:      int32(st.TotalAssets),
+		TotalVariants:    int32(st.TotalVariants),
+		SkippedRegress:   int32(st.SkippedRegress),
+	}
+}
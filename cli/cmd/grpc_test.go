@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestGRPCRootPath checks that BuildDirectory paths stay inside the build
+// root, also through symbolic links.
+func TestGRPCRootPath(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "images"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Skipf("symlink: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "images"), filepath.Join(root, "alias")); err != nil {
+		t.Fatal(err)
+	}
+	s := &grpcServer{buildRoot: root}
+	for _, tc := range []struct {
+		dir  string
+		want string // empty: rejected
+	}{
+		{"images", filepath.Join(root, "images")},
+		{"images/out", filepath.Join(root, "images", "out")}, // need not exist
+		{"alias/out", filepath.Join(root, "images", "out")},
+		{"", ""},
+		{"../images", ""},
+		{"/tmp", ""},
+		{"escape", ""},
+		{"escape/out", ""},
+	} {
+		got, err := s.rootPath("input_dir", tc.dir)
+		switch {
+		case tc.want == "" && err == nil:
+			t.Errorf("%q: resolved to %s, want an error", tc.dir, got)
+		case tc.want != "" && err != nil:
+			t.Errorf("%q: %v", tc.dir, err)
+		case got != tc.want:
+			t.Errorf("%q: resolved to %s, want %s", tc.dir, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+)
+
+// Cache-Control values for content-addressed variants and for the
+// manifest, which changes in place on every build.
+const (
+	variantCacheControl  = "public, max-age=31536000, immutable"
+	manifestCacheControl = "public, max-age=60, must-revalidate"
+)
+
+// headerTargets maps --emit-headers values to the file each writes into
+// the output directory. Netlify and Cloudflare Pages share _headers.
+var headerTargets = map[string]string{
+	"netlify":    "_headers",
+	"cloudflare": "_headers",
+	"htaccess":   ".htaccess",
+	"nginx":      "tgimg.nginx.conf",
+}
+
+// headerTargetNames lists the --emit-headers values in help order.
+var headerTargetNames = []string{"netlify", "cloudflare", "htaccess", "nginx"}
+
+// cloudflareHeaderRules is Cloudflare Pages' limit on _headers rules.
+const cloudflareHeaderRules = 100
+
+// checkHeaderTargets validates --emit-headers values.
+func checkHeaderTargets(targets []string) error {
+	for _, t := range targets {
+		if _, ok := headerTargets[t]; !ok {
+			return fmt.Errorf("invalid --emit-headers %q: want %s", t, strings.Join(headerTargetNames, ", "))
+		}
+	}
+	return nil
+}
+
+// writeHeaders writes the cache header config of every target for m's
+// variants into outDir: immutable caching for content-addressed variants,
+// a short TTL for the manifest.
+func writeHeaders(m *manifest.Manifest, outDir string, targets []string) error {
+	prefix := m.BasePath
+	if !strings.HasPrefix(prefix, "/") {
+		logging.Warnf("--emit-headers: base_path %q is not a URL path; rules assume the output directory is served at / (set --base-path)", m.BasePath)
+		prefix = "/"
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	var paths []string
+	exts := map[string]bool{}
+	seen := map[string]bool{}
+	for _, a := range m.Assets {
+		for _, v := range a.AllVariants() {
+			if v.Remote() || seen[v.Path] {
+				continue
+			}
+			seen[v.Path] = true
+			paths = append(paths, v.Path)
+			exts[strings.ToLower(strings.TrimPrefix(path.Ext(v.Path), "."))] = true
+		}
+	}
+	sort.Strings(paths)
+
+	written := map[string]bool{}
+	for _, t := range targets {
+		name := headerTargets[t]
+		if written[name] {
+			continue
+		}
+		written[name] = true
+		var data string
+		switch name {
+		case "_headers":
+			if len(paths)+1 > cloudflareHeaderRules {
+				logging.Warnf("--emit-headers: %d rules in _headers; Cloudflare Pages applies only the first %d", len(paths)+1, cloudflareHeaderRules)
+			}
+			data = headersFile(prefix, paths)
+		case ".htaccess":
+			data = htaccessFile(exts)
+		default:
+			data = nginxFile(prefix, exts)
+		}
+		if err := os.WriteFile(filepath.Join(outDir, name), []byte(data), 0o644); err != nil {
+			return err
+		}
+		logging.Debugf("headers: %s", filepath.Join(outDir, name))
+	}
+	return nil
+}
+
+// headersFile renders _headers for Netlify and Cloudflare Pages. Both
+// merge every rule matching a path, so each variant gets its own rule
+// rather than a splat that would also match the manifest.
+func headersFile(prefix string, paths []string) string {
+	var b strings.Builder
+	b.WriteString("# Generated by \"tgimg build --emit-headers\". Do not edit.\n")
+	fmt.Fprintf(&b, "%s%s\n  Cache-Control: %s\n", prefix, manifestFileName, manifestCacheControl)
+	for _, p := range paths {
+		fmt.Fprintf(&b, "%s%s\n  Cache-Control: %s\n", prefix, p, variantCacheControl)
+	}
+	return b.String()
+}
+
+// variantPattern returns a regular expression matching content-addressed
+// variant names (<stem>.<w>.<h>.<hash>.<ext>) with one of exts.
+func variantPattern(exts map[string]bool) string {
+	list := make([]string, 0, len(exts))
+	for ext := range exts {
+		list = append(list, regexp.QuoteMeta(ext))
+	}
+	sort.Strings(list)
+	if len(list) == 0 {
+		list = []string{"avif", "webp", "jpeg", "png"}
+	}
+	return `\.[0-9]+\.[0-9]+\.[0-9a-f]{8}\.(` + strings.Join(list, "|") + `)$`
+}
+
+// htaccessFile renders .htaccess for Apache, which applies it to the
+// output directory and below.
+func htaccessFile(exts map[string]bool) string {
+	return fmt.Sprintf(`# Generated by "tgimg build --emit-headers". Do not edit.
+<IfModule mod_mime.c>
+  AddType image/avif .avif
+  AddType image/webp .webp
+</IfModule>
+<IfModule mod_headers.c>
+  <FilesMatch "%s">
+    Header set Cache-Control "%s"
+  </FilesMatch>
+  <Files "%s">
+    Header set Cache-Control "%s"
+  </Files>
+</IfModule>
+`, variantPattern(exts), variantCacheControl, manifestFileName, manifestCacheControl)
+}
+
+// nginxFile renders location blocks to include in the server block that
+// serves the output directory at prefix.
+func nginxFile(prefix string, exts map[string]bool) string {
+	return fmt.Sprintf(`# Generated by "tgimg build --emit-headers". Do not edit.
+# Include in the server block serving the output directory at %[1]s.
+location = %[1]s%[2]s {
+    add_header Cache-Control "%[3]s";
+}
+location ~ "^%[4]s.+%[5]s" {
+    add_header Cache-Control "%[6]s";
+}
+`, prefix, manifestFileName, manifestCacheControl, regexp.QuoteMeta(prefix), variantPattern(exts), variantCacheControl)
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/AnyUserName/tgimg-cli/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var initForce bool
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Write a tgimg.config.json with default settings",
+	Long: `Creates tgimg.config.json in the current directory. Every command reads
+it, so a committed config replaces long flag strings:
+
+  input      source image directory (default argument of build/serve)
+  output     output directory (default for build --out, stats, validate, ...)
+  profile    processing profile
+  widths     override profile widths
+  formats    override profile formats
+  quality    override profile quality
+  base_path  manifest base_path, the URL prefix for variant paths
+  ignore     glob patterns of input paths to skip ("*.psd", "drafts/*")
+
+Flags on the command line always win over the config file.`,
+	Args: cobra.NoArgs,
+	RunE: runInit,
+}
+
+func init() {
+	initCmd.Flags().BoolVar(&initForce, "force", false, "overwrite an existing config file")
+	rootCmd.AddCommand(initCmd)
+}
+
+func runInit(_ *cobra.Command, _ []string) error {
+	path := config.FileName
+	if _, err := os.Stat(path); err == nil && !initForce {
+		return fmt.Errorf("%s already exists (use --force to overwrite)", path)
+	}
+	if err := config.Default().Write(path); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	fmt.Printf("  ✓ Wrote %s\n", path)
+	return nil
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+	"github.com/AnyUserName/tgimg-cli/internal/pipeline"
+	"github.com/AnyUserName/tgimg-cli/internal/s3"
+	"github.com/AnyUserName/tgimg-cli/internal/telegram"
+)
+
+// gcsEndpoint is Google Cloud Storage's S3-compatible XML API, which
+// takes HMAC keys in place of AWS credentials.
+const gcsEndpoint = "https://storage.googleapis.com"
+
+// bucketOptions configures the client of an s3:// or gs:// input.
+type bucketOptions struct {
+	endpoint  string
+	region    string
+	pathStyle bool
+}
+
+// telegramOptions configures the bot of a tg:// input.
+type telegramOptions struct {
+	token  string
+	apiURL string
+}
+
+// openInput resolves a build input: a local directory, a .zip, .tar or
+// .tar.gz archive, s3://bucket/prefix or gs://bucket/prefix for the
+// objects under a prefix, or tg://file_id[,file_id...] for files a bot
+// received. It returns the input and its name for messages and reports:
+// the absolute directory or archive path, or the input URL. Close an
+// input that implements io.Closer when done.
+func openInput(ctx context.Context, arg string, opts bucketOptions, tg telegramOptions) (pipeline.Input, string, error) {
+	scheme, rest, ok := strings.Cut(arg, "://")
+	if !ok {
+		abs, err := filepath.Abs(arg)
+		if err != nil {
+			return nil, "", fmt.Errorf("resolve input path: %w", err)
+		}
+		if pipeline.IsArchive(abs) {
+			if info, err := os.Stat(abs); err == nil && !info.IsDir() {
+				a, err := pipeline.OpenArchive(abs)
+				if err != nil {
+					return nil, "", err
+				}
+				return a, abs, nil
+			}
+		}
+		return pipeline.Dir(abs), abs, nil
+	}
+
+	if scheme == "tg" {
+		return telegramInput(ctx, arg, rest, tg)
+	}
+	if scheme != "s3" && scheme != "gs" {
+		return nil, "", withExitCode(ExitUsage, fmt.Errorf("unsupported input %q: want a directory, an archive, s3://bucket/prefix, gs://bucket/prefix or tg://file_id", arg))
+	}
+	client, prefix, err := bucketClient(arg, scheme, rest, opts)
+	if err != nil {
+		return nil, "", fmt.Errorf("input %w", err)
+	}
+	name := scheme + "://" + client.Bucket + "/" + prefix
+	return &pipeline.Bucket{Client: client, Prefix: prefix, URL: name, Context: ctx}, name, nil
+}
+
+// outputInsideInput returns d without outDir when the output directory
+// lies inside the input tree, where the next build would otherwise scan
+// its variants as sources, and warns about it. An output directory that
+// is the input directory itself is an error.
+func outputInsideInput(d pipeline.Dir, outDir string) (pipeline.Input, error) {
+	rel, nested := pipeline.NestedDir(string(d), outDir)
+	switch {
+	case !nested:
+		return d, nil
+	case rel == ".":
+		return nil, fmt.Errorf("%s is the input directory; the next build would take its variants for sources", outDir)
+	}
+	logging.Warnf("output directory %s is inside the input directory %s; it is left out of the scan, but move it elsewhere so its variants stay apart from the sources", outDir, d)
+	return d.Without(outDir), nil
+}
+
+// bucketClient returns the client and key prefix ("" or ending in "/") of
+// arg, an s3:// or gs:// URL split into scheme and rest. Credentials come
+// from the AWS_* variables.
+func bucketClient(arg, scheme, rest string, opts bucketOptions) (*s3.Client, string, error) {
+	client := &s3.Client{Endpoint: opts.endpoint, Region: opts.region, PathStyle: opts.pathStyle}
+	switch scheme {
+	case "s3":
+	case "gs":
+		if client.Endpoint == "" {
+			client.Endpoint = gcsEndpoint
+		}
+		client.Region = "auto"
+	default:
+		return nil, "", withExitCode(ExitUsage, fmt.Errorf("unsupported %q: want s3://bucket/prefix or gs://bucket/prefix", arg))
+	}
+	bucket, prefix, _ := strings.Cut(rest, "/")
+	if bucket == "" {
+		return nil, "", withExitCode(ExitUsage, fmt.Errorf("%q: missing bucket name", arg))
+	}
+	if _, err := url.Parse("https://" + bucket); err != nil || strings.ContainsAny(bucket, "?#") {
+		return nil, "", withExitCode(ExitUsage, fmt.Errorf("%q: invalid bucket name", arg))
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	client.Bucket = bucket
+	if err := client.CredentialsFromEnv(); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", arg, err)
+	}
+	return client, prefix, nil
+}
+
+// telegramInput returns the input of tg://file_id[,file_id...], rest
+// being the comma-separated file_ids.
+func telegramInput(ctx context.Context, arg, rest string, opts telegramOptions) (pipeline.Input, string, error) {
+	var ids []string
+	for _, id := range strings.Split(rest, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, "", withExitCode(ExitUsage, fmt.Errorf("%q: missing file_id", arg))
+	}
+	if opts.token == "" {
+		return nil, "", withExitCode(ExitUsage, fmt.Errorf("%q: a tg:// input needs --telegram-token or TGIMG_TOKEN", arg))
+	}
+	bot := &telegram.Bot{Token: opts.token, APIURL: opts.apiURL, MaxRetries: 5}
+	in := &pipeline.Telegram{Bot: bot, FileIDs: ids, Context: ctx}
+	return in, in.String(), nil
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/AnyUserName/tgimg-cli/internal/imageinfo"
+	"github.com/AnyUserName/tgimg-core/thumbhash"
+	"github.com/spf13/cobra"
+)
+
+var inspectJSON bool
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect <image>",
+	Short: "Print source image metadata for debugging",
+	Long: `Decodes one source image and prints what affects processing:
+dimensions, format, color model, chroma subsampling, bit depth, EXIF
+orientation, ICC profile presence, alpha usage, decoded memory and the
+thumbhash.
+
+Use --json for machine-readable output.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runInspect,
+}
+
+func init() {
+	inspectCmd.Flags().BoolVar(&inspectJSON, "json", false, "print metadata as JSON")
+	rootCmd.AddCommand(inspectCmd)
+}
+
+// orientationNames describes EXIF orientation values.
+var orientationNames = map[int]string{
+	1: "normal",
+	2: "mirrored",
+	3: "rotated 180°",
+	4: "mirrored, rotated 180°",
+	5: "mirrored, rotated 90° CCW",
+	6: "rotated 90° CW",
+	7: "mirrored, rotated 90° CW",
+	8: "rotated 90° CCW",
+}
+
+func runInspect(_ *cobra.Command, args []string) error {
+	path := args[0]
+	info, img, err := imageinfo.Inspect(path)
+	if err != nil {
+		return err
+	}
+	hash := base64.StdEncoding.EncodeToString(thumbhash.Encode(img))
+
+	if inspectJSON {
+		out := struct {
+			Path string `json:"path"`
+			*imageinfo.Info
+			ThumbHash string `json:"thumbhash"`
+		}{path, info, hash}
+		data, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	model := fmt.Sprintf("%s, %d-bit", info.ColorModel, info.BitDepth)
+	if info.Subsampling != "" {
+		model += ", " + info.Subsampling
+	}
+	alpha := "none"
+	switch {
+	case info.UsesAlpha:
+		alpha = "used"
+	case info.HasAlpha:
+		alpha = "channel present, fully opaque"
+	}
+
+	fmt.Println()
+	fmt.Printf("  File:         %s (%s)\n", path, formatBytes(info.FileSize))
+	fmt.Printf("  Format:       %s\n", info.Format)
+	fmt.Printf("  Dimensions:   %d×%d\n", info.Width, info.Height)
+	fmt.Printf("  Color model:  %s\n", model)
+	fmt.Printf("  Orientation:  %d (%s)\n", info.Orientation, orientationNames[info.Orientation])
+	fmt.Printf("  ICC profile:  %v\n", info.HasICC)
+	if info.ColorSpace != "" {
+		fmt.Printf("  Color space:  %s, converted to sRGB\n", info.ColorSpace)
+	}
+	fmt.Printf("  Alpha:        %s\n", alpha)
+	fmt.Printf("  Decode mem:   %s\n", formatBytes(info.DecodeBytes))
+	fmt.Printf("  Thumbhash:    %s\n", hash)
+
+	if info.Orientation != 1 {
+		fmt.Println("\n  ⚠ EXIF orientation is not applied by the pipeline; variants will appear unrotated.")
+	}
+	if info.ColorError != "" {
+		fmt.Printf("\n  ⚠ Color profile not converted (%s); colors are kept as they are.\n", info.ColorError)
+	}
+	fmt.Println()
+	return nil
+}
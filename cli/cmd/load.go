@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/AnyUserName/tgimg-cli/internal/pipeline"
+)
+
+// manifestFileName is the name of the manifest inside an output directory.
+const manifestFileName = "tgimg.manifest.json"
+
+// resolveManifestPath accepts either a manifest file or an output
+// directory containing one.
+func resolveManifestPath(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("stat %s: %w", path, err)
+	}
+	if info.IsDir() {
+		return filepath.Join(path, manifestFileName), nil
+	}
+	return path, nil
+}
+
+// loadManifest reads and parses a manifest from a file or output directory.
+func loadManifest(path string) (*manifest.Manifest, error) {
+	path, err := resolveManifestPath(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	var m manifest.Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		if _, serr := os.Stat(path + manifest.BackupSuffix); serr == nil {
+			return nil, fmt.Errorf("parse manifest: %w (the previous manifest is kept in %s)", err, path+manifest.BackupSuffix)
+		}
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// manifestUnicodeKeys returns the key normalization the manifest's build
+// used, so that a rescan of its input finds the same keys.
+func manifestUnicodeKeys(m *manifest.Manifest) pipeline.UnicodeKeys {
+	if m.Config == nil {
+		return pipeline.UnicodeKeysNFC
+	}
+	return pipeline.UnicodeKeys(m.Config.UnicodeKeys)
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/AnyUserName/tgimg-cli/internal/prom"
+)
+
+// serverMetrics are the Prometheus metrics "tgimg server" and "tgimg
+// serve" expose at /metrics.
+type serverMetrics struct {
+	reg *prom.Registry
+
+	images   *prom.Counter   // sources processed, by status
+	encode   *prom.Histogram // encode time, by format
+	hits     *prom.Counter   // cache hits, by cache
+	misses   *prom.Counter   // cache misses, by cache
+	errors   *prom.Counter   // failures, by operation
+	rebuilds *prom.Counter   // serve only
+}
+
+// newServerMetrics registers the metrics; assets reports the number of
+// assets in the live manifest at scrape time.
+func newServerMetrics(assets func() int) *serverMetrics {
+	reg := prom.NewRegistry()
+	m := &serverMetrics{
+		reg: reg,
+		images: reg.Counter("tgimg_images_processed_total",
+			"Source images processed: uploads for server, sources planned for serve.", "status"),
+		encode: reg.Histogram("tgimg_encode_duration_seconds",
+			"Time spent encoding one variant, by output format.", prom.DefBuckets, "format"),
+		hits: reg.Counter("tgimg_cache_hits_total",
+			"Variants served from a cache: render is serve's in-memory cache, encode the build cache.", "cache"),
+		misses: reg.Counter("tgimg_cache_misses_total",
+			"Variants serve's in-memory render cache did not have yet.", "cache"),
+		errors: reg.Counter("tgimg_errors_total",
+			"Failed operations: upload, encode, render or rebuild.", "op"),
+		rebuilds: reg.Counter("tgimg_rebuilds_total",
+			"Manifest rebuilds after input changes (serve)."),
+	}
+	reg.GaugeFunc("tgimg_assets", "Assets in the live manifest.", func() float64 { return float64(assets()) })
+	return m
+}
+
+// onEncode is a pipeline.Config.OnEncode that records encodes.
+func (m *serverMetrics) onEncode(format string, elapsed time.Duration, cached bool, err error) {
+	switch {
+	case err != nil:
+		m.errors.Inc("encode")
+	case cached:
+		m.hits.Inc("encode")
+	default:
+		m.encode.Observe(elapsed.Seconds(), format)
+	}
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+var migrateDryRun bool
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate [manifest_path]",
+	Short: "Upgrade a manifest to the current schema version in place",
+	Long: `Upgrades an older tgimg manifest to the current schema version,
+filling fields that older versions left empty (base_path, aspect_ratio,
+stats). The file is rewritten in place unless --dry-run is given.`,
+	Args: cobra.RangeArgs(0, 1),
+	RunE: runMigrate,
+}
+
+func init() {
+	migrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "print changes without writing the manifest")
+	rootCmd.AddCommand(migrateCmd)
+}
+
+func runMigrate(_ *cobra.Command, args []string) error {
+	arg, err := outputDirArg(args)
+	if err != nil {
+		return err
+	}
+	manifestPath, err := resolveManifestPath(arg)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+
+	var m manifest.Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("parse manifest: %w", err)
+	}
+
+	changes, err := manifest.Migrate(&m)
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+
+	if len(changes) == 0 {
+		fmt.Printf("  ✓ Manifest is already at version %d\n", m.Version)
+		return nil
+	}
+
+	fmt.Printf("  %d change(s):\n", len(changes))
+	for _, c := range changes {
+		fmt.Printf("    • %s\n", c)
+	}
+
+	if migrateDryRun {
+		fmt.Println("  (dry run — manifest not written)")
+		return nil
+	}
+	if err := manifest.WriteJSON(&m, manifestPath); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	fmt.Printf("  ✓ Migrated to version %d\n", m.Version)
+	return nil
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/AnyUserName/tgimg-core/thumbhash"
+)
+
+// Files written into the output directory by --emit-nextjs.
+const (
+	nextMapName    = "tgimg.next.json"
+	nextLoaderName = "tgimg-loader.js"
+)
+
+// nextFormats is the order in which --emit-nextjs picks each asset's
+// format. A next/image loader returns one URL for every browser, so
+// AVIF, which older Telegram webviews lack, comes last.
+var nextFormats = []string{"webp", "jpeg", "png", "avif"}
+
+// nextMap is tgimg.next.json: per asset key, what next/image needs to
+// size the image, blur it up and load it through tgimg-loader.js.
+type nextMap struct {
+	Images  map[string]nextImage `json:"images"`
+	Aliases map[string]string    `json:"aliases,omitempty"`
+}
+
+type nextImage struct {
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	BlurDataURL string    `json:"blurDataURL"`
+	Srcs        []nextSrc `json:"srcs"` // ascending width, one format
+}
+
+type nextSrc struct {
+	Width int    `json:"width"`
+	Src   string `json:"src"` // base_path + path
+}
+
+// writeNextJS writes tgimg.next.json and tgimg-loader.js for m into outDir.
+func writeNextJS(m *manifest.Manifest, outDir string) error {
+	if m.BasePath != "" && !strings.HasPrefix(m.BasePath, "/") && !strings.Contains(m.BasePath, "://") {
+		logging.Warnf("--emit-nextjs: base_path %q is relative; next/image needs URLs like /tgimg/ (set --base-path or --base-url)", m.BasePath)
+	}
+	nm, err := newNextMap(m)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(nm, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(outDir, nextMapName), append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outDir, nextLoaderName), []byte(nextLoaderJS), 0o644)
+}
+
+func newNextMap(m *manifest.Manifest) (*nextMap, error) {
+	nm := &nextMap{Images: make(map[string]nextImage, len(m.Assets)), Aliases: m.Aliases}
+	for key, a := range m.Assets {
+		srcs := nextSrcs(a, m.BasePath)
+		if len(srcs) == 0 {
+			continue
+		}
+		blur := a.Placeholder
+		if blur == "" {
+			hash, err := base64.StdEncoding.DecodeString(a.ThumbHash)
+			if err != nil {
+				return nil, fmt.Errorf("%s: thumbhash: %w", key, err)
+			}
+			if blur, err = thumbhash.DataURI(hash, 0); err != nil {
+				return nil, fmt.Errorf("%s: thumbhash: %w", key, err)
+			}
+		}
+		nm.Images[key] = nextImage{
+			Width:       a.Original.Width,
+			Height:      a.Original.Height,
+			BlurDataURL: blur,
+			Srcs:        srcs,
+		}
+	}
+	return nm, nil
+}
+
+// nextSrcs lists the responsive variants of a's first format in
+// nextFormats, one per width.
+func nextSrcs(a manifest.Asset, basePath string) []nextSrc {
+	for _, format := range nextFormats {
+		var srcs []nextSrc
+		for _, v := range a.Variants {
+			if v.Format == format && v.Responsive() {
+				srcs = append(srcs, nextSrc{Width: v.Width, Src: basePath + v.Path})
+			}
+		}
+		if len(srcs) == 0 {
+			continue
+		}
+		sort.SliceStable(srcs, func(i, j int) bool { return srcs[i].Width < srcs[j].Width })
+		out := srcs[:1]
+		for _, s := range srcs[1:] {
+			if s.Width != out[len(out)-1].Width {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// nextLoaderJS is tgimg-loader.js, a next/image loaderFile.
+const nextLoaderJS = `// Generated by "tgimg build --emit-nextjs". Do not edit.
+//
+// next.config.js:
+//   images: { loader: 'custom', loaderFile: './tgimg_out/tgimg-loader.js' }
+//
+// Then pass asset keys (or aliases) as src:
+//   import { tgimgImage } from './tgimg_out/tgimg-loader.js';
+//   <Image {...tgimgImage('promo/banner')} alt="Promo" sizes="100vw" />
+import map from './tgimg.next.json';
+
+function lookup(key) {
+  return map.images[key] ?? map.images[map.aliases?.[key]];
+}
+
+// The smallest variant at least width wide, else the largest. Keys that
+// are not tgimg assets pass through unchanged.
+export default function tgimgLoader({ src, width }) {
+  const image = lookup(src);
+  if (!image) return src;
+  const found = image.srcs.find((s) => s.width >= width);
+  return (found ?? image.srcs[image.srcs.length - 1]).src;
+}
+
+// Props for next/image: src, intrinsic size and the thumbhash blur.
+export function tgimgImage(key) {
+  const image = lookup(key);
+  if (!image) throw new Error('tgimg: unknown image "' + key + '"');
+  return {
+    src: key,
+    width: image.width,
+    height: image.height,
+    placeholder: 'blur',
+    blurDataURL: image.blurDataURL,
+  };
+}
+`
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"syscall"
+
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+)
+
+// Runtime profiling for diagnosing slow builds on user machines, e.g.
+//
+//	tgimg build ./images --cpuprofile cpu.out --memprofile mem.out
+//	go tool pprof -http :8080 cpu.out
+var (
+	cpuProfilePath string
+	memProfilePath string
+	tracePath      string
+
+	cpuProfileFile *os.File
+	traceFile      *os.File
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&cpuProfilePath, "cpuprofile", "", "write a pprof CPU profile of the command to this file")
+	rootCmd.PersistentFlags().StringVar(&memProfilePath, "memprofile", "", "write a pprof heap profile to this file when the command finishes")
+	rootCmd.PersistentFlags().StringVar(&tracePath, "trace", "", "write a runtime execution trace to this file (view with go tool trace)")
+}
+
+// startProfiling starts the CPU profile and execution trace requested on
+// the command line. stopProfiling must be called once the command ends.
+func startProfiling() error {
+	if cpuProfilePath != "" {
+		f, err := os.Create(cpuProfilePath)
+		if err != nil {
+			return fmt.Errorf("cpuprofile: %w", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return fmt.Errorf("cpuprofile: %w", err)
+		}
+		cpuProfileFile = f
+	}
+	if tracePath != "" {
+		f, err := os.Create(tracePath)
+		if err != nil {
+			return fmt.Errorf("trace: %w", err)
+		}
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			return fmt.Errorf("trace: %w", err)
+		}
+		traceFile = f
+	}
+	if cpuProfileFile != nil || traceFile != nil || memProfilePath != "" {
+		flushOnInterrupt()
+	}
+	return nil
+}
+
+// flushOnInterrupt writes the profiles before exiting on Ctrl-C, so
+// long-running commands like serve can be profiled too.
+func flushOnInterrupt() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		if err := stopProfiling(); err != nil {
+			logging.Errorf("%v", err)
+		}
+		os.Exit(130)
+	}()
+}
+
+// stopProfiling flushes the running profiles and writes the heap profile.
+// It runs after the command even when the command failed.
+func stopProfiling() error {
+	var errs []error
+	if cpuProfileFile != nil {
+		pprof.StopCPUProfile()
+		errs = append(errs, cpuProfileFile.Close())
+		logging.Infof("CPU profile written to %s", cpuProfilePath)
+		cpuProfileFile = nil
+	}
+	if traceFile != nil {
+		trace.Stop()
+		errs = append(errs, traceFile.Close())
+		logging.Infof("execution trace written to %s", tracePath)
+		traceFile = nil
+	}
+	if memProfilePath != "" {
+		errs = append(errs, writeHeapProfile(memProfilePath))
+	}
+	return errors.Join(errs...)
+}
+
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("memprofile: %w", err)
+	}
+	defer f.Close()
+	runtime.GC() // up-to-date statistics of live objects
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		return fmt.Errorf("memprofile: %w", err)
+	}
+	logging.Infof("heap profile written to %s", path)
+	return nil
+}
@@ -0,0 +1,513 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AnyUserName/tgimg-cli/internal/encoder"
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var profilesJSON bool
+
+var profilesCmd = &cobra.Command{
+	Use:   "profiles",
+	Short: "List built-in and config-defined processing profiles",
+	Long: `Lists every processing profile with its widths, formats and quality:
+the built-in ones and those defined under "profiles" in the config file.
+Config profiles with "extends" are shown with their base merged in.`,
+	Args: cobra.NoArgs,
+	RunE: runProfilesList,
+}
+
+var profilesListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List built-in and config-defined processing profiles",
+	Args:    cobra.NoArgs,
+	RunE:    runProfilesList,
+}
+
+func init() {
+	profilesCmd.PersistentFlags().BoolVar(&profilesJSON, "json", false, "print profiles as JSON")
+	profilesCmd.AddCommand(profilesListCmd)
+	rootCmd.AddCommand(profilesCmd)
+}
+
+// profileInfo is one profile as printed by `tgimg profiles`.
+type profileInfo struct {
+	Name        string         `json:"name"`
+	Source      string         `json:"source"`            // "built-in" or "config"
+	Extends     string         `json:"extends,omitempty"` // base of a config profile
+	Widths      []int          `json:"widths"`
+	Formats     []string       `json:"formats"`
+	Quality     int            `json:"quality"`
+	Effort      string         `json:"effort"`
+	DPRs        []float64      `json:"dprs"`
+	Descriptor  string         `json:"descriptor"`
+	Heights     []int          `json:"heights,omitempty"`
+	Crops       []string       `json:"crops,omitempty"`
+	Gravity     string         `json:"gravity,omitempty"`
+	Margin      float64        `json:"margin,omitempty"`
+	MinWidth    int            `json:"min_width,omitempty"`
+	FormatMin   map[string]int `json:"format_min_widths,omitempty"`
+	Breakpoints map[string]int `json:"breakpoints,omitempty"` // name → width
+	MaxSide     int            `json:"max_side,omitempty"`    // hard limits, see profile.Limits
+	ExactSide   bool           `json:"exact_side,omitempty"`
+	MaxBytes    int64          `json:"max_bytes,omitempty"`
+}
+
+func describeProfile(p profile.Profile) profileInfo {
+	source, extends := "built-in", ""
+	if projectConfig != nil {
+		if cp, ok := projectConfig.Profiles[p.Name]; ok {
+			source, extends = "config", cp.Extends
+		}
+	}
+	descriptor := p.Descriptor
+	if descriptor == "" {
+		descriptor = profile.DescriptorWidth
+	}
+	var crops []string
+	for _, b := range p.Crops {
+		crops = append(crops, b.String())
+	}
+	return profileInfo{
+		Name:        p.Name,
+		Source:      source,
+		Extends:     extends,
+		Widths:      p.Widths,
+		Formats:     p.Formats,
+		Quality:     encoder.EffectiveQuality(p.Quality),
+		Effort:      string(encoder.EffectiveEffort(p.Effort)),
+		DPRs:        p.EffectiveDPRs(),
+		Descriptor:  descriptor,
+		Heights:     p.Heights,
+		Crops:       crops,
+		Gravity:     p.Gravity,
+		Margin:      p.Margin,
+		MinWidth:    p.MinWidth,
+		FormatMin:   p.FormatMinWidths,
+		Breakpoints: p.Breakpoints,
+		MaxSide:     p.Limits.MaxSide,
+		ExactSide:   p.Limits.ExactSide,
+		MaxBytes:    p.Limits.MaxBytes,
+	}
+}
+
+func runProfilesList(_ *cobra.Command, _ []string) error {
+	var infos []profileInfo
+	for _, name := range profile.Names() {
+		p, _ := profile.Lookup(name)
+		infos = append(infos, describeProfile(p))
+	}
+
+	if profilesJSON {
+		data, err := json.MarshalIndent(infos, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Println()
+	fmt.Printf("  %-22s %-9s %-26s %-18s %3s  %s\n", "PROFILE", "SOURCE", "WIDTHS", "FORMATS", "Q", "OPTIONS")
+	for _, p := range infos {
+		var opts []string
+		if p.Extends != "" {
+			opts = append(opts, "extends "+p.Extends)
+		}
+		if len(p.DPRs) > 1 || p.DPRs[0] != 1 {
+			opts = append(opts, "DPR "+joinFloats(p.DPRs))
+		}
+		if p.Descriptor == profile.DescriptorDensity {
+			opts = append(opts, "x descriptors")
+		}
+		if len(p.Heights) > 0 {
+			opts = append(opts, "heights "+joinInts(p.Heights))
+		}
+		if len(p.Crops) > 0 {
+			opts = append(opts, "crops "+strings.Join(p.Crops, ","))
+		}
+		if p.MinWidth > 0 {
+			opts = append(opts, fmt.Sprintf("min width %d", p.MinWidth))
+		}
+		for _, f := range profile.Formats {
+			if w := p.FormatMin[f]; w > 0 {
+				opts = append(opts, fmt.Sprintf("%s ≥ %d px", f, w))
+			}
+		}
+		if p.Margin > 0 {
+			opts = append(opts, fmt.Sprintf("margin %g", p.Margin))
+		}
+		if p.Effort != string(encoder.EffortBalanced) {
+			opts = append(opts, p.Effort+" effort")
+		}
+		if p.ExactSide {
+			opts = append(opts, fmt.Sprintf("side = %d px", p.MaxSide))
+		} else if p.MaxSide > 0 {
+			opts = append(opts, fmt.Sprintf("side ≤ %d px", p.MaxSide))
+		}
+		if p.MaxBytes > 0 {
+			opts = append(opts, "≤ "+formatBytes(p.MaxBytes))
+		}
+		line := fmt.Sprintf("  %-22s %-9s %-26s %-18s %3d  %s",
+			p.Name, p.Source, joinInts(p.Widths), strings.Join(p.Formats, ","), p.Quality, strings.Join(opts, ", "))
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+	fmt.Println()
+	fmt.Println("  Formats are tried in order; ones without an installed encoder are skipped.")
+	fmt.Println()
+	return nil
+}
+
+func joinInts(xs []int) string {
+	parts := make([]string, len(xs))
+	for i, x := range xs {
+		parts[i] = strconv.Itoa(x)
+	}
+	return strings.Join(parts, ",")
+}
+
+func joinFloats(xs []float64) string {
+	parts := make([]string, len(xs))
+	for i, x := range xs {
+		parts[i] = strconv.FormatFloat(x, 'g', -1, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
+// formatBreakpoints prints breakpoints by width: "sm 320, md 640".
+func formatBreakpoints(breakpoints map[string]int) string {
+	var parts []string
+	for _, name := range profile.BreakpointNames(breakpoints) {
+		parts = append(parts, fmt.Sprintf("%s %d", name, breakpoints[name]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+var (
+	profilesFor   string
+	profilesAlpha bool
+)
+
+var profilesShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "Show a profile and the variants it generates for a source size",
+	Long: `Shows a profile's settings. With --for WxH, also lists the exact variants
+(widths × formats) a build would generate for a source of that size,
+taking upscaling limits, high-DPR widths and installed encoders into account.`,
+	Example: "  tgimg profiles show telegram-webview-hq --for 1600x900",
+	Args:    cobra.ExactArgs(1),
+	RunE:    runProfilesShow,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return completeProfiles(cmd, args, toComplete)
+	},
+}
+
+func init() {
+	profilesShowCmd.Flags().StringVar(&profilesFor, "for", "", "source size WxH to plan variants for (e.g. 1600x900)")
+	profilesShowCmd.Flags().BoolVar(&profilesAlpha, "alpha", false, "plan for a source with transparency")
+	profilesCmd.AddCommand(profilesShowCmd)
+}
+
+// profilePlan is the output of `tgimg profiles show`.
+type profilePlan struct {
+	profileInfo
+	For         *planSource      `json:"for,omitempty"`
+	Variants    []plannedVariant `json:"variants,omitempty"`
+	Skipped     []int            `json:"skipped_widths,omitempty"`      // larger than the source
+	Unavailable []string         `json:"unavailable_formats,omitempty"` // no encoder installed
+}
+
+type planSource struct {
+	Width    int  `json:"width"`
+	Height   int  `json:"height"`
+	HasAlpha bool `json:"has_alpha"`
+}
+
+type plannedVariant struct {
+	Width      int      `json:"width"`
+	Height     int      `json:"height"`
+	Density    float64  `json:"density,omitempty"`
+	Crop       string   `json:"crop,omitempty"` // profile box of a crop variant
+	Breakpoint string   `json:"breakpoint,omitempty"`
+	Formats    []string `json:"formats"`
+}
+
+func runProfilesShow(_ *cobra.Command, args []string) error {
+	p, ok := profile.Lookup(args[0])
+	if !ok {
+		return fmt.Errorf("unknown profile %q (see \"tgimg profiles\")", args[0])
+	}
+	plan := profilePlan{profileInfo: describeProfile(p)}
+
+	if profilesFor != "" {
+		w, h, err := parseSize(profilesFor)
+		if err != nil {
+			return fmt.Errorf("invalid --for: %w", err)
+		}
+		plan.For = &planSource{Width: w, Height: h, HasAlpha: profilesAlpha}
+
+		registry := encoder.NewRegistry()
+		formats := registry.ResolveFormats(p.Formats, profilesAlpha)
+		for _, f := range p.Formats {
+			if registry.Get(f) == nil {
+				plan.Unavailable = append(plan.Unavailable, f)
+			}
+		}
+		for _, vw := range p.EffectiveWidths(w, h) {
+			plan.Variants = append(plan.Variants, plannedVariant{
+				Width:      vw,
+				Height:     p.Height(w, h, vw),
+				Density:    p.Density(vw),
+				Breakpoint: p.Breakpoint(vw),
+				Formats:    p.FormatsFor(formats, vw),
+			})
+		}
+		sort.Slice(plan.Variants, func(i, j int) bool { return plan.Variants[i].Width < plan.Variants[j].Width })
+		for _, t := range p.CropTargets(w, h) {
+			plan.Variants = append(plan.Variants, plannedVariant{
+				Width:   t.Width,
+				Height:  t.Height,
+				Density: t.DPR,
+				Crop:    t.Box.String(),
+				Formats: p.FormatsFor(formats, t.Width),
+			})
+		}
+		for _, pw := range p.Widths {
+			if pw > w {
+				plan.Skipped = append(plan.Skipped, pw)
+			}
+		}
+	}
+
+	if profilesJSON {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	printProfilePlan(plan)
+	return nil
+}
+
+func printProfilePlan(plan profilePlan) {
+	fmt.Println()
+	fmt.Printf("  Profile:     %s (%s)\n", plan.Name, plan.Source)
+	widths := joinInts(plan.Widths)
+	if widths == "" {
+		widths = "none"
+	}
+	fmt.Printf("  Widths:      %s\n", widths)
+	fmt.Printf("  Formats:     %s\n", strings.Join(plan.Formats, ", "))
+	fmt.Printf("  Quality:     %d\n", plan.Quality)
+	fmt.Printf("  Effort:      %s\n", plan.Effort)
+	fmt.Printf("  DPRs:        %s\n", joinFloats(plan.DPRs))
+	fmt.Printf("  Descriptor:  %s\n", plan.Descriptor)
+	if len(plan.Breakpoints) > 0 {
+		fmt.Printf("  Breakpoints: %s\n", formatBreakpoints(plan.Breakpoints))
+	}
+	if len(plan.Heights) > 0 {
+		fmt.Printf("  Heights:     %s\n", joinInts(plan.Heights))
+	}
+	if len(plan.Crops) > 0 {
+		gravity := plan.Gravity
+		if gravity == "" {
+			gravity = "center"
+		}
+		fmt.Printf("  Crops:       %s (gravity %s)\n", strings.Join(plan.Crops, ", "), gravity)
+	}
+	fmt.Println()
+	if plan.For == nil {
+		fmt.Println("  Pass --for WxH to list the variants generated for a source size.")
+		fmt.Println()
+		return
+	}
+
+	src := plan.For
+	total := 0
+	for _, v := range plan.Variants {
+		total += len(v.Formats)
+	}
+	alpha := ""
+	if src.HasAlpha {
+		alpha = " with alpha"
+	}
+	fmt.Printf("  For a %d×%d source%s: %d variants\n", src.Width, src.Height, alpha, total)
+	for _, v := range plan.Variants {
+		density := ""
+		if v.Density > 0 {
+			density = fmt.Sprintf("  %gx", v.Density)
+		}
+		label := ""
+		if v.Breakpoint != "" {
+			label = "  " + v.Breakpoint
+		}
+		if v.Crop != "" {
+			label = "  crop " + v.Crop
+		}
+		fmt.Printf("    %5d × %-5d %s%s%s\n", v.Width, v.Height, strings.Join(v.Formats, ", "), density, label)
+	}
+	if len(plan.Skipped) > 0 {
+		fmt.Printf("  Skipped widths (no upscaling): %s\n", joinInts(plan.Skipped))
+	}
+	if len(plan.Unavailable) > 0 {
+		fmt.Printf("  Not installed, skipped: %s\n", strings.Join(plan.Unavailable, ", "))
+	}
+	fmt.Println()
+}
+
+// parseSize parses "WxH" (also "W×H").
+func parseSize(s string) (int, int, error) {
+	ws, hs, ok := strings.Cut(strings.ReplaceAll(strings.ToLower(s), "×", "x"), "x")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q: want WxH", s)
+	}
+	w, errW := strconv.Atoi(strings.TrimSpace(ws))
+	h, errH := strconv.Atoi(strings.TrimSpace(hs))
+	if errW != nil || errH != nil || w <= 0 || h <= 0 {
+		return 0, 0, fmt.Errorf("%q: want positive WxH", s)
+	}
+	return w, h, nil
+}
+
+var profilesLintStrict bool
+
+var profilesLintCmd = &cobra.Command{
+	Use:   "lint [name...]",
+	Short: "Check profiles for mistakes and settings that explode variant counts",
+	Long: `Checks every profile, or the named ones, for errors and suspicious
+settings: duplicate or unsorted widths, repeated formats or DPRs, widths
+clamped by max width, and widths × DPRs × formats adding up to more than
+` + strconv.Itoa(profile.MaxLintVariants) + ` variants per source. Config overrides are checked as applied
+to the config's profile.
+
+Exits with code 6 if any profile has errors, or warnings with --strict.`,
+	Example: "  tgimg profiles lint\n  tgimg profiles lint cards --strict",
+	RunE:    runProfilesLint,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeProfiles(cmd, args, toComplete)
+	},
+}
+
+func init() {
+	profilesLintCmd.Flags().BoolVar(&profilesLintStrict, "strict", false, "treat warnings as errors")
+	profilesCmd.AddCommand(profilesLintCmd)
+}
+
+// profileLint is one linted profile or override in `tgimg profiles lint`.
+type profileLint struct {
+	Name   string          `json:"name"`
+	Issues []profile.Issue `json:"issues"`
+}
+
+func runProfilesLint(_ *cobra.Command, args []string) error {
+	names := args
+	if len(names) == 0 {
+		names = profile.Names()
+	}
+	var results []profileLint
+	for _, name := range names {
+		p, ok := profile.Lookup(name)
+		if !ok {
+			return withExitCode(ExitUsage, fmt.Errorf("unknown profile %q (see \"tgimg profiles\")", name))
+		}
+		results = append(results, profileLint{Name: name, Issues: p.Lint()})
+	}
+	if len(args) == 0 {
+		results = append(results, lintOverrides()...)
+	}
+
+	errs, warnings := 0, 0
+	for _, r := range results {
+		for _, issue := range r.Issues {
+			if issue.Severity == profile.LintError {
+				errs++
+			} else {
+				warnings++
+			}
+		}
+	}
+
+	if profilesJSON {
+		for i := range results {
+			if results[i].Issues == nil {
+				results[i].Issues = []profile.Issue{}
+			}
+		}
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, r := range results {
+			if len(r.Issues) == 0 {
+				fmt.Printf("  ✓ %s\n", r.Name)
+				continue
+			}
+			fmt.Printf("  ✗ %s\n", r.Name)
+			for _, issue := range r.Issues {
+				fmt.Printf("    • %s: %s\n", issue.Severity, issue.Message)
+			}
+		}
+	}
+
+	if errs > 0 || profilesLintStrict && warnings > 0 {
+		return withExitCode(ExitValidation, fmt.Errorf("profile lint found %d error(s), %d warning(s)", errs, warnings))
+	}
+	return nil
+}
+
+// lintOverrides lints each config override applied to the config's
+// profile on its own, reporting only the issues the override adds. Sources matching several patterns get them merged,
+// which this does not cover.
+func lintOverrides() []profileLint {
+	overrides := configOverrides()
+	if len(overrides) == 0 {
+		return nil
+	}
+	name := projectConfig.Profile
+	if name == "" {
+		name = "telegram-webview"
+	}
+	base := profile.Get(name)
+	var results []profileLint
+	for _, o := range overrides {
+		label := fmt.Sprintf("override %q", o.Pattern)
+		merged, err := o.Apply(base)
+		if err != nil {
+			results = append(results, profileLint{Name: label, Issues: []profile.Issue{{Severity: profile.LintError, Message: err.Error()}}})
+			continue
+		}
+		results = append(results, profileLint{Name: label, Issues: overrideIssues(base, merged)})
+	}
+	return results
+}
+
+// overrideIssues returns the lint issues of an override merged onto base
+// that base does not have itself.
+func overrideIssues(base, merged profile.Profile) []profile.Issue {
+	inherited := map[profile.Issue]bool{}
+	for _, issue := range base.Lint() {
+		inherited[issue] = true
+	}
+	var issues []profile.Issue
+	for _, issue := range merged.Lint() {
+		if !inherited[issue] {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/AnyUserName/tgimg-cli/internal/telegram"
+	"github.com/spf13/cobra"
+)
+
+// telegramCacheFile maps uploaded content to file_ids so rebuilt
+// manifests reuse earlier uploads of identical variants.
+const telegramCacheFile = "tgimg.telegram.json"
+
+var (
+	publishToken    string
+	publishChatID   string
+	publishAPIURL   string
+	publishFormats  []string
+	publishWidths   []int
+	publishKeys     []string
+	publishAsPhoto  bool
+	publishInterval time.Duration
+	publishForce    bool
+	publishDryRun   bool
+)
+
+var publishTelegramCmd = &cobra.Command{
+	Use:   "publish-telegram [out_dir]",
+	Short: "Upload variants through the Telegram Bot API and record file_ids",
+	Long: `Uploads selected variants to a chat the bot can post to (typically a
+private channel used as storage) and records each returned file_id in
+the manifest under "telegram". Telegram then serves the files from its
+own CDN.
+
+Variants are sent with sendDocument, which keeps them byte-identical.
+--as-photo uses sendPhoto instead; Telegram re-encodes photos to JPEG,
+so only use it when the exact bytes do not matter.
+
+A file_id is bound to the bot. Downloading it requires getFile with the
+bot token, so mini apps must resolve file_ids through their own backend,
+never by shipping the token to the client.
+
+Uploaded content is remembered in tgimg.telegram.json next to the
+manifest, so publishing after a rebuild only sends changed variants.`,
+	Args: cobra.RangeArgs(0, 1),
+	RunE: runPublishTelegram,
+}
+
+func init() {
+	publishTelegramCmd.Flags().StringVar(&publishToken, "token", "", "bot token (or TGIMG_TOKEN)")
+	publishTelegramCmd.Flags().StringVar(&publishChatID, "chat-id", "", "chat or channel to upload into, e.g. -1001234567890 or @storage_channel")
+	publishTelegramCmd.Flags().StringVar(&publishAPIURL, "api-url", telegram.DefaultAPIURL, "Bot API server URL")
+	publishTelegramCmd.Flags().StringSliceVar(&publishFormats, "formats", nil, "only publish these formats (default all)")
+	publishTelegramCmd.RegisterFlagCompletionFunc("formats", completeFormats)
+	publishTelegramCmd.Flags().IntSliceVar(&publishWidths, "widths", nil, "only publish these widths (default all)")
+	publishTelegramCmd.Flags().StringSliceVar(&publishKeys, "keys", nil, "only publish assets matching these glob patterns")
+	publishTelegramCmd.Flags().BoolVar(&publishAsPhoto, "as-photo", false, "upload with sendPhoto (re-encoded by Telegram) instead of sendDocument")
+	publishTelegramCmd.Flags().DurationVar(&publishInterval, "interval", time.Second, "pause between uploads to stay under flood limits")
+	publishTelegramCmd.Flags().BoolVar(&publishForce, "force", false, "re-upload variants that already have a file_id")
+	publishTelegramCmd.Flags().BoolVar(&publishDryRun, "dry-run", false, "list the variants that would be uploaded")
+	publishTelegramCmd.MarkFlagRequired("token")
+	publishTelegramCmd.MarkFlagRequired("chat-id")
+	rootCmd.AddCommand(publishTelegramCmd)
+}
+
+// publishSelected reports whether a variant matches the selection flags.
+func publishSelected(key string, v manifest.Variant) bool {
+	if v.Original {
+		return false
+	}
+	if len(publishFormats) > 0 && !containsString(publishFormats, v.Format) {
+		return false
+	}
+	if len(publishWidths) > 0 {
+		found := false
+		for _, w := range publishWidths {
+			found = found || w == v.Width
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(publishKeys) > 0 {
+		for _, p := range publishKeys {
+			if ok, _ := path.Match(p, key); ok {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func runPublishTelegram(cmd *cobra.Command, args []string) error {
+	dir, err := outputDirArg(args)
+	if err != nil {
+		return err
+	}
+	manifestPath, err := resolveManifestPath(dir)
+	if err != nil {
+		return err
+	}
+	m, err := loadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	baseDir := filepath.Dir(manifestPath)
+
+	kind := "document"
+	if publishAsPhoto {
+		kind = "photo"
+	}
+	botID, _, _ := strings.Cut(publishToken, ":")
+	cachePath := filepath.Join(baseDir, telegramCacheFile)
+	cache := map[string]manifest.TelegramFile{}
+	if data, err := os.ReadFile(cachePath); err == nil {
+		if err := json.Unmarshal(data, &cache); err != nil {
+			return fmt.Errorf("parse %s: %w", telegramCacheFile, err)
+		}
+	}
+	cacheKey := func(v manifest.Variant) string {
+		return botID + "/" + kind + "/" + v.Hash
+	}
+
+	bot := &telegram.Bot{Token: publishToken, APIURL: publishAPIURL, MaxRetries: 5}
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var uploaded, reused, kept int
+	var lastUpload time.Time
+	publish := func(key string, variants []manifest.Variant) error {
+		for i := range variants {
+			v := &variants[i]
+			if !publishSelected(key, *v) || v.Remote() {
+				continue
+			}
+			if v.Telegram != nil && v.Telegram.Kind == kind && !publishForce {
+				kept++
+				continue
+			}
+			if f, ok := cache[cacheKey(*v)]; ok && !publishForce {
+				v.Telegram = &f
+				reused++
+				continue
+			}
+			if publishDryRun {
+				fmt.Printf("    would upload %s (%s)\n", v.Path, formatBytes(v.Size))
+				uploaded++
+				continue
+			}
+
+			data, err := os.ReadFile(filepath.Join(baseDir, filepath.FromSlash(v.Path)))
+			if err != nil {
+				return err
+			}
+			if wait := publishInterval - time.Since(lastUpload); wait > 0 {
+				time.Sleep(wait)
+			}
+			var f *telegram.File
+			if publishAsPhoto {
+				f, err = bot.SendPhoto(ctx, publishChatID, path.Base(v.Path), data)
+			} else {
+				f, err = bot.SendDocument(ctx, publishChatID, path.Base(v.Path), data)
+			}
+			lastUpload = time.Now()
+			if err != nil {
+				return fmt.Errorf("%s: %w", v.Path, err)
+			}
+			tf := manifest.TelegramFile{FileID: f.FileID, FileUniqueID: f.FileUniqueID, Kind: kind}
+			v.Telegram = &tf
+			cache[cacheKey(*v)] = tf
+			uploaded++
+			logging.Debugf("uploaded %s → %s", v.Path, f.FileUniqueID)
+		}
+		return nil
+	}
+
+	keys := make([]string, 0, len(m.Assets))
+	for k := range m.Assets {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var publishErr error
+	for _, k := range keys {
+		a := m.Assets[k]
+		if publishErr = publish(k, a.Variants); publishErr != nil {
+			break
+		}
+		for _, theme := range sortedThemes(a) {
+			t := a.Themes[theme]
+			if publishErr = publish(k, t.Variants); publishErr != nil {
+				break
+			}
+		}
+		if publishErr != nil {
+			break
+		}
+	}
+
+	if publishDryRun {
+		fmt.Printf("  Would upload %d variants (%d reusable from cache, %d already published)\n", uploaded, reused, kept)
+		return publishErr
+	}
+
+	// Save progress even when an upload failed, so a re-run resumes.
+	if uploaded+reused > 0 {
+		data, err := manifest.Marshal(m, manifest.WriteOptions{})
+		if err != nil {
+			return err
+		}
+		if err := manifest.WriteFile(manifestPath, data); err != nil {
+			return fmt.Errorf("write manifest: %w", err)
+		}
+		cacheData, err := json.MarshalIndent(cache, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(cachePath, append(cacheData, '\n'), 0o644); err != nil {
+			return fmt.Errorf("write %s: %w", telegramCacheFile, err)
+		}
+	}
+
+	var apiErr *telegram.APIError
+	if errors.As(publishErr, &apiErr) && apiErr.Code == 400 && strings.Contains(apiErr.Description, "chat not found") {
+		return fmt.Errorf("%w (add the bot to the chat and use its numeric id or @username)", publishErr)
+	}
+	if publishErr != nil {
+		return fmt.Errorf("publish: %w (%d uploaded before the error were saved)", publishErr, uploaded)
+	}
+	if !quiet {
+		fmt.Printf("  ✓ Published %d variants to Telegram (%d reused, %d already published)\n", uploaded, reused, kept)
+	}
+	return nil
+}
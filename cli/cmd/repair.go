@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/AnyUserName/tgimg-cli/internal/hasher"
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/AnyUserName/tgimg-cli/internal/pipeline"
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+)
+
+// repairResult summarizes `tgimg validate --fix`.
+type repairResult struct {
+	Restored  []string // re-encoded byte-identical to the manifest
+	Rewritten []string // re-encoded to different bytes; manifest entry updated
+	Failed    []string // could not be repaired, with the reason
+}
+
+// changed reports whether the manifest was modified and must be rewritten.
+func (r repairResult) changed() bool { return len(r.Rewritten) > 0 }
+
+// repairVariants regenerates every variant under baseDir that is missing or
+// whose size differs from the manifest, from the sources in inputDir.
+//
+// A repaired file keeps its path when the re-encode reproduces the recorded
+// hash. Otherwise (e.g. a different encoder version) it is written under a
+// new content-addressed name and the variant in m is updated to match.
+// Assets whose source changed since the build are not repaired: that is a
+// job for "tgimg build".
+func repairVariants(m *manifest.Manifest, baseDir, inputDir string) (repairResult, error) {
+	var r repairResult
+
+	sources, err := pipeline.Dir(inputDir).Without(baseDir).Scan(m.Config.Ignore)
+	if err != nil {
+		return r, fmt.Errorf("scan input: %w", err)
+	}
+	pipeline.NormalizeKeys(sources, manifestUnicodeKeys(m))
+	bySource := make(map[string]pipeline.Source, len(sources))
+	for _, s := range sources {
+		bySource[s.Key+"@"+s.Theme] = s
+	}
+
+	// One pipeline per quality: Render encodes at the profile's quality.
+	renderers := map[int]*pipeline.Pipeline{}
+	render := func(pv pipeline.PlannedVariant, quality int) ([]byte, error) {
+		p, ok := renderers[quality]
+		if !ok {
+			p = pipeline.New(pipeline.Config{Profile: profile.Profile{Quality: quality}, Workers: 1})
+			renderers[quality] = p
+		}
+		return p.Render(pv)
+	}
+
+	repair := func(key, theme string, orig manifest.OriginalInfo, variants []manifest.Variant) {
+		label := key
+		if theme != "" {
+			label += "@" + theme
+		}
+		for i := range variants {
+			v := &variants[i]
+			if v.Path == "" || v.Hash == "" || v.Remote() || !damaged(filepath.Join(baseDir, v.Path), v.Size) {
+				continue
+			}
+			name := fmt.Sprintf("%s %s", label, v.Path)
+
+			src, ok := bySource[key+"@"+theme]
+			if !ok {
+				r.Failed = append(r.Failed, name+": source not found in "+inputDir)
+				continue
+			}
+			if src.Size != orig.Size {
+				r.Failed = append(r.Failed, name+": source changed since the build (run tgimg build)")
+				continue
+			}
+
+			var data []byte
+			if v.Original {
+				data, err = os.ReadFile(src.AbsPath)
+			} else {
+				quality := v.Quality
+				if quality == 0 {
+					quality = m.Config.Quality
+				}
+				pv := pipeline.PlannedVariant{Source: src, Width: v.Width, Height: v.Height, Format: v.Format}
+				if v.Crop != nil {
+					pv.Crop = v.Crop.Rect()
+					pv.Margin = v.Crop.Margin
+				}
+				data, err = render(pv, quality)
+			}
+			if err != nil {
+				r.Failed = append(r.Failed, fmt.Sprintf("%s: %v", name, err))
+				continue
+			}
+
+			path := v.Path
+			hash := hasher.ContentHash(data, len(v.Hash))
+			if hash != v.Hash {
+				path = rehashPath(v.Path, v.Hash, hash)
+			}
+			if err := writeFileAtomic(filepath.Join(baseDir, path), data); err != nil {
+				r.Failed = append(r.Failed, fmt.Sprintf("%s: %v", name, err))
+				continue
+			}
+			if path == v.Path {
+				r.Restored = append(r.Restored, name)
+				continue
+			}
+			os.Remove(filepath.Join(baseDir, v.Path)) // the damaged file, if any
+			v.Path, v.Hash, v.Size = path, hash, int64(len(data))
+			r.Rewritten = append(r.Rewritten, fmt.Sprintf("%s → %s", name, path))
+		}
+	}
+
+	keys := make([]string, 0, len(m.Assets))
+	for k := range m.Assets {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		a := m.Assets[key]
+		repair(key, "", a.Original, a.Variants)
+		for theme, t := range a.Themes {
+			repair(key, theme, t.Original, t.Variants)
+		}
+	}
+	return r, nil
+}
+
+// damaged reports whether the file at path is missing or not want bytes
+// long (want 0 means the size is unknown and only existence is checked).
+func damaged(path string, want int64) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	return want > 0 && info.Size() != want
+}
+
+// rehashPath swaps the hash segment of a content-addressed variant path
+// (stem.w.h.<hash>.ext) for newHash, keeping its length.
+func rehashPath(path, oldHash, newHash string) string {
+	dir, base := filepath.Split(filepath.FromSlash(path))
+	n := len(oldHash)
+	if n > 8 {
+		n = 8
+	}
+	if i := strings.LastIndex(base, "."+oldHash[:n]+"."); i >= 0 {
+		base = base[:i+1] + newHash[:n] + base[i+1+n:]
+	} else {
+		ext := filepath.Ext(base)
+		base = strings.TrimSuffix(base, ext) + "." + newHash[:n] + ext
+	}
+	return filepath.ToSlash(filepath.Join(dir, base))
+}
+
+// writeFileAtomic writes data to path through a temp file in the same
+// directory, so a crash never leaves a truncated variant behind.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/AnyUserName/tgimg-cli/internal/pipeline"
+)
+
+// buildReportName is the --report-json file written into the output
+// directory when no path is given.
+const buildReportName = "build-report.json"
+
+// buildReport is the machine-readable summary of one `tgimg build`, kept
+// out of the manifest so tooling never has to parse stdout.
+type buildReport struct {
+	ReportVersion int                         `json:"report_version"`
+	ToolVersion   string                      `json:"tool_version"`
+	GeneratedAt   string                      `json:"generated_at"`
+	InputDir      string                      `json:"input_dir"`
+	OutputDir     string                      `json:"output_dir"`
+	Manifest      string                      `json:"manifest"`
+	ManifestBytes int64                       `json:"manifest_bytes"`
+	DurationMS    int64                       `json:"duration_ms"`
+	Stages        *manifest.StageTimings      `json:"stages,omitempty"`
+	Config        *manifest.BuildConfig       `json:"config,omitempty"`
+	Totals        buildReportTotals           `json:"totals"`
+	Formats       []formatStat                `json:"formats"`
+	Assets        []buildReportAsset          `json:"assets"`
+	Skipped       []pipeline.SkippedVariant   `json:"skipped"`
+	Unreadable    []pipeline.UnreadableSource `json:"unreadable"`
+	Errors        []*pipeline.AssetError      `json:"errors"`
+}
+
+type buildReportTotals struct {
+	Assets         int     `json:"assets"`
+	Variants       int     `json:"variants"`
+	Skipped        int     `json:"skipped"`
+	Unreadable     int     `json:"unreadable"`
+	Errors         int     `json:"errors"`
+	InputBytes     int64   `json:"input_bytes"`
+	OutputBytes    int64   `json:"output_bytes"`
+	ServedBytes    int64   `json:"served_bytes"`
+	SavedBytes     int64   `json:"saved_bytes"`
+	SavingsPercent float64 `json:"savings_percent"`
+}
+
+// buildReportAsset reports savings per asset. ServedBytes is the smallest
+// variant at the largest width, i.e. what a full-size display downloads
+// instead of the original.
+type buildReportAsset struct {
+	Key           string `json:"key"`
+	OriginalBytes int64  `json:"original_bytes"`
+	Variants      int    `json:"variants"`
+	OutputBytes   int64  `json:"output_bytes"`
+	ServedBytes   int64  `json:"served_bytes"`
+	SavedBytes    int64  `json:"saved_bytes"`
+}
+
+func newBuildReport(m *manifest.Manifest, rep pipeline.Report, inputDir, outputDir, manifestPath string, manifestBytes int64, elapsed time.Duration) *buildReport {
+	r := &buildReport{
+		ReportVersion: 1,
+		ToolVersion:   version,
+		GeneratedAt:   m.GeneratedAt,
+		InputDir:      inputDir,
+		OutputDir:     outputDir,
+		Manifest:      manifestPath,
+		ManifestBytes: manifestBytes,
+		DurationMS:    elapsed.Milliseconds(),
+		Config:        m.Config,
+		Formats:       buildStatsReport(m).Formats,
+		Assets:        []buildReportAsset{},
+		Skipped:       rep.Skipped,
+		Unreadable:    rep.Unreadable,
+		Errors:        rep.Errors,
+	}
+	if m.BuildInfo != nil {
+		r.Stages = m.BuildInfo.Stages
+	}
+
+	keys := make([]string, 0, len(m.Assets))
+	for k := range m.Assets {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	t := &r.Totals
+	for _, k := range keys {
+		a := m.Assets[k]
+		ra := buildReportAsset{Key: k, OriginalBytes: a.Original.Size}
+		maxW := 0
+		for _, v := range a.AllVariants() {
+			if v.Original {
+				continue
+			}
+			ra.Variants++
+			ra.OutputBytes += v.Size
+			if v.Crop == nil {
+				maxW = max(maxW, v.Width)
+			}
+		}
+		for _, v := range a.Variants {
+			if v.Responsive() && v.Width == maxW && (ra.ServedBytes == 0 || v.Size < ra.ServedBytes) {
+				ra.ServedBytes = v.Size
+			}
+		}
+		if ra.ServedBytes > 0 {
+			ra.SavedBytes = ra.OriginalBytes - ra.ServedBytes
+			t.InputBytes += ra.OriginalBytes
+			t.ServedBytes += ra.ServedBytes
+		}
+		t.Variants += ra.Variants
+		t.OutputBytes += ra.OutputBytes
+		r.Assets = append(r.Assets, ra)
+	}
+	t.Assets = len(m.Assets)
+	t.Skipped = len(rep.Skipped)
+	t.Unreadable = len(rep.Unreadable)
+	t.Errors = len(rep.Errors)
+	t.SavedBytes = t.InputBytes - t.ServedBytes
+	if t.InputBytes > 0 {
+		t.SavingsPercent = float64(t.SavedBytes) / float64(t.InputBytes) * 100
+	}
+	return r
+}
+
+func (r *buildReport) write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
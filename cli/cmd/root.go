@@ -1,16 +1,18 @@
 package cmd
 
 import (
-	"fmt"
-	"os"
-	"runtime"
-
+	"github.com/AnyUserName/tgimg-cli/internal/config"
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+	"github.com/AnyUserName/tgimg-cli/internal/tempfile"
 	"github.com/spf13/cobra"
 )
 
 var (
-	version = "0.1.0"
-	verbose bool
+	version  = "0.1.0"
+	verbose  bool
+	logLevel string
+	quiet    bool
+	tempDir  string
 )
 
 var rootCmd = &cobra.Command{
@@ -22,23 +24,80 @@ with instant thumbhash placeholders and zero layout shift.
 Generates optimized AVIF/WebP variants, content-addressed filenames,
 and a manifest for the @tgimg/react runtime component.`,
 	Version: version,
+	PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+		// Flags and arguments parsed; from here on errors are not usage
+		// mistakes, so don't bury them under the help text.
+		cmd.SilenceUsage = true
+
+		// Apply command-line levels first so settings resolution itself can
+		// be traced with -v, then again once env/config values are merged.
+		if err := configureLogging(); err != nil {
+			return withExitCode(ExitUsage, err)
+		}
+		if err := resolveSettings(cmd); err != nil {
+			return withExitCode(ExitUsage, err)
+		}
+		if err := configureLogging(); err != nil {
+			return withExitCode(ExitUsage, err)
+		}
+		tempfile.SetBase(tempDir)
+		return startProfiling()
+	},
 }
 
+// Execute runs the CLI. Map the returned error to the process exit code
+// with ExitCode.
 func Execute() error {
-	return rootCmd.Execute()
+	rootCmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return withExitCode(ExitUsage, err)
+	})
+	markArgErrors(rootCmd)
+	err := rootCmd.Execute()
+	if perr := stopProfiling(); perr != nil {
+		logging.Errorf("%v", perr)
+	}
+	if terr := tempfile.Cleanup(); terr != nil {
+		logging.Warnf("remove temp dir: %v", terr)
+	}
+	return err
+}
+
+// markArgErrors tags positional-argument validation errors of cmd and its
+// subcommands with ExitUsage.
+func markArgErrors(cmd *cobra.Command) {
+	if validate := cmd.Args; validate != nil {
+		cmd.Args = func(c *cobra.Command, args []string) error {
+			return withExitCode(ExitUsage, validate(c, args))
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		markArgErrors(sub)
+	}
 }
 
 func init() {
-	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
-	rootCmd.SetVersionTemplate(fmt.Sprintf(
-		"tgimg %s (%s/%s, %s)\n",
-		version, runtime.GOOS, runtime.GOARCH, runtime.Version(),
-	))
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "log level: debug, info, warn or error")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "shorthand for --log-level debug")
+	rootCmd.RegisterFlagCompletionFunc("log-level", completeValues("debug", "info", "warn", "error"))
+	rootCmd.PersistentFlags().BoolVar(&quiet, "quiet", false, "print errors only and no reports (for CI)")
+	rootCmd.PersistentFlags().StringVar(&tempDir, "temp-dir", "", "directory for temp files handed to encoders (default $TMPDIR)")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "config file: .json, .yaml/.yml or .toml (default ./"+config.FileName+" if present)")
+	rootCmd.SetVersionTemplate(versionLine() + "\n")
 }
 
-// logVerbose prints a message only when --verbose is set.
-func logVerbose(format string, args ...any) {
-	if verbose {
-		fmt.Fprintf(os.Stderr, "[tgimg] "+format+"\n", args...)
+// configureLogging applies --quiet, --verbose and --log-level, in that
+// order of precedence, to the shared logger.
+func configureLogging() error {
+	level, err := logging.ParseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+	switch {
+	case quiet:
+		level = logging.LevelError
+	case verbose:
+		level = logging.LevelDebug
 	}
+	logging.SetLevel(level)
+	return nil
 }
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the manifest JSON Schema",
+	Long: `Prints the JSON Schema (draft 2020-12) describing tgimg.manifest.json.
+
+The schema is generated from the CLI's own manifest types, so it always
+matches what this version of tgimg writes. Unknown fields are rejected.`,
+	Args: cobra.NoArgs,
+	RunE: runSchema,
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+}
+
+func runSchema(_ *cobra.Command, _ []string) error {
+	data, err := manifest.SchemaJSON()
+	if err != nil {
+		return fmt.Errorf("generate schema: %w", err)
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
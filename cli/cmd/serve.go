@@ -0,0 +1,402 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/AnyUserName/tgimg-cli/internal/pipeline"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveAddr         string
+	serveProfile      string
+	serveWorkers      int
+	serveEncoderProcs int
+	serveWidths       []int
+	serveDPRs         []float64
+	serveQuality      int
+	servePoll         time.Duration
+	serveNoReload     bool
+	serveFormats      []string
+	serveBasePath     string
+	serveIgnore       []string
+	serveNoMetrics    bool
+	serveUnicodeKeys  string
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve [input_dir]",
+	Short: "Serve variants on demand for local development",
+	Long: `Starts a development server for <input_dir>.
+
+The manifest is served live at /tgimg.manifest.json. Variants are listed
+in it immediately but only encoded on their first request, then cached in
+memory. The input directory is polled for changes and the manifest is
+rebuilt automatically, so there is no separate build step in the dev loop.
+/events streams a server-sent "manifest" event after every rebuild, which
+TgImgProvider's liveReload prop uses to swap images without a page reload.
+Prometheus metrics are served at /metrics unless --no-metrics is set.
+
+Variant paths embed a hash of the source file, not of the encoded output,
+so they differ from "tgimg build" output. Do not deploy served files.`,
+	Args: cobra.RangeArgs(0, 1),
+	RunE: runServe,
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveAddr, "addr", "127.0.0.1:8790", "listen address")
+	serveCmd.Flags().StringVarP(&serveProfile, "profile", "p", "telegram-webview", "processing profile")
+	serveCmd.Flags().IntVarP(&serveWorkers, "workers", "w", 0, "parallel workers (0 = NumCPU, fewer when memory is short)")
+	serveCmd.Flags().IntVar(&serveEncoderProcs, "encoder-concurrency", 0, "max concurrent cwebp/avifenc processes (0 = no limit)")
+	serveCmd.Flags().IntSliceVar(&serveWidths, "widths", nil, "custom widths (overrides profile)")
+	serveCmd.Flags().Float64SliceVar(&serveDPRs, "dprs", nil, "device pixel ratios generated per width, e.g. 1,2,3 (overrides profile)")
+	serveCmd.Flags().IntVarP(&serveQuality, "quality", "q", 0, "quality 1-100 (0 = profile default)")
+	serveCmd.Flags().StringSliceVar(&serveFormats, "formats", nil, "output formats in priority order (overrides profile)")
+	serveCmd.Flags().StringVar(&serveBasePath, "base-path", "", "manifest base_path (default \"./\")")
+	serveCmd.Flags().StringSliceVar(&serveIgnore, "ignore", nil, "glob patterns of input paths to skip (repeatable)")
+	serveCmd.Flags().DurationVar(&servePoll, "poll", time.Second, "input directory polling interval")
+	serveCmd.Flags().BoolVar(&serveNoReload, "no-reload", false, "disable rebuilding on file changes")
+	serveCmd.Flags().StringVar(&serveUnicodeKeys, "unicode-keys", "nfc", "Unicode form of asset keys: nfc or none (keep the file names' form)")
+	serveCmd.Flags().BoolVar(&serveNoMetrics, "no-metrics", false, "do not serve Prometheus metrics at /metrics")
+	registerCompletions(serveCmd, buildFlagCompletions)
+	rootCmd.AddCommand(serveCmd)
+}
+
+func runServe(_ *cobra.Command, args []string) error {
+	inputDir, err := inputDirArg(args)
+	if err != nil {
+		return err
+	}
+	absInput, err := filepath.Abs(inputDir)
+	if err != nil {
+		return fmt.Errorf("resolve input path: %w", err)
+	}
+	prof, err := resolveProfile(serveProfile, serveWidths, serveDPRs, serveFormats, serveQuality, "")
+	if err != nil {
+		return err
+	}
+	unicodeKeys, err := pipeline.ParseUnicodeKeys(serveUnicodeKeys)
+	if err != nil {
+		return withExitCode(ExitUsage, fmt.Errorf("invalid --unicode-keys: %w", err))
+	}
+	aliases, err := pipeline.LoadAliases(pipeline.Dir(absInput))
+	if err != nil {
+		return fmt.Errorf("load aliases: %w", err)
+	}
+	focus, err := pipeline.LoadFocus(pipeline.Dir(absInput))
+	if err != nil {
+		return fmt.Errorf("load focal points: %w", err)
+	}
+	recolor, err := pipeline.LoadRecolor(pipeline.Dir(absInput))
+	if err != nil {
+		return fmt.Errorf("load recolor rules: %w", err)
+	}
+
+	srv := &devServer{}
+	var onEncode func(string, time.Duration, bool, error)
+	if !serveNoMetrics {
+		srv.metrics = newServerMetrics(func() int { return len(srv.current().Assets) })
+		onEncode = srv.metrics.onEncode
+	}
+	srv.p = pipeline.New(pipeline.Config{
+		InputDir:           absInput,
+		Profile:            prof,
+		Workers:            serveWorkers,
+		EncoderConcurrency: serveEncoderProcs,
+		Aliases:            aliases,
+		Focus:              focus,
+		Recolor:            recolor,
+		Overrides:          configOverrides(),
+		BasePath:           serveBasePath,
+		Ignore:             serveIgnore,
+		UnicodeKeys:        unicodeKeys,
+		OnEncode:           onEncode,
+	})
+	if err := srv.rebuild(); err != nil {
+		return err
+	}
+	if !serveNoReload {
+		go srv.watch(absInput, servePoll)
+	}
+
+	fmt.Printf("  tgimg dev server: http://%s/%s\n", serveAddr, manifestFileName)
+	fmt.Printf("  serving %s (%d assets, profile %s)\n", absInput, len(srv.current().Assets), prof.Name)
+	return http.ListenAndServe(serveAddr, srv)
+}
+
+// devServer holds the live manifest and an in-memory cache of rendered
+// variants. A rebuild swaps both atomically under mu.
+type devServer struct {
+	p       *pipeline.Pipeline
+	metrics *serverMetrics // nil with --no-metrics
+
+	mu       sync.RWMutex
+	manifest *manifest.Manifest
+	planned  map[string]pipeline.PlannedVariant
+	cache    map[string]*renderEntry
+	event    manifestEvent          // of the last rebuild
+	subs     map[chan struct{}]bool // /events clients, signaled on rebuilds
+}
+
+// manifestEvent is the data of a "manifest" event on /events.
+type manifestEvent struct {
+	Generation int      `json:"generation"`        // rebuild count, from 1
+	Changed    []string `json:"changed,omitempty"` // asset keys added or modified
+	Removed    []string `json:"removed,omitempty"` // asset keys removed
+}
+
+// renderEntry renders a variant at most once, even under concurrent requests.
+type renderEntry struct {
+	once sync.Once
+	data []byte
+	err  error
+}
+
+func (s *devServer) current() *manifest.Manifest {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.manifest
+}
+
+// rebuild re-plans the manifest and drops every cached variant.
+func (s *devServer) rebuild() error {
+	start := time.Now()
+	m, planned, err := s.p.Plan()
+	if err != nil {
+		if s.metrics != nil {
+			s.metrics.errors.Inc("rebuild")
+		}
+		return err
+	}
+	m.ComputeStats()
+	if s.metrics != nil {
+		s.metrics.images.Add(float64(len(m.Assets)), "ok")
+	}
+
+	s.mu.Lock()
+	changed, removed := diffAssets(s.manifest, m)
+	s.manifest = m
+	s.planned = planned
+	s.cache = map[string]*renderEntry{}
+	s.event = manifestEvent{Generation: s.event.Generation + 1, Changed: changed, Removed: removed}
+	for ch := range s.subs {
+		select {
+		case ch <- struct{}{}:
+		default: // already signaled; the client reads the latest event
+		}
+	}
+	s.mu.Unlock()
+
+	logging.Debugf("planned %d assets, %d variants in %s",
+		len(m.Assets), len(planned), time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// watch polls inputDir and rebuilds when any file is added, removed or
+// modified. Polling avoids a platform-specific file notification dependency.
+func (s *devServer) watch(inputDir string, interval time.Duration) {
+	last := dirSignature(inputDir)
+	for range time.Tick(interval) {
+		sig := dirSignature(inputDir)
+		if sig == last {
+			continue
+		}
+		last = sig
+		if s.metrics != nil {
+			s.metrics.rebuilds.Inc()
+		}
+		if err := s.rebuild(); err != nil {
+			logging.Errorf("rebuild: %v", err)
+			continue
+		}
+		fmt.Printf("  ↻ rebuilt manifest (%d assets)\n", len(s.current().Assets))
+	}
+}
+
+// diffAssets returns the keys of assets added or modified in m and removed
+// from it since old. Nothing changed relative to a nil old.
+func diffAssets(old, m *manifest.Manifest) (changed, removed []string) {
+	if old == nil {
+		return nil, nil
+	}
+	for key, a := range m.Assets {
+		prev, ok := old.Assets[key]
+		if !ok {
+			changed = append(changed, key)
+			continue
+		}
+		x, _ := json.Marshal(prev)
+		y, _ := json.Marshal(a)
+		if !bytes.Equal(x, y) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range old.Assets {
+		if _, ok := m.Assets[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return changed, removed
+}
+
+// dirSignature summarizes path, size and mtime of every file under dir.
+func dirSignature(dir string) string {
+	var entries []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		entries = append(entries, fmt.Sprintf("%s|%d|%d", path, info.Size(), info.ModTime().UnixNano()))
+		return nil
+	})
+	sort.Strings(entries)
+	return strings.Join(entries, "\n")
+}
+
+func (s *devServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if path == "metrics" && s.metrics != nil {
+		s.metrics.reg.ServeHTTP(w, r)
+		return
+	}
+	if path == manifestFileName {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.current())
+		return
+	}
+	if path == "events" {
+		s.serveEvents(w, r)
+		return
+	}
+
+	s.mu.RLock()
+	pv, ok := s.planned[path]
+	entry := s.cache[path]
+	if ok && entry == nil {
+		s.mu.RUnlock()
+		s.mu.Lock()
+		if entry = s.cache[path]; entry == nil {
+			entry = &renderEntry{}
+			s.cache[path] = entry
+		}
+		s.mu.Unlock()
+	} else {
+		s.mu.RUnlock()
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	rendered := false
+	entry.once.Do(func() {
+		start := time.Now()
+		entry.data, entry.err = s.p.Render(pv)
+		rendered = true
+		logging.Debugf("rendered %s in %s", path, time.Since(start).Round(time.Millisecond))
+	})
+	if s.metrics != nil {
+		if !rendered {
+			s.metrics.hits.Inc("render")
+		} else if s.metrics.misses.Inc("render"); entry.err != nil {
+			s.metrics.errors.Inc("render")
+		}
+	}
+	if entry.err != nil {
+		http.Error(w, entry.err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType(pv.Format))
+	w.Write(entry.data)
+}
+
+// eventsHeartbeat is how often /events sends a comment line, so proxies
+// and browsers keep an idle stream open.
+const eventsHeartbeat = 15 * time.Second
+
+// serveEvents streams server-sent events: a "manifest" event with the
+// current generation on connect, then one after every rebuild.
+func (s *devServer) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	ch := make(chan struct{}, 1)
+	s.mu.Lock()
+	if s.subs == nil {
+		s.subs = map[chan struct{}]bool{}
+	}
+	s.subs[ch] = true
+	first := manifestEvent{Generation: s.event.Generation}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subs, ch)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	send := func(ev manifestEvent) {
+		data, _ := json.Marshal(ev)
+		fmt.Fprintf(w, "event: manifest\nid: %d\ndata: %s\n\n", ev.Generation, data)
+		flusher.Flush()
+	}
+	send(first)
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ch:
+			s.mu.RLock()
+			ev := s.event
+			s.mu.RUnlock()
+			send(ev)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// contentType maps an output format to its MIME type.
+func contentType(format string) string {
+	switch format {
+	case "avif":
+		return "image/avif"
+	case "webp":
+		return "image/webp"
+	case "jpeg":
+		return "image/jpeg"
+	case "png":
+		return "image/png"
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,402 @@
+package cmd
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/AnyUserName/tgimg-cli/internal/pipeline"
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+	"github.com/AnyUserName/tgimg-cli/internal/uploads"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serverListen       string
+	serverOutDir       string
+	serverProfile      string
+	serverWorkers      int
+	serverEncoderProcs int
+	serverWidths       []int
+	serverDPRs         []float64
+	serverQuality      int
+	serverFormats      []string
+	serverBasePath     string
+	serverMaxUpload    int64
+	serverMaxBatch     int64
+	serverMaxUnpacked  int64
+	serverNoMetrics    bool
+	serverFreeMemory   bool
+)
+
+var serverCmd = &cobra.Command{
+	Use:   "server",
+	Short: "Run an HTTP API that processes uploaded images on demand",
+	Long: `Starts an HTTP server that runs the build pipeline on uploaded images,
+for apps that receive user uploads.
+
+  POST /v1/images[?key=<key>]   process an image: raw body or multipart "file"
+  POST /v1/batch                build a tar (or .tar.gz) of images, reply with a tar
+  GET  /v1/images/<key>         an asset from the output manifest, or an alias
+  GET  /tgimg.manifest.json     the output manifest
+  GET  /<variant path>          a variant file
+  GET  /metrics                 Prometheus metrics (unless --no-metrics)
+
+Uploads are written to --out like "tgimg build" output and merged into its
+manifest, so assets built there beforehand are served too. An upload
+without a key is stored under its content hash; an upload with an existing
+key replaces that asset. Responses carry the asset as in the manifest
+(variants, thumbhash, average color) plus the URL of every variant.
+
+Unlike "tgimg serve", which is a development server for an input
+directory, this server stores real, deployable output.
+
+/v1/batch is a one-shot remote build for thin clients: the request body is
+an archive as "tgimg build" accepts one (images plus optional aliases,
+focus and recolor sidecars) and the response is a tar of every variant
+followed by the manifest. Nothing is written to --out; batches run one
+at a time.`,
+	Args: cobra.NoArgs,
+	RunE: runServer,
+}
+
+func init() {
+	serverCmd.Flags().StringVar(&serverListen, "listen", ":8080", "listen address")
+	serverCmd.Flags().StringVarP(&serverOutDir, "out", "o", "./tgimg_out", "output directory for variants and the manifest")
+	serverCmd.Flags().StringVarP(&serverProfile, "profile", "p", "telegram-webview", "processing profile")
+	serverCmd.Flags().IntVarP(&serverWorkers, "workers", "w", 0, "images processed at once (0 = NumCPU, fewer when memory is short)")
+	serverCmd.Flags().IntVar(&serverEncoderProcs, "encoder-concurrency", 0, "max concurrent cwebp/avifenc processes (0 = no limit)")
+	serverCmd.Flags().IntSliceVar(&serverWidths, "widths", nil, "custom widths (overrides profile)")
+	serverCmd.Flags().Float64SliceVar(&serverDPRs, "dprs", nil, "device pixel ratios generated per width, e.g. 1,2,3 (overrides profile)")
+	serverCmd.Flags().IntVarP(&serverQuality, "quality", "q", 0, "quality 1-100 (0 = profile default)")
+	serverCmd.Flags().StringSliceVar(&serverFormats, "formats", nil, "output formats in priority order (overrides profile)")
+	serverCmd.Flags().StringVar(&serverBasePath, "base-path", "", "URL prefix for variant paths (default: the manifest's, or \"/\" for a new one)")
+	serverCmd.Flags().Int64Var(&serverMaxUpload, "max-upload", 20<<20, "largest accepted upload in bytes")
+	serverCmd.Flags().Int64Var(&serverMaxBatch, "max-batch", 512<<20, "largest accepted /v1/batch archive in bytes")
+	serverCmd.Flags().Int64Var(&serverMaxUnpacked, "max-batch-unpacked", 2<<30, "largest total uncompressed size of the images in a /v1/batch archive in bytes")
+	serverCmd.Flags().BoolVar(&serverNoMetrics, "no-metrics", false, "do not serve Prometheus metrics at /metrics")
+	serverCmd.Flags().BoolVar(&serverFreeMemory, "free-memory", false, "return pooled buffers to the OS after each /v1/batch build")
+	registerCompletions(serverCmd, buildFlagCompletions)
+	rootCmd.AddCommand(serverCmd)
+}
+
+func runServer(_ *cobra.Command, _ []string) error {
+	prof, err := resolveProfile(serverProfile, serverWidths, serverDPRs, serverFormats, serverQuality, "")
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+	if serverMaxUpload <= 0 {
+		return withExitCode(ExitUsage, fmt.Errorf("invalid --max-upload %d", serverMaxUpload))
+	}
+	if serverMaxBatch <= 0 {
+		return withExitCode(ExitUsage, fmt.Errorf("invalid --max-batch %d", serverMaxBatch))
+	}
+	if serverMaxUnpacked <= 0 {
+		return withExitCode(ExitUsage, fmt.Errorf("invalid --max-batch-unpacked %d", serverMaxUnpacked))
+	}
+	srv := &assetServer{prof: prof}
+	var onEncode func(string, time.Duration, bool, error)
+	if !serverNoMetrics {
+		srv.metrics = newServerMetrics(func() int { return srv.store.Len() })
+		onEncode = srv.metrics.onEncode
+	}
+	srv.store, srv.outDir, err = openUploadStore(serverOutDir, prof, serverBasePath, serverWorkers, serverEncoderProcs, onEncode)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("  tgimg server: http://%s/v1/images\n", serverListen)
+	fmt.Printf("  storing in %s (%d assets, profile %s)\n", srv.outDir, srv.store.Len(), prof.Name)
+	return http.ListenAndServe(serverListen, srv.routes())
+}
+
+// openUploadStore opens the manifest in outDir, or starts one with base
+// path "/", for "tgimg server" and "tgimg grpc". A non-empty basePath
+// replaces the manifest's; onEncode, if set, observes encodes. It returns
+// the store and the absolute outDir.
+func openUploadStore(outDir string, prof profile.Profile, basePath string, workers, encoderProcs int, onEncode func(string, time.Duration, bool, error)) (*uploads.Store, string, error) {
+	absOutput, err := filepath.Abs(outDir)
+	if err != nil {
+		return nil, "", fmt.Errorf("resolve output path: %w", err)
+	}
+	if err := os.MkdirAll(absOutput, 0o755); err != nil {
+		return nil, "", fmt.Errorf("create output dir: %w", err)
+	}
+
+	m, err := loadManifest(absOutput)
+	if errors.Is(err, fs.ErrNotExist) {
+		m, err = manifest.New(prof.Name), nil
+		m.BasePath = "/"
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if basePath != "" {
+		m.BasePath = basePath
+	}
+
+	if workers <= 0 {
+		workers = pipeline.AutoWorkers(prof)
+	}
+	p := pipeline.New(pipeline.Config{
+		OutputDir:          absOutput,
+		Profile:            prof,
+		Workers:            workers,
+		EncoderConcurrency: encoderProcs,
+		Overrides:          configOverrides(),
+		NoRegressSize:      true,
+		OnEncode:           onEncode,
+	})
+	manifestPath := filepath.Join(absOutput, manifestFileName)
+	store := uploads.New(p, m, workers, func(data []byte) error {
+		return manifest.WriteFile(manifestPath, data)
+	})
+	return store, absOutput, nil
+}
+
+// assetServer serves the HTTP API over an upload store in outDir.
+type assetServer struct {
+	store   *uploads.Store
+	outDir  string
+	prof    profile.Profile
+	metrics *serverMetrics // nil with --no-metrics
+
+	batchMu sync.Mutex // one /v1/batch build at a time
+}
+
+func (s *assetServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/images", s.handleUpload)
+	mux.HandleFunc("POST /v1/batch", s.handleBatch)
+	mux.HandleFunc("GET /v1/images/{ref...}", s.handleAsset)
+	mux.HandleFunc("GET /"+manifestFileName, s.handleManifest)
+	if s.metrics != nil {
+		mux.Handle("GET /metrics", s.metrics.reg)
+	}
+	mux.HandleFunc("GET /", s.handleFile)
+	return mux
+}
+
+func (s *assetServer) handleUpload(w http.ResponseWriter, r *http.Request) {
+	data, err := readUpload(w, r)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("upload exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := s.store.Add(data, r.URL.Query().Get("key"))
+	if s.metrics != nil {
+		status := "ok"
+		if err != nil {
+			status = "error"
+			s.metrics.errors.Inc("upload")
+		}
+		s.metrics.images.Inc(status)
+	}
+	switch {
+	case errors.Is(err, uploads.ErrInvalidKey):
+		writeJSONError(w, http.StatusBadRequest, err)
+	case errors.Is(err, uploads.ErrUnprocessable):
+		writeJSONError(w, http.StatusUnprocessableEntity, err)
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, err)
+	default:
+		writeJSON(w, http.StatusCreated, res)
+	}
+}
+
+// handleBatch builds the archive in the request body in memory and
+// replies with a tar of its variants and manifest. Each image may
+// unpack to --max-upload bytes, all of them to --max-batch-unpacked.
+func (s *assetServer) handleBatch(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, serverMaxBatch)
+	archive, err := pipeline.ReadTar("batch", body, pipeline.TarLimits{Entry: serverMaxUpload, Total: serverMaxUnpacked})
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("batch exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		var overLimit *pipeline.TarLimitError
+		if errors.As(err, &overLimit) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	aliases, err := pipeline.LoadAliases(archive)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("load aliases: %w", err))
+		return
+	}
+	focus, err := pipeline.LoadFocus(archive)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("load focal points: %w", err))
+		return
+	}
+	recolor, err := pipeline.LoadRecolor(archive)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("load recolor rules: %w", err))
+		return
+	}
+	s.batch(w, archive, aliases, focus, recolor)
+}
+
+// batch runs one /v1/batch build and writes the response.
+func (s *assetServer) batch(w http.ResponseWriter, archive *pipeline.Archive, aliases map[string]string, focus map[string][2]float64, recolor []pipeline.RecolorRule) {
+	s.batchMu.Lock()
+	defer s.batchMu.Unlock()
+
+	out := &pipeline.MemOutput{}
+	cfg := pipeline.Config{
+		Input:              archive,
+		Output:             out,
+		Profile:            s.prof,
+		Workers:            serverWorkers,
+		EncoderConcurrency: serverEncoderProcs,
+		Overrides:          configOverrides(),
+		NoRegressSize:      true,
+		Aliases:            aliases,
+		Focus:              focus,
+		Recolor:            recolor,
+		FreeMemory:         serverFreeMemory,
+	}
+	if s.metrics != nil {
+		cfg.OnEncode = s.metrics.onEncode
+		cfg.Progress = func(_, _ int, _ string, err error) {
+			status := "ok"
+			if err != nil {
+				status = "error"
+			}
+			s.metrics.images.Inc(status)
+		}
+	}
+	p := pipeline.New(cfg)
+	m, err := p.Run()
+	switch {
+	case errors.Is(err, pipeline.ErrNoImages):
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	case errors.Is(err, pipeline.ErrAllFailed):
+		writeJSONError(w, http.StatusUnprocessableEntity, err)
+		return
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	m.BuildInfo.ToolVersion = version
+	data, err := manifest.Marshal(m, manifest.WriteOptions{})
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Variants first and the manifest last, as "tgimg upload" orders
+	// them, so a client extracting as it reads never has a manifest
+	// pointing at missing files.
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("X-Tgimg-Failed", strconv.Itoa(len(p.Report().Errors)))
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	put := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: now, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	for _, name := range out.Names() {
+		data, _ := out.ReadFile(name)
+		if err := put(name, data); err != nil {
+			return // the client left
+		}
+	}
+	if err := put(manifestFileName, data); err == nil {
+		tw.Close()
+	}
+}
+
+func (s *assetServer) handleAsset(w http.ResponseWriter, r *http.Request) {
+	res, ok := s.store.Lookup(r.PathValue("ref"))
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("asset %q not found", r.PathValue("ref")))
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *assetServer) handleManifest(w http.ResponseWriter, _ *http.Request) {
+	data, err := s.store.ManifestJSON()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// handleFile serves variant files. Only variant paths are served, so temp
+// files and anything else in outDir stay private.
+func (s *assetServer) handleFile(w http.ResponseWriter, r *http.Request) {
+	rel := strings.TrimPrefix(r.URL.Path, "/")
+	format, ok := s.store.File(rel)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", contentType(format))
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable") // content-addressed
+	http.ServeFile(w, r, filepath.Join(s.outDir, filepath.FromSlash(rel)))
+}
+
+// readUpload reads the image from a multipart "file" field or, for any
+// other content type, the raw request body, up to --max-upload bytes.
+func readUpload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, serverMaxUpload)
+	body := io.Reader(r.Body)
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct == "multipart/form-data" {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, fmt.Errorf("multipart upload: %w", err)
+		}
+		defer f.Close()
+		body = f
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty upload")
+	}
+	return data, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
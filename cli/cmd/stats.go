@@ -3,62 +3,315 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
 	"runtime"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/AnyUserName/tgimg-cli/internal/manifest"
 	"github.com/spf13/cobra"
 )
 
+var (
+	statsJSON   bool
+	statsAssets bool
+	statsTop    int
+	statsSort   string
+)
+
+// Per-asset sort keys for `tgimg stats --sort`; every order is descending.
+var statsSortKeys = []string{"input", "output", "savings", "variants"}
+
 var statsCmd = &cobra.Command{
-	Use:   "stats <out_dir_or_manifest>",
+	Use:   "stats [out_dir_or_manifest]",
 	Short: "Display statistics for a built asset directory",
-	Args:  cobra.ExactArgs(1),
-	RunE:  runStats,
+	Long: `Displays totals and format/width breakdowns for a built asset directory.
+
+With --assets (or --top/--sort) it prints a per-asset table instead, to
+find the assets dominating the payload. --sort orders it by input, output
+or saved bytes, or by variant count, largest first.`,
+	Example: "  tgimg stats ./public/img\n  tgimg stats ./public/img --top 10 --sort savings",
+	Args:    cobra.RangeArgs(0, 1),
+	RunE:    runStats,
 }
 
 func init() {
+	statsCmd.Flags().BoolVar(&statsJSON, "json", false, "print the full breakdown as JSON")
+	statsCmd.Flags().BoolVar(&statsAssets, "assets", false, "print a per-asset table")
+	statsCmd.Flags().IntVar(&statsTop, "top", 0, "show only the first N assets of the table (0 = all)")
+	statsCmd.Flags().StringVar(&statsSort, "sort", "output", "sort the asset table by "+strings.Join(statsSortKeys, ", "))
+	registerCompletions(statsCmd, map[string]func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective){
+		"sort": completeValues(statsSortKeys...),
+	})
 	rootCmd.AddCommand(statsCmd)
 }
 
-func runStats(_ *cobra.Command, args []string) error {
-	path := args[0]
+func runStats(cmd *cobra.Command, args []string) error {
+	if !containsString(statsSortKeys, statsSort) {
+		return withExitCode(ExitUsage, fmt.Errorf("invalid --sort %q: want one of %s", statsSort, strings.Join(statsSortKeys, ", ")))
+	}
+	if statsTop < 0 {
+		return withExitCode(ExitUsage, fmt.Errorf("invalid --top %d", statsTop))
+	}
+	tableMode := statsAssets || cmd.Flags().Changed("top") || cmd.Flags().Changed("sort")
 
-	// If path is a directory, look for manifest inside.
-	info, err := os.Stat(path)
+	path, err := outputDirArg(args)
 	if err != nil {
-		return fmt.Errorf("stat %s: %w", path, err)
+		return err
 	}
-	if info.IsDir() {
-		path = filepath.Join(path, "tgimg.manifest.json")
+	m, err := loadManifest(path)
+	if err != nil {
+		return err
 	}
 
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return fmt.Errorf("read manifest: %w", err)
+	if statsJSON {
+		r := buildStatsReport(m)
+		if tableMode {
+			r.Assets = topAssets(m, statsSort, statsTop)
+		}
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	if tableMode {
+		printAssetTable(topAssets(m, statsSort, statsTop), len(m.Assets), statsSort)
+		return nil
+	}
+	printStats(m)
+	return nil
+}
+
+// statsReport is the breakdown printed by `tgimg stats` and emitted
+// as-is by `tgimg stats --json`.
+type statsReport struct {
+	ManifestVersion  int                   `json:"manifest_version"`
+	GeneratedAt      string                `json:"generated_at"`
+	Profile          string                `json:"profile"`
+	Config           *manifest.BuildConfig `json:"config,omitempty"`
+	BuildInfo        *manifest.BuildInfo   `json:"build_info,omitempty"`
+	Totals           manifest.Stats        `json:"totals"`
+	CompressionRatio float64               `json:"compression_ratio,omitempty"` // output / input bytes
+	Formats          []formatStat          `json:"formats"`
+	Widths           []widthStat           `json:"widths"`
+	SlowestEncodes   []encodeStat          `json:"slowest_encodes,omitempty"`
+	ThumbHashAssets  int                   `json:"thumbhash_assets"`
+	Warnings         []string              `json:"warnings"`
+	Assets           []assetStat           `json:"assets,omitempty"` // with --assets/--top/--sort
+}
+
+// assetStat is one row of the per-asset table. Bytes include theme
+// renditions; Saved is negative when the variants outweigh the source.
+type assetStat struct {
+	Key      string `json:"key"`
+	Input    int64  `json:"input_bytes"`
+	Output   int64  `json:"output_bytes"`
+	Saved    int64  `json:"saved_bytes"`
+	Variants int    `json:"variants"`
+}
+
+type formatStat struct {
+	Format string `json:"format"`
+	Files  int    `json:"files"`
+	Bytes  int64  `json:"bytes"`
+}
+
+type widthStat struct {
+	Width    int   `json:"width"`
+	Variants int   `json:"variants"`
+	Bytes    int64 `json:"bytes"`
+}
+
+type encodeStat struct {
+	Key      string `json:"key"`
+	Path     string `json:"path"`
+	Format   string `json:"format"`
+	Width    int    `json:"width"`
+	Quality  int    `json:"quality,omitempty"`
+	EncodeMS int64  `json:"encode_ms"`
+}
+
+// slowestEncodesShown bounds the "Slowest encodes" list.
+const slowestEncodesShown = 5
+
+func buildStatsReport(m *manifest.Manifest) statsReport {
+	r := statsReport{
+		ManifestVersion: m.Version,
+		GeneratedAt:     m.GeneratedAt,
+		Profile:         m.Profile,
+		Config:          m.Config,
+		BuildInfo:       m.BuildInfo,
+		Totals:          m.Stats,
+		Formats:         []formatStat{},
+		Widths:          []widthStat{},
+		Warnings:        []string{},
+	}
+	if s := m.Stats; s.TotalInputBytes > 0 {
+		r.CompressionRatio = float64(s.TotalOutputBytes) / float64(s.TotalInputBytes)
 	}
 
-	var m manifest.Manifest
-	if err := json.Unmarshal(data, &m); err != nil {
-		return fmt.Errorf("parse manifest: %w", err)
+	keys := make([]string, 0, len(m.Assets))
+	for k := range m.Assets {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 
-	printStats(&m)
-	return nil
+	byFormat := map[string]*formatStat{}
+	byWidth := map[int]*widthStat{}
+	for _, key := range keys {
+		a := m.Assets[key]
+		for _, v := range a.AllVariants() {
+			fs := byFormat[v.Format]
+			if fs == nil {
+				fs = &formatStat{Format: v.Format}
+				byFormat[v.Format] = fs
+			}
+			fs.Files++
+			fs.Bytes += v.Size
+
+			ws := byWidth[v.Width]
+			if ws == nil {
+				ws = &widthStat{Width: v.Width}
+				byWidth[v.Width] = ws
+			}
+			ws.Variants++
+			ws.Bytes += v.Size
+
+			if v.EncodeMS > 0 {
+				r.SlowestEncodes = append(r.SlowestEncodes, encodeStat{
+					Key: key, Path: v.Path, Format: v.Format,
+					Width: v.Width, Quality: v.Quality, EncodeMS: v.EncodeMS,
+				})
+			}
+		}
+
+		if a.ThumbHash != "" {
+			r.ThumbHashAssets++
+		}
+		if len(a.Variants) == 0 {
+			r.Warnings = append(r.Warnings, fmt.Sprintf("asset %q has no variants", key))
+		}
+		if a.ThumbHash == "" {
+			r.Warnings = append(r.Warnings, fmt.Sprintf("asset %q missing thumbhash", key))
+		}
+	}
+
+	failed := make([]string, 0, len(m.Errors))
+	for k := range m.Errors {
+		failed = append(failed, k)
+	}
+	sort.Strings(failed)
+	for _, k := range failed {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("asset %q failed to build: %s", k, m.Errors[k].Error))
+	}
+
+	for _, f := range []string{"avif", "webp", "jpeg", "png"} {
+		if fs, ok := byFormat[f]; ok {
+			r.Formats = append(r.Formats, *fs)
+		}
+	}
+	for _, ws := range byWidth {
+		r.Widths = append(r.Widths, *ws)
+	}
+	sort.Slice(r.Widths, func(i, j int) bool { return r.Widths[i].Width < r.Widths[j].Width })
+
+	// Slowest encodes — pathological inputs show up here first.
+	sort.Slice(r.SlowestEncodes, func(i, j int) bool {
+		a, b := r.SlowestEncodes[i], r.SlowestEncodes[j]
+		if a.EncodeMS != b.EncodeMS {
+			return a.EncodeMS > b.EncodeMS
+		}
+		return a.Path < b.Path
+	})
+	if len(r.SlowestEncodes) > slowestEncodesShown {
+		r.SlowestEncodes = r.SlowestEncodes[:slowestEncodesShown]
+	}
+	return r
+}
+
+// topAssets returns per-asset totals ordered by sortBy (largest first,
+// then by key) and cut to the first top rows when top > 0.
+func topAssets(m *manifest.Manifest, sortBy string, top int) []assetStat {
+	rows := make([]assetStat, 0, len(m.Assets))
+	for key, a := range m.Assets {
+		row := assetStat{Key: key, Input: a.Original.Size}
+		for _, t := range a.Themes {
+			row.Input += t.Original.Size
+		}
+		for _, v := range a.AllVariants() {
+			if v.Original {
+				continue // copy-through, not an optimized output
+			}
+			row.Output += v.Size
+			row.Variants++
+		}
+		row.Saved = row.Input - row.Output
+		rows = append(rows, row)
+	}
+
+	metric := func(r assetStat) int64 {
+		switch sortBy {
+		case "input":
+			return r.Input
+		case "savings":
+			return r.Saved
+		case "variants":
+			return int64(r.Variants)
+		}
+		return r.Output
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := metric(rows[i]), metric(rows[j])
+		if a != b {
+			return a > b
+		}
+		return rows[i].Key < rows[j].Key
+	})
+	if top > 0 && len(rows) > top {
+		rows = rows[:top]
+	}
+	return rows
+}
+
+func printAssetTable(rows []assetStat, total int, sortBy string) {
+	fmt.Println()
+	fmt.Printf("  %-40s %10s %10s %10s %8s\n", "ASSET", "INPUT", "OUTPUT", "SAVED", "VARIANTS")
+	for _, r := range rows {
+		saved := formatBytes(r.Saved)
+		if r.Saved < 0 {
+			saved = "-" + formatBytes(-r.Saved)
+		}
+		fmt.Printf("  %-40s %10s %10s %10s %8d\n",
+			truncKey(r.Key, 40), formatBytes(r.Input), formatBytes(r.Output), saved, r.Variants)
+	}
+	fmt.Println()
+	fmt.Printf("  %d of %d assets, by %s\n", len(rows), total, sortBy)
+	fmt.Println()
 }
 
 func printStats(m *manifest.Manifest) {
+	r := buildStatsReport(m)
+
 	fmt.Println()
 	fmt.Printf("  Manifest version: %d\n", m.Version)
 	fmt.Printf("  Generated:        %s\n", m.GeneratedAt)
 	fmt.Printf("  Profile:          %s\n", m.Profile)
+	if c := m.Config; c != nil {
+		dprs := c.DPRs
+		if len(dprs) == 0 && c.Retina { // manifests from before DPR lists
+			dprs = []float64{1, 2}
+		}
+		fmt.Printf("  Config:           widths=%v formats=%v q=%d dprs=%v (%s)\n",
+			c.Widths, c.Formats, c.Quality, dprs, c.Fingerprint)
+	}
 	if m.BuildInfo != nil {
 		poolMB := float64(m.BuildInfo.Workers*m.BuildInfo.PoolEntryKB) / 1024
 		fmt.Printf("  Workers:          %d\n", m.BuildInfo.Workers)
 		fmt.Printf("  Pool footprint:   %d × %d KB ≈ %.1f MB\n",
 			m.BuildInfo.Workers, m.BuildInfo.PoolEntryKB, poolMB)
+		printBuildTimings(m.BuildInfo)
 	} else {
 		workers := runtime.NumCPU()
 		poolMB := float64(workers*167) / 1024
@@ -69,84 +322,73 @@ func printStats(m *manifest.Manifest) {
 	s := m.Stats
 	fmt.Printf("  Total assets:     %d\n", s.TotalAssets)
 	fmt.Printf("  Total variants:   %d\n", s.TotalVariants)
+	if s.FailedAssets > 0 {
+		fmt.Printf("  Failed assets:    %d\n", s.FailedAssets)
+	}
 	fmt.Printf("  Input size:       %s\n", formatBytes(s.TotalInputBytes))
 	fmt.Printf("  Output size:      %s\n", formatBytes(s.TotalOutputBytes))
 
-	if s.TotalInputBytes > 0 {
-		ratio := float64(s.TotalOutputBytes) / float64(s.TotalInputBytes) * 100
-		fmt.Printf("  Compression:      %.1f%% of original\n", ratio)
+	if r.CompressionRatio > 0 {
+		fmt.Printf("  Compression:      %.1f%% of original\n", r.CompressionRatio*100)
 	}
 	fmt.Println()
 
-	// Per-format breakdown.
-	formatStats := map[string]struct {
-		count int
-		bytes int64
-	}{}
-	for _, a := range m.Assets {
-		for _, v := range a.Variants {
-			fs := formatStats[v.Format]
-			fs.count++
-			fs.bytes += v.Size
-			formatStats[v.Format] = fs
-		}
-	}
-
 	fmt.Println("  Format breakdown:")
-	for _, f := range []string{"avif", "webp", "jpeg", "png"} {
-		if fs, ok := formatStats[f]; ok {
-			fmt.Printf("    %-6s  %4d files  %s\n", f, fs.count, formatBytes(fs.bytes))
-		}
+	for _, fs := range r.Formats {
+		fmt.Printf("    %-6s  %4d files  %s\n", fs.Format, fs.Files, formatBytes(fs.Bytes))
 	}
 	fmt.Println()
 
-	// Per-width breakdown.
-	widthStats := map[int]int{}
-	for _, a := range m.Assets {
-		for _, v := range a.Variants {
-			widthStats[v.Width]++
-		}
-	}
-	var widths []int
-	for w := range widthStats {
-		widths = append(widths, w)
-	}
-	sort.Ints(widths)
 	fmt.Println("  Width breakdown:")
-	for _, w := range widths {
-		fmt.Printf("    %5dpx  %4d variants\n", w, widthStats[w])
+	for _, ws := range r.Widths {
+		fmt.Printf("    %5dpx  %4d variants\n", ws.Width, ws.Variants)
 	}
 	fmt.Println()
 
-	// Assets with largest thumbhash payloads.
-	type thInfo struct {
-		key  string
-		size int
-	}
-	var ths []thInfo
-	for key, a := range m.Assets {
-		if a.ThumbHash != "" {
-			ths = append(ths, thInfo{key, len(a.ThumbHash)})
+	if len(r.SlowestEncodes) > 0 {
+		fmt.Println("  Slowest encodes:")
+		for _, e := range r.SlowestEncodes {
+			fmt.Printf("    %-40s %-4s %5dpx  q=%-3d %6dms\n",
+				truncKey(e.Key, 40), e.Format, e.Width, e.Quality, e.EncodeMS)
 		}
+		fmt.Println()
 	}
-	fmt.Printf("  ThumbHash coverage: %d / %d assets\n", len(ths), len(m.Assets))
 
-	// Warnings.
-	var warnings []string
-	for key, a := range m.Assets {
-		if len(a.Variants) == 0 {
-			warnings = append(warnings, fmt.Sprintf("asset %q has no variants", key))
-		}
-		if a.ThumbHash == "" {
-			warnings = append(warnings, fmt.Sprintf("asset %q missing thumbhash", key))
-		}
-	}
-	if len(warnings) > 0 {
+	fmt.Printf("  ThumbHash coverage: %d / %d assets\n", r.ThumbHashAssets, len(m.Assets))
+
+	if len(r.Warnings) > 0 {
 		fmt.Println()
-		fmt.Printf("  Warnings (%d):\n", len(warnings))
-		for _, w := range warnings {
+		fmt.Printf("  Warnings (%d):\n", len(r.Warnings))
+		for _, w := range r.Warnings {
 			fmt.Printf("    ⚠ %s\n", w)
 		}
 	}
 	fmt.Println()
 }
+
+// printBuildTimings prints the diagnostic parts of BuildInfo that are
+// useful when comparing a slow build against a previous fast one.
+func printBuildTimings(bi *manifest.BuildInfo) {
+	if bi.ToolVersion != "" {
+		fmt.Printf("  tgimg version:    %s\n", bi.ToolVersion)
+	}
+	if bi.Host != nil {
+		fmt.Printf("  Host:             %s/%s, %d CPUs, %s\n",
+			bi.Host.GOOS, bi.Host.GOARCH, bi.Host.NumCPU, bi.Host.GoVersion)
+	}
+	if bi.DurationMS > 0 {
+		fmt.Printf("  Build time:       %s\n", time.Duration(bi.DurationMS)*time.Millisecond)
+	}
+	if st := bi.Stages; st != nil {
+		fmt.Printf("    scan %dms · process %dms · collect %dms\n",
+			st.ScanMS, st.ProcessMS, st.CollectMS)
+	}
+	if len(bi.Encoders) > 0 {
+		fmt.Println("  Encoders:")
+		for _, f := range []string{"avif", "webp", "jpeg", "png"} {
+			if v, ok := bi.Encoders[f]; ok {
+				fmt.Printf("    %-6s  %s\n", f, v)
+			}
+		}
+	}
+}
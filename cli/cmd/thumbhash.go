@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"os"
+
+	"github.com/AnyUserName/tgimg-cli/internal/pipeline"
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+	"github.com/AnyUserName/tgimg-core/thumbhash"
+	"github.com/spf13/cobra"
+)
+
+var (
+	thumbhashFormat  string
+	thumbhashProfile string
+)
+
+var thumbhashCmd = &cobra.Command{
+	Use:   "thumbhash <image>",
+	Short: "Print the thumbhash of a single image",
+	Long: `Computes the thumbhash placeholder of one image file without running
+a full build. The image is decoded as "tgimg build" decodes it: a GIF
+on its logical screen, a wide-gamut source converted to sRGB and a large
+JPEG at the reduced scale --profile allows. The hash is identical to what
+a build with the same profile writes, and width and height are the ones
+the manifest records.
+
+Formats:
+  base64  the manifest encoding (default)
+  hex     lowercase hex
+  json    hash plus width, height and has_alpha`,
+	Args: cobra.ExactArgs(1),
+	RunE: runThumbhash,
+}
+
+func init() {
+	thumbhashCmd.Flags().StringVarP(&thumbhashFormat, "format", "f", "base64", "output format: base64, hex or json")
+	thumbhashCmd.Flags().StringVarP(&thumbhashProfile, "profile", "p", "telegram-webview", "processing profile whose build decode to match")
+	rootCmd.AddCommand(thumbhashCmd)
+}
+
+func runThumbhash(_ *cobra.Command, args []string) error {
+	path := args[0]
+	switch thumbhashFormat {
+	case "base64", "hex", "json":
+	default:
+		return fmt.Errorf("invalid --format %q: want base64, hex or json", thumbhashFormat)
+	}
+
+	src, err := pipeline.DecodeFile(path, profile.Get(thumbhashProfile))
+	if err != nil {
+		return err
+	}
+	hash := thumbhash.Encode(src.Image)
+
+	switch thumbhashFormat {
+	case "hex":
+		fmt.Println(hex.EncodeToString(hash))
+	case "json":
+		out := struct {
+			ThumbHash string `json:"thumbhash"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+			Format    string `json:"format"`
+			HasAlpha  bool   `json:"has_alpha"`
+		}{
+			ThumbHash: base64.StdEncoding.EncodeToString(hash),
+			Width:     src.Width,
+			Height:    src.Height,
+			Format:    src.Format,
+			HasAlpha:  thumbhash.HasAlpha(src.Image),
+		}
+		data, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	default:
+		fmt.Println(base64.StdEncoding.EncodeToString(hash))
+	}
+	return nil
+}
+
+var (
+	thumbhashOut  string
+	thumbhashSize int
+)
+
+var thumbhashDecodeCmd = &cobra.Command{
+	Use:   "decode <base64>",
+	Short: "Render a thumbhash into a PNG",
+	Long: `Decodes a base64 thumbhash (as stored in the manifest) and writes it
+as a PNG, so you can check what users see before the image loads.
+
+--size sets the longest side in pixels; the other side follows the
+aspect ratio stored in the hash.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runThumbhashDecode,
+}
+
+func init() {
+	thumbhashDecodeCmd.Flags().StringVarP(&thumbhashOut, "output", "o", "", "output PNG path (required)")
+	thumbhashDecodeCmd.Flags().IntVar(&thumbhashSize, "size", 64, "longest side of the rendered image in pixels")
+	thumbhashDecodeCmd.MarkFlagRequired("output")
+	thumbhashCmd.AddCommand(thumbhashDecodeCmd)
+}
+
+func runThumbhashDecode(_ *cobra.Command, args []string) error {
+	if thumbhashSize <= 0 {
+		return fmt.Errorf("invalid --size %d: must be positive", thumbhashSize)
+	}
+	hash, err := base64.StdEncoding.DecodeString(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid base64 thumbhash: %w", err)
+	}
+	img, err := thumbhash.Decode(hash, thumbhashSize)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(thumbhashOut)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return fmt.Errorf("encode %s: %w", thumbhashOut, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	b := img.Bounds()
+	fmt.Printf("  ✓ %s (%d×%d)\n", thumbhashOut, b.Dx(), b.Dy())
+	return nil
+}
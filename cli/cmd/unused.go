@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	unusedSrcDirs  []string
+	unusedManifest string
+	unusedPrune    bool
+)
+
+var unusedCmd = &cobra.Command{
+	Use:   "unused",
+	Short: "Report (or prune) manifest assets never referenced by app source",
+	Long: `Scans the app source tree for string literals matching asset keys or
+aliases, with an optional @breakpoint or @theme suffix ("photo@md"), and
+reports manifest entries that are never referenced.
+
+Only literal keys are detected: a key built at runtime (e.g. a template
+string "cards/item-${id}") is reported as unused, so review the list
+before pruning. With --prune the unused entries are removed from the
+manifest and their variant files are deleted.`,
+	Args: cobra.NoArgs,
+	RunE: runUnused,
+}
+
+func init() {
+	unusedCmd.Flags().StringSliceVar(&unusedSrcDirs, "src", []string{"./src"}, "app source directories to scan")
+	unusedCmd.Flags().StringVar(&unusedManifest, "manifest", "./tgimg_out/"+manifestFileName, "manifest file or output directory")
+	unusedCmd.Flags().BoolVar(&unusedPrune, "prune", false, "remove unused assets from the manifest and delete their files")
+	rootCmd.AddCommand(unusedCmd)
+}
+
+// sourceExtensions are the app files scanned for asset key literals.
+var sourceExtensions = map[string]bool{
+	".js": true, ".jsx": true, ".ts": true, ".tsx": true, ".mjs": true, ".cjs": true,
+	".vue": true, ".svelte": true, ".astro": true, ".html": true, ".css": true,
+	".scss": true, ".json": true, ".md": true, ".mdx": true,
+}
+
+// stringLiteral matches single-, double- and backtick-quoted strings on one line.
+var stringLiteral = regexp.MustCompile("\"([^\"\\n]{1,512})\"|'([^'\\n]{1,512})'|`([^`\\n]{1,512})`")
+
+func runUnused(_ *cobra.Command, _ []string) error {
+	manifestPath, err := resolveManifestPath(unusedManifest)
+	if err != nil {
+		return err
+	}
+	m, err := loadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	literals := map[string]bool{}
+	for _, dir := range unusedSrcDirs {
+		if err := collectLiterals(dir, literals); err != nil {
+			return fmt.Errorf("scan %s: %w", dir, err)
+		}
+	}
+
+	unused := findUnused(m, literals)
+	if len(unused) == 0 {
+		fmt.Printf("  ✓ All %d assets are referenced\n", len(m.Assets))
+		return nil
+	}
+
+	var saved int64
+	fmt.Printf("  %d of %d assets never referenced:\n", len(unused), len(m.Assets))
+	for _, key := range unused {
+		var size int64
+		for _, v := range m.Assets[key].AllVariants() {
+			size += v.Size
+		}
+		saved += size
+		fmt.Printf("    • %-40s %8s\n", truncKey(key, 40), formatBytes(size))
+	}
+	fmt.Printf("  Total: %s\n", formatBytes(saved))
+
+	if !unusedPrune {
+		return nil
+	}
+
+	// Rewrite the manifest in the format it was built with.
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return err
+	}
+	baseDir := filepath.Dir(manifestPath)
+	removed := pruneAssets(m, unused, baseDir)
+	if err := manifest.WriteJSONWith(m, manifestPath, manifest.OptionsOf(data)); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	fmt.Printf("  ✓ Pruned %d assets, deleted %d files\n", len(unused), removed)
+	return nil
+}
+
+// collectLiterals adds every quoted string found in app source under dir.
+// node_modules, build output and hidden directories are skipped.
+func collectLiterals(dir string, out map[string]bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != dir && (strings.HasPrefix(name, ".") || name == "node_modules" || name == "dist") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !sourceExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, match := range stringLiteral.FindAllSubmatch(data, -1) {
+			for _, g := range match[1:] {
+				if len(g) > 0 {
+					out[string(g)] = true
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// findUnused returns the sorted keys of assets referenced neither directly
+// nor through an alias. A reference may name a breakpoint ("photo@md") or
+// a theme rendition ("logo@dark"), as <TgImg src> and tgimg get accept;
+// any other "@" suffix of a known key counts too, so pruning errs on the
+// side of keeping.
+func findUnused(m *manifest.Manifest, literals map[string]bool) []string {
+	used := map[string]bool{}
+	for lit := range literals {
+		key, _, _, ok := m.LookupRef(lit)
+		if !ok {
+			continue
+		}
+		if target, alias := m.Aliases[key]; alias {
+			key = target
+		}
+		used[key] = true
+	}
+
+	var unused []string
+	for key := range m.Assets {
+		if !used[key] {
+			unused = append(unused, key)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
+
+// pruneAssets removes keys (and aliases pointing at them) from m and
+// deletes their variant files. It returns the number of files deleted.
+func pruneAssets(m *manifest.Manifest, keys []string, baseDir string) int {
+	removed := 0
+	drop := map[string]bool{}
+	for _, key := range keys {
+		drop[key] = true
+		for _, v := range m.Assets[key].AllVariants() {
+			if err := os.Remove(filepath.Join(baseDir, v.Path)); err == nil {
+				removed++
+			} else {
+				logging.Debugf("remove %s: %v", v.Path, err)
+			}
+		}
+		delete(m.Assets, key)
+	}
+	for alias, target := range m.Aliases {
+		if drop[target] {
+			delete(m.Aliases, alias)
+		}
+	}
+	return removed
+}
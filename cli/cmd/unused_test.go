@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+)
+
+// unusedManifestFixture writes a manifest with one variant file per asset
+// to dir.
+func unusedManifestFixture(t *testing.T, dir string) *manifest.Manifest {
+	t.Helper()
+	m := manifest.New("test")
+	for _, key := range []string{"photo", "logo", "banner", "old"} {
+		v := manifest.Variant{Format: "png", Width: 320, Height: 240, Path: key + ".320.240.png", Breakpoint: "md"}
+		if err := os.WriteFile(filepath.Join(dir, v.Path), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		m.Assets[key] = manifest.Asset{AspectRatio: 4.0 / 3, Variants: []manifest.Variant{v}}
+	}
+	logo := m.Assets["logo"]
+	logo.Themes = map[string]manifest.ThemedAsset{"dark": {Variants: []manifest.Variant{{Format: "png", Path: "logo@dark.320.240.png"}}}}
+	m.Assets["logo"] = logo
+	m.Aliases = map[string]string{"hero": "banner"}
+	if err := manifest.WriteJSON(m, filepath.Join(dir, manifestFileName)); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestFindUnusedRefs(t *testing.T) {
+	m := unusedManifestFixture(t, t.TempDir())
+	literals := map[string]bool{"photo@md": true, "logo@dark": true, "hero@md": true, "old-photo": true}
+	if got, want := findUnused(m, literals), []string{"old"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("findUnused = %v, want %v", got, want)
+	}
+}
+
+func TestUnusedPruneKeepsBreakpointRefs(t *testing.T) {
+	out, src := t.TempDir(), t.TempDir()
+	unusedManifestFixture(t, out)
+	app := `export const A = () => <TgImg src="photo@md" />;
+const logo = 'logo@dark', hero = "hero";
+`
+	if err := os.WriteFile(filepath.Join(src, "App.tsx"), []byte(app), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	unusedSrcDirs, unusedManifest, unusedPrune = []string{src}, out, true
+	defer func() {
+		unusedSrcDirs, unusedManifest, unusedPrune = []string{"./src"}, "./tgimg_out/"+manifestFileName, false
+	}()
+	if err := runUnused(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := loadManifest(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"photo", "logo", "banner"} {
+		a, ok := m.Assets[key]
+		if !ok {
+			t.Errorf("%s was pruned", key)
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(out, a.Variants[0].Path)); err != nil {
+			t.Errorf("%s: %v", key, err)
+		}
+	}
+	if _, ok := m.Assets["old"]; ok {
+		t.Error("old was kept")
+	}
+	if _, err := os.Stat(filepath.Join(out, "old.320.240.png")); !os.IsNotExist(err) {
+		t.Errorf("old's variant not deleted: %v", err)
+	}
+}
+
+func TestUnusedPruneKeepsCompactManifest(t *testing.T) {
+	out, src := t.TempDir(), t.TempDir()
+	m := unusedManifestFixture(t, out)
+	path := filepath.Join(out, manifestFileName)
+	if err := manifest.WriteJSONWith(m, path, manifest.WriteOptions{Compact: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "App.tsx"), []byte(`<TgImg src="photo" />`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	unusedSrcDirs, unusedManifest, unusedPrune = []string{src}, out, true
+	defer func() {
+		unusedSrcDirs, unusedManifest, unusedPrune = []string{"./src"}, "./tgimg_out/"+manifestFileName, false
+	}()
+	if err := runUnused(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !manifest.OptionsOf(data).Compact || strings.Contains(string(data), "\n ") {
+		t.Errorf("pruned manifest is no longer compact:\n%s", data)
+	}
+}
@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+	"github.com/AnyUserName/tgimg-cli/internal/s3"
+	"github.com/spf13/cobra"
+)
+
+var (
+	uploadBucket        string
+	uploadPrefix        string
+	uploadRegion        string
+	uploadEndpoint      string
+	uploadPathStyle     bool
+	uploadCacheControl  string
+	uploadManifestCache string
+	uploadConcurrency   int
+	uploadDryRun        bool
+	uploadForce         bool
+)
+
+var uploadCmd = &cobra.Command{
+	Use:   "upload [out_dir]",
+	Short: "Upload variants and the manifest to S3-compatible storage",
+	Long: `Uploads every file referenced by the manifest, then the manifest itself,
+so clients never see a manifest pointing at missing objects.
+
+Variants get a long-lived immutable Cache-Control (their names are
+content-addressed); the manifest gets a short one. Objects whose remote
+ETag already matches the local MD5 are skipped, so re-uploads only send
+what changed (--force uploads everything).
+
+Credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+AWS_SESSION_TOKEN. For R2, MinIO and similar stores, set --endpoint
+(and usually --path-style).`,
+	Args: cobra.RangeArgs(0, 1),
+	RunE: runUpload,
+}
+
+func init() {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	uploadCmd.Flags().StringVar(&uploadBucket, "bucket", "", "bucket name (required)")
+	uploadCmd.Flags().StringVar(&uploadPrefix, "prefix", "", "key prefix, e.g. \"static/img\"")
+	uploadCmd.Flags().StringVar(&uploadRegion, "region", region, "bucket region (default $AWS_REGION)")
+	uploadCmd.Flags().StringVar(&uploadEndpoint, "endpoint", "", "S3-compatible endpoint URL (default AWS)")
+	uploadCmd.Flags().BoolVar(&uploadPathStyle, "path-style", false, "use path-style bucket addressing")
+	uploadCmd.Flags().StringVar(&uploadCacheControl, "cache-control", variantCacheControl, "Cache-Control for variants")
+	uploadCmd.Flags().StringVar(&uploadManifestCache, "manifest-cache-control", manifestCacheControl, "Cache-Control for the manifest")
+	uploadCmd.Flags().IntVar(&uploadConcurrency, "concurrency", 8, "parallel uploads")
+	uploadCmd.Flags().BoolVar(&uploadDryRun, "dry-run", false, "print what would be uploaded without uploading")
+	uploadCmd.Flags().BoolVar(&uploadForce, "force", false, "upload every file even if unchanged")
+	uploadCmd.MarkFlagRequired("bucket")
+	rootCmd.AddCommand(uploadCmd)
+}
+
+// uploadItem is one local file and its object key.
+type uploadItem struct {
+	local        string
+	key          string
+	contentType  string
+	cacheControl string
+}
+
+func runUpload(cmd *cobra.Command, args []string) error {
+	dir, err := outputDirArg(args)
+	if err != nil {
+		return err
+	}
+	manifestPath, err := resolveManifestPath(dir)
+	if err != nil {
+		return err
+	}
+	m, err := loadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	if uploadConcurrency < 1 {
+		uploadConcurrency = 1
+	}
+
+	prefix := strings.Trim(uploadPrefix, "/")
+	objectKey := func(rel string) string {
+		return path.Join(prefix, filepath.ToSlash(rel))
+	}
+
+	// Variants, deduplicated and sorted for stable output. Paths are
+	// relative to the manifest; base_path is the public URL prefix and
+	// does not affect object keys.
+	baseDir := filepath.Dir(manifestPath)
+	seen := map[string]bool{}
+	var items []uploadItem
+	for _, a := range m.Assets {
+		for _, v := range a.AllVariants() {
+			if seen[v.Path] || v.Remote() {
+				continue
+			}
+			seen[v.Path] = true
+			items = append(items, uploadItem{
+				local:        filepath.Join(baseDir, filepath.FromSlash(v.Path)),
+				key:          objectKey(v.Path),
+				contentType:  contentType(v.Format),
+				cacheControl: uploadCacheControl,
+			})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].key < items[j].key })
+	manifestItem := uploadItem{
+		local:        manifestPath,
+		key:          objectKey(filepath.Base(manifestPath)),
+		contentType:  "application/json",
+		cacheControl: uploadManifestCache,
+	}
+
+	client := &s3.Client{
+		Endpoint:  uploadEndpoint,
+		Region:    uploadRegion,
+		Bucket:    uploadBucket,
+		PathStyle: uploadPathStyle,
+	}
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var remote map[string]string
+	if !uploadDryRun || !uploadForce {
+		if err := client.CredentialsFromEnv(); err != nil {
+			return err
+		}
+	}
+	if !uploadForce {
+		listPrefix := prefix
+		if listPrefix != "" {
+			listPrefix += "/"
+		}
+		if remote, err = client.List(ctx, listPrefix); err != nil {
+			return fmt.Errorf("list bucket: %w", err)
+		}
+		logging.Debugf("%d objects already under s3://%s/%s", len(remote), uploadBucket, listPrefix)
+	}
+
+	upload := func(it uploadItem) (sent bool, size int64, err error) {
+		data, err := os.ReadFile(it.local)
+		if err != nil {
+			return false, 0, err
+		}
+		sum := md5.Sum(data)
+		if etag, ok := remote[it.key]; ok && etag == hex.EncodeToString(sum[:]) {
+			logging.Debugf("unchanged %s", it.key)
+			return false, 0, nil
+		}
+		if uploadDryRun {
+			fmt.Printf("    would upload %s (%s)\n", it.key, formatBytes(int64(len(data))))
+			return true, int64(len(data)), nil
+		}
+		if err := client.Put(ctx, it.key, data, it.contentType, it.cacheControl); err != nil {
+			return false, 0, err
+		}
+		logging.Debugf("uploaded %s", it.key)
+		return true, int64(len(data)), nil
+	}
+
+	var (
+		mu       sync.Mutex
+		uploaded int
+		skipped  int
+		bytes    int64
+		errs     []error
+	)
+	record := func(sent bool, size int64, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case err != nil:
+			errs = append(errs, err)
+		case sent:
+			uploaded++
+			bytes += size
+		default:
+			skipped++
+		}
+	}
+
+	jobs := make(chan uploadItem)
+	var wg sync.WaitGroup
+	for i := 0; i < uploadConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range jobs {
+				record(upload(it))
+			}
+		}()
+	}
+	for _, it := range items {
+		jobs <- it
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(errs) > 0 {
+		for _, err := range errs {
+			logging.Errorf("%v", err)
+		}
+		return fmt.Errorf("%d uploads failed; manifest not uploaded", len(errs))
+	}
+
+	// The manifest goes last so it never references missing objects.
+	record(upload(manifestItem))
+	if len(errs) > 0 {
+		return fmt.Errorf("upload manifest: %w", errs[0])
+	}
+
+	verb := "Uploaded"
+	if uploadDryRun {
+		verb = "Would upload"
+	}
+	if !quiet {
+		fmt.Printf("  ✓ %s %d files (%s) to s3://%s/%s, %d unchanged\n",
+			verb, uploaded, formatBytes(bytes), uploadBucket, prefix, skipped)
+	}
+	return nil
+}
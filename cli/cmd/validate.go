@@ -10,19 +10,61 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	validateStrict bool
+	validateFix    bool
+	validateInput  string
+	validateDeep   string
+)
+
 var validateCmd = &cobra.Command{
-	Use:   "validate <manifest_path>",
+	Use:   "validate [manifest_path]",
 	Short: "Validate a tgimg manifest and check referenced files exist",
-	Args:  cobra.ExactArgs(1),
-	RunE:  runValidate,
+	Long: `Validates a tgimg manifest and checks that every referenced file exists.
+
+With --strict the raw JSON is additionally checked against the manifest
+JSON Schema (see "tgimg schema"): missing required fields, wrong types and
+unknown fields are all reported as errors.
+
+Sources the build recorded as failed (the manifest's "errors" section)
+are reported as errors too: their assets are missing from the output.
+
+With --fix, variants that are missing or have the wrong size are
+regenerated from the original sources (--input, or "input" from the config
+file) before validating, repairing a damaged output directory in place.
+Variants whose re-encode differs from the recorded hash get a new
+content-addressed file name and the manifest is updated.
+
+--deep additionally decodes every variant to catch files that exist with
+the right size but corrupted content: --deep (or --deep=header) parses
+each image header and checks its format and dimensions, --deep=full
+decodes every pixel. Full AVIF decoding needs avifdec in PATH.`,
+	Example: "  tgimg validate ./public/img\n  tgimg validate ./public/img --deep=full\n  tgimg validate ./public/img --fix --input ./assets",
+	Args:    cobra.RangeArgs(0, 1),
+	RunE:    runValidate,
 }
 
 func init() {
+	validateCmd.Flags().BoolVar(&validateStrict, "strict", false, "validate against the JSON Schema and reject unknown fields")
+	validateCmd.Flags().BoolVar(&validateFix, "fix", false, "regenerate missing or size-mismatched variants from the sources")
+	validateCmd.Flags().StringVarP(&validateInput, "input", "i", "", "source image directory the manifest was built from (for --fix)")
+	validateCmd.Flags().StringVar(&validateDeep, "deep", "", "decode every variant: header (format and dimensions) or full (every pixel)")
+	validateCmd.Flags().Lookup("deep").NoOptDefVal = deepHeader
 	rootCmd.AddCommand(validateCmd)
 }
 
 func runValidate(_ *cobra.Command, args []string) error {
-	manifestPath := args[0]
+	if validateDeep != "" && validateDeep != deepHeader && validateDeep != deepFull {
+		return withExitCode(ExitUsage, fmt.Errorf("invalid --deep %q: want %s or %s", validateDeep, deepHeader, deepFull))
+	}
+	arg, err := outputDirArg(args)
+	if err != nil {
+		return err
+	}
+	manifestPath, err := resolveManifestPath(arg)
+	if err != nil {
+		return err
+	}
 
 	data, err := os.ReadFile(manifestPath)
 	if err != nil {
@@ -31,15 +73,37 @@ func runValidate(_ *cobra.Command, args []string) error {
 
 	var m manifest.Manifest
 	if err := json.Unmarshal(data, &m); err != nil {
-		return fmt.Errorf("parse manifest: %w", err)
+		return withExitCode(ExitValidation, fmt.Errorf("parse manifest: %w", err))
 	}
 
 	baseDir := filepath.Dir(manifestPath)
-	errors := validateManifest(&m, baseDir)
+	if validateFix {
+		if data, err = fixManifest(&m, manifestPath); err != nil {
+			return err
+		}
+	}
+
+	var errors []string
+	if validateStrict {
+		errors = append(errors, manifest.ValidateSchema(data)...)
+	}
+	errors = append(errors, validateManifest(&m, baseDir)...)
+	headerOnly := 0
+	if validateDeep != "" {
+		var deepErrs []string
+		deepErrs, headerOnly = deepValidate(&m, baseDir, validateDeep)
+		errors = append(errors, deepErrs...)
+	}
+	if headerOnly > 0 {
+		fmt.Printf("  ! %d AVIF file(s) header-checked only (avifdec not found)\n", headerOnly)
+	}
 
 	if len(errors) == 0 {
 		fmt.Println("  ✓ Manifest is valid")
 		fmt.Printf("  ✓ %d assets, %d variants — all files present\n", m.Stats.TotalAssets, m.Stats.TotalVariants)
+		if validateDeep != "" {
+			fmt.Printf("  ✓ All variants decode (%s)\n", validateDeep)
+		}
 		return nil
 	}
 
@@ -47,7 +111,49 @@ func runValidate(_ *cobra.Command, args []string) error {
 	for _, e := range errors {
 		fmt.Printf("    • %s\n", e)
 	}
-	return fmt.Errorf("validation failed with %d errors", len(errors))
+	return withExitCode(ExitValidation, fmt.Errorf("validation failed with %d errors", len(errors)))
+}
+
+// fixManifest runs repairVariants for `validate --fix`, prints what was
+// repaired and rewrites the manifest when variants were renamed. It
+// returns the manifest JSON to validate.
+func fixManifest(m *manifest.Manifest, manifestPath string) ([]byte, error) {
+	inputDir := validateInput
+	if inputDir == "" {
+		if projectConfig == nil || projectConfig.Input == "" {
+			return nil, withExitCode(ExitUsage, fmt.Errorf("--fix needs --input (the source directory used for the build)"))
+		}
+		inputDir = projectConfig.Resolve(projectConfig.Input)
+	}
+
+	r, err := repairVariants(m, filepath.Dir(manifestPath), inputDir)
+	if err != nil {
+		return nil, err
+	}
+	if r.changed() {
+		if err := manifest.WriteJSON(m, manifestPath); err != nil {
+			return nil, fmt.Errorf("write manifest: %w", err)
+		}
+	}
+
+	if n := len(r.Restored) + len(r.Rewritten); n > 0 {
+		fmt.Printf("  ✓ Repaired %d variant(s)\n", n)
+		for _, s := range r.Restored {
+			fmt.Printf("    • %s\n", s)
+		}
+		for _, s := range r.Rewritten {
+			fmt.Printf("    • %s (new hash)\n", s)
+		}
+	} else if len(r.Failed) == 0 {
+		fmt.Println("  ✓ Nothing to repair")
+	}
+	if len(r.Failed) > 0 {
+		fmt.Printf("  ✗ Could not repair %d variant(s):\n", len(r.Failed))
+		for _, s := range r.Failed {
+			fmt.Printf("    • %s\n", s)
+		}
+	}
+	return os.ReadFile(manifestPath)
 }
 
 func validateManifest(m *manifest.Manifest, baseDir string) []string {
@@ -82,53 +188,94 @@ func validateManifest(m *manifest.Manifest, baseDir string) []string {
 		}
 
 		seenPaths := map[string]bool{}
-		for i, v := range asset.Variants {
-			// Check variant fields.
-			if v.Format == "" {
-				errs = append(errs, fmt.Sprintf("asset %q variant[%d]: empty format", key, i))
-			}
-			if v.Width <= 0 || v.Height <= 0 {
-				errs = append(errs, fmt.Sprintf("asset %q variant[%d]: invalid dimensions %dx%d",
-					key, i, v.Width, v.Height))
-			}
-			if v.Hash == "" {
-				errs = append(errs, fmt.Sprintf("asset %q variant[%d]: missing hash", key, i))
-			}
-			if v.Path == "" {
-				errs = append(errs, fmt.Sprintf("asset %q variant[%d]: missing path", key, i))
-				continue
-			}
+		errs = append(errs, validateVariants(fmt.Sprintf("asset %q", key), asset.Variants, baseDir, seenPaths)...)
 
-			// Check duplicate paths.
-			if seenPaths[v.Path] {
-				errs = append(errs, fmt.Sprintf("asset %q variant[%d]: duplicate path %q", key, i, v.Path))
+		// Check theme renditions.
+		for theme, t := range asset.Themes {
+			label := fmt.Sprintf("asset %q theme %q", key, theme)
+			if t.ThumbHash == "" {
+				errs = append(errs, fmt.Sprintf("%s: missing thumbhash", label))
 			}
-			seenPaths[v.Path] = true
-
-			// Check file exists.
-			fullPath := filepath.Join(baseDir, v.Path)
-			info, err := os.Stat(fullPath)
-			if err != nil {
-				errs = append(errs, fmt.Sprintf("asset %q variant[%d]: file not found: %s", key, i, v.Path))
-			} else if v.Size > 0 && info.Size() != v.Size {
-				errs = append(errs, fmt.Sprintf("asset %q variant[%d]: size mismatch: manifest=%d, disk=%d",
-					key, i, v.Size, info.Size()))
+			if len(t.Variants) == 0 {
+				errs = append(errs, fmt.Sprintf("%s: no variants", label))
 			}
+			errs = append(errs, validateVariants(label, t.Variants, baseDir, seenPaths)...)
 		}
 	}
 
+	// Check aliases.
+	for name, target := range m.Aliases {
+		if _, ok := m.Assets[name]; ok {
+			errs = append(errs, fmt.Sprintf("alias %q shadows an asset with the same key", name))
+		}
+		if _, ok := m.Assets[target]; !ok {
+			errs = append(errs, fmt.Sprintf("alias %q points to unknown asset %q", name, target))
+		}
+	}
+
+	// Check recorded build failures: their assets are missing.
+	for key, e := range m.Errors {
+		errs = append(errs, fmt.Sprintf("asset %q failed to build: %s", key, e.Error))
+	}
+
 	// Verify stats consistency.
 	assetCount := len(m.Assets)
 	variantCount := 0
 	for _, a := range m.Assets {
-		variantCount += len(a.Variants)
+		variantCount += len(a.AllVariants())
 	}
 	if m.Stats.TotalAssets != assetCount {
 		errs = append(errs, fmt.Sprintf("stats.total_assets mismatch: %d != %d", m.Stats.TotalAssets, assetCount))
 	}
+	if m.Stats.FailedAssets != len(m.Errors) {
+		errs = append(errs, fmt.Sprintf("stats.failed_assets mismatch: %d != %d", m.Stats.FailedAssets, len(m.Errors)))
+	}
 	if m.Stats.TotalVariants != variantCount {
 		errs = append(errs, fmt.Sprintf("stats.total_variants mismatch: %d != %d", m.Stats.TotalVariants, variantCount))
 	}
 
 	return errs
 }
+
+// validateVariants checks one list of variants and that their files exist
+// under baseDir. seenPaths is shared across an asset's theme renditions.
+func validateVariants(label string, variants []manifest.Variant, baseDir string, seenPaths map[string]bool) []string {
+	var errs []string
+	for i, v := range variants {
+		// Check variant fields.
+		if v.Format == "" {
+			errs = append(errs, fmt.Sprintf("%s variant[%d]: empty format", label, i))
+		}
+		if v.Width <= 0 || v.Height <= 0 {
+			errs = append(errs, fmt.Sprintf("%s variant[%d]: invalid dimensions %dx%d",
+				label, i, v.Width, v.Height))
+		}
+		if v.Hash == "" {
+			errs = append(errs, fmt.Sprintf("%s variant[%d]: missing hash", label, i))
+		}
+		if v.Path == "" {
+			errs = append(errs, fmt.Sprintf("%s variant[%d]: missing path", label, i))
+			continue
+		}
+
+		// Check duplicate paths.
+		if seenPaths[v.Path] {
+			errs = append(errs, fmt.Sprintf("%s variant[%d]: duplicate path %q", label, i, v.Path))
+		}
+		seenPaths[v.Path] = true
+		if v.Remote() {
+			continue // a --cdn URL; nothing on disk to check
+		}
+
+		// Check file exists.
+		fullPath := filepath.Join(baseDir, v.Path)
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s variant[%d]: file not found: %s", label, i, v.Path))
+		} else if v.Size > 0 && info.Size() != v.Size {
+			errs = append(errs, fmt.Sprintf("%s variant[%d]: size mismatch: manifest=%d, disk=%d",
+				label, i, v.Size, info.Size()))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/AnyUserName/tgimg-cli/internal/hasher"
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+var verifyWorkers int
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [out_dir_or_manifest]",
+	Short: "Re-hash every referenced file and compare against the manifest",
+	Long: `Re-hashes every file referenced by the manifest and compares it against
+the variant's content hash, reporting missing, truncated, corrupted or
+modified outputs. Unlike "tgimg validate", which only checks that files
+exist with the recorded size, verify reads every byte.`,
+	Args: cobra.RangeArgs(0, 1),
+	RunE: runVerify,
+}
+
+func init() {
+	verifyCmd.Flags().IntVarP(&verifyWorkers, "workers", "w", 0, "parallel hashing workers (0 = NumCPU)")
+	rootCmd.AddCommand(verifyCmd)
+}
+
+// verifyTarget is one variant file to check.
+type verifyTarget struct {
+	label string // "key", "key@theme"
+	v     manifest.Variant
+}
+
+func runVerify(_ *cobra.Command, args []string) error {
+	arg, err := outputDirArg(args)
+	if err != nil {
+		return err
+	}
+	manifestPath, err := resolveManifestPath(arg)
+	if err != nil {
+		return err
+	}
+	m, err := loadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	baseDir := filepath.Dir(manifestPath)
+
+	targets := verifyTargets(m)
+	problems := make([]string, len(targets))
+	workers := verifyWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for i, t := range targets {
+		wg.Add(1)
+		go func(idx int, t verifyTarget) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			problems[idx] = verifyFile(filepath.Join(baseDir, t.v.Path), t.v)
+		}(i, t)
+	}
+	wg.Wait()
+
+	var failed []string
+	var bytes int64
+	for i, p := range problems {
+		if p != "" {
+			failed = append(failed, fmt.Sprintf("%s (%s): %s", targets[i].v.Path, targets[i].label, p))
+			continue
+		}
+		bytes += targets[i].v.Size
+	}
+
+	if len(failed) == 0 {
+		fmt.Printf("  ✓ %d files verified (%s), all hashes match\n", len(targets), formatBytes(bytes))
+		return nil
+	}
+	fmt.Printf("  ✗ %d of %d files failed verification:\n", len(failed), len(targets))
+	for _, f := range failed {
+		fmt.Printf("    • %s\n", f)
+	}
+	return withExitCode(ExitValidation, fmt.Errorf("verification failed for %d files", len(failed)))
+}
+
+// verifyTargets lists every local variant of every asset and theme
+// rendition, in key order. --cdn URLs have no file to check.
+func verifyTargets(m *manifest.Manifest) []verifyTarget {
+	keys := make([]string, 0, len(m.Assets))
+	for k := range m.Assets {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var targets []verifyTarget
+	for _, key := range keys {
+		a := m.Assets[key]
+		for _, v := range a.Variants {
+			if !v.Remote() {
+				targets = append(targets, verifyTarget{label: key, v: v})
+			}
+		}
+		for _, theme := range sortedThemes(a) {
+			for _, v := range a.Themes[theme].Variants {
+				if !v.Remote() {
+					targets = append(targets, verifyTarget{label: key + "@" + theme, v: v})
+				}
+			}
+		}
+	}
+	return targets
+}
+
+// verifyFile hashes path and returns a description of the mismatch with v,
+// or "" if the file is intact.
+func verifyFile(path string, v manifest.Variant) string {
+	if v.Hash == "" {
+		return "no hash in manifest"
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "missing"
+	}
+	if err != nil {
+		return err.Error()
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err.Error()
+	}
+	if v.Size > 0 && info.Size() != v.Size {
+		return fmt.Sprintf("size %d, manifest says %d", info.Size(), v.Size)
+	}
+	got, err := hasher.ContentHashReader(f, len(v.Hash))
+	if err != nil {
+		return fmt.Sprintf("read: %v", err)
+	}
+	if got != v.Hash {
+		return fmt.Sprintf("modified (hash %s, manifest says %s)", got, v.Hash)
+	}
+	return ""
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/AnyUserName/tgimg-cli/internal/encoder"
+	"github.com/spf13/cobra"
+)
+
+// Build metadata, set by release builds with
+//
+//	go build -ldflags "-X github.com/AnyUserName/tgimg-cli/cmd.version=1.2.3
+//	  -X github.com/AnyUserName/tgimg-cli/cmd.commit=$(git rev-parse HEAD)
+//	  -X github.com/AnyUserName/tgimg-cli/cmd.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// (see "make build"). When unset, commit and date fall back to the VCS
+// stamp the Go toolchain embeds in binaries built inside a git checkout.
+var (
+	commit    = ""
+	buildDate = ""
+)
+
+var versionJSON bool
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print version, build metadata and available encoders",
+	Long: `Prints the tgimg version, the commit and date it was built from, the Go
+toolchain and platform, and the encoder backend found for each format.
+Include the --json output in bug reports.`,
+	Args: cobra.NoArgs,
+	RunE: runVersion,
+}
+
+func init() {
+	versionCmd.Flags().BoolVar(&versionJSON, "json", false, "print build metadata as JSON")
+	rootCmd.AddCommand(versionCmd)
+}
+
+// versionInfo is the output of `tgimg version --json`.
+type versionInfo struct {
+	Version   string            `json:"version"`
+	Commit    string            `json:"commit,omitempty"`
+	Modified  bool              `json:"modified,omitempty"`   // built from a dirty working tree
+	BuildDate string            `json:"build_date,omitempty"` // commit time when not set by ldflags
+	GoVersion string            `json:"go_version"`
+	OS        string            `json:"os"`
+	Arch      string            `json:"arch"`
+	Encoders  map[string]string `json:"encoders"` // format → backend version; absent formats have no encoder
+}
+
+// buildVersionInfo collects the linked-in metadata, filling gaps from the
+// toolchain's embedded build info.
+func buildVersionInfo() versionInfo {
+	v := versionInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if v.Commit == "" {
+					v.Commit = s.Value
+				}
+			case "vcs.time":
+				if v.BuildDate == "" {
+					v.BuildDate = s.Value
+				}
+			case "vcs.modified":
+				v.Modified = s.Value == "true"
+			}
+		}
+	}
+	return v
+}
+
+func runVersion(_ *cobra.Command, _ []string) error {
+	v := buildVersionInfo()
+	v.Encoders = encoder.NewRegistry().Versions()
+
+	if versionJSON {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("tgimg %s\n", v.Version)
+	if v.Commit != "" {
+		dirty := ""
+		if v.Modified {
+			dirty = " (modified)"
+		}
+		fmt.Printf("  commit:    %s%s\n", v.Commit, dirty)
+	}
+	if v.BuildDate != "" {
+		fmt.Printf("  built:     %s\n", v.BuildDate)
+	}
+	fmt.Printf("  go:        %s %s/%s\n", v.GoVersion, v.OS, v.Arch)
+	fmt.Println("  encoders:")
+	for _, f := range allFormats {
+		backend, ok := v.Encoders[f]
+		if !ok {
+			backend = "not available"
+		}
+		fmt.Printf("    %-6s %s\n", f, backend)
+	}
+	return nil
+}
+
+// versionLine is the one-line summary printed by `tgimg --version`.
+func versionLine() string {
+	v := buildVersionInfo()
+	var extra []string
+	if v.Commit != "" {
+		c := v.Commit
+		if len(c) > 12 {
+			c = c[:12]
+		}
+		if v.Modified {
+			c += "-dirty"
+		}
+		extra = append(extra, c)
+	}
+	if v.BuildDate != "" {
+		extra = append(extra, v.BuildDate)
+	}
+	extra = append(extra, v.OS+"/"+v.Arch, v.GoVersion)
+	return fmt.Sprintf("tgimg %s (%s)", v.Version, strings.Join(extra, ", "))
+}
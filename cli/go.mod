@@ -3,13 +3,23 @@ module github.com/AnyUserName/tgimg-cli
 go 1.22
 
 require (
+	github.com/AnyUserName/tgimg-core/thumbhash v0.0.0-00010101000000-000000000000
 	github.com/cespare/xxhash/v2 v2.3.0
-	github.com/disintegration/imaging v1.6.2
 	github.com/spf13/cobra v1.8.1
+	github.com/spf13/pflag v1.0.5
 	golang.org/x/image v0.23.0
+	golang.org/x/text v0.21.0
+	google.golang.org/grpc v1.67.1
+	google.golang.org/protobuf v1.35.2
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
+	golang.org/x/net v0.28.0 // indirect
+	golang.org/x/sys v0.24.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240814211410-ddb44dafa142 // indirect
 )
+
+// The thumbhash module lives in this repository; released versions are
+// tagged thumbhash/vX.Y.Z.
+replace github.com/AnyUserName/tgimg-core/thumbhash => ../thumbhash
@@ -0,0 +1,287 @@
+// Package cache is the local encode cache that makes rebuilds incremental.
+// Encoded variants are stored content-addressed under a key derived from
+// the source bytes and every encoder setting, so unchanged sources skip
+// cwebp/avifenc entirely on the next build.
+//
+// Layout:
+//
+//	<dir>/objects/ab/abcdef0123456789   encoded variant bytes
+//	<dir>/stats.json                    lifetime hit/miss counters
+//
+// An entry's modification time is bumped on every hit, which is what GC
+// uses to find stale entries. A Remote (S3 or Redis) can back the local
+// directory so machines share entries.
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AnyUserName/tgimg-cli/internal/hasher"
+)
+
+const (
+	objectsDir    = "objects"
+	statsFileName = "stats.json"
+)
+
+// DefaultDir returns the per-user cache directory, e.g. ~/.cache/tgimg.
+func DefaultDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "tgimg"), nil
+}
+
+// Cache is a directory of encoded variants. It is safe for concurrent use.
+type Cache struct {
+	dir string
+
+	hits   atomic.Int64
+	misses atomic.Int64
+
+	remote         Remote
+	remoteReadOnly bool
+	remoteHits     atomic.Int64
+	remoteErrs     atomic.Int64
+	remoteErr      atomic.Value // error
+}
+
+// Open returns the cache rooted at dir, creating it if needed.
+func Open(dir string) (*Cache, error) {
+	if err := os.MkdirAll(filepath.Join(dir, objectsDir), 0o755); err != nil {
+		return nil, fmt.Errorf("cache: %w", err)
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// Dir returns the cache root.
+func (c *Cache) Dir() string { return c.dir }
+
+// Key derives a cache key from the given parts (source hash, width,
+// format, quality, encoder version, ...).
+func Key(parts ...string) string {
+	return hasher.ContentHash([]byte(strings.Join(parts, "\x00")), 0)
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, objectsDir, key[:2], key)
+}
+
+// Get returns the cached bytes for key and records a hit or miss. A
+// local miss falls back to the remote, if any.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if data, ok := c.getRemote(key); ok {
+			c.hits.Add(1)
+			return data, true
+		}
+		c.misses.Add(1)
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now) // best effort: marks the entry as recently used
+	c.hits.Add(1)
+	return data, true
+}
+
+// Put stores data under key and writes it through to the remote, if any.
+// The local write is atomic, so concurrent builds never observe a partial
+// entry. Remote failures are counted in RemoteCounts, not returned.
+func (c *Cache) Put(key string, data []byte) error {
+	err := c.putLocal(key, data)
+	c.putRemote(key, data)
+	return err
+}
+
+func (c *Cache) putLocal(key string, data []byte) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Counts returns this process's hits and misses.
+func (c *Cache) Counts() (hits, misses int64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+// Stats are the lifetime counters kept in stats.json.
+type Stats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	// RemoteHits counts the hits, included in Hits, served by a remote.
+	RemoteHits int64  `json:"remote_hits,omitempty"`
+	Builds     int64  `json:"builds"`
+	LastBuild  string `json:"last_build,omitempty"` // RFC 3339
+}
+
+// HitRate returns hits / (hits + misses), or 0 without lookups.
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// statsMu serializes read-modify-write of stats.json within a process.
+var statsMu sync.Mutex
+
+// Flush adds this process's counters to the lifetime stats and resets them.
+func (c *Cache) Flush() error {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	s, err := c.ReadStats()
+	if err != nil {
+		return err
+	}
+	s.Hits += c.hits.Swap(0)
+	s.Misses += c.misses.Swap(0)
+	s.RemoteHits += c.remoteHits.Swap(0)
+	s.Builds++
+	s.LastBuild = time.Now().UTC().Format(time.RFC3339)
+	return c.writeStats(s)
+}
+
+// ReadStats returns the lifetime counters; a missing stats file is zero.
+func (c *Cache) ReadStats() (Stats, error) {
+	var s Stats
+	data, err := os.ReadFile(filepath.Join(c.dir, statsFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("cache stats: %w", err)
+	}
+	return s, nil
+}
+
+func (c *Cache) writeStats(s Stats) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(c.dir, statsFileName), append(data, '\n'), 0o644)
+}
+
+// Entry describes one cached object.
+type Entry struct {
+	Key     string
+	Size    int64
+	ModTime time.Time // last write or hit
+}
+
+// Entries lists every cached object, least recently used first.
+func (c *Cache) Entries() ([]Entry, error) {
+	var entries []Entry
+	root := filepath.Join(c.dir, objectsDir)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(d.Name(), ".tmp") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, Entry{Key: d.Name(), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].ModTime.Equal(entries[j].ModTime) {
+			return entries[i].ModTime.Before(entries[j].ModTime)
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	return entries, err
+}
+
+// Clear removes every entry and the lifetime stats.
+func (c *Cache) Clear() error {
+	if err := os.RemoveAll(filepath.Join(c.dir, objectsDir)); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(c.dir, statsFileName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.MkdirAll(filepath.Join(c.dir, objectsDir), 0o755)
+}
+
+// GCResult summarizes a garbage collection.
+type GCResult struct {
+	Removed      int
+	RemovedBytes int64
+	Kept         int
+	KeptBytes    int64
+}
+
+// GC evicts entries not used for longer than maxAge, then the least
+// recently used entries until the cache fits in maxSize bytes. Zero
+// disables either bound.
+func (c *Cache) GC(maxSize int64, maxAge time.Duration) (GCResult, error) {
+	var r GCResult
+	entries, err := c.Entries()
+	if err != nil {
+		return r, err
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+
+	cutoff := time.Time{}
+	if maxAge > 0 {
+		cutoff = time.Now().Add(-maxAge)
+	}
+	for _, e := range entries { // oldest first
+		stale := maxAge > 0 && e.ModTime.Before(cutoff)
+		over := maxSize > 0 && total > maxSize
+		if !stale && !over {
+			r.Kept++
+			r.KeptBytes += e.Size
+			continue
+		}
+		if err := os.Remove(c.path(e.Key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return r, err
+		}
+		total -= e.Size
+		r.Removed++
+		r.RemovedBytes += e.Size
+	}
+	return r, nil
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestGetPutCounts(t *testing.T) {
+	c, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := Key("src", "320", "webp")
+	if _, ok := c.Get(key); ok {
+		t.Fatal("hit on empty cache")
+	}
+	if err := c.Put(key, []byte("encoded")); err != nil {
+		t.Fatal(err)
+	}
+	data, ok := c.Get(key)
+	if !ok || !bytes.Equal(data, []byte("encoded")) {
+		t.Fatalf("Get = %q, %v", data, ok)
+	}
+	if hits, misses := c.Counts(); hits != 1 || misses != 1 {
+		t.Errorf("Counts = %d, %d; want 1, 1", hits, misses)
+	}
+
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.ReadStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Hits != 1 || s.Misses != 1 || s.Builds != 1 || s.HitRate() != 0.5 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestKeyDependsOnEveryPart(t *testing.T) {
+	if Key("a", "bc") == Key("ab", "c") {
+		t.Error("keys of different parts collide")
+	}
+}
+
+func TestGCEvictsLeastRecentlyUsed(t *testing.T) {
+	c, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	for i, k := range []string{"old", "mid", "new"} {
+		key := Key(k)
+		if err := c.Put(key, make([]byte, 100)); err != nil {
+			t.Fatal(err)
+		}
+		mt := old.Add(time.Duration(i) * time.Hour)
+		if k == "new" {
+			mt = time.Now()
+		}
+		os.Chtimes(c.path(key), mt, mt)
+	}
+
+	r, err := c.GC(250, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Removed != 1 || r.Kept != 2 {
+		t.Fatalf("GC by size = %+v", r)
+	}
+	if _, ok := c.Get(Key("old")); ok {
+		t.Error("least recently used entry survived")
+	}
+
+	r, err = c.GC(0, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Removed != 1 || r.Kept != 1 {
+		t.Fatalf("GC by age = %+v", r)
+	}
+}
@@ -0,0 +1,215 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedisRemote keeps entries in Redis (or a protocol-compatible store such
+// as Valkey or KeyDB) as plain string values. Connections are pooled.
+type RedisRemote struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	DB       int
+	TLS      bool
+	// Prefix is prepended to every key, e.g. "tgimg:".
+	Prefix string
+	// TTL expires entries not written for that long; 0 keeps them, so
+	// Redis' maxmemory policy decides.
+	TTL time.Duration
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+// ParseRedisURL parses redis://[user:password@]host[:port][/db], or
+// rediss:// for TLS, into a remote with the default "tgimg:" prefix.
+func ParseRedisURL(raw string) (*RedisRemote, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("invalid redis URL %q: want redis:// or rediss://", raw)
+	}
+	r := &RedisRemote{Addr: u.Host, TLS: u.Scheme == "rediss", Prefix: "tgimg:"}
+	if u.Port() == "" {
+		r.Addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		r.Password, _ = u.User.Password()
+		if r.Password == "" {
+			r.Password = u.User.Username() // redis://:password@ and redis://password@
+		} else {
+			r.Username = u.User.Username()
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if r.DB, err = strconv.Atoi(db); err != nil || r.DB < 0 {
+			return nil, fmt.Errorf("invalid redis URL %q: bad database %q", raw, db)
+		}
+	}
+	return r, nil
+}
+
+func (r *RedisRemote) Get(ctx context.Context, key string) ([]byte, error) {
+	reply, err := r.do(ctx, "GET", r.Prefix+key)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, fs.ErrNotExist
+	}
+	return reply, nil
+}
+
+func (r *RedisRemote) Put(ctx context.Context, key string, data []byte) error {
+	args := []string{"SET", r.Prefix + key, string(data)}
+	if r.TTL > 0 {
+		args = append(args, "EX", strconv.Itoa(int(r.TTL/time.Second)))
+	}
+	_, err := r.do(ctx, args...)
+	return err
+}
+
+func (r *RedisRemote) String() string {
+	scheme := "redis"
+	if r.TLS {
+		scheme = "rediss"
+	}
+	return fmt.Sprintf("%s://%s/%d", scheme, r.Addr, r.DB)
+}
+
+// do runs one command on a pooled connection. Connections that fail are
+// dropped rather than returned to the pool.
+func (r *RedisRemote) do(ctx context.Context, args ...string) ([]byte, error) {
+	conn, err := r.conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("redis %s: %w", r.Addr, err)
+	}
+	reply, err := conn.do(ctx, args...)
+	if _, isReply := err.(redisError); err != nil && !isReply {
+		conn.Close()
+		return nil, fmt.Errorf("redis %s: %w", r.Addr, err)
+	}
+	r.mu.Lock()
+	r.idle = append(r.idle, conn)
+	r.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("redis %s: %s: %w", r.Addr, args[0], err)
+	}
+	return reply, nil
+}
+
+func (r *RedisRemote) conn(ctx context.Context) (*redisConn, error) {
+	r.mu.Lock()
+	if n := len(r.idle); n > 0 {
+		c := r.idle[n-1]
+		r.idle = r.idle[:n-1]
+		r.mu.Unlock()
+		return c, nil
+	}
+	r.mu.Unlock()
+
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", r.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if r.TLS {
+		host, _, _ := net.SplitHostPort(r.Addr)
+		tc := tls.Client(nc, &tls.Config{ServerName: host})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			nc.Close()
+			return nil, err
+		}
+		nc = tc
+	}
+	c := &redisConn{Conn: nc, rd: bufio.NewReader(nc)}
+	if r.Password != "" {
+		auth := []string{"AUTH", r.Password}
+		if r.Username != "" {
+			auth = []string{"AUTH", r.Username, r.Password}
+		}
+		if _, err := c.do(ctx, auth...); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("AUTH: %w", err)
+		}
+	}
+	if r.DB != 0 {
+		if _, err := c.do(ctx, "SELECT", strconv.Itoa(r.DB)); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("SELECT %d: %w", r.DB, err)
+		}
+	}
+	return c, nil
+}
+
+// redisConn speaks RESP2, the Redis protocol, over one connection.
+type redisConn struct {
+	net.Conn
+	rd *bufio.Reader
+}
+
+// redisError is an error reply; the connection stays usable.
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// do sends a command and reads its reply: the bytes of a bulk or simple
+// string reply, or nil for a nil reply. Integer replies are returned as
+// their decimal text.
+func (c *redisConn) do(ctx context.Context, args ...string) ([]byte, error) {
+	deadline, _ := ctx.Deadline() // zero, meaning none, without one
+	c.SetDeadline(deadline)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(c.Conn, b.String()); err != nil {
+		return nil, err
+	}
+
+	line, err := c.rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("malformed reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return []byte(line[1:]), nil
+	case '-':
+		return nil, redisError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("malformed reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2) // payload and CRLF
+		if _, err := io.ReadFull(c.rd, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	default:
+		return nil, fmt.Errorf("unexpected reply %q", line)
+	}
+}
@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/AnyUserName/tgimg-cli/internal/s3"
+)
+
+// Remote is a cache shared between machines, such as CI runners and
+// teammates' laptops. A Cache consults it on local misses and writes new
+// entries through to it. Keys are the same content-derived keys as the
+// local cache, so entries never go stale, only unused.
+type Remote interface {
+	// Get returns the entry for key. A missing entry yields an error
+	// matching fs.ErrNotExist.
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, data []byte) error
+	// String names the remote in messages, e.g. "s3://bucket/tgimg/".
+	String() string
+}
+
+const (
+	// remoteTimeout bounds one remote request.
+	remoteTimeout = 30 * time.Second
+	// remoteMaxErrors is how many failed requests disable the remote for
+	// the rest of the process, so an unreachable cache does not stall
+	// every variant for remoteTimeout.
+	remoteMaxErrors = 3
+)
+
+// SetRemote makes c consult r on local misses and, unless readOnly,
+// write new entries through to it.
+func (c *Cache) SetRemote(r Remote, readOnly bool) {
+	c.remote = r
+	c.remoteReadOnly = readOnly
+}
+
+// RemoteCounts returns this process's remote hits and failed remote
+// requests, with the last failure.
+func (c *Cache) RemoteCounts() (hits, errs int64, lastErr error) {
+	if e, ok := c.remoteErr.Load().(error); ok {
+		lastErr = e
+	}
+	return c.remoteHits.Load(), c.remoteErrs.Load(), lastErr
+}
+
+// remoteActive reports whether the remote is set and has not been
+// disabled by failures.
+func (c *Cache) remoteActive() bool {
+	return c.remote != nil && c.remoteErrs.Load() < remoteMaxErrors
+}
+
+func (c *Cache) remoteFailed(err error) {
+	c.remoteErr.Store(err)
+	c.remoteErrs.Add(1)
+}
+
+// getRemote fetches key from the remote and stores it locally.
+func (c *Cache) getRemote(key string) ([]byte, bool) {
+	if !c.remoteActive() {
+		return nil, false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout)
+	defer cancel()
+	data, err := c.remote.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			c.remoteFailed(err)
+		}
+		return nil, false
+	}
+	c.putLocal(key, data) // best effort: the next build hits locally
+	c.remoteHits.Add(1)
+	return data, true
+}
+
+// putRemote writes key through to the remote.
+func (c *Cache) putRemote(key string, data []byte) {
+	if c.remoteReadOnly || !c.remoteActive() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout)
+	defer cancel()
+	if err := c.remote.Put(ctx, key, data); err != nil {
+		c.remoteFailed(err)
+	}
+}
+
+// S3Remote keeps entries in S3-compatible object storage under Prefix,
+// laid out like the local objects directory.
+type S3Remote struct {
+	Client *s3.Client
+	Prefix string // "" or ending in "/", e.g. "tgimg-cache/"
+	URL    string // e.g. "s3://bucket/tgimg-cache/", for messages
+}
+
+func (r *S3Remote) objectKey(key string) string {
+	return r.Prefix + key[:2] + "/" + key
+}
+
+func (r *S3Remote) Get(ctx context.Context, key string) ([]byte, error) {
+	body, err := r.Client.Get(ctx, r.objectKey(key))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func (r *S3Remote) Put(ctx context.Context, key string, data []byte) error {
+	return r.Client.Put(ctx, r.objectKey(key), data, "application/octet-stream", "")
+}
+
+func (r *S3Remote) String() string { return r.URL }
@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// mapRemote is an in-memory Remote; fail makes every request fail.
+type mapRemote struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+	fail    bool
+	calls   int
+}
+
+func (m *mapRemote) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if m.fail {
+		return nil, errors.New("unreachable")
+	}
+	data, ok := m.entries[key]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return data, nil
+}
+
+func (m *mapRemote) Put(_ context.Context, key string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if m.fail {
+		return errors.New("unreachable")
+	}
+	m.entries[key] = data
+	return nil
+}
+
+func (m *mapRemote) String() string { return "map" }
+
+func TestRemoteSharesEntries(t *testing.T) {
+	remote := &mapRemote{entries: map[string][]byte{}}
+	key := Key("src", "320", "webp")
+
+	// One machine encodes and writes through.
+	a, _ := Open(t.TempDir())
+	a.SetRemote(remote, false)
+	if _, ok := a.Get(key); ok {
+		t.Fatal("hit on empty caches")
+	}
+	if err := a.Put(key, []byte("encoded")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another hits remotely, then locally.
+	b, _ := Open(t.TempDir())
+	b.SetRemote(remote, true)
+	for i := 0; i < 2; i++ {
+		if data, ok := b.Get(key); !ok || string(data) != "encoded" {
+			t.Fatalf("Get #%d = %q, %v", i, data, ok)
+		}
+	}
+	if hits, errs, _ := b.RemoteCounts(); hits != 1 || errs != 0 {
+		t.Errorf("RemoteCounts = %d, %d; want 1, 0", hits, errs)
+	}
+	if hits, misses := b.Counts(); hits != 2 || misses != 0 {
+		t.Errorf("Counts = %d, %d; want 2, 0", hits, misses)
+	}
+
+	// A read-only remote is not written to.
+	if err := b.Put(Key("other"), []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := remote.entries[Key("other")]; ok {
+		t.Error("read-only cache wrote to the remote")
+	}
+}
+
+func TestRemoteDisabledAfterFailures(t *testing.T) {
+	remote := &mapRemote{entries: map[string][]byte{}, fail: true}
+	c, _ := Open(t.TempDir())
+	c.SetRemote(remote, false)
+	for i := 0; i < 10; i++ {
+		c.Get(Key(strconv.Itoa(i)))
+	}
+	if remote.calls != remoteMaxErrors {
+		t.Errorf("remote called %d times, want %d", remote.calls, remoteMaxErrors)
+	}
+	if _, errs, err := c.RemoteCounts(); errs != remoteMaxErrors || err == nil {
+		t.Errorf("RemoteCounts errs = %d, %v", errs, err)
+	}
+	if _, misses := c.Counts(); misses != 10 {
+		t.Errorf("misses = %d, want 10", misses)
+	}
+}
+
+// fakeRedis serves GET, SET, AUTH and SELECT from a map.
+func fakeRedis(t *testing.T, password string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var mu sync.Mutex
+	data := map[string]string{}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				rd := bufio.NewReader(conn)
+				authed := password == ""
+				for {
+					args, err := readCommand(rd)
+					if err != nil {
+						return
+					}
+					mu.Lock()
+					var reply string
+					switch cmd := strings.ToUpper(args[0]); {
+					case cmd == "AUTH":
+						authed = args[len(args)-1] == password
+						reply = "+OK\r\n"
+						if !authed {
+							reply = "-WRONGPASS invalid password\r\n"
+						}
+					case !authed:
+						reply = "-NOAUTH Authentication required.\r\n"
+					case cmd == "SELECT":
+						reply = "+OK\r\n"
+					case cmd == "SET":
+						data[args[1]] = args[2]
+						reply = "+OK\r\n"
+					case cmd == "GET":
+						v, ok := data[args[1]]
+						reply = "$-1\r\n"
+						if ok {
+							reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+						}
+					default:
+						reply = "-ERR unknown command\r\n"
+					}
+					mu.Unlock()
+					io.WriteString(conn, reply)
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestRedisRemote(t *testing.T) {
+	addr := fakeRedis(t, "s3cret")
+	r, err := ParseRedisURL("redis://:s3cret@" + addr + "/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Addr != addr || r.Password != "s3cret" || r.DB != 2 {
+		t.Fatalf("ParseRedisURL = %+v", r)
+	}
+	ctx := context.Background()
+	if _, err := r.Get(ctx, "k"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Get missing = %v, want fs.ErrNotExist", err)
+	}
+	payload := []byte("binary\r\n\x00data")
+	if err := r.Put(ctx, "k", payload); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Get(ctx, "k")
+	if err != nil || string(got) != string(payload) {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+
+	bad, _ := ParseRedisURL("redis://:wrong@" + addr)
+	if _, err := bad.Get(ctx, "k"); err == nil || errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Get with a wrong password = %v", err)
+	}
+}
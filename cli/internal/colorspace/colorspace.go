@@ -0,0 +1,230 @@
+// Package colorspace converts wide-gamut sources to sRGB. Webviews treat
+// untagged variants as sRGB, so a Display P3 or Adobe RGB original whose
+// pixels were passed through unchanged would lose its saturated colors:
+// P3 red (255, 0, 0) shown as sRGB red is visibly duller.
+//
+// The source's color space comes from an embedded ICC profile (JPEG APP2,
+// PNG iCCP, WebP ICCP) or a PNG cICP chunk. RGB matrix/TRC profiles, the
+// kind cameras, phones and design tools embed, are converted; sRGB and
+// non-RGB (gray, CMYK) profiles are left alone.
+package colorspace
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Transform converts pixels of one RGB color space to sRGB.
+type Transform struct {
+	// Name describes the source color space, e.g. "Display P3".
+	Name string
+
+	dec [3][256]float32 // per-channel 8-bit value → linear light
+	m   [9]float32      // linear source RGB → linear sRGB, row-major
+}
+
+// encSteps is the resolution of the linear → sRGB encode table.
+const encSteps = 4096
+
+// srgbEnc maps linear light in [0, 1], quantized to encSteps, to an 8-bit
+// sRGB value.
+var srgbEnc = func() (t [encSteps + 1]uint8) {
+	for i := range t {
+		t[i] = uint8(math.Round(255 * srgbEncode(float64(i)/encSteps)))
+	}
+	return t
+}()
+
+// srgbDecode is the sRGB transfer function, encoded value → linear.
+func srgbDecode(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// srgbEncode is the inverse of srgbDecode.
+func srgbEncode(l float64) float64 {
+	if l <= 0.0031308 {
+		return l * 12.92
+	}
+	return 1.055*math.Pow(l, 1/2.4) - 0.055
+}
+
+// newTransform builds a Transform from per-channel transfer functions and
+// the matrix from linear source RGB to linear sRGB. It returns nil when
+// the result maps every 8-bit color to itself within one level, i.e. the
+// source already is sRGB.
+func newTransform(name string, trc [3]func(float64) float64, m mat3) *Transform {
+	t := &Transform{Name: name}
+	for c := range trc {
+		for v := range 256 {
+			t.dec[c][v] = float32(trc[c](float64(v) / 255))
+		}
+	}
+	for i, x := range m {
+		t.m[i] = float32(x)
+	}
+	if t.identity() {
+		return nil
+	}
+	return t
+}
+
+// identity reports whether t changes no color by more than one level.
+func (t *Transform) identity() bool {
+	for i, x := range t.m {
+		want := float32(0)
+		if i%4 == 0 {
+			want = 1
+		}
+		if math.Abs(float64(x-want)) > 0.005 {
+			return false
+		}
+	}
+	for c := range t.dec {
+		for v, l := range t.dec[c] {
+			if d := int(encode(l)) - v; d < -1 || d > 1 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// encode maps linear light to 8-bit sRGB, clipping out-of-gamut values.
+func encode(l float32) uint8 {
+	if !(l > 0) { // also NaN
+		return 0
+	}
+	if l >= 1 {
+		return 255
+	}
+	return srgbEnc[int(l*encSteps+0.5)]
+}
+
+// pixel converts one non-premultiplied 8-bit color.
+func (t *Transform) pixel(r, g, b uint8) (uint8, uint8, uint8) {
+	lr, lg, lb := t.dec[0][r], t.dec[1][g], t.dec[2][b]
+	m := &t.m
+	return encode(m[0]*lr + m[1]*lg + m[2]*lb),
+		encode(m[3]*lr + m[4]*lg + m[5]*lb),
+		encode(m[6]*lr + m[7]*lg + m[8]*lb)
+}
+
+// Convert returns img converted to sRGB. Colors outside the sRGB gamut
+// are clipped per channel; alpha is kept. 16-bit sources are converted
+// at 8 bits, the depth every variant is encoded at.
+func (t *Transform) Convert(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	out := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := out.Pix[out.PixOffset(b.Min.X, y):][:4*b.Dx()]
+		switch m := img.(type) {
+		case *image.NRGBA:
+			copy(row, m.Pix[m.PixOffset(b.Min.X, y):])
+		case *image.YCbCr:
+			for x := b.Min.X; x < b.Max.X; x++ {
+				yi, ci := m.YOffset(x, y), m.COffset(x, y)
+				i := 4 * (x - b.Min.X)
+				row[i], row[i+1], row[i+2] = color.YCbCrToRGB(m.Y[yi], m.Cb[ci], m.Cr[ci])
+				row[i+3] = 0xff
+			}
+		default:
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				i := 4 * (x - b.Min.X)
+				row[i], row[i+1], row[i+2], row[i+3] = c.R, c.G, c.B, c.A
+			}
+		}
+		for i := 0; i < len(row); i += 4 {
+			row[i], row[i+1], row[i+2] = t.pixel(row[i], row[i+1], row[i+2])
+		}
+	}
+	return out
+}
+
+// mat3 is a row-major 3×3 matrix.
+type mat3 [9]float64
+
+func (a mat3) mul(b mat3) (c mat3) {
+	for i := range 3 {
+		for j := range 3 {
+			for k := range 3 {
+				c[3*i+j] += a[3*i+k] * b[3*k+j]
+			}
+		}
+	}
+	return c
+}
+
+func (a mat3) apply(v [3]float64) (r [3]float64) {
+	for i := range 3 {
+		r[i] = a[3*i]*v[0] + a[3*i+1]*v[1] + a[3*i+2]*v[2]
+	}
+	return r
+}
+
+func (a mat3) inverse() (mat3, bool) {
+	det := a[0]*(a[4]*a[8]-a[5]*a[7]) - a[1]*(a[3]*a[8]-a[5]*a[6]) + a[2]*(a[3]*a[7]-a[4]*a[6])
+	if math.Abs(det) < 1e-12 {
+		return mat3{}, false
+	}
+	return mat3{
+		(a[4]*a[8] - a[5]*a[7]) / det, (a[2]*a[7] - a[1]*a[8]) / det, (a[1]*a[5] - a[2]*a[4]) / det,
+		(a[5]*a[6] - a[3]*a[8]) / det, (a[0]*a[8] - a[2]*a[6]) / det, (a[2]*a[3] - a[0]*a[5]) / det,
+		(a[3]*a[7] - a[4]*a[6]) / det, (a[1]*a[6] - a[0]*a[7]) / det, (a[0]*a[4] - a[1]*a[3]) / det,
+	}, true
+}
+
+// xyz returns the XYZ of chromaticity (x, y) at luminance 1.
+func xyz(x, y float64) [3]float64 {
+	return [3]float64{x / y, 1, (1 - x - y) / y}
+}
+
+// primaries are the chromaticities of an RGB space's red, green, blue and
+// white point.
+type primaries [4][2]float64
+
+var (
+	primariesSRGB   = primaries{{0.64, 0.33}, {0.30, 0.60}, {0.15, 0.06}, {0.3127, 0.3290}}
+	primariesP3     = primaries{{0.680, 0.320}, {0.265, 0.690}, {0.150, 0.060}, {0.3127, 0.3290}}
+	primariesBT2020 = primaries{{0.708, 0.292}, {0.170, 0.797}, {0.131, 0.046}, {0.3127, 0.3290}}
+)
+
+// toXYZ returns the matrix from linear RGB to XYZ for p.
+func (p primaries) toXYZ() mat3 {
+	r, g, b := xyz(p[0][0], p[0][1]), xyz(p[1][0], p[1][1]), xyz(p[2][0], p[2][1])
+	m := mat3{r[0], g[0], b[0], r[1], g[1], b[1], r[2], g[2], b[2]}
+	inv, _ := m.inverse()
+	s := inv.apply(xyz(p[3][0], p[3][1]))
+	for i := range 3 {
+		for j := range 3 {
+			m[3*i+j] *= s[j]
+		}
+	}
+	return m
+}
+
+// d50 is the ICC profile connection space white point.
+var d50 = [3]float64{0.9642, 1, 0.8249}
+
+// bradford returns the Bradford chromatic adaptation from white point src
+// to dst, both in XYZ.
+func bradford(src, dst [3]float64) mat3 {
+	ma := mat3{0.8951, 0.2664, -0.1614, -0.7502, 1.7135, 0.0367, 0.0389, -0.0685, 1.0296}
+	inv, _ := ma.inverse()
+	s, d := ma.apply(src), ma.apply(dst)
+	scale := mat3{d[0] / s[0], 0, 0, 0, d[1] / s[1], 0, 0, 0, d[2] / s[2]}
+	return inv.mul(scale).mul(ma)
+}
+
+// fromXYZD50 is the matrix from D50-adapted XYZ, the space ICC colorants
+// are stored in, to linear sRGB.
+var fromXYZD50 = func() mat3 {
+	w := primariesSRGB[3]
+	m := bradford(xyz(w[0], w[1]), d50).mul(primariesSRGB.toXYZ())
+	inv, _ := m.inverse()
+	return inv
+}()
@@ -0,0 +1,212 @@
+package colorspace
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var primariesAdobeRGB = primaries{{0.64, 0.33}, {0.21, 0.71}, {0.15, 0.06}, {0.3127, 0.3290}}
+
+// sRGBPara is the sRGB tone curve as an ICC parametricCurveType.
+var sRGBPara = paraTag(3, 2.4, 1/1.055, 0.055/1.055, 1/12.92, 0.04045)
+
+func s15(v float64) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(int32(v*65536+0.5)))
+}
+
+func paraTag(fn uint16, params ...float64) []byte {
+	tag := append([]byte("para\x00\x00\x00\x00"), byte(fn>>8), byte(fn), 0, 0)
+	for _, p := range params {
+		tag = append(tag, s15(p)...)
+	}
+	return tag
+}
+
+// gammaTag is a curveType with a single gamma.
+func gammaTag(g float64) []byte {
+	return append([]byte("curv\x00\x00\x00\x00\x00\x00\x00\x01"), byte(int(g*256)>>8), byte(int(g*256)), 0, 0)
+}
+
+// iccProfile builds a v4 matrix/TRC RGB profile for p, with colorants
+// adapted to D50 as an ICC profile stores them.
+func iccProfile(desc string, p primaries, trc []byte) []byte {
+	w := p[3]
+	m := bradford(xyz(w[0], w[1]), d50).mul(p.toXYZ())
+	tags := [][2]any{{"desc", append(append([]byte("desc\x00\x00\x00\x00"), binary.BigEndian.AppendUint32(nil, uint32(len(desc)+1))...), append([]byte(desc), 0)...)}}
+	for c, ch := range []string{"r", "g", "b"} {
+		tag := []byte("XYZ \x00\x00\x00\x00")
+		for i := range 3 {
+			tag = append(tag, s15(m[3*i+c])...)
+		}
+		tags = append(tags, [2]any{ch + "XYZ", tag}, [2]any{ch + "TRC", trc})
+	}
+
+	head := make([]byte, 128)
+	copy(head[16:], "RGB XYZ ")
+	copy(head[36:], "acsp")
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	var data []byte
+	off := 128 + 4 + 12*len(tags)
+	for _, t := range tags {
+		b := t[1].([]byte)
+		table = append(table, t[0].(string)...)
+		table = binary.BigEndian.AppendUint32(table, uint32(off+len(data)))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(b)))
+		data = append(data, b...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	prof := append(append(head, table...), data...)
+	binary.BigEndian.PutUint32(prof, uint32(len(prof)))
+	return prof
+}
+
+func near(t *testing.T, what string, got, want color.NRGBA) {
+	t.Helper()
+	d := func(a, b uint8) int { return max(int(a)-int(b), int(b)-int(a)) }
+	if d(got.R, want.R) > 2 || d(got.G, want.G) > 2 || d(got.B, want.B) > 2 || got.A != want.A {
+		t.Errorf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+func convertOne(tr *Transform, c color.NRGBA) color.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	img.SetNRGBA(0, 0, c)
+	return tr.Convert(img).NRGBAAt(0, 0)
+}
+
+func TestFromICC(t *testing.T) {
+	tr, err := fromICC(iccProfile("sRGB IEC61966-2.1", primariesSRGB, sRGBPara))
+	if err != nil || tr != nil {
+		t.Errorf("sRGB profile: got %v, %v; want no transform", tr, err)
+	}
+
+	tr, err = fromICC(iccProfile("Display P3", primariesP3, sRGBPara))
+	if err != nil || tr == nil {
+		t.Fatalf("Display P3 profile: got %v, %v", tr, err)
+	}
+	if tr.Name != "Display P3" {
+		t.Errorf("name %q", tr.Name)
+	}
+	// sRGB red is (234, 51, 35) in Display P3; P3 red lies outside sRGB
+	// and clips to its red.
+	near(t, "P3 (234,51,35)", convertOne(tr, color.NRGBA{234, 51, 35, 200}), color.NRGBA{255, 0, 0, 200})
+	near(t, "P3 red", convertOne(tr, color.NRGBA{255, 0, 0, 255}), color.NRGBA{255, 0, 0, 255})
+	near(t, "P3 gray", convertOne(tr, color.NRGBA{128, 128, 128, 255}), color.NRGBA{128, 128, 128, 255})
+
+	tr, err = fromICC(iccProfile("Adobe RGB (1998)", primariesAdobeRGB, gammaTag(563.0/256)))
+	if err != nil || tr == nil {
+		t.Fatalf("Adobe RGB profile: got %v, %v", tr, err)
+	}
+	near(t, "Adobe white", convertOne(tr, color.NRGBA{255, 255, 255, 255}), color.NRGBA{255, 255, 255, 255})
+	if got := convertOne(tr, color.NRGBA{0, 128, 0, 255}); got.R != 0 || got.G <= 128 {
+		t.Errorf("Adobe RGB green (0,128,0) = %v, want a lighter pure green", got)
+	}
+
+	lut := iccProfile("LUT", primariesP3, sRGBPara)
+	copy(lut[132+12:], "A2B0") // the tag after desc, rXYZ
+	if _, err := fromICC(lut); err == nil {
+		t.Error("profile without colorants: want an error")
+	}
+}
+
+func TestFromHeaderJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	// Split the profile across two APP2 segments, as encoders do above
+	// 64 KB.
+	prof := iccProfile("Display P3", primariesP3, sRGBPara)
+	var segs []byte
+	for i, part := range [][]byte{prof[:100], prof[100:]} {
+		payload := append([]byte("ICC_PROFILE\x00"), byte(i+1), 2)
+		payload = append(payload, part...)
+		segs = append(segs, 0xFF, 0xE2, byte((len(payload)+2)>>8), byte(len(payload)+2))
+		segs = append(segs, payload...)
+	}
+	data := append(append([]byte{0xFF, 0xD8}, segs...), buf.Bytes()[2:]...)
+
+	tr, err := FromHeader(data)
+	if err != nil || tr == nil || tr.Name != "Display P3" {
+		t.Fatalf("got %v, %v; want Display P3", tr, err)
+	}
+	if tr, err := FromHeader(buf.Bytes()); tr != nil || err != nil {
+		t.Errorf("untagged JPEG: got %v, %v", tr, err)
+	}
+}
+
+// pngChunk encodes one PNG chunk.
+func pngChunk(typ string, data []byte) []byte {
+	c := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	c = append(append(c, typ...), data...)
+	return binary.BigEndian.AppendUint32(c, crc32.ChecksumIEEE(c[4:]))
+}
+
+// withChunk inserts a chunk right after a PNG's IHDR.
+func withChunk(t *testing.T, typ string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	const ihdrEnd = 8 + 12 + 13
+	return append(append(append([]byte{}, b[:ihdrEnd]...), pngChunk(typ, data)...), b[ihdrEnd:]...)
+}
+
+func TestFromHeaderPNG(t *testing.T) {
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(iccProfile("Adobe RGB (1998)", primariesAdobeRGB, gammaTag(563.0/256)))
+	zw.Close()
+	iccp := append([]byte("Adobe RGB\x00\x00"), z.Bytes()...)
+
+	for _, tc := range []struct {
+		name, typ string
+		data      []byte
+		want      string // transform name; "" for none
+		err       bool
+	}{
+		{"iCCP", "iCCP", iccp, "Adobe RGB (1998)", false},
+		{"cICP P3", "cICP", []byte{12, 13, 0, 1}, "Display P3", false},
+		{"cICP sRGB", "cICP", []byte{1, 13, 0, 1}, "", false},
+		{"cICP PQ", "cICP", []byte{9, 16, 0, 1}, "", true},
+		{"sRGB chunk", "sRGB", []byte{0}, "", false},
+	} {
+		data := withChunk(t, tc.typ, tc.data)
+		if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+			t.Fatalf("%s: test PNG: %v", tc.name, err)
+		}
+		tr, err := FromHeader(data)
+		if (err != nil) != tc.err {
+			t.Errorf("%s: err %v", tc.name, err)
+		}
+		got := ""
+		if tr != nil {
+			got = tr.Name
+		}
+		if got != tc.want {
+			t.Errorf("%s: transform %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestConvertYCbCr(t *testing.T) {
+	tr, _ := fromCICP(12, 13)
+	img := image.NewYCbCr(image.Rect(0, 0, 2, 2), image.YCbCrSubsampleRatio420)
+	y, cb, cr := color.RGBToYCbCr(234, 51, 35)
+	for i := range img.Y {
+		img.Y[i] = y
+	}
+	img.Cb[0], img.Cr[0] = cb, cr
+	near(t, "YCbCr P3", tr.Convert(img).NRGBAAt(1, 1), color.NRGBA{255, 0, 0, 255})
+}
@@ -0,0 +1,182 @@
+package colorspace
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// maxProfile caps the size of an ICC profile, compressed or not. Matrix
+// profiles are a few KB; bigger ones are LUT-based printer profiles.
+const maxProfile = 4 << 20
+
+// FromHeader returns the transform to sRGB of the image whose file starts
+// with head, which must include every byte before the image data. It
+// returns nil, nil when the image has no color information, is sRGB or is
+// not RGB, and an error when it is tagged with an RGB space that cannot be
+// converted: a LUT-based ICC profile, an HDR transfer function or a
+// damaged profile.
+func FromHeader(head []byte) (*Transform, error) {
+	switch {
+	case bytes.HasPrefix(head, []byte("\xff\xd8")):
+		return fromICCData(jpegICC(head))
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return fromPNG(head)
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		return fromICCData(webpICC(head))
+	}
+	return nil, nil
+}
+
+func fromICCData(p []byte, err error) (*Transform, error) {
+	if err != nil || p == nil {
+		return nil, err
+	}
+	return fromICC(p)
+}
+
+// jpegICC reassembles the ICC profile from the APP2 segments before the
+// first scan; a profile over 64 KB spans several, each numbered.
+func jpegICC(data []byte) ([]byte, error) {
+	var chunks [][]byte
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			break
+		}
+		marker := data[i+1]
+		if marker == 0xD8 || marker >= 0xD0 && marker <= 0xD7 || marker == 0x01 || marker == 0xFF {
+			i += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 { // start of scan / end of image
+			break
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if n < 2 || i+2+n > len(data) {
+			break
+		}
+		seg := data[i+4 : i+2+n]
+		if marker == 0xE2 && len(seg) >= 14 && string(seg[:12]) == "ICC_PROFILE\x00" {
+			seq, count := int(seg[12]), int(seg[13])
+			if chunks == nil && count > 0 {
+				chunks = make([][]byte, count)
+			}
+			if seq < 1 || seq > len(chunks) {
+				return nil, errors.New("malformed ICC profile segments")
+			}
+			chunks[seq-1] = seg[14:]
+		}
+		i += 2 + n
+	}
+	if chunks == nil {
+		return nil, nil
+	}
+	var p []byte
+	for _, c := range chunks {
+		if c == nil {
+			return nil, errors.New("truncated ICC profile")
+		}
+		p = append(p, c...)
+	}
+	return p, nil
+}
+
+// webpICC returns the ICCP chunk of an extended WebP.
+func webpICC(data []byte) ([]byte, error) {
+	for i := 12; i+8 <= len(data); {
+		n := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if n < 0 || i+8+n > len(data) {
+			break
+		}
+		switch string(data[i : i+4]) {
+		case "ICCP":
+			return data[i+8 : i+8+n], nil
+		case "VP8 ", "VP8L", "ANIM":
+			return nil, nil
+		}
+		i += 8 + n + n%2
+	}
+	return nil, nil
+}
+
+// fromPNG reads the color chunks before IDAT. Per the PNG specification
+// cICP wins over iCCP, and an sRGB chunk marks the image as sRGB.
+func fromPNG(data []byte) (*Transform, error) {
+	var icc []byte
+	for i := 8; i+8 <= len(data); {
+		n := int(binary.BigEndian.Uint32(data[i:]))
+		typ := string(data[i+4 : i+8])
+		if typ == "IDAT" || n < 0 || i+12+n > len(data) {
+			break
+		}
+		chunk := data[i+8 : i+8+n]
+		switch typ {
+		case "cICP":
+			if n != 4 {
+				return nil, errors.New("malformed cICP chunk")
+			}
+			return fromCICP(chunk[0], chunk[1])
+		case "sRGB":
+			return nil, nil
+		case "iCCP":
+			icc = chunk
+		}
+		i += 12 + n
+	}
+	if icc == nil {
+		return nil, nil
+	}
+	// Profile name, NUL, compression method (0, zlib), profile.
+	name, z, ok := bytes.Cut(icc, []byte{0})
+	if !ok || len(z) < 1 || z[0] != 0 {
+		return nil, fmt.Errorf("malformed iCCP chunk %q", name)
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(z[1:]))
+	if err != nil {
+		return nil, fmt.Errorf("iCCP: %w", err)
+	}
+	p, err := io.ReadAll(io.LimitReader(zr, maxProfile))
+	if err != nil {
+		return nil, fmt.Errorf("iCCP: %w", err)
+	}
+	return fromICC(p)
+}
+
+// fromCICP returns the transform for ITU-T H.273 colour primaries and
+// transfer characteristics, as a PNG cICP chunk carries them.
+func fromCICP(prim, transfer byte) (*Transform, error) {
+	var p primaries
+	var name string
+	switch prim {
+	case 1:
+		p, name = primariesSRGB, "sRGB"
+	case 9:
+		p, name = primariesBT2020, "BT.2020"
+	case 12:
+		p, name = primariesP3, "Display P3"
+	default:
+		return nil, fmt.Errorf("cICP primaries %d are not supported", prim)
+	}
+	var curve func(float64) float64
+	switch transfer {
+	case 13, 2: // sRGB; unspecified
+		curve = srgbDecode
+	case 1, 6, 14, 15: // BT.709 and its higher-precision twins
+		curve = parametric(3, [7]float64{1 / 0.45, 1 / 1.099, 0.099 / 1.099, 1 / 4.5, 0.081})
+	case 4:
+		curve = func(x float64) float64 { return math.Pow(x, 2.2) }
+	case 5:
+		curve = func(x float64) float64 { return math.Pow(x, 2.8) }
+	case 8:
+		curve = func(x float64) float64 { return x }
+	default: // 16 PQ and 18 HLG are HDR and need tone mapping
+		return nil, fmt.Errorf("%s: cICP transfer function %d is not supported", name, transfer)
+	}
+	srgb, _ := primariesSRGB.toXYZ().inverse()
+	m := srgb.mul(p.toXYZ())
+	return newTransform(name, [3]func(float64) float64{curve, curve, curve}, m), nil
+}
@@ -0,0 +1,168 @@
+package colorspace
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf16"
+)
+
+// An ICC profile is a 128-byte header followed by a tag table; see
+// ICC.1:2022 (v4), whose matrix/TRC subset v2 profiles share.
+
+// fromICC returns the transform of an RGB ICC profile to sRGB: nil for an
+// sRGB or non-RGB profile, an error for one it cannot convert.
+func fromICC(p []byte) (*Transform, error) {
+	if len(p) < 132 || string(p[36:40]) != "acsp" {
+		return nil, errors.New("malformed ICC profile")
+	}
+	if string(p[16:20]) != "RGB " {
+		return nil, nil
+	}
+	tags := map[string][]byte{}
+	n := int(binary.BigEndian.Uint32(p[128:]))
+	for i := 0; i < n; i++ {
+		e := 132 + 12*i
+		if e+12 > len(p) {
+			return nil, errors.New("truncated ICC profile")
+		}
+		off, size := int(binary.BigEndian.Uint32(p[e+4:])), int(binary.BigEndian.Uint32(p[e+8:]))
+		if off < 0 || size < 0 || off+size > len(p) {
+			return nil, errors.New("truncated ICC profile")
+		}
+		tags[string(p[e:e+4])] = p[off : off+size]
+	}
+
+	name := iccDescription(tags["desc"])
+	if name == "" {
+		name = "ICC profile"
+	}
+	var m mat3
+	var trc [3]func(float64) float64
+	for c, ch := range []string{"r", "g", "b"} {
+		col, ok := iccXYZ(tags[ch+"XYZ"])
+		if !ok {
+			return nil, fmt.Errorf("%s: only matrix/TRC RGB profiles are supported", name)
+		}
+		m[c], m[3+c], m[6+c] = col[0], col[1], col[2]
+		var err error
+		if trc[c], err = iccCurve(tags[ch+"TRC"]); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return newTransform(name, trc, fromXYZD50.mul(m)), nil
+}
+
+// s15f16 reads an ICC s15Fixed16Number.
+func s15f16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// iccXYZ reads an XYZType tag.
+func iccXYZ(tag []byte) ([3]float64, bool) {
+	if len(tag) < 20 || string(tag[:4]) != "XYZ " {
+		return [3]float64{}, false
+	}
+	return [3]float64{s15f16(tag[8:]), s15f16(tag[12:]), s15f16(tag[16:])}, true
+}
+
+// iccCurve reads a curveType or parametricCurveType tag as a function
+// from encoded values to linear light, both in [0, 1].
+func iccCurve(tag []byte) (func(float64) float64, error) {
+	if len(tag) < 12 {
+		return nil, errors.New("missing tone curve")
+	}
+	switch string(tag[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(tag[8:]))
+		switch {
+		case n == 0:
+			return func(x float64) float64 { return x }, nil
+		case n == 1 && len(tag) >= 14:
+			g := float64(binary.BigEndian.Uint16(tag[12:])) / 256
+			return func(x float64) float64 { return math.Pow(x, g) }, nil
+		case n > 1 && len(tag) >= 12+2*n:
+			table := make([]float64, n)
+			for i := range table {
+				table[i] = float64(binary.BigEndian.Uint16(tag[12+2*i:])) / 65535
+			}
+			return func(x float64) float64 {
+				f := x * float64(n-1)
+				i := min(int(f), n-2)
+				return table[i] + (f-float64(i))*(table[i+1]-table[i])
+			}, nil
+		}
+	case "para":
+		fn := binary.BigEndian.Uint16(tag[8:])
+		counts := []int{1, 3, 4, 5, 7}
+		if int(fn) >= len(counts) || len(tag) < 12+4*counts[fn] {
+			break
+		}
+		var v [7]float64
+		for i := range counts[fn] {
+			v[i] = s15f16(tag[12+4*i:])
+		}
+		return parametric(fn, v), nil
+	}
+	return nil, errors.New("malformed tone curve")
+}
+
+// parametric returns ICC parametric curve fn with parameters g, a, b, c,
+// d, e, f.
+func parametric(fn uint16, v [7]float64) func(float64) float64 {
+	g, a, b, c, d, e, f := v[0], v[1], v[2], v[3], v[4], v[5], v[6]
+	pow := func(x float64) float64 { return math.Pow(max(a*x+b, 0), g) }
+	switch fn {
+	case 0:
+		return func(x float64) float64 { return math.Pow(x, g) }
+	case 1:
+		return pow
+	case 2:
+		return func(x float64) float64 { return pow(x) + c }
+	case 3:
+		return func(x float64) float64 {
+			if x >= d {
+				return pow(x)
+			}
+			return c * x
+		}
+	}
+	return func(x float64) float64 {
+		if x >= d {
+			return pow(x) + e
+		}
+		return c*x + f
+	}
+}
+
+// iccDescription reads the profile description from a v2 textDescription
+// or a v4 multiLocalizedUnicode tag, or returns "".
+func iccDescription(tag []byte) string {
+	if len(tag) < 12 {
+		return ""
+	}
+	switch string(tag[:4]) {
+	case "desc":
+		n := int(binary.BigEndian.Uint32(tag[8:]))
+		if n > len(tag)-12 {
+			return ""
+		}
+		return strings.TrimRight(string(tag[12:12+n]), "\x00")
+	case "mluc":
+		if len(tag) < 28 || binary.BigEndian.Uint32(tag[8:]) == 0 {
+			return ""
+		}
+		n, off := int(binary.BigEndian.Uint32(tag[20:])), int(binary.BigEndian.Uint32(tag[24:]))
+		if n < 0 || off < 0 || off+n > len(tag) {
+			return ""
+		}
+		u := make([]uint16, n/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(tag[off+2*i:])
+		}
+		return strings.TrimRight(string(utf16.Decode(u)), "\x00")
+	}
+	return ""
+}
@@ -0,0 +1,493 @@
+// Package config loads the project config file (tgimg.config.json,
+// .yaml/.yml or .toml) that records build settings, so builds are
+// reproducible without long flag strings.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/AnyUserName/tgimg-cli/internal/encoder"
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+)
+
+// FileName is the config file written by `tgimg init`.
+const FileName = "tgimg.config.json"
+
+// FileNames lists the config files looked up in the working directory,
+// in order. JSON wins if several exist.
+var FileNames = []string{
+	FileName,
+	"tgimg.config.yaml",
+	"tgimg.config.yml",
+	"tgimg.config.toml",
+}
+
+// Config is the project configuration. Every field is optional; zero
+// values fall back to flag defaults and the selected profile.
+type Config struct {
+	Input    string    `json:"input,omitempty"`     // source image directory
+	Output   string    `json:"output,omitempty"`    // build output directory
+	Profile  string    `json:"profile,omitempty"`   // processing profile name
+	Widths   []int     `json:"widths,omitempty"`    // overrides profile widths
+	Formats  []string  `json:"formats,omitempty"`   // overrides profile formats
+	Quality  int       `json:"quality,omitempty"`   // 1-100, overrides profile quality
+	DPRs     []float64 `json:"dprs,omitempty"`      // device pixel ratios, overrides profile DPRs
+	BasePath string    `json:"base_path,omitempty"` // manifest base_path (URL prefix for variant paths)
+	Ignore   []string  `json:"ignore,omitempty"`    // glob patterns of input paths to skip
+
+	// Effort is the encoding effort (fast, balanced, max), overriding the
+	// profile's.
+	Effort string `json:"effort,omitempty"`
+
+	// UnicodeKeys is the Unicode form of asset keys: "nfc" (default) or
+	// "none".
+	UnicodeKeys string `json:"unicode_keys,omitempty"`
+
+	// EncoderConcurrency caps concurrent cwebp/avifenc processes.
+	EncoderConcurrency int `json:"encoder_concurrency,omitempty"`
+
+	// TempDir is where each run keeps its temp files; empty for the
+	// system temp directory.
+	TempDir string `json:"temp_dir,omitempty"`
+
+	// Profiles defines project profiles by name, selectable with
+	// "profile" or --profile like the built-ins. JSON configs only: the
+	// YAML/TOML readers accept flat keys.
+	Profiles map[string]Profile `json:"profiles,omitempty"`
+
+	// Overrides changes the profile for sources matching a glob, e.g.
+	// {"icons/**": {"formats": ["png"], "widths": [64, 128]}}. JSON
+	// configs only.
+	Overrides map[string]Override `json:"overrides,omitempty"`
+
+	// Path is the file the config was loaded from. Input and Output are
+	// resolved relative to its directory.
+	Path string `json:"-"`
+}
+
+// Profile is a user-defined processing profile.
+type Profile struct {
+	// Extends names a built-in or config profile to start from. Only the
+	// fields set here replace its values, so the profile picks up later
+	// changes to its base.
+	Extends string `json:"extends,omitempty"`
+
+	Widths     []int     `json:"widths"`
+	Formats    []string  `json:"formats"`
+	Quality    int       `json:"quality,omitempty"`    // 1-100; 0 = encoder default
+	DPRs       []float64 `json:"dprs,omitempty"`       // device pixel ratios per width, e.g. [1, 2, 3]
+	Retina     bool      `json:"retina,omitempty"`     // shorthand for dprs [1, 2]
+	Descriptor string    `json:"descriptor,omitempty"` // "w" (default) or "x"
+	MinWidth   int       `json:"min_width,omitempty"`  // sources narrower get one source-width variant
+	Heights    []int     `json:"heights,omitempty"`    // target heights, e.g. [360, 720]
+	Crops      []string  `json:"crops,omitempty"`      // fixed WxH boxes, e.g. ["1080x1920"]
+	Gravity    string    `json:"gravity,omitempty"`    // crop anchor without a focal point; default "center"
+
+	// Margin pads crop variants by this fraction of the box per side.
+	// CircleSafe picks the margin that fits crops inside a circle mask.
+	Margin     float64 `json:"margin,omitempty"`
+	CircleSafe bool    `json:"circle_safe,omitempty"`
+
+	// FormatMinWidths skips a format for narrower variants: {"avif": 200}.
+	FormatMinWidths map[string]int `json:"format_min_widths,omitempty"`
+
+	// Effort trades encoding time for file size: fast, balanced or max.
+	Effort string `json:"effort,omitempty"`
+
+	// Breakpoints names widths for frontends ("md": 640). Widths may be
+	// omitted; they then default to the breakpoint widths.
+	Breakpoints map[string]int `json:"breakpoints,omitempty"`
+}
+
+// Override is a partial profile applied to the sources matching its
+// glob. Unset fields keep the active profile's values.
+type Override struct {
+	Profile     string         `json:"profile,omitempty"` // start from this profile instead of the active one
+	Widths      []int          `json:"widths,omitempty"`
+	Formats     []string       `json:"formats,omitempty"`
+	Quality     int            `json:"quality,omitempty"`
+	DPRs        []float64      `json:"dprs,omitempty"`
+	Descriptor  string         `json:"descriptor,omitempty"`
+	MaxWidth    int            `json:"max_width,omitempty"`
+	MinWidth    int            `json:"min_width,omitempty"`
+	Heights     []int          `json:"heights,omitempty"`
+	Crops       []string       `json:"crops,omitempty"`
+	Gravity     string         `json:"gravity,omitempty"`
+	Margin      float64        `json:"margin,omitempty"`
+	CircleSafe  bool           `json:"circle_safe,omitempty"`
+	Breakpoints map[string]int `json:"breakpoints,omitempty"`
+
+	FormatMinWidths map[string]int `json:"format_min_widths,omitempty"`
+	Effort          string         `json:"effort,omitempty"`
+}
+
+// Default returns the config written by `tgimg init`.
+func Default() *Config {
+	return &Config{
+		Input:    "./images",
+		Output:   "./tgimg_out",
+		Profile:  "telegram-webview",
+		BasePath: "./",
+		Ignore:   []string{"*.psd", "drafts/*"},
+	}
+}
+
+// Find returns the path of the config file in dir, or "" if there is none.
+func Find(dir string) string {
+	for _, name := range FileNames {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// Load reads and parses a config file, choosing the format by extension.
+// Unknown fields are rejected so typos do not silently fall back to
+// defaults.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+	case ".yaml", ".yml", ".toml":
+		parse := parseYAML
+		if ext == ".toml" {
+			parse = parseTOML
+		}
+		values, err := parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		if data, err = json.Marshal(values); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config format %q (want .json, .yaml, .yml or .toml)", ext)
+	}
+
+	var c Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	c.Path = path
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Validate checks value ranges that cannot be expressed by JSON types.
+func (c *Config) Validate() error {
+	if c.Quality < 0 || c.Quality > 100 {
+		return fmt.Errorf("quality %d out of range 1-100", c.Quality)
+	}
+	if _, err := encoder.ParseEffort(c.Effort); err != nil {
+		return err
+	}
+	if c.UnicodeKeys != "" && c.UnicodeKeys != "nfc" && c.UnicodeKeys != "none" {
+		return fmt.Errorf("invalid unicode_keys %q: want nfc or none", c.UnicodeKeys)
+	}
+	if c.EncoderConcurrency < 0 {
+		return fmt.Errorf("encoder_concurrency %d must not be negative", c.EncoderConcurrency)
+	}
+	for _, w := range c.Widths {
+		if w <= 0 {
+			return fmt.Errorf("invalid width %d", w)
+		}
+	}
+	if err := profile.ValidateDPRs(c.DPRs); err != nil {
+		return fmt.Errorf("dprs: %w", err)
+	}
+	for name, p := range c.Profiles {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("profile %q: %w", name, err)
+		}
+		if p.Extends == "" {
+			continue
+		}
+		if _, ok := c.Profiles[p.Extends]; !ok && !profile.IsBuiltin(p.Extends) {
+			return fmt.Errorf("profile %q: extends unknown profile %q", name, p.Extends)
+		}
+	}
+	if err := c.checkExtendsCycles(); err != nil {
+		return err
+	}
+	for _, pattern := range c.Ignore {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid ignore pattern %q: %w", pattern, err)
+		}
+	}
+	for pattern, o := range c.Overrides {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid override pattern %q: %w", pattern, err)
+		}
+		if _, err := o.ProfileOverride(); err != nil {
+			return fmt.Errorf("override %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// checkExtendsCycles reports profiles that extend themselves through
+// other config profiles. A profile extending its own name starts from
+// the built-in of that name, which is not a cycle.
+func (c *Config) checkExtendsCycles() error {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		chain := []string{name}
+		for cur := name; ; {
+			next := c.Profiles[cur].Extends
+			if next == "" || next == cur {
+				break
+			}
+			if _, ok := c.Profiles[next]; !ok {
+				break
+			}
+			chain = append(chain, next)
+			if slices.Contains(chain[:len(chain)-1], next) {
+				return fmt.Errorf("profile %q: extends cycle %s", name, strings.Join(chain, " → "))
+			}
+			cur = next
+		}
+	}
+	return nil
+}
+
+// validate checks p's own fields. A profile with Extends may leave out
+// widths and formats; the merged profile is checked when registered.
+func (p Profile) validate() error {
+	if p.Extends == "" && len(p.Widths) == 0 && len(p.Heights) == 0 && len(p.Crops) == 0 && len(p.Breakpoints) == 0 {
+		return fmt.Errorf("no widths, heights, crops or breakpoints")
+	}
+	for _, w := range p.Widths {
+		if w <= 0 {
+			return fmt.Errorf("invalid width %d", w)
+		}
+	}
+	if p.Extends == "" && len(p.Formats) == 0 {
+		return fmt.Errorf("no formats")
+	}
+	for _, f := range p.Formats {
+		switch f {
+		case "avif", "webp", "jpeg", "png":
+		default:
+			return fmt.Errorf("invalid format %q: want avif, webp, jpeg or png", f)
+		}
+	}
+	if p.Quality < 0 || p.Quality > 100 {
+		return fmt.Errorf("quality %d out of range 1-100", p.Quality)
+	}
+	if p.Retina && len(p.DPRs) > 0 {
+		return fmt.Errorf("set dprs or retina, not both")
+	}
+	if err := profile.ValidateDPRs(p.DPRs); err != nil {
+		return err
+	}
+	switch p.Descriptor {
+	case "", "w", "x":
+	default:
+		return fmt.Errorf("invalid descriptor %q: want \"w\" or \"x\"", p.Descriptor)
+	}
+	if p.MinWidth < 0 {
+		return fmt.Errorf("min_width %d must not be negative", p.MinWidth)
+	}
+	for _, h := range p.Heights {
+		if h <= 0 {
+			return fmt.Errorf("invalid height %d", h)
+		}
+	}
+	if _, err := p.CropBoxes(); err != nil {
+		return err
+	}
+	if p.Extends == "" || len(p.Widths) > 0 {
+		if err := profile.ValidateBreakpoints(p.Breakpoints, p.EffectiveWidths()); err != nil {
+			return err
+		}
+	}
+	if _, err := margin(p.Margin, p.CircleSafe); err != nil {
+		return err
+	}
+	if err := profile.ValidateFormatMinWidths(p.FormatMinWidths); err != nil {
+		return err
+	}
+	if _, err := encoder.ParseEffort(p.Effort); err != nil {
+		return err
+	}
+	return profile.ValidateGravity(p.Gravity)
+}
+
+// margin resolves the margin and circle_safe settings.
+func margin(m float64, circleSafe bool) (float64, error) {
+	if circleSafe {
+		if m != 0 {
+			return 0, fmt.Errorf("set margin or circle_safe, not both")
+		}
+		return profile.CircleSafeMargin, nil
+	}
+	return m, profile.ValidateMargin(m)
+}
+
+// Override returns p as a change to its Extends base. Retina becomes
+// dprs [1, 2]; empty Widths keep the base's widths.
+func (p Profile) Override() (profile.Override, error) {
+	dprs := p.DPRs
+	if p.Retina {
+		dprs = []float64{1, 2}
+	}
+	crops, err := p.CropBoxes()
+	if err != nil {
+		return profile.Override{}, err
+	}
+	m, err := margin(p.Margin, p.CircleSafe)
+	if err != nil {
+		return profile.Override{}, err
+	}
+	o := profile.Override{
+		Base:        p.Extends,
+		Formats:     p.Formats,
+		Quality:     p.Quality,
+		DPRs:        dprs,
+		Descriptor:  p.Descriptor,
+		MinWidth:    p.MinWidth,
+		Heights:     p.Heights,
+		Crops:       crops,
+		Gravity:     p.Gravity,
+		Margin:      m,
+		Breakpoints: p.Breakpoints,
+
+		FormatMinWidths: p.FormatMinWidths,
+		Effort:          encoder.Effort(p.Effort),
+	}
+	if len(p.Widths) > 0 {
+		o.Widths = p.Widths
+	}
+	return o, nil
+}
+
+// EffectiveWidths returns Widths, or the breakpoint widths in ascending
+// order when Widths is empty.
+func (p Profile) EffectiveWidths() []int {
+	if len(p.Widths) > 0 {
+		return p.Widths
+	}
+	var widths []int
+	for _, name := range profile.BreakpointNames(p.Breakpoints) {
+		if w := p.Breakpoints[name]; !slices.Contains(widths, w) {
+			widths = append(widths, w)
+		}
+	}
+	return widths
+}
+
+// CropBoxes parses Crops.
+func (p Profile) CropBoxes() ([]profile.Box, error) {
+	var boxes []profile.Box
+	for _, c := range p.Crops {
+		b, err := profile.ParseBox(c)
+		if err != nil {
+			return nil, err
+		}
+		boxes = append(boxes, b)
+	}
+	return boxes, nil
+}
+
+// ProfileOverride converts o, checking the fields it sets. Whether the
+// merged profile is complete is checked when it is applied.
+func (o Override) ProfileOverride() (profile.Override, error) {
+	po := profile.Override{
+		Base:        o.Profile,
+		Widths:      o.Widths,
+		Formats:     o.Formats,
+		Quality:     o.Quality,
+		DPRs:        o.DPRs,
+		Descriptor:  o.Descriptor,
+		MaxWidth:    o.MaxWidth,
+		MinWidth:    o.MinWidth,
+		Heights:     o.Heights,
+		Gravity:     o.Gravity,
+		Breakpoints: o.Breakpoints,
+
+		FormatMinWidths: o.FormatMinWidths,
+		Effort:          encoder.Effort(o.Effort),
+	}
+	for _, w := range append(append([]int(nil), o.Widths...), o.Heights...) {
+		if w <= 0 {
+			return po, fmt.Errorf("invalid width or height %d", w)
+		}
+	}
+	for _, f := range o.Formats {
+		switch f {
+		case "avif", "webp", "jpeg", "png":
+		default:
+			return po, fmt.Errorf("invalid format %q: want avif, webp, jpeg or png", f)
+		}
+	}
+	if o.Quality < 0 || o.Quality > 100 {
+		return po, fmt.Errorf("quality %d out of range 1-100", o.Quality)
+	}
+	if o.MaxWidth < 0 {
+		return po, fmt.Errorf("max_width %d must not be negative", o.MaxWidth)
+	}
+	if o.MinWidth < 0 {
+		return po, fmt.Errorf("min_width %d must not be negative", o.MinWidth)
+	}
+	if err := profile.ValidateDPRs(o.DPRs); err != nil {
+		return po, err
+	}
+	switch o.Descriptor {
+	case "", "w", "x":
+	default:
+		return po, fmt.Errorf("invalid descriptor %q: want \"w\" or \"x\"", o.Descriptor)
+	}
+	if err := profile.ValidateGravity(o.Gravity); err != nil {
+		return po, err
+	}
+	if err := profile.ValidateFormatMinWidths(o.FormatMinWidths); err != nil {
+		return po, err
+	}
+	if _, err := encoder.ParseEffort(o.Effort); err != nil {
+		return po, err
+	}
+	var err error
+	if po.Margin, err = margin(o.Margin, o.CircleSafe); err != nil {
+		return po, err
+	}
+	po.Crops, err = Profile{Crops: o.Crops}.CropBoxes()
+	return po, err
+}
+
+// Resolve returns p relative to the config file's directory. Absolute
+// paths and configs without a Path are returned unchanged.
+func (c *Config) Resolve(p string) string {
+	if p == "" || c.Path == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(filepath.Dir(c.Path), p)
+}
+
+// Write stores the config as indented JSON.
+func (c *Config) Write(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The config schema is flat: scalars and lists of scalars under top-level
+// keys. parseYAML and parseTOML accept exactly that subset of each format,
+// which keeps the CLI free of parser dependencies. Values are returned as
+// a generic map and decoded through encoding/json, so every format gets
+// the same type checks and unknown-field errors.
+
+// parseYAML parses "key: value" lines, flow lists ("[a, b]") and block
+// lists ("- a" under a key).
+func parseYAML(data []byte) (map[string]any, error) {
+	out := map[string]any{}
+	var listKey string
+	for i, raw := range strings.Split(string(data), "\n") {
+		line := strings.TrimRight(stripComment(raw), " \t\r")
+		if strings.TrimSpace(line) == "" || line == "---" {
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+
+		if item, ok := strings.CutPrefix(trimmed, "- "); ok || trimmed == "-" {
+			if listKey == "" || line[0] != ' ' && line[0] != '-' {
+				return nil, fmt.Errorf("line %d: list item without a key", i+1)
+			}
+			list, _ := out[listKey].([]any)
+			out[listKey] = append(list, scalar(item))
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: nested mappings are not supported", i+1)
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", i+1)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		listKey = ""
+		switch {
+		case value == "":
+			// Block list follows; an empty key with no items stays an empty list.
+			listKey = key
+			out[key] = []any{}
+		case strings.HasPrefix(value, "["):
+			list, err := flowList(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			out[key] = list
+		default:
+			out[key] = scalar(value)
+		}
+	}
+	return out, nil
+}
+
+// parseTOML parses top-level "key = value" lines with scalar or
+// single-line array values. Tables are not supported.
+func parseTOML(data []byte) (map[string]any, error) {
+	out := map[string]any{}
+	for i, raw := range strings.Split(string(data), "\n") {
+		line := strings.TrimSpace(stripComment(raw))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("line %d: tables are not supported", i+1)
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key = value\"", i+1)
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"`)
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, "[") {
+			list, err := flowList(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			out[key] = list
+			continue
+		}
+		out[key] = scalar(value)
+	}
+	return out, nil
+}
+
+// flowList parses "[a, b, c]".
+func flowList(s string) ([]any, error) {
+	inner, ok := strings.CutPrefix(s, "[")
+	if !ok {
+		return nil, fmt.Errorf("expected list, got %q", s)
+	}
+	inner, ok = strings.CutSuffix(inner, "]")
+	if !ok {
+		return nil, fmt.Errorf("unterminated list %q", s)
+	}
+	list := []any{}
+	if strings.TrimSpace(inner) == "" {
+		return list, nil
+	}
+	for _, item := range strings.Split(inner, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue // trailing comma
+		}
+		list = append(list, scalar(item))
+	}
+	return list, nil
+}
+
+// scalar converts a bare or quoted token to a string, number or bool.
+func scalar(s string) any {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' && s[len(s)-1] == '"' || s[0] == '\'' && s[len(s)-1] == '\'') {
+		return s[1 : len(s)-1]
+	}
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
+// stripComment removes a trailing "# ..." comment outside quotes.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
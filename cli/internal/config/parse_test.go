@@ -0,0 +1,126 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		want map[string]any
+		err  string // substring of the error; empty: no error
+	}{
+		{name: "scalars", in: "input: ./images\nquality: 80\nno_cache: true\n",
+			want: map[string]any{"input": "./images", "quality": int64(80), "no_cache": true}},
+		{name: "document marker and CRLF", in: "---\r\nquality: 80\r\n",
+			want: map[string]any{"quality": int64(80)}},
+		{name: "flow list", in: "widths: [320, 640, ]\ndprs: [1, 1.5]\n",
+			want: map[string]any{"widths": []any{int64(320), int64(640)}, "dprs": []any{int64(1), 1.5}}},
+		{name: "empty flow list", in: "ignore: []\n",
+			want: map[string]any{"ignore": []any{}}},
+		{name: "block list", in: "formats:\n  - webp\n  - 'jpeg'\nquality: 70\n",
+			want: map[string]any{"formats": []any{"webp", "jpeg"}, "quality": int64(70)}},
+		{name: "unindented block list", in: "ignore:\n- \"*.tmp\"\n- drafts/**\n",
+			want: map[string]any{"ignore": []any{"*.tmp", "drafts/**"}}},
+		{name: "key without items", in: "ignore:\nquality: 80\n",
+			want: map[string]any{"ignore": []any{}, "quality": int64(80)}},
+		{name: "quoting", in: "base_path: \"/cdn/#v1\"\nprofile: 'a: b'\neffort: \"80\"\n",
+			want: map[string]any{"base_path": "/cdn/#v1", "profile": "a: b", "effort": "80"}},
+		{name: "comments", in: "# tgimg\n\nquality: 80 # high\nbase_path: /a#b\n  # indented comment\n",
+			want: map[string]any{"quality": int64(80), "base_path": "/a#b"}},
+
+		{name: "item without key", in: "- webp\n", err: "line 1: list item without a key"},
+		{name: "item after scalar", in: "quality: 80\n  - webp\n", err: "line 2: list item without a key"},
+		{name: "nested mapping", in: "profiles:\n  cards:\n    quality: 75\n", err: "line 2: nested mappings are not supported"},
+		{name: "missing colon", in: "quality 80\n", err: "line 1: expected \"key: value\""},
+		{name: "unterminated list", in: "widths: [320, 640\n", err: "line 1: unterminated list"},
+	} {
+		got, err := parseYAML([]byte(tc.in))
+		checkParse(t, tc.name, got, err, tc.want, tc.err)
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		want map[string]any
+		err  string
+	}{
+		{name: "scalars", in: "input = \"./images\"\nquality = 80\nno_cache = false\n",
+			want: map[string]any{"input": "./images", "quality": int64(80), "no_cache": false}},
+		{name: "quoted key", in: "\"base_path\" = '/cdn/'\r\n",
+			want: map[string]any{"base_path": "/cdn/"}},
+		{name: "arrays", in: "widths = [320, 640]\nformats = [\"webp\", 'jpeg',]\nignore = []\n",
+			want: map[string]any{"widths": []any{int64(320), int64(640)}, "formats": []any{"webp", "jpeg"}, "ignore": []any{}}},
+		{name: "comments", in: "# tgimg\n\nquality = 80 # high\nbase_path = \"/a # b\"\n",
+			want: map[string]any{"quality": int64(80), "base_path": "/a # b"}},
+
+		{name: "table", in: "quality = 80\n[profiles.cards]\n", err: "line 2: tables are not supported"},
+		{name: "missing equals", in: "quality: 80\n", err: "line 1: expected \"key = value\""},
+		{name: "unterminated array", in: "widths = [320,\n", err: "line 1: unterminated list"},
+	} {
+		got, err := parseTOML([]byte(tc.in))
+		checkParse(t, tc.name, got, err, tc.want, tc.err)
+	}
+}
+
+func checkParse(t *testing.T, name string, got map[string]any, err error, want map[string]any, wantErr string) {
+	t.Helper()
+	switch {
+	case wantErr != "":
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%s: error %v, want %q", name, err, wantErr)
+		}
+	case err != nil:
+		t.Errorf("%s: %v", name, err)
+	case !reflect.DeepEqual(got, want):
+		t.Errorf("%s: got %#v, want %#v", name, got, want)
+	}
+}
+
+// TestLoadFormats loads the same flat config from every format.
+func TestLoadFormats(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"tgimg.config.json": `{"input": "./images", "widths": [320, 640], "formats": ["webp", "jpeg"], "quality": 80, "dprs": [1, 2], "ignore": ["*.tmp"]}`,
+		"tgimg.config.yaml": "input: ./images\nwidths: [320, 640]\nformats:\n  - webp\n  - jpeg\nquality: 80\ndprs: [1, 2]\nignore:\n  - \"*.tmp\"\n",
+		"tgimg.config.toml": "input = \"./images\"\nwidths = [320, 640]\nformats = [\"webp\", \"jpeg\"]\nquality = 80\ndprs = [1, 2]\nignore = [\"*.tmp\"]\n",
+	}
+	var want *Config
+	for _, name := range []string{"tgimg.config.json", "tgimg.config.yaml", "tgimg.config.toml"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(files[name]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		c, err := Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Path = ""
+		if want == nil {
+			want = c
+		} else if !reflect.DeepEqual(c, want) {
+			t.Errorf("%s: %+v, want %+v", name, c, want)
+		}
+	}
+
+	for name, data := range map[string]string{
+		"typo.yaml":  "qualty: 80\n",
+		"type.toml":  "quality = \"high\"\n",
+		"range.yaml": "quality: 101\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("%s: loaded, want an error", name)
+		}
+	}
+}
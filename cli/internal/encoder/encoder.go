@@ -1,6 +1,7 @@
 package encoder
 
 import (
+	"fmt"
 	"image"
 )
 
@@ -10,7 +11,9 @@ type Encoder interface {
 	Format() string
 
 	// Encode converts the image to bytes at the given quality (1-100).
-	Encode(img image.Image, quality int) ([]byte, error)
+	// Effort trades encoding time for file size; encoders without such a
+	// setting ignore it.
+	Encode(img image.Image, quality int, effort Effort) ([]byte, error)
 
 	// Available returns true if the encoder is ready to use.
 	// External encoders (cwebp, avifenc) may not be installed.
@@ -18,4 +21,54 @@ type Encoder interface {
 
 	// Extension returns the file extension without dot.
 	Extension() string
+
+	// Version returns a human-readable version string for the encoder
+	// implementation, recorded in the manifest's build info.
+	Version() string
+}
+
+// DefaultQuality is used when a caller passes a quality outside 1-100.
+const DefaultQuality = 82
+
+// EffectiveQuality returns the quality an encoder will actually use for
+// the requested value: out-of-range values fall back to DefaultQuality.
+func EffectiveQuality(quality int) int {
+	if quality <= 0 || quality > 100 {
+		return DefaultQuality
+	}
+	return quality
+}
+
+// Effort trades encoding time for smaller files at the same quality.
+type Effort string
+
+// Encoding efforts. EffortBalanced is the default and keeps the settings
+// used before efforts existed.
+const (
+	EffortFast     Effort = "fast"     // quick dev builds
+	EffortBalanced Effort = "balanced" // cwebp -m 6, avifenc --speed 6
+	EffortMax      Effort = "max"      // smallest files for release builds
+)
+
+// Efforts lists the valid efforts from fastest to slowest.
+var Efforts = []Effort{EffortFast, EffortBalanced, EffortMax}
+
+// ParseEffort checks an effort name. "" is the default, EffortBalanced.
+func ParseEffort(s string) (Effort, error) {
+	switch e := Effort(s); e {
+	case "":
+		return EffortBalanced, nil
+	case EffortFast, EffortBalanced, EffortMax:
+		return e, nil
+	}
+	return "", fmt.Errorf("invalid effort %q: want fast, balanced or max", s)
+}
+
+// EffectiveEffort returns the effort an encoder will actually use: ""
+// and unknown values fall back to EffortBalanced.
+func EffectiveEffort(e Effort) Effort {
+	if e, err := ParseEffort(string(e)); err == nil {
+		return e
+	}
+	return EffortBalanced
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"image"
 	"image/jpeg"
+	"runtime"
 )
 
 // JPEGEncoder encodes images to JPEG using Go's standard library.
@@ -12,11 +13,10 @@ type JPEGEncoder struct{}
 func (e *JPEGEncoder) Format() string    { return "jpeg" }
 func (e *JPEGEncoder) Extension() string { return "jpeg" }
 func (e *JPEGEncoder) Available() bool   { return true }
+func (e *JPEGEncoder) Version() string   { return "stdlib " + runtime.Version() }
 
-func (e *JPEGEncoder) Encode(img image.Image, quality int) ([]byte, error) {
-	if quality <= 0 || quality > 100 {
-		quality = 82
-	}
+func (e *JPEGEncoder) Encode(img image.Image, quality int, _ Effort) ([]byte, error) {
+	quality = EffectiveQuality(quality)
 
 	var buf bytes.Buffer
 	buf.Grow(256 * 1024) // pre-alloc 256KB — avoids repeated grow for typical photos
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"image"
 	"image/png"
+	"runtime"
 )
 
 // PNGEncoder encodes images to PNG using Go's standard library.
@@ -13,12 +14,21 @@ type PNGEncoder struct{}
 func (e *PNGEncoder) Format() string    { return "png" }
 func (e *PNGEncoder) Extension() string { return "png" }
 func (e *PNGEncoder) Available() bool   { return true }
+func (e *PNGEncoder) Version() string   { return "stdlib " + runtime.Version() }
 
-func (e *PNGEncoder) Encode(img image.Image, _ int) ([]byte, error) {
+// pngCompression maps efforts to zlib levels. Balanced and max both use
+// the best compression, as PNG encoding always did.
+var pngCompression = map[Effort]png.CompressionLevel{
+	EffortFast:     png.BestSpeed,
+	EffortBalanced: png.BestCompression,
+	EffortMax:      png.BestCompression,
+}
+
+func (e *PNGEncoder) Encode(img image.Image, _ int, effort Effort) ([]byte, error) {
 	var buf bytes.Buffer
 	buf.Grow(512 * 1024) // pre-alloc 512KB
 
-	enc := &png.Encoder{CompressionLevel: png.BestCompression}
+	enc := &png.Encoder{CompressionLevel: pngCompression[EffectiveEffort(effort)]}
 	err := enc.Encode(&buf, img)
 	if err != nil {
 		return nil, err
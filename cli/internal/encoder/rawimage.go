@@ -0,0 +1,124 @@
+package encoder
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+
+	"github.com/AnyUserName/tgimg-cli/internal/tempfile"
+)
+
+// cwebp and avifenc read their input from a file. PNG would cost a
+// deflate per variant only for the tool to inflate it again, so the
+// image is handed over uncompressed: PAM for cwebp, Y4M for avifenc.
+
+// opaque reports whether img is known to have no transparent pixels.
+func opaque(img image.Image) bool {
+	o, ok := img.(interface{ Opaque() bool })
+	return ok && o.Opaque()
+}
+
+// nrgbaRows calls fn with each row of img as NRGBA bytes. The rows of an
+// *image.NRGBA are passed as they are; fn must not keep them.
+func nrgbaRows(img image.Image, fn func(row []byte) error) error {
+	b := img.Bounds()
+	if m, ok := img.(*image.NRGBA); ok {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			i := m.PixOffset(b.Min.X, y)
+			if err := fn(m.Pix[i : i+4*b.Dx()]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	row := make([]byte, 4*b.Dx())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			i := 4 * (x - b.Min.X)
+			row[i], row[i+1], row[i+2], row[i+3] = c.R, c.G, c.B, c.A
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePAM writes img as a PAM (Netpbm P7) RGB_ALPHA image, which cwebp
+// reads like a PNG. An opaque alpha channel is dropped by cwebp.
+func writePAM(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	bw := bufio.NewWriterSize(w, 64<<10)
+	fmt.Fprintf(bw, "P7\nWIDTH %d\nHEIGHT %d\nDEPTH 4\nMAXVAL 255\nTUPLTYPE RGB_ALPHA\nENDHDR\n", b.Dx(), b.Dy())
+	if err := nrgbaRows(img, func(row []byte) error {
+		_, err := bw.Write(row)
+		return err
+	}); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// writeY4M writes img as a single-frame full-range 4:4:4 YUV4MPEG2 file,
+// with an alpha plane unless img is opaque. Y'CbCr is BT.601 as JPEG
+// uses it (color.RGBToYCbCr), which avifenc must be told with --cicp
+// (see y4mCICP); it is the matrix avifenc picks for a PNG too.
+func writeY4M(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	n := b.Dx() * b.Dy()
+	withAlpha := !opaque(img)
+	planes := make([]byte, 3*n, 4*n)
+	if withAlpha {
+		planes = planes[:4*n]
+	}
+	yp, cb, cr := planes[:n], planes[n:2*n], planes[2*n:3*n]
+	i := 0
+	if err := nrgbaRows(img, func(row []byte) error {
+		for x := 0; x < len(row); x += 4 {
+			yp[i], cb[i], cr[i] = color.RGBToYCbCr(row[x], row[x+1], row[x+2])
+			if withAlpha {
+				planes[3*n+i] = row[x+3]
+			}
+			i++
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	chroma := "444"
+	if withAlpha {
+		chroma = "444alpha"
+	}
+	if _, err := fmt.Fprintf(w, "YUV4MPEG2 W%d H%d F25:1 Ip A1:1 C%s XCOLORRANGE=FULL\nFRAME\n", b.Dx(), b.Dy(), chroma); err != nil {
+		return err
+	}
+	_, err := w.Write(planes)
+	return err
+}
+
+// y4mCICP is the avifenc --cicp value matching writeY4M: BT.709
+// primaries, sRGB transfer and BT.601 matrix coefficients.
+const y4mCICP = "1/13/6"
+
+// writeTemp writes img to a new file in the run's temp directory with
+// write, returning its path. The caller removes it.
+func writeTemp(pattern string, img image.Image, write func(io.Writer, image.Image) error) (string, error) {
+	f, err := tempfile.Create(pattern)
+	if err != nil {
+		return "", fmt.Errorf("create temp: %w", err)
+	}
+	err = write(f, img)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("write temp image: %w", err)
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,120 @@
+package encoder
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// rawTestImages returns a 3×2 image with distinct pixels, once as an
+// *image.NRGBA sub-image (so rows do not start at Pix[0]) and once as an
+// *image.RGBA, which takes the conversion path. alpha sets the alpha of
+// pixel (1, 1); 255 keeps the image opaque.
+func rawTestImages(alpha uint8) []image.Image {
+	big := image.NewNRGBA(image.Rect(0, 0, 5, 4))
+	rgba := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			c := color.NRGBA{uint8(40 * x), uint8(100 + 50*y), uint8(200 - 30*x), 255}
+			if x == 1 && y == 1 {
+				c.A = alpha
+			}
+			big.SetNRGBA(x+2, y+1, c)
+			rgba.Set(x, y, c)
+		}
+	}
+	return []image.Image{big.SubImage(image.Rect(2, 1, 5, 3)), rgba}
+}
+
+// wantPixel returns pixel (x, y) of rawTestImages as NRGBA, as read back
+// from img.
+func wantPixel(img image.Image, x, y int) color.NRGBA {
+	b := img.Bounds()
+	return color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+}
+
+func TestWritePAM(t *testing.T) {
+	for _, img := range append(rawTestImages(255), rawTestImages(128)...) {
+		name := fmt.Sprintf("%T opaque=%v", img, opaque(img))
+		var buf bytes.Buffer
+		if err := writePAM(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		header := "P7\nWIDTH 3\nHEIGHT 2\nDEPTH 4\nMAXVAL 255\nTUPLTYPE RGB_ALPHA\nENDHDR\n"
+		data, ok := bytes.CutPrefix(buf.Bytes(), []byte(header))
+		if !ok {
+			t.Fatalf("%s: header %q", name, buf.Bytes()[:min(buf.Len(), len(header))])
+		}
+		if len(data) != 3*2*4 {
+			t.Fatalf("%s: %d bytes of pixels, want 24", name, len(data))
+		}
+		for y := 0; y < 2; y++ {
+			for x := 0; x < 3; x++ {
+				p := data[4*(3*y+x):]
+				if got, want := (color.NRGBA{p[0], p[1], p[2], p[3]}), wantPixel(img, x, y); got != want {
+					t.Errorf("%s: pixel %d,%d is %v, want %v", name, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestWriteY4M(t *testing.T) {
+	for _, alpha := range []uint8{255, 128} {
+		for _, img := range rawTestImages(alpha) {
+			name := fmt.Sprintf("%T alpha=%d", img, alpha)
+			var buf bytes.Buffer
+			if err := writeY4M(&buf, img); err != nil {
+				t.Fatal(err)
+			}
+			chroma, planes := "C444", 3
+			if alpha != 255 {
+				chroma, planes = "C444alpha", 4
+			}
+			header := fmt.Sprintf("YUV4MPEG2 W3 H2 F25:1 Ip A1:1 %s XCOLORRANGE=FULL\nFRAME\n", chroma)
+			data, ok := bytes.CutPrefix(buf.Bytes(), []byte(header))
+			if !ok {
+				t.Fatalf("%s: header %q, want %q", name, buf.Bytes()[:min(buf.Len(), len(header)+8)], header)
+			}
+			const n = 3 * 2
+			if len(data) != planes*n {
+				t.Fatalf("%s: %d bytes of planes, want %d", name, len(data), planes*n)
+			}
+			// Planes are Y, Cb, Cr and alpha, each in row order.
+			for y := 0; y < 2; y++ {
+				for x := 0; x < 3; x++ {
+					i := 3*y + x
+					c := wantPixel(img, x, y)
+					wy, wcb, wcr := color.RGBToYCbCr(c.R, c.G, c.B)
+					if data[i] != wy || data[n+i] != wcb || data[2*n+i] != wcr {
+						t.Errorf("%s: pixel %d,%d is Y'CbCr %d,%d,%d, want %d,%d,%d",
+							name, x, y, data[i], data[n+i], data[2*n+i], wy, wcb, wcr)
+					}
+					if planes == 4 && data[3*n+i] != c.A {
+						t.Errorf("%s: pixel %d,%d has alpha %d, want %d", name, x, y, data[3*n+i], c.A)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestY4MMatrix pins one pixel of the BT.601 full-range conversion that
+// y4mCICP declares: pure red in JPEG's Y'CbCr.
+func TestY4MMatrix(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+	var buf bytes.Buffer
+	if err := writeY4M(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	planes := buf.Bytes()[buf.Len()-3:]
+	if want := []byte{76, 85, 255}; !bytes.Equal(planes, want) {
+		t.Errorf("red is Y'CbCr %v, want %v", planes, want)
+	}
+	if y4mCICP != "1/13/6" {
+		t.Errorf("y4mCICP = %s; the planes are BT.601 (matrix 6)", y4mCICP)
+	}
+}
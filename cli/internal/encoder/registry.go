@@ -12,18 +12,19 @@ type Registry struct {
 
 // NewRegistry creates a registry, probing all encoders for availability.
 func NewRegistry() *Registry {
-	r := &Registry{
-		encoders: make(map[string]Encoder),
-	}
-
 	// Register all encoders. Only available ones will be used.
-	all := []Encoder{
+	return newRegistry(
 		&AVIFEncoder{},
 		&WebPEncoder{},
 		&JPEGEncoder{},
 		&PNGEncoder{},
-	}
+	)
+}
 
+func newRegistry(all ...Encoder) *Registry {
+	r := &Registry{
+		encoders: make(map[string]Encoder),
+	}
 	for _, enc := range all {
 		if enc.Available() {
 			r.encoders[enc.Format()] = enc
@@ -33,6 +34,24 @@ func NewRegistry() *Registry {
 	return r
 }
 
+// SetSubprocessLimit caps how many external encoder processes (cwebp,
+// avifenc) run at once across all goroutines, independently of the number
+// of pipeline workers. n <= 0 removes the cap. Call it before encoding.
+func (r *Registry) SetSubprocessLimit(n int) {
+	var l procLimit
+	if n > 0 {
+		l = make(procLimit, n)
+	}
+	for _, enc := range r.encoders {
+		switch e := enc.(type) {
+		case *WebPEncoder:
+			e.limit = l
+		case *AVIFEncoder:
+			e.limit = l
+		}
+	}
+}
+
 // Get returns an encoder for the given format, or nil if unavailable.
 func (r *Registry) Get(format string) Encoder {
 	return r.encoders[strings.ToLower(format)]
@@ -50,15 +69,40 @@ func (r *Registry) Available() []string {
 	return result
 }
 
+// Versions returns the version string of every available encoder, by
+// format. Formats without an available encoder are left out rather than
+// mapped to "", so the manifest's build info only names encoders that
+// could have produced its variants.
+func (r *Registry) Versions() map[string]string {
+	out := make(map[string]string, len(r.encoders))
+	for f, enc := range r.encoders {
+		if !enc.Available() {
+			continue
+		}
+		if v := enc.Version(); v != "" {
+			out[f] = v
+		}
+	}
+	return out
+}
+
 // ResolveFormats filters requested formats to only those available,
 // and ensures at least one fallback format is present.
 func (r *Registry) ResolveFormats(requested []string, hasAlpha bool) []string {
+	return ResolveFormats(requested, hasAlpha, func(f string) bool { return r.encoders[f] != nil })
+}
+
+// ResolveFormats filters requested formats to those available reports,
+// and ensures at least one fallback format is present. Registry uses it
+// for the local encoders; image CDNs, which encode every format, pass
+// any known format.
+func ResolveFormats(requested []string, hasAlpha bool, available func(format string) bool) []string {
 	var resolved []string
 	seen := map[string]bool{}
 
 	for _, f := range requested {
 		f = strings.ToLower(f)
-		if _, ok := r.encoders[f]; ok && !seen[f] {
+		if available(f) && !seen[f] {
 			resolved = append(resolved, f)
 			seen[f] = true
 		}
@@ -67,11 +111,11 @@ func (r *Registry) ResolveFormats(requested []string, hasAlpha bool) []string {
 	// Ensure we always have at least one output format.
 	if len(resolved) == 0 {
 		if hasAlpha {
-			if r.encoders["png"] != nil {
+			if available("png") {
 				resolved = append(resolved, "png")
 			}
 		} else {
-			if r.encoders["jpeg"] != nil {
+			if available("jpeg") {
 				resolved = append(resolved, "jpeg")
 			}
 		}
@@ -79,7 +123,7 @@ func (r *Registry) ResolveFormats(requested []string, hasAlpha bool) []string {
 
 	// For alpha images, ensure PNG is included as fallback
 	// (webp/avif may not support alpha well on all decoders).
-	if hasAlpha && !seen["png"] && r.encoders["png"] != nil {
+	if hasAlpha && !seen["png"] && available("png") {
 		resolved = append(resolved, "png")
 	}
 
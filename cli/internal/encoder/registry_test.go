@@ -0,0 +1,59 @@
+package encoder
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+// fakeEncoder is an Encoder whose availability and version a test sets.
+type fakeEncoder struct {
+	format    string
+	available bool
+	version   string
+}
+
+func (e *fakeEncoder) Format() string    { return e.format }
+func (e *fakeEncoder) Extension() string { return e.format }
+func (e *fakeEncoder) Available() bool   { return e.available }
+func (e *fakeEncoder) Version() string   { return e.version }
+
+func (e *fakeEncoder) Encode(image.Image, int, Effort) ([]byte, error) { return nil, nil }
+
+func TestRegistryVersions(t *testing.T) {
+	webp := &fakeEncoder{format: "webp", available: true, version: "cwebp 1.4.0"}
+	r := newRegistry(
+		&fakeEncoder{format: "avif"}, // avifenc not installed
+		webp,
+		&fakeEncoder{format: "jpeg", available: true, version: "stdlib go1.22"},
+		&fakeEncoder{format: "png", available: true}, // no version to report
+	)
+	want := map[string]string{"webp": "cwebp 1.4.0", "jpeg": "stdlib go1.22"}
+	if got := r.Versions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Versions() = %v, want %v", got, want)
+	}
+	if got := r.Available(); !reflect.DeepEqual(got, []string{"webp", "jpeg", "png"}) {
+		t.Errorf("Available() = %v", got)
+	}
+
+	// An encoder that goes away after the registry probed it.
+	webp.available = false
+	if _, ok := r.Versions()["webp"]; ok {
+		t.Error("unavailable webp encoder listed")
+	}
+}
+
+func TestNewRegistryVersions(t *testing.T) {
+	r := NewRegistry()
+	versions := r.Versions()
+	for _, f := range r.Available() {
+		if versions[f] == "" {
+			t.Errorf("%s: available but no version", f)
+		}
+	}
+	for f, v := range versions {
+		if r.Get(f) == nil || v == "" {
+			t.Errorf("%s: version %q for an unavailable encoder", f, v)
+		}
+	}
+}
@@ -3,16 +3,35 @@ package encoder
 import (
 	"fmt"
 	"image"
-	"image/png"
 	"os"
 	"os/exec"
+	"strings"
 	"sync"
 	"sync/atomic"
+
+	"github.com/AnyUserName/tgimg-cli/internal/tempfile"
+	"github.com/AnyUserName/tgimg-cli/internal/tools"
 )
 
 // Atomic counter for unique temp file names across goroutines.
 var tempCounter atomic.Int64
 
+// procLimit is a counting semaphore for encoder subprocesses.
+// A nil limit never blocks.
+type procLimit chan struct{}
+
+func (l procLimit) acquire() {
+	if l != nil {
+		l <- struct{}{}
+	}
+}
+
+func (l procLimit) release() {
+	if l != nil {
+		<-l
+	}
+}
+
 // WebPEncoder encodes images to WebP by shelling out to cwebp.
 // This approach avoids CGO while still producing optimized WebP.
 // Install: brew install webp / apt install webp
@@ -20,6 +39,10 @@ type WebPEncoder struct {
 	once      sync.Once
 	available bool
 	cwebpPath string
+	limit     procLimit // shared with the other external encoders
+
+	versionOnce sync.Once
+	version     string
 }
 
 func (e *WebPEncoder) Format() string    { return "webp" }
@@ -27,7 +50,7 @@ func (e *WebPEncoder) Extension() string { return "webp" }
 
 func (e *WebPEncoder) Available() bool {
 	e.once.Do(func() {
-		path, err := exec.LookPath("cwebp")
+		path, err := tools.LookPath("cwebp")
 		if err == nil {
 			e.available = true
 			e.cwebpPath = path
@@ -36,53 +59,59 @@ func (e *WebPEncoder) Available() bool {
 	return e.available
 }
 
-func (e *WebPEncoder) Encode(img image.Image, quality int) ([]byte, error) {
+// Version returns the output of `cwebp -version`, e.g. "cwebp 1.3.2".
+func (e *WebPEncoder) Version() string {
+	e.versionOnce.Do(func() {
+		if e.Available() {
+			e.version = "cwebp " + toolVersion(e.cwebpPath, "-version")
+		}
+	})
+	return e.version
+}
+
+// cwebpMethod maps efforts to cwebp's -m compression method (0=fast,
+// 6=best). Balanced already uses the slowest method, so max matches it.
+var cwebpMethod = map[Effort]int{
+	EffortFast:     2,
+	EffortBalanced: 6,
+	EffortMax:      6,
+}
+
+func (e *WebPEncoder) Encode(img image.Image, quality int, effort Effort) ([]byte, error) {
 	if !e.Available() {
-		return nil, fmt.Errorf("cwebp not found in PATH; install with: brew install webp")
-	}
-	if quality <= 0 || quality > 100 {
-		quality = 82
+		return nil, fmt.Errorf("cwebp not found; install with: brew install webp, or run tgimg doctor")
 	}
+	quality = EffectiveQuality(quality)
 
-	// Write source as PNG to temp file (cwebp reads files).
+	// Write source as PAM to temp file (cwebp reads files).
 	// Use atomic counter to ensure unique filenames across goroutines.
 	id := tempCounter.Add(1)
-	srcFile, err := os.CreateTemp("", fmt.Sprintf("tgimg_src_%d_*.png", id))
+	srcPath, err := writeTemp(fmt.Sprintf("tgimg_src_%d_*.pam", id), img, writePAM)
 	if err != nil {
-		return nil, fmt.Errorf("create temp: %w", err)
+		return nil, err
 	}
-	srcPath := srcFile.Name()
-	dstFile, err := os.CreateTemp("", fmt.Sprintf("tgimg_dst_%d_*.webp", id))
+	defer os.Remove(srcPath)
+	dstFile, err := tempfile.Create(fmt.Sprintf("tgimg_dst_%d_*.webp", id))
 	if err != nil {
-		srcFile.Close()
-		os.Remove(srcPath)
 		return nil, fmt.Errorf("create temp: %w", err)
 	}
 	dstPath := dstFile.Name()
 	dstFile.Close()
-	defer os.Remove(srcPath)
 	defer os.Remove(dstPath)
 
-	f := srcFile
-	if err != nil {
-		return nil, fmt.Errorf("create temp: %w", err)
-	}
-	if err := png.Encode(f, img); err != nil {
-		f.Close()
-		return nil, fmt.Errorf("encode temp png: %w", err)
-	}
-	f.Close()
-
 	// Run cwebp.
 	cmd := exec.Command(e.cwebpPath,
 		"-q", fmt.Sprintf("%d", quality),
-		"-m", "6", // compression method (0=fast, 6=best)
+		"-m", fmt.Sprintf("%d", cwebpMethod[EffectiveEffort(effort)]),
 		"-mt",     // multi-threaded
 		"-quiet",
 		srcPath,
 		"-o", dstPath,
 	)
-	if out, err := cmd.CombinedOutput(); err != nil {
+	e.limit.acquire()
+	out, err := cmd.CombinedOutput()
+	e.limit.release()
+	if err != nil {
 		return nil, fmt.Errorf("cwebp: %w: %s", err, string(out))
 	}
 
@@ -91,10 +120,15 @@ func (e *WebPEncoder) Encode(img image.Image, quality int) ([]byte, error) {
 
 // AVIFEncoder encodes images to AVIF by shelling out to avifenc.
 // Install: brew install libavif / apt install libavif-bin
+// cwebp and avifenc are looked up on PATH, then in the tools directory.
 type AVIFEncoder struct {
 	once        sync.Once
 	available   bool
 	avifencPath string
+	limit       procLimit // shared with the other external encoders
+
+	versionOnce sync.Once
+	version     string
 }
 
 func (e *AVIFEncoder) Format() string    { return "avif" }
@@ -102,7 +136,7 @@ func (e *AVIFEncoder) Extension() string { return "avif" }
 
 func (e *AVIFEncoder) Available() bool {
 	e.once.Do(func() {
-		path, err := exec.LookPath("avifenc")
+		path, err := tools.LookPath("avifenc")
 		if err == nil {
 			e.available = true
 			e.avifencPath = path
@@ -111,57 +145,80 @@ func (e *AVIFEncoder) Available() bool {
 	return e.available
 }
 
-func (e *AVIFEncoder) Encode(img image.Image, quality int) ([]byte, error) {
+// Version returns the first line of `avifenc --version`,
+// e.g. "avifenc Version: 1.0.4 (dav1d [dec]:1.4.1, aom [enc/dec]:3.8.2)".
+func (e *AVIFEncoder) Version() string {
+	e.versionOnce.Do(func() {
+		if e.Available() {
+			e.version = "avifenc " + toolVersion(e.avifencPath, "--version")
+		}
+	})
+	return e.version
+}
+
+// avifencSpeed maps efforts to avifenc's --speed (0=slowest, 10=fastest).
+var avifencSpeed = map[Effort]int{
+	EffortFast:     9,
+	EffortBalanced: 6,
+	EffortMax:      2,
+}
+
+func (e *AVIFEncoder) Encode(img image.Image, quality int, effort Effort) ([]byte, error) {
 	if !e.Available() {
-		return nil, fmt.Errorf("avifenc not found in PATH; install with: brew install libavif")
-	}
-	if quality <= 0 || quality > 100 {
-		quality = 82
+		return nil, fmt.Errorf("avifenc not found; install with: brew install libavif, or run tgimg doctor")
 	}
+	quality = EffectiveQuality(quality)
 
 	// avifenc uses a different quality scale: lower = better, 0-63.
 	// Map our 1-100 to avifenc's scale.
 	avifQ := 63 - (quality * 63 / 100)
-	speed := 6 // 0=slowest, 10=fastest
+	speed := avifencSpeed[EffectiveEffort(effort)]
 
+	// avifenc tells inputs apart by extension, so the Y4M needs its own.
 	id := tempCounter.Add(1)
-	srcFile, err := os.CreateTemp("", fmt.Sprintf("tgimg_avif_src_%d_*.png", id))
+	srcPath, err := writeTemp(fmt.Sprintf("tgimg_avif_src_%d_*.y4m", id), img, writeY4M)
 	if err != nil {
-		return nil, fmt.Errorf("create temp: %w", err)
+		return nil, err
 	}
-	srcPath := srcFile.Name()
-	dstFile, err := os.CreateTemp("", fmt.Sprintf("tgimg_avif_dst_%d_*.avif", id))
+	defer os.Remove(srcPath)
+	dstFile, err := tempfile.Create(fmt.Sprintf("tgimg_avif_dst_%d_*.avif", id))
 	if err != nil {
-		srcFile.Close()
-		os.Remove(srcPath)
 		return nil, fmt.Errorf("create temp: %w", err)
 	}
 	dstPath := dstFile.Name()
 	dstFile.Close()
-	defer os.Remove(srcPath)
 	defer os.Remove(dstPath)
 
-	f := srcFile
-	if err != nil {
-		return nil, fmt.Errorf("create temp: %w", err)
-	}
-	if err := png.Encode(f, img); err != nil {
-		f.Close()
-		return nil, fmt.Errorf("encode temp png: %w", err)
-	}
-	f.Close()
-
 	cmd := exec.Command(e.avifencPath,
 		"--min", fmt.Sprintf("%d", avifQ),
 		"--max", fmt.Sprintf("%d", avifQ),
 		"--speed", fmt.Sprintf("%d", speed),
+		"--cicp", y4mCICP,
 		"-j", "all",
 		srcPath,
 		dstPath,
 	)
-	if out, err := cmd.CombinedOutput(); err != nil {
+	e.limit.acquire()
+	out, err := cmd.CombinedOutput()
+	e.limit.release()
+	if err != nil {
 		return nil, fmt.Errorf("avifenc: %w: %s", err, string(out))
 	}
 
 	return os.ReadFile(dstPath)
 }
+
+// toolVersion runs an external encoder with its version flag and returns
+// the first non-empty output line, or "unknown" if it cannot be determined.
+func toolVersion(path string, args ...string) string {
+	out, err := exec.Command(path, args...).CombinedOutput()
+	if err != nil {
+		return "unknown"
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return "unknown"
+}
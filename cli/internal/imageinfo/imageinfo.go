@@ -0,0 +1,289 @@
+// Package imageinfo reports source image properties that affect how an
+// asset is processed: color model, subsampling, bit depth, EXIF
+// orientation, embedded ICC profiles and wide-gamut color spaces.
+package imageinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+
+	"github.com/AnyUserName/tgimg-cli/internal/colorspace"
+)
+
+// Info describes a decoded image and its container metadata.
+type Info struct {
+	Format      string `json:"format"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ColorModel  string `json:"color_model"`
+	Subsampling string `json:"subsampling,omitempty"` // "4:2:0" etc. for YCbCr images
+	BitDepth    int    `json:"bit_depth"`             // bits per channel
+	Orientation int    `json:"orientation"`           // EXIF orientation 1-8; 1 if absent
+	HasICC      bool   `json:"has_icc"`
+	HasAlpha    bool   `json:"has_alpha"`    // the color model has an alpha channel
+	UsesAlpha   bool   `json:"uses_alpha"`   // some pixel is not fully opaque
+	DecodeBytes int64  `json:"decode_bytes"` // memory held by the decoded pixel buffer
+	FileSize    int64  `json:"file_size"`
+
+	// ColorSpace names the wide-gamut color space the image is tagged
+	// with, which the pipeline converts to sRGB; ColorError says why a
+	// tagged color space is kept as it is.
+	ColorSpace string `json:"color_space,omitempty"`
+	ColorError string `json:"color_space_error,omitempty"`
+}
+
+// Inspect decodes the image at path and collects its metadata. The image
+// is returned as the pipeline sees it: converted to sRGB if it is tagged
+// with a wide-gamut color space.
+func Inspect(path string) (*Info, image.Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+
+	b := img.Bounds()
+	info := &Info{
+		Format:      format,
+		Width:       b.Dx(),
+		Height:      b.Dy(),
+		Orientation: 1,
+		FileSize:    int64(len(data)),
+	}
+	info.ColorModel, info.BitDepth, info.HasAlpha = describeModel(img)
+	info.DecodeBytes = decodeBytes(img)
+	if ycc, ok := img.(*image.YCbCr); ok {
+		info.Subsampling = subsamplingNames[ycc.SubsampleRatio]
+	}
+	info.UsesAlpha = info.HasAlpha && !opaque(img)
+
+	switch format {
+	case "jpeg":
+		info.Orientation, info.HasICC = scanJPEG(data)
+	case "png":
+		info.HasICC = hasPNGChunk(data, "iCCP")
+	case "webp":
+		info.Orientation, info.HasICC = scanWebP(data)
+	}
+	if t, err := colorspace.FromHeader(data); err != nil {
+		info.ColorError = err.Error()
+	} else if t != nil {
+		info.ColorSpace = t.Name
+		img = t.Convert(img)
+	}
+	return info, img, nil
+}
+
+var subsamplingNames = map[image.YCbCrSubsampleRatio]string{
+	image.YCbCrSubsampleRatio444: "4:4:4",
+	image.YCbCrSubsampleRatio422: "4:2:2",
+	image.YCbCrSubsampleRatio420: "4:2:0",
+	image.YCbCrSubsampleRatio440: "4:4:0",
+	image.YCbCrSubsampleRatio411: "4:1:1",
+	image.YCbCrSubsampleRatio410: "4:1:0",
+}
+
+// describeModel names the decoded color model and its bit depth.
+func describeModel(img image.Image) (name string, depth int, alpha bool) {
+	switch img.(type) {
+	case *image.YCbCr:
+		return "YCbCr", 8, false
+	case *image.NYCbCrA:
+		return "YCbCrA", 8, true
+	case *image.CMYK:
+		return "CMYK", 8, false
+	case *image.Gray:
+		return "Gray", 8, false
+	case *image.Gray16:
+		return "Gray", 16, false
+	case *image.Paletted:
+		return "Paletted", 8, true
+	case *image.NRGBA:
+		return "NRGBA", 8, true
+	case *image.RGBA:
+		return "RGBA", 8, true
+	case *image.NRGBA64:
+		return "NRGBA", 16, true
+	case *image.RGBA64:
+		return "RGBA", 16, true
+	}
+	switch img.ColorModel() {
+	case color.Alpha16Model, color.AlphaModel:
+		return "Alpha", 8, true
+	}
+	return fmt.Sprintf("%T", img), 8, true
+}
+
+// decodeBytes approximates the memory of the decoded pixel buffer.
+func decodeBytes(img image.Image) int64 {
+	switch m := img.(type) {
+	case *image.YCbCr:
+		return int64(len(m.Y) + len(m.Cb) + len(m.Cr))
+	case *image.NYCbCrA:
+		return int64(len(m.Y) + len(m.Cb) + len(m.Cr) + len(m.A))
+	case *image.Gray:
+		return int64(len(m.Pix))
+	case *image.Gray16:
+		return int64(len(m.Pix))
+	case *image.Paletted:
+		return int64(len(m.Pix))
+	case *image.CMYK:
+		return int64(len(m.Pix))
+	case *image.NRGBA:
+		return int64(len(m.Pix))
+	case *image.RGBA:
+		return int64(len(m.Pix))
+	case *image.NRGBA64:
+		return int64(len(m.Pix))
+	case *image.RGBA64:
+		return int64(len(m.Pix))
+	}
+	b := img.Bounds()
+	return int64(b.Dx()) * int64(b.Dy()) * 4
+}
+
+// opaque reports whether every pixel has full alpha.
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// scanJPEG walks the JPEG marker segments up to the first scan and
+// returns the EXIF orientation and whether an ICC profile is embedded.
+func scanJPEG(data []byte) (orientation int, icc bool) {
+	orientation = 1
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return
+		}
+		marker := data[i+1]
+		if marker == 0xD8 || marker >= 0xD0 && marker <= 0xD7 || marker == 0x01 || marker == 0xFF {
+			i += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 { // start of scan / end of image
+			return
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if n < 2 || i+2+n > len(data) {
+			return
+		}
+		seg := data[i+4 : i+2+n]
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")):
+			if o := exifOrientation(seg[6:]); o != 0 {
+				orientation = o
+			}
+		case marker == 0xE2 && bytes.HasPrefix(seg, []byte("ICC_PROFILE\x00")):
+			icc = true
+		}
+		i += 2 + n
+	}
+	return
+}
+
+// exifOrientation reads tag 0x0112 from IFD0 of a TIFF-structured EXIF
+// block. It returns 0 if the tag is missing or malformed.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var bo binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(bo.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(bo.Uint16(tiff[ifd:]))
+	for j := 0; j < count; j++ {
+		e := ifd + 2 + j*12
+		if e+12 > len(tiff) {
+			return 0
+		}
+		if bo.Uint16(tiff[e:]) == 0x0112 {
+			o := int(bo.Uint16(tiff[e+8:]))
+			if o >= 1 && o <= 8 {
+				return o
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// hasPNGChunk reports whether a chunk of the given type precedes IDAT.
+func hasPNGChunk(data []byte, typ string) bool {
+	const sigLen = 8
+	for i := sigLen; i+8 <= len(data); {
+		n := int(binary.BigEndian.Uint32(data[i:]))
+		t := string(data[i+4 : i+8])
+		if t == typ {
+			return true
+		}
+		if t == "IDAT" || n < 0 || i+12+n > len(data) {
+			return false
+		}
+		i += 12 + n
+	}
+	return false
+}
+
+// scanWebP walks the RIFF chunks of an extended WebP for ICCP and EXIF.
+func scanWebP(data []byte) (orientation int, icc bool) {
+	orientation = 1
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return
+	}
+	for i := 12; i+8 <= len(data); {
+		typ := string(data[i : i+4])
+		n := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if n < 0 || i+8+n > len(data) {
+			return
+		}
+		switch typ {
+		case "ICCP":
+			icc = true
+		case "EXIF":
+			chunk := bytes.TrimPrefix(data[i+8:i+8+n], []byte("Exif\x00\x00"))
+			if o := exifOrientation(chunk); o != 0 {
+				orientation = o
+			}
+		}
+		i += 8 + n + n%2
+	}
+	return
+}
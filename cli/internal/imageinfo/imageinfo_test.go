@@ -0,0 +1,96 @@
+package imageinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// exifSegment builds an APP1 segment carrying a big-endian EXIF block
+// with a single orientation tag.
+func exifSegment(orientation uint16) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("MM")
+	binary.Write(&tiff, binary.BigEndian, uint16(42))
+	binary.Write(&tiff, binary.BigEndian, uint32(8)) // IFD0 offset
+	binary.Write(&tiff, binary.BigEndian, uint16(1)) // entry count
+	binary.Write(&tiff, binary.BigEndian, uint16(0x0112))
+	binary.Write(&tiff, binary.BigEndian, uint16(3)) // SHORT
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, orientation)
+	binary.Write(&tiff, binary.BigEndian, uint16(0))
+	binary.Write(&tiff, binary.BigEndian, uint32(0)) // next IFD
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestInspectJPEGOrientation(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	withExif := append(append([]byte{0xFF, 0xD8}, exifSegment(6)...), data[2:]...)
+
+	info, _, err := Inspect(writeFile(t, "a.jpg", withExif))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Format != "jpeg" || info.Width != 32 || info.Height != 16 {
+		t.Errorf("got %s %dx%d", info.Format, info.Width, info.Height)
+	}
+	if info.Orientation != 6 {
+		t.Errorf("orientation = %d, want 6", info.Orientation)
+	}
+	if info.ColorModel != "YCbCr" || info.Subsampling != "4:2:0" {
+		t.Errorf("model = %s %s, want YCbCr 4:2:0", info.ColorModel, info.Subsampling)
+	}
+	if info.HasICC {
+		t.Error("unexpected ICC profile")
+	}
+}
+
+func TestInspectPNGAlpha(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	img.SetNRGBA(1, 1, color.NRGBA{10, 20, 30, 128})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	info, _, err := Inspect(writeFile(t, "a.png", buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.HasAlpha || !info.UsesAlpha {
+		t.Errorf("alpha = %v/%v, want true/true", info.HasAlpha, info.UsesAlpha)
+	}
+	if info.Orientation != 1 || info.BitDepth != 8 {
+		t.Errorf("orientation %d depth %d", info.Orientation, info.BitDepth)
+	}
+	if info.DecodeBytes != 4*4*4 {
+		t.Errorf("decode bytes = %d", info.DecodeBytes)
+	}
+}
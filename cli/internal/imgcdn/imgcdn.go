@@ -0,0 +1,166 @@
+// Package imgcdn builds transformation URLs for image CDNs (imgproxy,
+// Cloudflare Images), for builds that leave resizing and encoding to the
+// CDN and only analyze sources locally.
+package imgcdn
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"os"
+	"strings"
+)
+
+// Providers lists the supported CDNs.
+var Providers = []string{"imgproxy", "cloudflare"}
+
+// Transform is one rendition of a source image.
+type Transform struct {
+	Source       string // input-relative source path, slash-separated
+	SourceWidth  int
+	SourceHeight int
+
+	Width, Height int
+	Format        string          // "avif", "webp", "jpeg" or "png"
+	Quality       int             // 0 for lossless formats
+	Crop          image.Rectangle // source region; empty for the whole source
+}
+
+// Provider turns transforms into URLs.
+type Provider interface {
+	Name() string
+	URL(t Transform) string
+}
+
+// New returns the provider called name. baseURL is the CDN endpoint and
+// source the prefix that turns input-relative paths into the CDN's source
+// references. Signing keys come from the environment: IMGPROXY_KEY and
+// IMGPROXY_SALT (hex), or CLOUDFLARE_IMAGES_SIGNING_KEY.
+func New(name, baseURL, source string) (Provider, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("%s: CDN URL is required", name)
+	}
+	if !strings.HasPrefix(baseURL, "https://") && !strings.HasPrefix(baseURL, "http://") {
+		return nil, fmt.Errorf("%s: CDN URL %q: want http:// or https://", name, baseURL)
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	switch name {
+	case "imgproxy":
+		if source == "" {
+			return nil, fmt.Errorf("imgproxy: source URL is required")
+		}
+		p := &Imgproxy{BaseURL: baseURL, SourceURL: source}
+		key, salt := os.Getenv("IMGPROXY_KEY"), os.Getenv("IMGPROXY_SALT")
+		if (key == "") != (salt == "") {
+			return nil, fmt.Errorf("imgproxy: set both IMGPROXY_KEY and IMGPROXY_SALT, or neither")
+		}
+		var err error
+		if p.Key, err = hex.DecodeString(key); err != nil {
+			return nil, fmt.Errorf("imgproxy: IMGPROXY_KEY: %w", err)
+		}
+		if p.Salt, err = hex.DecodeString(salt); err != nil {
+			return nil, fmt.Errorf("imgproxy: IMGPROXY_SALT: %w", err)
+		}
+		return p, nil
+	case "cloudflare":
+		return &Cloudflare{
+			BaseURL:  baseURL,
+			IDPrefix: source,
+			Key:      []byte(os.Getenv("CLOUDFLARE_IMAGES_SIGNING_KEY")),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown CDN %q: want imgproxy or cloudflare", name)
+	}
+}
+
+// Imgproxy builds imgproxy processing URLs:
+//
+//	<base>/<signature>/c:<w>:<h>:nowe:<x>:<y>/rs:fill:<w>:<h>/q:<q>/<base64 source>.<ext>
+//
+// The crop option is present for crop variants only.
+type Imgproxy struct {
+	BaseURL   string // e.g. https://img.example.com
+	SourceURL string // prefix of the source URLs imgproxy fetches, e.g. s3://bucket/images/
+	Key, Salt []byte // signing key and salt; empty for unsigned ("insecure") URLs
+}
+
+func (p *Imgproxy) Name() string { return "imgproxy" }
+
+func (p *Imgproxy) URL(t Transform) string {
+	var opts []string
+	if !t.Crop.Empty() {
+		opts = append(opts, fmt.Sprintf("c:%d:%d:nowe:%d:%d", t.Crop.Dx(), t.Crop.Dy(), t.Crop.Min.X, t.Crop.Min.Y))
+	}
+	opts = append(opts, fmt.Sprintf("rs:fill:%d:%d", t.Width, t.Height))
+	if t.Quality > 0 {
+		opts = append(opts, fmt.Sprintf("q:%d", t.Quality))
+	}
+	src := base64.RawURLEncoding.EncodeToString([]byte(p.SourceURL + t.Source))
+	path := "/" + strings.Join(opts, "/") + "/" + src + "." + extension(t.Format)
+	return p.BaseURL + "/" + p.sign(path) + path
+}
+
+// sign returns the URL-safe base64 HMAC-SHA256 of salt+path, or
+// "insecure" without a key.
+func (p *Imgproxy) sign(path string) string {
+	if len(p.Key) == 0 {
+		return "insecure"
+	}
+	mac := hmac.New(sha256.New, p.Key)
+	mac.Write(p.Salt)
+	mac.Write([]byte(path))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Cloudflare builds Cloudflare Images delivery URLs with flexible
+// variants:
+//
+//	<base>/<image id>/width=<w>,height=<h>,fit=cover,format=<f>[,quality=<q>][,trim=<t;r;b;l>]
+//
+// The image ID is IDPrefix plus the source path, so originals must be
+// uploaded under those custom IDs. With a key, URLs carry the sig token
+// for images that require signed URLs.
+type Cloudflare struct {
+	BaseURL  string // https://imagedelivery.net/<account hash>
+	IDPrefix string
+	Key      []byte // URL signing key; empty for public images
+}
+
+func (c *Cloudflare) Name() string { return "cloudflare" }
+
+func (c *Cloudflare) URL(t Transform) string {
+	opts := []string{
+		fmt.Sprintf("width=%d", t.Width),
+		fmt.Sprintf("height=%d", t.Height),
+		"fit=cover",
+		"format=" + t.Format,
+	}
+	if t.Quality > 0 {
+		opts = append(opts, fmt.Sprintf("quality=%d", t.Quality))
+	}
+	if !t.Crop.Empty() {
+		opts = append(opts, fmt.Sprintf("trim=%d;%d;%d;%d",
+			t.Crop.Min.Y, t.SourceWidth-t.Crop.Max.X, t.SourceHeight-t.Crop.Max.Y, t.Crop.Min.X))
+	}
+	u := c.BaseURL + "/" + c.IDPrefix + t.Source + "/" + strings.Join(opts, ",")
+	if len(c.Key) == 0 {
+		return u
+	}
+	// The token signs the URL's path and query, which is empty here.
+	path := u[strings.Index(u, "://")+3:]
+	path = path[strings.IndexByte(path, '/'):]
+	mac := hmac.New(sha256.New, c.Key)
+	mac.Write([]byte(path + "?"))
+	return u + "?sig=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// extension returns the file extension imgproxy uses to pick format.
+func extension(format string) string {
+	if format == "jpeg" {
+		return "jpg"
+	}
+	return format
+}
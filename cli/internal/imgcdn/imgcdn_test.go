@@ -0,0 +1,107 @@
+package imgcdn
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestImgproxyURL(t *testing.T) {
+	p := &Imgproxy{BaseURL: "https://img.example.com", SourceURL: "s3://bucket/images/"}
+	tr := Transform{Source: "promo/banner.jpg", Width: 640, Height: 360, Format: "jpeg", Quality: 82}
+	src := base64.RawURLEncoding.EncodeToString([]byte("s3://bucket/images/promo/banner.jpg"))
+	want := "https://img.example.com/insecure/rs:fill:640:360/q:82/" + src + ".jpg"
+	if got := p.URL(tr); got != want {
+		t.Errorf("unsigned:\n got %s\nwant %s", got, want)
+	}
+
+	tr.Crop = image.Rect(100, 50, 500, 275)
+	if got := p.URL(tr); !strings.Contains(got, "/insecure/c:400:225:nowe:100:50/rs:fill:640:360/") {
+		t.Errorf("crop: got %s", got)
+	}
+}
+
+func TestImgproxySignature(t *testing.T) {
+	p := &Imgproxy{
+		BaseURL:   "https://img.example.com",
+		SourceURL: "https://origin.example.com/",
+		Key:       []byte("secret"),
+		Salt:      []byte("salt"),
+	}
+	got := p.URL(Transform{Source: "a.png", Width: 100, Height: 100, Format: "png"})
+	rest := strings.TrimPrefix(got, "https://img.example.com/")
+	sig, path, _ := strings.Cut(rest, "/")
+	path = "/" + path
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("salt" + path))
+	if want := base64.RawURLEncoding.EncodeToString(mac.Sum(nil)); sig != want {
+		t.Errorf("signature = %s, want %s", sig, want)
+	}
+	if strings.Contains(path, "q:") {
+		t.Errorf("lossless variant has a quality option: %s", path)
+	}
+}
+
+func TestCloudflareURL(t *testing.T) {
+	c := &Cloudflare{BaseURL: "https://imagedelivery.net/hash", IDPrefix: "app/"}
+	tr := Transform{
+		Source: "covers/spring.jpg", SourceWidth: 2000, SourceHeight: 1000,
+		Width: 540, Height: 960, Format: "webp", Quality: 80,
+		Crop: image.Rect(700, 0, 1262, 1000),
+	}
+	want := "https://imagedelivery.net/hash/app/covers/spring.jpg/width=540,height=960,fit=cover,format=webp,quality=80,trim=0;738;0;700"
+	if got := c.URL(tr); got != want {
+		t.Errorf("unsigned:\n got %s\nwant %s", got, want)
+	}
+
+	c.Key = []byte("k")
+	got := c.URL(tr)
+	u, sig, ok := strings.Cut(got, "?sig=")
+	if !ok || u != want {
+		t.Fatalf("signed: got %s", got)
+	}
+	mac := hmac.New(sha256.New, []byte("k"))
+	mac.Write([]byte(strings.TrimPrefix(u, "https://imagedelivery.net") + "?"))
+	if w := hex.EncodeToString(mac.Sum(nil)); sig != w {
+		t.Errorf("sig = %s, want %s", sig, w)
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Setenv("IMGPROXY_KEY", "")
+	t.Setenv("IMGPROXY_SALT", "")
+	for _, tc := range []struct {
+		name, base, source string
+		ok                 bool
+	}{
+		{"imgproxy", "https://img.example.com/", "s3://b/", true},
+		{"imgproxy", "https://img.example.com", "", false},
+		{"imgproxy", "img.example.com", "s3://b/", false},
+		{"cloudflare", "https://imagedelivery.net/hash", "", true},
+		{"cloudflare", "", "", false},
+		{"fastly", "https://x", "", false},
+	} {
+		_, err := New(tc.name, tc.base, tc.source)
+		if (err == nil) != tc.ok {
+			t.Errorf("New(%q, %q, %q): err = %v", tc.name, tc.base, tc.source, err)
+		}
+	}
+
+	t.Setenv("IMGPROXY_KEY", "6b6579")
+	if _, err := New("imgproxy", "https://img.example.com", "s3://b/"); err == nil {
+		t.Error("key without salt accepted")
+	}
+	t.Setenv("IMGPROXY_SALT", "73616c74")
+	p, err := New("imgproxy", "https://img.example.com/", "s3://b/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip := p.(*Imgproxy); string(ip.Key) != "key" || string(ip.Salt) != "salt" || ip.BaseURL != "https://img.example.com" {
+		t.Errorf("got %+v", ip)
+	}
+}
@@ -0,0 +1,184 @@
+package jpegdec
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testJPEG encodes a smooth w×h gradient with some detail, in color or
+// grayscale.
+func testJPEG(t *testing.T, w, h int, gray bool) []byte {
+	t.Helper()
+	var img image.Image
+	if gray {
+		g := image.NewGray(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				g.SetGray(x, y, color.Gray{Y: uint8((x*255/w + y*255/h) / 2)})
+			}
+		}
+		img = g
+	} else {
+		m := image.NewNRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				m.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 255 / w), G: uint8(y * 255 / h), B: uint8(128 + 60*math.Sin(float64(x+y)/40)), A: 255})
+			}
+		}
+		img = m
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// meanDiff returns the mean absolute per-channel difference between
+// small and big box-averaged down by scale.
+func meanDiff(small, big image.Image, scale int) float64 {
+	var diff float64
+	var count int
+	b := small.Bounds()
+	bb := big.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var sum [3]float64
+			var n float64
+			for yy := y * scale; yy < min((y+1)*scale, bb.Max.Y); yy++ {
+				for xx := x * scale; xx < min((x+1)*scale, bb.Max.X); xx++ {
+					r, g, b, _ := big.At(xx, yy).RGBA()
+					sum[0] += float64(r >> 8)
+					sum[1] += float64(g >> 8)
+					sum[2] += float64(b >> 8)
+					n++
+				}
+			}
+			r, g, bl, _ := small.At(x, y).RGBA()
+			diff += math.Abs(float64(r>>8)-sum[0]/n) + math.Abs(float64(g>>8)-sum[1]/n) + math.Abs(float64(bl>>8)-sum[2]/n)
+			count += 3
+		}
+	}
+	return diff / float64(count)
+}
+
+func TestDecodeScaled(t *testing.T) {
+	for _, gray := range []bool{false, true} {
+		data := testJPEG(t, 203, 157, gray)
+		full, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		same, err := DecodeScaled(bytes.NewReader(data), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := meanDiff(same, full, 1); d != 0 {
+			t.Errorf("gray=%v: full-size decode differs from image/jpeg by %.2f", gray, d)
+		}
+
+		for _, scale := range []int{2, 4, 8} {
+			var gotW, gotH int
+			img, err := DecodeScaled(bytes.NewReader(data), func(w, h int) int {
+				gotW, gotH = w, h
+				return scale
+			})
+			if err != nil {
+				t.Fatalf("gray=%v 1/%d: %v", gray, scale, err)
+			}
+			if gotW != 203 || gotH != 157 {
+				t.Errorf("pick got %dx%d, want the full 203x157", gotW, gotH)
+			}
+			want := image.Rect(0, 0, (203+scale-1)/scale, (157+scale-1)/scale)
+			if img.Bounds() != want {
+				t.Errorf("gray=%v 1/%d: bounds %v, want %v", gray, scale, img.Bounds(), want)
+			}
+			// 4:2:0 chroma ends up at half the scaled luma resolution,
+			// as it is at full size, so color images stray further from
+			// a box filter at 1/8.
+			limit := 2.5
+			if !gray {
+				limit = 4
+			}
+			if d := meanDiff(img, full, scale); d > limit {
+				t.Errorf("gray=%v 1/%d: mean difference from a box-filtered full decode %.2f", gray, scale, d)
+			}
+		}
+	}
+}
+
+func TestDecodeScaledRejectsOtherScales(t *testing.T) {
+	data := testJPEG(t, 16, 16, true)
+	if _, err := DecodeScaled(bytes.NewReader(data), func(int, int) int { return 3 }); err == nil {
+		t.Error("scale 3 decoded")
+	}
+}
+
+func TestDecodeAlloc(t *testing.T) {
+	for _, gray := range []bool{false, true} {
+		data := testJPEG(t, 45, 30, gray)
+		want, err := DecodeScaled(bytes.NewReader(data), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var allocs int
+		got, err := Decode(bytes.NewReader(data), &Options{Alloc: func(n int) []byte {
+			allocs++
+			return make([]byte, n)
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allocs != 1 {
+			t.Errorf("gray=%v: Alloc called %d times, want 1", gray, allocs)
+		}
+		if d := meanDiff(got, want, 1); d != 0 {
+			t.Errorf("gray=%v: decode into Alloc buffers differs by %.2f", gray, d)
+		}
+	}
+}
+
+// TestDecodeProgressive decodes progressive JPEGs, which are decoded
+// from coefficients kept across scans rather than block by block, at
+// every scale. testdata holds them with the baseline files they were
+// losslessly converted from.
+func TestDecodeProgressive(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.progressive.jpeg")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no test files: %v", err)
+	}
+	for _, prog := range files {
+		base := strings.TrimSuffix(prog, ".progressive.jpeg") + ".jpeg"
+		progData, err := os.ReadFile(prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		baseData, err := os.ReadFile(base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, scale := range []int{1, 2, 4, 8} {
+			pick := func(w, h int) int { return scale }
+			got, err := DecodeScaled(bytes.NewReader(progData), pick)
+			if err != nil {
+				t.Fatalf("%s 1/%d: %v", prog, scale, err)
+			}
+			want, err := DecodeScaled(bytes.NewReader(baseData), pick)
+			if err != nil {
+				t.Fatalf("%s 1/%d: %v", base, scale, err)
+			}
+			if got.Bounds() != want.Bounds() {
+				t.Errorf("%s 1/%d: bounds %v, baseline %v", prog, scale, got.Bounds(), want.Bounds())
+			} else if d := meanDiff(got, want, 1); d != 0 {
+				t.Errorf("%s 1/%d: differs from the baseline decode by %.2f", prog, scale, d)
+			}
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Package logging is the leveled stderr logger shared by cmd/ and
+// pipeline/. Messages carry the "[tgimg]" prefix; warnings and errors
+// are tagged and colored when stderr is a terminal and NO_COLOR is unset.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Level is a message severity. Messages below the logger's level are
+// dropped.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string { return levelNames[l] }
+
+// ParseLevel parses "debug", "info", "warn" (or "warning") and "error".
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("invalid log level %q: want debug, info, warn or error", s)
+}
+
+// Logger writes leveled messages to one writer.
+type Logger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+	color bool
+}
+
+// New returns a logger writing to w at level. Color is enabled when w is
+// a terminal and NO_COLOR is unset.
+func New(w io.Writer, level Level) *Logger {
+	l := &Logger{w: w, level: level}
+	if f, ok := w.(*os.File); ok {
+		l.color = ColorEnabled(f)
+	}
+	return l
+}
+
+// SetLevel changes the minimum level that is written.
+func (l *Logger) SetLevel(level Level) {
+	l.mu.Lock()
+	l.level = level
+	l.mu.Unlock()
+}
+
+// Enabled reports whether messages at level are written.
+func (l *Logger) Enabled(level Level) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return level >= l.level
+}
+
+// ANSI color codes for tagged levels.
+const (
+	colorReset  = "\x1b[0m"
+	colorYellow = "\x1b[33m"
+	colorRed    = "\x1b[31m"
+)
+
+func (l *Logger) logf(level Level, format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if level < l.level {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	tag := ""
+	switch level {
+	case LevelWarn:
+		tag = "warn: "
+		if l.color {
+			tag = colorYellow + tag + colorReset
+		}
+	case LevelError:
+		tag = "error: "
+		if l.color {
+			tag = colorRed + tag + colorReset
+		}
+	}
+	fmt.Fprintf(l.w, "[tgimg] %s%s\n", tag, msg)
+}
+
+func (l *Logger) Debugf(format string, args ...any) { l.logf(LevelDebug, format, args...) }
+func (l *Logger) Infof(format string, args ...any)  { l.logf(LevelInfo, format, args...) }
+func (l *Logger) Warnf(format string, args ...any)  { l.logf(LevelWarn, format, args...) }
+func (l *Logger) Errorf(format string, args ...any) { l.logf(LevelError, format, args...) }
+
+// std is the process-wide logger used by the package-level functions.
+var std = New(os.Stderr, LevelInfo)
+
+// Default returns the process-wide logger.
+func Default() *Logger { return std }
+
+// SetLevel sets the process-wide level.
+func SetLevel(level Level) { std.SetLevel(level) }
+
+// Enabled reports whether the process-wide logger writes level.
+func Enabled(level Level) bool { return std.Enabled(level) }
+
+func Debugf(format string, args ...any) { std.Debugf(format, args...) }
+func Infof(format string, args ...any)  { std.Infof(format, args...) }
+func Warnf(format string, args ...any)  { std.Warnf(format, args...) }
+func Errorf(format string, args ...any) { std.Errorf(format, args...) }
+
+// IsTerminal reports whether f is a character device (a TTY).
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ColorEnabled reports whether styled output (ANSI colors, box drawing)
+// should be written to f: f is a terminal, NO_COLOR is unset
+// (https://no-color.org) and TERM is not "dumb".
+func ColorEnabled(f *os.File) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return IsTerminal(f)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -112,3 +113,96 @@ func TestManifestIgnoresUnknownFields(t *testing.T) {
 		t.Error("build_info not parsed correctly")
 	}
 }
+
+func TestLookupFollowsAliases(t *testing.T) {
+	m := New("alias-test")
+	m.Assets["banners/spring-2025"] = Asset{AspectRatio: 2}
+	m.Aliases = map[string]string{"hero": "banners/spring-2025", "stale": "missing"}
+
+	if a, ok := m.Lookup("hero"); !ok || a.AspectRatio != 2 {
+		t.Errorf("hero: got %+v, %v", a, ok)
+	}
+	if _, ok := m.Lookup("banners/spring-2025"); !ok {
+		t.Error("direct key lookup failed")
+	}
+	if _, ok := m.Lookup("stale"); ok {
+		t.Error("alias to missing asset should not resolve")
+	}
+}
+
+func TestMarshalCompact(t *testing.T) {
+	m := New("compact-test")
+	m.BuildInfo = &BuildInfo{Workers: 4, PoolEntryKB: 167}
+	m.Assets["a"] = Asset{
+		ThumbHash: "AAAA",
+		Variants: []Variant{
+			{Format: "webp", Width: 320, Height: 240, Size: 5000, Hash: "abcd", Path: "a.webp", EncodeMS: 12, Quality: 82},
+		},
+	}
+
+	data, err := Marshal(m, WriteOptions{Compact: true})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	s := string(data)
+	for _, unwanted := range []string{"\n  ", "build_info", "encode_ms", `"quality"`} {
+		if strings.Contains(s, unwanted) {
+			t.Errorf("compact output contains %q", unwanted)
+		}
+	}
+
+	// The in-memory manifest keeps its diagnostics.
+	if m.BuildInfo == nil || m.Assets["a"].Variants[0].EncodeMS != 12 {
+		t.Error("compact marshal mutated the manifest")
+	}
+}
+
+func TestOptionsOf(t *testing.T) {
+	m := New("options-test")
+	m.Assets["a"] = Asset{ThumbHash: "AAAA"}
+	for _, opts := range []WriteOptions{{}, {Compact: true}} {
+		data, err := Marshal(m, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := OptionsOf(data); got != opts {
+			t.Errorf("OptionsOf(Marshal(%+v)) = %+v", opts, got)
+		}
+	}
+	if got := OptionsOf([]byte("not json")); got.Compact {
+		t.Error("OptionsOf(garbage) reports compact")
+	}
+}
+
+func TestWriteFileKeepsBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tgimg.manifest.json")
+	bak := path + BackupSuffix
+
+	if err := WriteFile(path, []byte(`{"version":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(bak); !os.IsNotExist(err) {
+		t.Errorf("first write made a backup: %v", err)
+	}
+	if err := WriteFile(path, []byte(`{"version":2}`)); err != nil {
+		t.Fatal(err)
+	}
+	// A damaged manifest is replaced but does not overwrite the backup.
+	if err := os.WriteFile(path, []byte(`{"vers`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(path, []byte(`{"version":3}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	for p, want := range map[string]string{path: `{"version":3}`, bak: `{"version":1}`} {
+		got, err := os.ReadFile(p)
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", filepath.Base(p), got, err, want)
+		}
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 2 {
+		t.Errorf("left %d files, want the manifest and its backup", len(entries))
+	}
+}
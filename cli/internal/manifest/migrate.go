@@ -0,0 +1,84 @@
+package manifest
+
+import (
+	"fmt"
+	"math"
+)
+
+// migrations upgrade a manifest from the keyed version to the next one.
+// Each step returns a human-readable description of what it changed.
+var migrations = map[int]func(m *Manifest) []string{
+	0: migrateV0,
+}
+
+// Migrate upgrades m in place to SupportedManifestVersion and fills fields
+// that older writers left empty, so runtimes only ever need to understand
+// the newest schema. It returns the list of changes applied (empty when
+// the manifest was already current).
+func Migrate(m *Manifest) ([]string, error) {
+	if m.Version > SupportedManifestVersion {
+		return nil, fmt.Errorf("manifest version %d is newer than this tgimg supports (%d)",
+			m.Version, SupportedManifestVersion)
+	}
+	if m.Version < 0 {
+		return nil, fmt.Errorf("invalid manifest version %d", m.Version)
+	}
+
+	var changes []string
+	for m.Version < SupportedManifestVersion {
+		step, ok := migrations[m.Version]
+		if !ok {
+			return changes, fmt.Errorf("no migration from manifest version %d", m.Version)
+		}
+		from := m.Version
+		changes = append(changes, step(m)...)
+		m.Version = from + 1
+		changes = append(changes, fmt.Sprintf("version %d → %d", from, m.Version))
+	}
+	changes = append(changes, fillDefaults(m)...)
+	return changes, nil
+}
+
+// migrateV0 upgrades pre-versioned manifests (no "version" field), which
+// were written before base_path and aspect_ratio existed.
+func migrateV0(m *Manifest) []string {
+	var changes []string
+	if m.BasePath == "" {
+		m.BasePath = "./"
+		changes = append(changes, `set base_path to "./"`)
+	}
+	return changes
+}
+
+// fillDefaults fills fields that are derivable from the rest of the
+// manifest. It is applied after every migration and is idempotent.
+func fillDefaults(m *Manifest) []string {
+	var changes []string
+	if m.Assets == nil {
+		m.Assets = make(map[string]Asset)
+		changes = append(changes, "added empty assets map")
+	}
+	for key, a := range m.Assets {
+		changed := false
+		if a.Variants == nil {
+			a.Variants = []Variant{}
+			changed = true
+			changes = append(changes, fmt.Sprintf("asset %q: null variants → []", key))
+		}
+		if a.AspectRatio <= 0 && a.Original.Width > 0 && a.Original.Height > 0 {
+			a.AspectRatio = math.Round(float64(a.Original.Width)/float64(a.Original.Height)*1e4) / 1e4
+			changed = true
+			changes = append(changes, fmt.Sprintf("asset %q: computed aspect_ratio %.4f", key, a.AspectRatio))
+		}
+		if changed {
+			m.Assets[key] = a
+		}
+	}
+
+	before := m.Stats
+	m.ComputeStats()
+	if m.Stats != before {
+		changes = append(changes, "recomputed stats")
+	}
+	return changes
+}
@@ -0,0 +1,65 @@
+package manifest
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMigrateV0(t *testing.T) {
+	raw := `{
+		"generated_at": "2024-06-01T00:00:00Z",
+		"profile": "legacy",
+		"assets": {
+			"a": {
+				"original": { "width": 1920, "height": 1080, "format": "png", "size": 1000, "has_alpha": false },
+				"thumbhash": "AAAA",
+				"variants": null
+			}
+		}
+	}`
+	var m Manifest
+	if err := json.Unmarshal([]byte(raw), &m); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	changes, err := Migrate(&m)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if len(changes) == 0 {
+		t.Fatal("expected changes")
+	}
+	if m.Version != SupportedManifestVersion {
+		t.Errorf("version: got %d", m.Version)
+	}
+	if m.BasePath != "./" {
+		t.Errorf("base_path: got %q", m.BasePath)
+	}
+	a := m.Assets["a"]
+	if a.AspectRatio != 1.7778 {
+		t.Errorf("aspect_ratio: got %v", a.AspectRatio)
+	}
+	if a.Variants == nil {
+		t.Error("variants still null")
+	}
+	if m.Stats.TotalAssets != 1 || m.Stats.TotalInputBytes != 1000 {
+		t.Errorf("stats not recomputed: %+v", m.Stats)
+	}
+
+	// Second run is a no-op.
+	again, err := Migrate(&m)
+	if err != nil {
+		t.Fatalf("migrate again: %v", err)
+	}
+	if len(again) != 0 {
+		t.Errorf("expected idempotent migration, got %v", again)
+	}
+}
+
+func TestMigrateRejectsNewer(t *testing.T) {
+	m := New("future")
+	m.Version = SupportedManifestVersion + 1
+	if _, err := Migrate(m); err == nil {
+		t.Fatal("expected error for newer manifest")
+	}
+}
@@ -0,0 +1,225 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Schema returns the JSON Schema (draft 2020-12) for the manifest.
+// It is derived from the Go types by reflection, so it can never drift
+// from what `tgimg build` actually writes: fields without omitempty are
+// required and unknown fields are rejected (additionalProperties: false).
+func Schema() map[string]any {
+	s := typeSchema(reflect.TypeOf(Manifest{}))
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["title"] = "tgimg manifest"
+	return s
+}
+
+// SchemaJSON returns the indented JSON encoding of Schema.
+func SchemaJSON() ([]byte, error) {
+	data, err := json.MarshalIndent(Schema(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// typeSchema maps a Go type to its JSON Schema fragment.
+func typeSchema(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Uint8:
+		return map[string]any{"type": "integer", "minimum": 0, "maximum": 255}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Array:
+		return map[string]any{
+			"type":     "array",
+			"items":    typeSchema(t.Elem()),
+			"minItems": t.Len(),
+			"maxItems": t.Len(),
+		}
+	case reflect.Map:
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": typeSchema(t.Elem()),
+		}
+	case reflect.Struct:
+		props := map[string]any{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, omitempty, ok := jsonField(f)
+			if !ok {
+				continue
+			}
+			props[name] = typeSchema(f.Type)
+			if !omitempty {
+				required = append(required, name)
+			}
+		}
+		return map[string]any{
+			"type":                 "object",
+			"properties":           props,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	}
+	return map[string]any{}
+}
+
+// jsonField returns the JSON name of a struct field and whether it is
+// tagged omitempty. ok is false for unexported or "-" fields.
+func jsonField(f reflect.StructField) (name string, omitempty, ok bool) {
+	if !f.IsExported() {
+		return "", false, false
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if name == "" {
+		name = f.Name
+	}
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitempty = true
+		}
+	}
+	return name, omitempty, true
+}
+
+// ValidateSchema checks raw manifest JSON against Schema and returns one
+// message per violation. Unlike json.Unmarshal, unknown fields, missing
+// required fields and type mismatches are all reported.
+func ValidateSchema(data []byte) []string {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return []string{fmt.Sprintf("invalid JSON: %v", err)}
+	}
+	var errs []string
+	validateValue(v, Schema(), "$", &errs)
+	return errs
+}
+
+func validateValue(v any, s map[string]any, path string, errs *[]string) {
+	typ, _ := s["type"].(string)
+	switch typ {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			*errs = append(*errs, fmt.Sprintf("%s: expected object, got %s", path, jsonKind(v)))
+			return
+		}
+		props, _ := s["properties"].(map[string]any)
+		if req, ok := s["required"].([]string); ok {
+			for _, name := range req {
+				if _, present := obj[name]; !present {
+					*errs = append(*errs, fmt.Sprintf("%s: missing required field %q", path, name))
+				}
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if ps, ok := props[k].(map[string]any); ok {
+				validateValue(obj[k], ps, path+"."+k, errs)
+				continue
+			}
+			switch extra := s["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					*errs = append(*errs, fmt.Sprintf("%s: unknown field %q", path, k))
+				}
+			case map[string]any:
+				validateValue(obj[k], extra, fmt.Sprintf("%s[%q]", path, k), errs)
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			*errs = append(*errs, fmt.Sprintf("%s: expected array, got %s", path, jsonKind(v)))
+			return
+		}
+		if n, ok := s["minItems"].(int); ok && len(arr) < n {
+			*errs = append(*errs, fmt.Sprintf("%s: expected at least %d items, got %d", path, n, len(arr)))
+		}
+		if n, ok := s["maxItems"].(int); ok && len(arr) > n {
+			*errs = append(*errs, fmt.Sprintf("%s: expected at most %d items, got %d", path, n, len(arr)))
+		}
+		if items, ok := s["items"].(map[string]any); ok {
+			for i, e := range arr {
+				validateValue(e, items, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			*errs = append(*errs, fmt.Sprintf("%s: expected integer, got %s", path, jsonKind(v)))
+			return
+		}
+		i, err := n.Int64()
+		if err != nil {
+			*errs = append(*errs, fmt.Sprintf("%s: expected integer, got %s", path, n))
+			return
+		}
+		if lo, ok := s["minimum"].(int); ok && i < int64(lo) {
+			*errs = append(*errs, fmt.Sprintf("%s: %d is below minimum %d", path, i, lo))
+		}
+		if hi, ok := s["maximum"].(int); ok && i > int64(hi) {
+			*errs = append(*errs, fmt.Sprintf("%s: %d is above maximum %d", path, i, hi))
+		}
+	case "number":
+		if _, ok := v.(json.Number); !ok {
+			*errs = append(*errs, fmt.Sprintf("%s: expected number, got %s", path, jsonKind(v)))
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			*errs = append(*errs, fmt.Sprintf("%s: expected string, got %s", path, jsonKind(v)))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			*errs = append(*errs, fmt.Sprintf("%s: expected boolean, got %s", path, jsonKind(v)))
+		}
+	}
+}
+
+func jsonKind(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,69 @@
+package manifest
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSchemaAcceptsWrittenManifest(t *testing.T) {
+	m := New("schema-test")
+	m.BuildInfo = &BuildInfo{Workers: 2, PoolEntryKB: 167}
+	avg := [3]uint8{10, 20, 30}
+	m.Assets["a"] = Asset{
+		Original:    OriginalInfo{Width: 10, Height: 10, Format: "png", Size: 100},
+		ThumbHash:   "AAAA",
+		AspectRatio: 1,
+		AvgColor:    &avg,
+		Variants: []Variant{
+			{Format: "png", Width: 10, Height: 10, Size: 50, Hash: "abcd", Path: "a.10.10.abcd.png"},
+		},
+	}
+	m.Errors = map[string]AssetError{
+		"b@dark": {Source: "b@dark.png", Theme: "dark", Error: "decode: unexpected EOF"},
+	}
+	m.ComputeStats()
+	if m.Stats.FailedAssets != 1 {
+		t.Errorf("failed_assets = %d, want 1", m.Stats.FailedAssets)
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if errs := ValidateSchema(data); len(errs) != 0 {
+		t.Fatalf("unexpected schema errors: %v", errs)
+	}
+}
+
+func TestSchemaRejectsUnknownAndMissing(t *testing.T) {
+	raw := `{
+		"version": 1,
+		"generated_at": "2025-01-01T00:00:00Z",
+		"profile": "test",
+		"base_path": "./",
+		"future_field": true,
+		"assets": {
+			"a": {
+				"original": { "width": 1, "height": 1, "format": "png", "size": 1, "has_alpha": false },
+				"thumbhash": "AAAA",
+				"aspect_ratio": 1,
+				"avg_color": [1, 2, 300],
+				"variants": [ { "format": "png", "width": "1" } ]
+			}
+		},
+		"stats": { "total_input_bytes": 0, "total_output_bytes": 0, "total_assets": 1, "total_variants": 1 }
+	}`
+
+	errs := strings.Join(ValidateSchema([]byte(raw)), "\n")
+	for _, want := range []string{
+		`$: unknown field "future_field"`,
+		`$.assets["a"].avg_color[2]: 300 is above maximum 255`,
+		`$.assets["a"].variants[0].width: expected integer, got string`,
+		`$.assets["a"].variants[0]: missing required field "path"`,
+	} {
+		if !strings.Contains(errs, want) {
+			t.Errorf("missing error %q in:\n%s", want, errs)
+		}
+	}
+}
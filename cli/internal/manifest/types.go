@@ -1,5 +1,10 @@
 package manifest
 
+import (
+	"image"
+	"strings"
+)
+
 // Manifest is the top-level output of a tgimg build.
 type Manifest struct {
 	Version     int              `json:"version"`
@@ -7,14 +12,105 @@ type Manifest struct {
 	Profile     string           `json:"profile"`
 	BasePath    string           `json:"base_path"`
 	BuildInfo   *BuildInfo       `json:"build_info,omitempty"`
+	Config      *BuildConfig     `json:"config,omitempty"`
 	Assets      map[string]Asset `json:"assets"`
 	Stats       Stats            `json:"stats"`
+
+	// Aliases maps stable logical names to asset keys (e.g. "hero" →
+	// "banners/spring-2025"). Targets are always real asset keys, never
+	// other aliases.
+	Aliases map[string]string `json:"aliases,omitempty"`
+
+	// Errors records the sources that failed to build, by asset key, or
+	// "key@theme" for a theme rendition. Their assets are missing from
+	// Assets (a failed rendition leaves its base without that theme), so
+	// validators and runtimes can tell a failure from a typo.
+	Errors map[string]AssetError `json:"errors,omitempty"`
+}
+
+// AssetError is a source the build could not process.
+type AssetError struct {
+	Source string `json:"source"`          // path relative to the input directory
+	Theme  string `json:"theme,omitempty"` // set for a theme rendition
+	Error  string `json:"error"`
 }
 
 // BuildInfo captures build-time parameters for diagnostics.
 type BuildInfo struct {
 	Workers     int `json:"workers"`
 	PoolEntryKB int `json:"pool_entry_kb"` // per-worker thumbhash pool (~167 KB for float32)
+
+	ToolVersion string            `json:"tool_version,omitempty"` // tgimg CLI version
+	DurationMS  int64             `json:"duration_ms,omitempty"`  // total pipeline wall time
+	Stages      *StageTimings     `json:"stages,omitempty"`
+	Encoders    map[string]string `json:"encoders,omitempty"` // format → encoder version string
+	Host        *HostInfo         `json:"host,omitempty"`
+}
+
+// BuildConfig is the effective configuration a build ran with: the
+// resolved profile after flag overrides plus output-affecting options.
+// Fingerprint changes whenever any output-affecting setting changes.
+type BuildConfig struct {
+	Widths        []int     `json:"widths"`
+	Formats       []string  `json:"formats"`
+	Quality       int       `json:"quality"`
+	Retina        bool      `json:"retina"`         // some DPR above 1×; kept for runtimes reading only this
+	DPRs          []float64 `json:"dprs,omitempty"` // device pixel ratios generated per width
+	Descriptor    string    `json:"descriptor,omitempty"`
+	NoRegressSize bool      `json:"no_regress_size"`
+	CopyOriginal  bool      `json:"copy_original,omitempty"`
+	EmitDataURI   bool      `json:"emit_placeholder_datauri,omitempty"`
+	Ignore        []string  `json:"ignore,omitempty"`
+	MaxWidth      int       `json:"max_width,omitempty"`
+	MinWidth      int       `json:"min_width,omitempty"` // sources below get one variant
+	Heights       []int     `json:"heights,omitempty"`
+	Crops         []string  `json:"crops,omitempty"` // "WxH" boxes
+	Gravity       string    `json:"gravity,omitempty"`
+	Margin        float64   `json:"margin,omitempty"` // crop padding fraction per side
+
+	// Focus holds the crop focal points read from tgimg.focus.json, by
+	// asset key, when the profile has crops.
+	Focus map[string][2]float64 `json:"focus,omitempty"`
+
+	Breakpoints map[string]int `json:"breakpoints,omitempty"` // name → 1× width, e.g. "md": 640
+
+	Limits *Limits `json:"limits,omitempty"` // hard per-variant constraints, e.g. for stickers
+
+	FormatMinWidths map[string]int `json:"format_min_widths,omitempty"` // format → narrowest variant encoded in it
+
+	Effort string `json:"effort,omitempty"` // "fast" or "max"; omitted for the default, balanced
+
+	CDN string `json:"cdn,omitempty"` // "imgproxy" or "cloudflare" when variants are CDN URLs (--cdn)
+
+	UnicodeKeys string `json:"unicode_keys,omitempty"` // "none" when keys keep the file names' form; omitted for NFC
+
+	Recolor map[string]map[string]Recolor `json:"recolor,omitempty"` // tgimg.recolor.json: by glob, then theme
+
+	Overrides map[string]ProfileOverride `json:"overrides,omitempty"` // by glob, e.g. "icons/**"
+
+	Fingerprint string `json:"fingerprint"` // xxhash64 of the fields above
+}
+
+// Limits are the hard constraints every variant of a build met.
+type Limits struct {
+	MaxSide   int   `json:"max_side,omitempty"`   // longer side cap, px
+	ExactSide bool  `json:"exact_side,omitempty"` // longer side equals max_side
+	MaxBytes  int64 `json:"max_bytes,omitempty"`  // encoded size cap
+}
+
+// StageTimings breaks the pipeline wall time down by stage, in milliseconds.
+type StageTimings struct {
+	ScanMS    int64 `json:"scan_ms"`
+	ProcessMS int64 `json:"process_ms"`
+	CollectMS int64 `json:"collect_ms"`
+}
+
+// HostInfo describes the machine and toolchain that produced the build.
+type HostInfo struct {
+	GOOS      string `json:"goos"`
+	GOARCH    string `json:"goarch"`
+	NumCPU    int    `json:"num_cpu"`
+	GoVersion string `json:"go_version"`
 }
 
 // Asset describes a single source image and all its generated variants.
@@ -23,7 +119,37 @@ type Asset struct {
 	ThumbHash   string       `json:"thumbhash"`              // base64-encoded thumbhash bytes
 	AspectRatio float64      `json:"aspect_ratio"`            // width / height
 	AvgColor    *[3]uint8    `json:"avg_color,omitempty"`     // [R,G,B] 0–255, optional
+	Placeholder string       `json:"placeholder,omitempty"`   // decoded thumbhash as PNG data URI, opt-in
+	Descriptor  string       `json:"descriptor,omitempty"`    // "x" for density srcsets; omitted means "w"
+	Variants    []Variant    `json:"variants"`
+
+	// Themes holds color-scheme renditions grouped from logo@dark.png-style
+	// sources or generated by recolor rules, keyed by theme ("light",
+	// "dark", "tinted"). The asset's own fields are the default rendition.
+	Themes map[string]ThemedAsset `json:"themes,omitempty"`
+}
+
+// ThemedAsset is one color-scheme rendition of an Asset.
+type ThemedAsset struct {
+	Original    OriginalInfo `json:"original"`
+	ThumbHash   string       `json:"thumbhash"`
+	AspectRatio float64      `json:"aspect_ratio"`
+	AvgColor    *[3]uint8    `json:"avg_color,omitempty"`
+	Placeholder string       `json:"placeholder,omitempty"`
 	Variants    []Variant    `json:"variants"`
+
+	// Recolor is the rule that generated the rendition from the asset's
+	// own source; nil for a paired source such as logo@dark.png.
+	Recolor *Recolor `json:"recolor,omitempty"`
+}
+
+// Recolor derives a theme rendition from a source's pixels. Exactly one
+// of Invert, Tint and Replace is set; alpha is always kept.
+type Recolor struct {
+	Invert    bool              `json:"invert,omitempty"`    // mirror lightness, keeping hue
+	Tint      string            `json:"tint,omitempty"`      // "#rrggbb" painted over every pixel
+	Replace   map[string]string `json:"replace,omitempty"`   // "#rrggbb" → "#rrggbb" color swaps
+	Tolerance int               `json:"tolerance,omitempty"` // per-channel slack for Replace matches
 }
 
 // OriginalInfo holds metadata about the source image.
@@ -43,6 +169,89 @@ type Variant struct {
 	Size   int64  `json:"size"`    // bytes on disk
 	Hash   string `json:"hash"`    // first 16 hex chars of xxhash64
 	Path   string `json:"path"`    // relative to base_path
+
+	EncodeMS int64 `json:"encode_ms,omitempty"` // wall time spent in the encoder
+	Quality  int   `json:"quality,omitempty"`   // effective encoder quality; 0 for lossless formats
+
+	Density float64 `json:"density,omitempty"` // srcset density (1, 2, …) when the asset uses "x" descriptors
+
+	// Breakpoint is the profile's name for this variant's width ("md"),
+	// set on the 1× variants of named widths. Frontends resolve
+	// "key@md" to the width of the variant carrying it.
+	Breakpoint string `json:"breakpoint,omitempty"`
+
+	// Original marks the untouched source file copied through by
+	// --copy-original. Runtimes must not pick it for responsive display;
+	// it exists for download buttons and lightbox zoom views.
+	Original bool `json:"original,omitempty"`
+
+	// Crop marks a fixed-size variant cut from the source for a profile
+	// crop box. Like originals, runtimes must not mix it into responsive
+	// srcsets: its aspect ratio differs from the asset's.
+	Crop *Crop `json:"crop,omitempty"`
+
+	// Telegram is set by `tgimg publish-telegram` once the variant has
+	// been uploaded through the Bot API.
+	Telegram *TelegramFile `json:"telegram,omitempty"`
+}
+
+// ProfileOverride records a config override: the settings it changes for
+// sources matching its glob. Unset fields keep the build's profile.
+type ProfileOverride struct {
+	Profile     string         `json:"profile,omitempty"` // base profile replacing the build's
+	Widths      []int          `json:"widths,omitempty"`
+	Formats     []string       `json:"formats,omitempty"`
+	Quality     int            `json:"quality,omitempty"`
+	DPRs        []float64      `json:"dprs,omitempty"`
+	Descriptor  string         `json:"descriptor,omitempty"`
+	MaxWidth    int            `json:"max_width,omitempty"`
+	MinWidth    int            `json:"min_width,omitempty"`
+	Heights     []int          `json:"heights,omitempty"`
+	Crops       []string       `json:"crops,omitempty"`
+	Gravity     string         `json:"gravity,omitempty"`
+	Margin      float64        `json:"margin,omitempty"`
+	Breakpoints map[string]int `json:"breakpoints,omitempty"`
+
+	FormatMinWidths map[string]int `json:"format_min_widths,omitempty"`
+	Effort          string         `json:"effort,omitempty"`
+}
+
+// Crop describes how a crop variant was cut: the profile box it renders
+// at 1× and the region of the source it shows, in source pixels.
+type Crop struct {
+	Box    string `json:"box"` // "1080x1920"
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+
+	// Margin is the fraction of the box padded on each side; the region
+	// is scaled into the rest, centered.
+	Margin float64 `json:"margin,omitempty"`
+}
+
+// Rect returns the cropped region of the source.
+func (c *Crop) Rect() image.Rectangle {
+	return image.Rect(c.X, c.Y, c.X+c.Width, c.Y+c.Height)
+}
+
+// Remote reports whether v is rendered by an image CDN (tgimg build
+// --cdn): its path is an absolute URL and no file backs it.
+func (v Variant) Remote() bool {
+	return strings.Contains(v.Path, "://")
+}
+
+// Responsive reports whether v belongs in the asset's responsive srcsets:
+// it is neither a copied original nor a crop.
+func (v Variant) Responsive() bool {
+	return !v.Original && v.Crop == nil
+}
+
+// TelegramFile identifies a copy of a variant stored on Telegram's servers.
+type TelegramFile struct {
+	FileID       string `json:"file_id"`        // bot-specific; resolve with getFile
+	FileUniqueID string `json:"file_unique_id"` // stable across bots
+	Kind         string `json:"kind"`           // "document" (byte-identical) or "photo" (re-encoded by Telegram)
 }
 
 // Stats aggregates build metrics.
@@ -52,6 +261,7 @@ type Stats struct {
 	TotalAssets      int   `json:"total_assets"`
 	TotalVariants    int   `json:"total_variants"`
 	SkippedRegress   int   `json:"skipped_regress,omitempty"` // variants skipped (larger than original)
+	FailedAssets     int   `json:"failed_assets,omitempty"`   // entries in Errors
 }
 
 // SupportedManifestVersion is the current schema version.
@@ -1,9 +1,17 @@
 package manifest
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
+
+	"github.com/AnyUserName/tgimg-cli/internal/hasher"
 )
 
 // New creates an empty manifest with defaults.
@@ -17,28 +25,233 @@ func New(profileName string) *Manifest {
 	}
 }
 
-// ComputeStats recalculates aggregate statistics from assets.
+// ComputeStats recalculates aggregate statistics from assets. Copied
+// originals are no optimized output and count toward neither variants nor
+// output bytes. SkippedRegress cannot be derived from assets and is
+// preserved.
 func (m *Manifest) ComputeStats() {
-	var s Stats
+	s := Stats{SkippedRegress: m.Stats.SkippedRegress}
 	s.TotalAssets = len(m.Assets)
+	s.FailedAssets = len(m.Errors)
 	for _, a := range m.Assets {
 		s.TotalInputBytes += a.Original.Size
-		s.TotalVariants += len(a.Variants)
-		for _, v := range a.Variants {
+		for _, t := range a.Themes {
+			s.TotalInputBytes += t.Original.Size
+		}
+		for _, v := range a.AllVariants() {
+			if v.Original {
+				continue
+			}
+			s.TotalVariants++
 			s.TotalOutputBytes += v.Size
 		}
 	}
 	m.Stats = s
 }
 
-// WriteJSON serializes the manifest to a JSON file with stable ordering.
+// ComputeFingerprint sets c.Fingerprint to the hash of every other field.
+func (c *BuildConfig) ComputeFingerprint() {
+	cp := *c
+	cp.Fingerprint = ""
+	data, _ := json.Marshal(cp) // plain struct, cannot fail
+	c.Fingerprint = hasher.ContentHash(data, 16)
+}
+
+// AllVariants returns the asset's own variants followed by those of every
+// theme rendition, in theme name order.
+func (a Asset) AllVariants() []Variant {
+	if len(a.Themes) == 0 {
+		return a.Variants
+	}
+	out := append([]Variant(nil), a.Variants...)
+	names := make([]string, 0, len(a.Themes))
+	for name := range a.Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		out = append(out, a.Themes[name].Variants...)
+	}
+	return out
+}
+
+// Themed converts the asset into a ThemedAsset rendition.
+func (a Asset) Themed() ThemedAsset {
+	return ThemedAsset{
+		Original:    a.Original,
+		ThumbHash:   a.ThumbHash,
+		AspectRatio: a.AspectRatio,
+		AvgColor:    a.AvgColor,
+		Placeholder: a.Placeholder,
+		Variants:    a.Variants,
+	}
+}
+
+// Lookup returns the asset for key, following an alias if key is not an
+// asset key itself.
+func (m *Manifest) Lookup(key string) (Asset, bool) {
+	if a, ok := m.Assets[key]; ok {
+		return a, true
+	}
+	if target, ok := m.Aliases[key]; ok {
+		a, ok := m.Assets[target]
+		return a, ok
+	}
+	return Asset{}, false
+}
+
+// LookupRef resolves an asset reference: a key or alias, optionally
+// followed by "@" and a breakpoint name ("hero@md"). The whole reference
+// is tried as a key first, since keys like "icon@2x" may contain "@".
+func (m *Manifest) LookupRef(ref string) (key, breakpoint string, a Asset, ok bool) {
+	if a, ok := m.Lookup(ref); ok {
+		return ref, "", a, true
+	}
+	if i := strings.LastIndex(ref, "@"); i > 0 {
+		if a, ok := m.Lookup(ref[:i]); ok {
+			return ref[:i], ref[i+1:], a, true
+		}
+	}
+	return ref, "", Asset{}, false
+}
+
+// BreakpointWidth returns the width of the asset's variants tagged with
+// the breakpoint name. ok is false when the source was too narrow for it
+// or the profile has no such breakpoint.
+func (a Asset) BreakpointWidth(name string) (width int, ok bool) {
+	for _, v := range a.Variants {
+		if v.Breakpoint == name {
+			return v.Width, true
+		}
+	}
+	return 0, false
+}
+
+// WriteOptions controls manifest serialization.
+type WriteOptions struct {
+	// Compact writes minified JSON and drops fields the runtime never
+	// reads (build_info, per-variant encode_ms and quality).
+	Compact bool
+}
+
+// WriteJSON serializes the manifest to a JSON file with stable ordering,
+// replacing it as WriteFile does.
 func WriteJSON(m *Manifest, path string) error {
-	m.ComputeStats()
+	return WriteJSONWith(m, path, WriteOptions{})
+}
+
+// WriteJSONWith is WriteJSON with explicit options.
+func WriteJSONWith(m *Manifest, path string, opts WriteOptions) error {
+	data, err := Marshal(m, opts)
+	if err != nil {
+		return err
+	}
+	return WriteFile(path, data)
+}
+
+// BackupSuffix is appended to a manifest's path for the copy of the
+// previous manifest WriteFile keeps.
+const BackupSuffix = ".bak"
+
+// WriteFile replaces the manifest at path with data. The data goes to a
+// synced temp file in the same directory that is renamed over path, so a
+// reader, or a crash mid-write, sees either the old manifest or the new
+// one and never a truncated file. The previous manifest is kept as
+// path+BackupSuffix, unless it is not valid JSON: a damaged manifest
+// would otherwise replace the last good backup.
+func WriteFile(path string, data []byte) error {
+	prev, err := os.ReadFile(path)
+	switch {
+	case err == nil && json.Valid(prev):
+		if err := replaceFile(path+BackupSuffix, prev); err != nil {
+			return err
+		}
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+	return replaceFile(path, data)
+}
 
-	data, err := json.MarshalIndent(m, "", "  ")
+// replaceFile writes data to path through a synced temp file in the same
+// directory.
+func replaceFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
 	if err != nil {
 		return err
 	}
-	data = append(data, '\n')
-	return os.WriteFile(path, data, 0o644)
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0o644) // CreateTemp creates files 0600
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Marshal recomputes stats and encodes the manifest as it would be written
+// to disk, including the trailing newline.
+func Marshal(m *Manifest, opts WriteOptions) ([]byte, error) {
+	m.ComputeStats()
+
+	var data []byte
+	var err error
+	if opts.Compact {
+		data, err = json.Marshal(compactCopy(m))
+	} else {
+		data, err = json.MarshalIndent(m, "", "  ")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// OptionsOf returns the WriteOptions a manifest file was written with, as
+// far as data tells, so that a command rewriting it keeps its format:
+// Marshal indents everything but a compact manifest, whose "{" is followed
+// directly by the first field.
+func OptionsOf(data []byte) WriteOptions {
+	rest, ok := bytes.CutPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("{"))
+	return WriteOptions{Compact: ok && len(rest) > 0 && rest[0] == '"'}
+}
+
+// compactCopy returns a shallow copy of m without diagnostics-only fields.
+// m itself is left untouched.
+func compactCopy(m *Manifest) *Manifest {
+	c := *m
+	c.BuildInfo = nil
+	c.Assets = make(map[string]Asset, len(m.Assets))
+	for key, a := range m.Assets {
+		a.Variants = compactVariants(a.Variants)
+		if len(a.Themes) > 0 {
+			themes := make(map[string]ThemedAsset, len(a.Themes))
+			for name, t := range a.Themes {
+				t.Variants = compactVariants(t.Variants)
+				themes[name] = t
+			}
+			a.Themes = themes
+		}
+		c.Assets[key] = a
+	}
+	return &c
+}
+
+func compactVariants(vs []Variant) []Variant {
+	out := make([]Variant, len(vs))
+	for i, v := range vs {
+		v.EncodeMS = 0
+		v.Quality = 0
+		out[i] = v
+	}
+	return out
 }
@@ -0,0 +1,141 @@
+// Package metrics computes full-reference image quality metrics (PSNR
+// and SSIM) between a source image and an encoded variant.
+package metrics
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"math"
+)
+
+// ErrSizeMismatch is returned when the two images differ in dimensions.
+var ErrSizeMismatch = errors.New("metrics: image sizes differ")
+
+// SSIM parameters from Wang et al. 2004 for 8-bit data.
+const (
+	ssimWindow = 8
+	ssimStride = 4
+	ssimC1     = (0.01 * 255) * (0.01 * 255)
+	ssimC2     = (0.03 * 255) * (0.03 * 255)
+)
+
+// planes holds an image composited over white as float RGB planes.
+// Compositing makes transparent regions compare as they render on a
+// light background instead of by their (invisible) color values.
+type planes struct {
+	w, h    int
+	r, g, b []float64
+}
+
+func toPlanes(img image.Image) planes {
+	bounds := img.Bounds()
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok || bounds.Min != (image.Point{}) {
+		nrgba = image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+	}
+	w, h := bounds.Dx(), bounds.Dy()
+	p := planes{w: w, h: h, r: make([]float64, w*h), g: make([]float64, w*h), b: make([]float64, w*h)}
+	for y := 0; y < h; y++ {
+		row := nrgba.Pix[y*nrgba.Stride:]
+		for x := 0; x < w; x++ {
+			px := row[x*4 : x*4+4]
+			a := float64(px[3]) / 255
+			i := y*w + x
+			p.r[i] = float64(px[0])*a + 255*(1-a)
+			p.g[i] = float64(px[1])*a + 255*(1-a)
+			p.b[i] = float64(px[2])*a + 255*(1-a)
+		}
+	}
+	return p
+}
+
+// luma returns BT.601 luma.
+func (p planes) luma() []float64 {
+	y := make([]float64, len(p.r))
+	for i := range y {
+		y[i] = 0.299*p.r[i] + 0.587*p.g[i] + 0.114*p.b[i]
+	}
+	return y
+}
+
+// Compare returns PSNR (dB, over RGB) and SSIM (on luma) between a and b,
+// which must have the same dimensions. PSNR is +Inf for identical images.
+func Compare(a, b image.Image) (psnr, ssim float64, err error) {
+	if a.Bounds().Dx() != b.Bounds().Dx() || a.Bounds().Dy() != b.Bounds().Dy() {
+		return 0, 0, ErrSizeMismatch
+	}
+	pa, pb := toPlanes(a), toPlanes(b)
+	return psnrPlanes(pa, pb), ssimPlane(pa.luma(), pb.luma(), pa.w, pa.h), nil
+}
+
+// PSNR returns the peak signal-to-noise ratio over RGB in dB.
+func PSNR(a, b image.Image) (float64, error) {
+	psnr, _, err := Compare(a, b)
+	return psnr, err
+}
+
+// SSIM returns the mean structural similarity of the luma channels,
+// 1 for identical images.
+func SSIM(a, b image.Image) (float64, error) {
+	_, ssim, err := Compare(a, b)
+	return ssim, err
+}
+
+func psnrPlanes(a, b planes) float64 {
+	var sum float64
+	for i := range a.r {
+		dr, dg, db := a.r[i]-b.r[i], a.g[i]-b.g[i], a.b[i]-b.b[i]
+		sum += dr*dr + dg*dg + db*db
+	}
+	mse := sum / float64(3*len(a.r))
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
+
+// ssimPlane averages SSIM over 8×8 windows with a stride of 4. Images
+// smaller than one window are compared as a single window.
+func ssimPlane(a, b []float64, w, h int) float64 {
+	win := ssimWindow
+	if w < win || h < win {
+		return ssimBlock(a, b, w, 0, 0, w, h)
+	}
+	var sum float64
+	var n int
+	for y := 0; y+win <= h; y += ssimStride {
+		for x := 0; x+win <= w; x += ssimStride {
+			sum += ssimBlock(a, b, w, x, y, win, win)
+			n++
+		}
+	}
+	return sum / float64(n)
+}
+
+func ssimBlock(a, b []float64, stride, x0, y0, bw, bh int) float64 {
+	n := float64(bw * bh)
+	var sa, sb float64
+	for y := y0; y < y0+bh; y++ {
+		for x := x0; x < x0+bw; x++ {
+			sa += a[y*stride+x]
+			sb += b[y*stride+x]
+		}
+	}
+	ma, mb := sa/n, sb/n
+	var va, vb, cov float64
+	for y := y0; y < y0+bh; y++ {
+		for x := x0; x < x0+bw; x++ {
+			da, db := a[y*stride+x]-ma, b[y*stride+x]-mb
+			va += da * da
+			vb += db * db
+			cov += da * db
+		}
+	}
+	va /= n
+	vb /= n
+	cov /= n
+	return ((2*ma*mb + ssimC1) * (2*cov + ssimC2)) /
+		((ma*ma + mb*mb + ssimC1) * (va + vb + ssimC2))
+}
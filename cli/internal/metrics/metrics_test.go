@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func gradient(w, h int, shift uint8) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x*4) + shift, uint8(y * 4), 128, 255})
+		}
+	}
+	return img
+}
+
+func TestCompareIdentical(t *testing.T) {
+	img := gradient(32, 24, 0)
+	psnr, ssim, err := Compare(img, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsInf(psnr, 1) {
+		t.Errorf("PSNR = %v, want +Inf", psnr)
+	}
+	if math.Abs(ssim-1) > 1e-9 {
+		t.Errorf("SSIM = %v, want 1", ssim)
+	}
+}
+
+func TestCompareDegrades(t *testing.T) {
+	a := gradient(32, 24, 0)
+	small, _, _ := Compare(a, gradient(32, 24, 2))
+	large, _, _ := Compare(a, gradient(32, 24, 20))
+	if !(small > large) {
+		t.Errorf("PSNR should fall as error grows: %v vs %v", small, large)
+	}
+
+	noisy := gradient(32, 24, 0)
+	for i := 0; i < len(noisy.Pix); i += 4 * 3 {
+		noisy.Pix[i] ^= 0x40
+	}
+	_, ssim, _ := Compare(a, noisy)
+	if ssim >= 0.99 || ssim <= 0 {
+		t.Errorf("SSIM of noisy image = %v, want in (0, 0.99)", ssim)
+	}
+}
+
+func TestCompareSizeMismatch(t *testing.T) {
+	if _, _, err := Compare(gradient(8, 8, 0), gradient(9, 8, 0)); err != ErrSizeMismatch {
+		t.Errorf("err = %v, want ErrSizeMismatch", err)
+	}
+}
+
+func TestCompareTransparentOverWhite(t *testing.T) {
+	a := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	b := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := range b.Pix {
+		b.Pix[i] = 255 // opaque white
+	}
+	// a is fully transparent black: composited over white it matches b.
+	psnr, _, _ := Compare(a, b)
+	if !math.IsInf(psnr, 1) {
+		t.Errorf("PSNR = %v, want +Inf", psnr)
+	}
+}
@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+)
+
+// AliasesFile is the optional sidecar in the input directory that maps
+// logical names to asset keys: {"hero": "banners/spring-2025"}.
+const AliasesFile = "tgimg.aliases.json"
+
+// LoadAliases reads the aliases sidecar from the input. A missing file is
+// not an error and yields an empty map.
+func LoadAliases(in Input) (map[string]string, error) {
+	data, err := in.ReadFile(AliasesFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	aliases := map[string]string{}
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", AliasesFile, err)
+	}
+	return aliases, nil
+}
+
+// failedKeys returns the asset keys of the unreadable sources, to which
+// the keys of sources that failed to build are added.
+func failedKeys(unreadable []UnreadableSource) map[string]bool {
+	failed := make(map[string]bool, len(unreadable))
+	for _, u := range unreadable {
+		failed[u.key] = true
+	}
+	return failed
+}
+
+// resolveAliases checks aliases against the built assets. An alias may not
+// shadow an asset key and must point at an existing asset. An alias to a
+// source in failed, one that could not be built or read, is left out with
+// a warning, so that one bad file does not fail the whole build.
+func resolveAliases(aliases map[string]string, assets, failed map[string]bool) (map[string]string, error) {
+	if len(aliases) == 0 {
+		return nil, nil
+	}
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make(map[string]string, len(aliases))
+	for _, name := range names {
+		target := aliases[name]
+		if assets[name] {
+			return nil, fmt.Errorf("alias %q shadows an asset with the same key", name)
+		}
+		if !assets[target] && failed[target] {
+			logging.Warnf("alias %q left out: asset %q failed to build", name, target)
+			continue
+		}
+		if !assets[target] {
+			return nil, fmt.Errorf("alias %q points to unknown asset %q", name, target)
+		}
+		out[name] = target
+	}
+	return out, nil
+}
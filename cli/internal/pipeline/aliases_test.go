@@ -0,0 +1,83 @@
+package pipeline
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+)
+
+func TestResolveAliases(t *testing.T) {
+	assets := map[string]bool{"img0": true, "logo": true}
+	failed := map[string]bool{"broken": true}
+	for _, tc := range []struct {
+		name    string
+		aliases map[string]string
+		want    map[string]string
+		err     string
+	}{
+		{"resolved", map[string]string{"hero": "img0"}, map[string]string{"hero": "img0"}, ""},
+		{"failed target left out", map[string]string{"hero": "img0", "bad": "broken"}, map[string]string{"hero": "img0"}, ""},
+		{"unknown target", map[string]string{"hero": "missing"}, nil, `points to unknown asset "missing"`},
+		{"shadows an asset", map[string]string{"logo": "img0"}, nil, "shadows an asset"},
+	} {
+		got, err := resolveAliases(tc.aliases, assets, failed)
+		switch {
+		case tc.err != "":
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: error %v, want %q", tc.name, err, tc.err)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", tc.name, err)
+		case !reflect.DeepEqual(got, tc.want):
+			t.Errorf("%s: %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// TestBuildDropsAliasToFailedSource builds an input where an alias points
+// at a file that is no image: the build still writes a manifest.
+func TestBuildDropsAliasToFailedSource(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	f, err := os.Create(filepath.Join(in, "img0.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 64, 48)))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// broken.png is unreadable; truncated.png passes the sniff but fails
+	// to decode.
+	files := map[string]string{"broken.png": "not an image", "truncated.png": "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(in, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prof := profile.Get("telegram-webview")
+	prof.Formats = []string{"png"}
+	aliases := map[string]string{"hero": "img0", "bad": "broken", "cut": "truncated"}
+	m, err := New(Config{InputDir: in, OutputDir: out, Profile: prof, Workers: 1, Aliases: aliases}).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"hero": "img0"}; !reflect.DeepEqual(m.Aliases, want) {
+		t.Errorf("aliases %v, want %v", m.Aliases, want)
+	}
+	if _, ok := m.Errors["truncated"]; !ok {
+		t.Errorf("errors %v, want truncated", m.Errors)
+	}
+
+	aliases["gone"] = "missing"
+	if _, err := New(Config{InputDir: in, OutputDir: out, Profile: prof, Workers: 1, Aliases: aliases}).Run(); err == nil {
+		t.Error("alias to a key not in the input: no error")
+	}
+}
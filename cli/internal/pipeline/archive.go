@@ -0,0 +1,337 @@
+package pipeline
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AnyUserName/tgimg-cli/internal/tempfile"
+)
+
+// archiveExtensions lists the archive formats OpenArchive reads.
+var archiveExtensions = []string{".zip", ".tar", ".tar.gz", ".tgz"}
+
+// IsArchive reports whether name has an archive extension OpenArchive
+// reads.
+func IsArchive(name string) bool {
+	lower := strings.ToLower(name)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Archive is an input read from a .zip, .tar, .tar.gz or .tgz file, such
+// as a designer export. Zip entries are read on demand; the entries of a
+// tar file, which can only be read in order, are copied to one temp file
+// up front. When every entry sits under one top-level directory, as when
+// a folder is zipped, paths are relative to that directory.
+type Archive struct {
+	Path string
+
+	files map[string]*archiveFile // by path below the root
+	zip   *zip.ReadCloser
+	spill *os.File // the tar entries of a local archive
+}
+
+type archiveFile struct {
+	size    int64
+	modTime time.Time
+	zip     *zip.File // zip entries are read on demand
+	spill   *os.File  // local tar entries sit in the spill file at offset
+	offset  int64
+	data    []byte // tar streams are held in memory
+}
+
+// OpenArchive indexes the archive at path. Only images and JSON sidecars
+// are kept; hidden entries and macOS __MACOSX metadata are skipped.
+// Entries with absolute or ".." paths, and two entries with the same
+// path, are an error. Close releases the archive.
+func OpenArchive(path string) (*Archive, error) {
+	a := &Archive{Path: path}
+	files := map[string]*archiveFile{}
+	var err error
+	if strings.HasSuffix(strings.ToLower(path), ".zip") {
+		err = a.indexZip(files)
+	} else {
+		err = a.indexTar(files)
+	}
+	if err != nil {
+		a.Close()
+		return nil, fmt.Errorf("read archive %s: %w", path, err)
+	}
+	a.files = stripRoot(files)
+	return a, nil
+}
+
+func (a *Archive) indexZip(files map[string]*archiveFile) error {
+	r, err := zip.OpenReader(a.Path)
+	if err != nil {
+		return err
+	}
+	a.zip = r
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		// The zip spec wants forward slashes; some Windows tools write
+		// backslashes anyway.
+		name, keep, err := archiveEntry(strings.ReplaceAll(f.Name, `\`, "/"))
+		if err != nil {
+			return err
+		}
+		if keep {
+			if files[name] != nil {
+				return fmt.Errorf("duplicate entry %q", name)
+			}
+			files[name] = &archiveFile{size: int64(f.UncompressedSize64), modTime: f.Modified, zip: f}
+		}
+	}
+	return nil
+}
+
+// TarLimits caps what ReadTar holds in memory: the uncompressed size of
+// each kept entry and of all of them together. Zero means no limit.
+type TarLimits struct {
+	Entry int64
+	Total int64
+}
+
+// TarLimitError is returned by ReadTar when an entry, or the entries
+// together, exceed a TarLimits cap.
+type TarLimitError struct {
+	Entry string // the entry that went over; empty for the total
+	Limit int64
+}
+
+func (e *TarLimitError) Error() string {
+	if e.Entry != "" {
+		return fmt.Sprintf("entry %s exceeds %d bytes uncompressed", e.Entry, e.Limit)
+	}
+	return fmt.Sprintf("entries exceed %d bytes uncompressed in total", e.Limit)
+}
+
+// ReadTar indexes a tar stream, gzip-compressed or not, such as an
+// upload, like OpenArchive indexes a .tar file. name identifies it in
+// messages. The whole stream is read before ReadTar returns; limits caps
+// the entries it keeps in memory, so that a small compressed stream
+// cannot expand without bound.
+func ReadTar(name string, r io.Reader, limits TarLimits) (*Archive, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("read archive %s: %w", name, err)
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+	files := map[string]*archiveFile{}
+	if err := indexTar(r, files, limits, nil); err != nil {
+		return nil, fmt.Errorf("read archive %s: %w", name, err)
+	}
+	return &Archive{Path: name, files: stripRoot(files)}, nil
+}
+
+func (a *Archive) indexTar(files map[string]*archiveFile) error {
+	f, err := os.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if lower := strings.ToLower(a.Path); strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	// A tar file can only be read in order, and the pipeline opens
+	// sources out of order and more than once, so entries are copied to
+	// a temp file rather than held in memory.
+	a.spill, err = tempfile.Create("tgimg_archive_*.tar")
+	if err != nil {
+		return err
+	}
+	return indexTar(r, files, TarLimits{}, a.spill)
+}
+
+// indexTar adds the kept regular files of the tar stream r to files,
+// within limits. With a spill file, entries are appended to it;
+// otherwise they are held in memory.
+func indexTar(r io.Reader, files map[string]*archiveFile, limits TarLimits, spill *os.File) error {
+	tr := tar.NewReader(r)
+	var total int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue // directories, links and devices
+		}
+		name, keep, err := archiveEntry(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if !keep {
+			continue
+		}
+		if files[name] != nil {
+			return fmt.Errorf("duplicate entry %q", name)
+		}
+		// Count what is read rather than trust hdr.Size.
+		limit := int64(-1)
+		if limits.Entry > 0 {
+			limit = limits.Entry
+		}
+		if limits.Total > 0 && (limit < 0 || limits.Total-total < limit) {
+			limit = limits.Total - total
+		}
+		var er io.Reader = tr
+		if limit >= 0 {
+			er = io.LimitReader(tr, limit+1)
+		}
+		f := &archiveFile{modTime: hdr.ModTime}
+		if spill != nil {
+			f.spill, f.offset = spill, total
+			f.size, err = io.Copy(spill, er)
+		} else {
+			f.data, err = io.ReadAll(er)
+			f.size = int64(len(f.data))
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		if limit >= 0 && f.size > limit {
+			if limits.Entry > 0 && f.size > limits.Entry {
+				return &TarLimitError{Entry: hdr.Name, Limit: limits.Entry}
+			}
+			return &TarLimitError{Limit: limits.Total}
+		}
+		total += f.size
+		files[name] = f
+	}
+}
+
+// archiveEntry cleans an entry name and reports whether the entry is an
+// image or JSON sidecar worth keeping.
+func archiveEntry(name string) (string, bool, error) {
+	name = strings.TrimPrefix(name, "./")
+	if !fs.ValidPath(name) {
+		return "", false, fmt.Errorf("unsafe entry path %q", name)
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if strings.HasPrefix(seg, ".") || seg == "__MACOSX" {
+			return "", false, nil
+		}
+	}
+	ext := strings.ToLower(path.Ext(name))
+	return name, imageExtensions[ext] || ext == ".json", nil
+}
+
+// stripRoot removes the top-level directory every entry shares, if any.
+func stripRoot(files map[string]*archiveFile) map[string]*archiveFile {
+	root := ""
+	for name := range files {
+		dir, _, ok := strings.Cut(name, "/")
+		if !ok || (root != "" && dir != root) {
+			return files
+		}
+		root = dir
+	}
+	if root == "" {
+		return files
+	}
+	out := make(map[string]*archiveFile, len(files))
+	for name, f := range files {
+		out[strings.TrimPrefix(name, root+"/")] = f
+	}
+	return out
+}
+
+// Close releases the archive and removes its temp file, if any.
+func (a *Archive) Close() error {
+	if a.spill != nil {
+		a.spill.Close()
+		os.Remove(a.spill.Name())
+	}
+	if a.zip != nil {
+		return a.zip.Close()
+	}
+	return nil
+}
+
+func (a *Archive) Scan(ignore []string) ([]Source, error) {
+	names := make([]string, 0, len(a.files))
+	for name := range a.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sources []Source
+	for _, rel := range names {
+		ext := strings.ToLower(path.Ext(rel))
+		if !imageExtensions[ext] || ignoredObject(rel, ignore) {
+			continue
+		}
+		f := a.files[rel]
+		key, theme := splitTheme(strings.TrimSuffix(rel, path.Ext(rel)))
+		src := Source{
+			AbsPath: a.Path + "/" + rel,
+			RelPath: rel,
+			Key:     key,
+			Format:  sourceFormat(ext),
+			Size:    f.size,
+			Theme:   theme,
+			ModTime: f.modTime,
+			Open:    f.open,
+		}
+		src.sniff()
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
+func (f *archiveFile) open() (io.ReadCloser, error) {
+	if f.zip != nil {
+		return f.zip.Open()
+	}
+	if f.spill != nil {
+		return io.NopCloser(io.NewSectionReader(f.spill, f.offset, f.size)), nil
+	}
+	return io.NopCloser(bytes.NewReader(f.data)), nil
+}
+
+func (a *Archive) ReadFile(name string) ([]byte, error) {
+	f, ok := a.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: a.Path + "/" + name, Err: fs.ErrNotExist}
+	}
+	r, err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func (a *Archive) String() string { return a.Path }
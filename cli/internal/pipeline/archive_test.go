@@ -0,0 +1,187 @@
+package pipeline
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AnyUserName/tgimg-cli/internal/tempfile"
+)
+
+// writeTar writes a gzipped tar with the given entries to path, in order.
+// The run's temp directory, where OpenArchive copies the entries, is
+// removed when the test ends.
+func writeTar(t *testing.T, path string, entries [][2]string) {
+	t.Helper()
+	t.Cleanup(func() { tempfile.Cleanup() })
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	for _, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: e[0], Mode: 0o644, Size: int64(len(e[1])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, e[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestOpenArchiveTarSpills checks that a local tar's entries are kept in
+// a temp file, not in memory, and read back out of order.
+func TestOpenArchiveTarSpills(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.tar.gz")
+	writeTar(t, path, [][2]string{
+		{"export/a.png", "first"},
+		{"export/icons/b.png", "second entry"},
+		{"export/tgimg.focus.json", "{}"},
+	})
+	a, err := OpenArchive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.spill == nil {
+		t.Fatal("no spill file")
+	}
+	for _, f := range a.files {
+		if f.data != nil {
+			t.Error("entry held in memory")
+		}
+	}
+	sources, err := a.Scan(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 2 {
+		t.Fatalf("%d sources, want 2", len(sources))
+	}
+	for _, want := range []struct {
+		i    int
+		data string
+	}{{1, "second entry"}, {0, "first"}, {1, "second entry"}} {
+		r, err := sources[want.i].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || string(got) != want.data {
+			t.Errorf("%s = %q, %v; want %q", sources[want.i].RelPath, got, err, want.data)
+		}
+	}
+	if data, err := a.ReadFile("tgimg.focus.json"); err != nil || string(data) != "{}" {
+		t.Errorf("sidecar = %q, %v", data, err)
+	}
+
+	spill := a.spill.Name()
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(spill); !os.IsNotExist(err) {
+		t.Errorf("spill file left behind: %v", err)
+	}
+}
+
+func TestOpenArchiveDuplicateEntry(t *testing.T) {
+	dir := t.TempDir()
+	tarPath := filepath.Join(dir, "dup.tar.gz")
+	writeTar(t, tarPath, [][2]string{{"a.png", "one"}, {"b.png", "b"}, {"./a.png", "two"}})
+
+	zipPath := filepath.Join(dir, "dup.zip")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, name := range []string{`icons/a.png`, `icons\a.png`} {
+		if _, err := zw.Create(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	for _, path := range []string{tarPath, zipPath} {
+		a, err := OpenArchive(path)
+		if err == nil {
+			a.Close()
+			t.Errorf("%s: no error", filepath.Base(path))
+		} else if !strings.Contains(err.Error(), "duplicate entry") {
+			t.Errorf("%s: %v", filepath.Base(path), err)
+		}
+	}
+}
+
+// TestReadTarLimits reads a gzipped tar whose entries unpack to far more
+// than the compressed stream, as a decompression bomb does.
+func TestReadTarLimits(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, name := range []string{"a.png", "b.png", "skip.txt"} {
+		data := make([]byte, 1<<20)
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() > 64<<10 {
+		t.Fatalf("compressed to %d bytes; the test wants a small stream", buf.Len())
+	}
+
+	for _, tc := range []struct {
+		name   string
+		limits TarLimits
+		want   *TarLimitError // nil: no error
+	}{
+		{"no limits", TarLimits{}, nil},
+		{"within limits", TarLimits{Entry: 1 << 20, Total: 2 << 20}, nil},
+		{"entry", TarLimits{Entry: 1<<20 - 1}, &TarLimitError{Entry: "a.png", Limit: 1<<20 - 1}},
+		{"total", TarLimits{Entry: 1 << 20, Total: 3 << 19}, &TarLimitError{Limit: 3 << 19}},
+		{"skipped entries do not count", TarLimits{Total: 2 << 20}, nil},
+	} {
+		a, err := ReadTar("batch", bytes.NewReader(buf.Bytes()), tc.limits)
+		var got *TarLimitError
+		if errors.As(err, &got) {
+			if tc.want == nil || *got != *tc.want {
+				t.Errorf("%s: %v, want %v", tc.name, got, tc.want)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if tc.want != nil {
+			t.Errorf("%s: no error, want %v", tc.name, tc.want)
+		} else if len(a.files) != 2 {
+			t.Errorf("%s: %d files, want 2", tc.name, len(a.files))
+		}
+	}
+}
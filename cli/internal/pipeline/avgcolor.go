@@ -0,0 +1,151 @@
+package pipeline
+
+import (
+	"image"
+	"math"
+)
+
+// computeAvgColor calculates the average RGB color of an image, with
+// transparent pixels counting as black. NRGBA, RGBA, YCbCr and Gray
+// pixels are summed as integers straight from their buffers; others go
+// through readRow.
+func computeAvgColor(img image.Image) [3]uint8 {
+	bounds := img.Bounds()
+	count := uint64(bounds.Dx()) * uint64(bounds.Dy())
+	if count == 0 {
+		return [3]uint8{0, 0, 0}
+	}
+	var sum [3]uint64
+	div := count // sum / div is the average
+	switch m := img.(type) {
+	case *image.NRGBA:
+		sum = sumNRGBA(m)
+		div *= 255
+	case *image.RGBA:
+		sum = sumRGBA(m)
+	case *image.YCbCr:
+		return avgYCbCr(m)
+	case *image.Gray:
+		sum = sumGray(m)
+	default:
+		sum, div = sumAt(img), count*255
+	}
+	return [3]uint8{
+		uint8((sum[0] + div/2) / div),
+		uint8((sum[1] + div/2) / div),
+		uint8((sum[2] + div/2) / div),
+	}
+}
+
+// sumNRGBA sums the premultiplied channels of m, at 255·255 full.
+func sumNRGBA(m *image.NRGBA) [3]uint64 {
+	var sum [3]uint64
+	w := 4 * m.Rect.Dx()
+	for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+		p := m.Pix[m.PixOffset(m.Rect.Min.X, y):][:w]
+		for i := 0; i+3 < len(p); i += 4 {
+			a := uint64(p[i+3])
+			sum[0] += uint64(p[i]) * a
+			sum[1] += uint64(p[i+1]) * a
+			sum[2] += uint64(p[i+2]) * a
+		}
+	}
+	return sum
+}
+
+// sumRGBA sums the channels of m.
+func sumRGBA(m *image.RGBA) [3]uint64 {
+	var sum [3]uint64
+	w := 4 * m.Rect.Dx()
+	for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+		p := m.Pix[m.PixOffset(m.Rect.Min.X, y):][:w]
+		for i := 0; i+3 < len(p); i += 4 {
+			sum[0] += uint64(p[i])
+			sum[1] += uint64(p[i+1])
+			sum[2] += uint64(p[i+2])
+		}
+	}
+	return sum
+}
+
+// avgYCbCr averages m's luma and chroma planes, each chroma sample
+// weighted by the pixels sharing it, and converts the averages as
+// color.YCbCrToRGB converts a pixel. Like the thumbhash downscale, it
+// skips the per-pixel clamp, which moves the average of a saturated
+// image by a level or two at most, to read each plane once.
+func avgYCbCr(m *image.YCbCr) [3]uint8 {
+	b := m.Rect
+	var ySum uint64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for _, v := range m.Y[m.YOffset(b.Min.X, y):][:b.Dx()] {
+			ySum += uint64(v)
+		}
+	}
+
+	// Chroma columns and rows of b, as COffset maps pixels to them, and
+	// how many of b's pixels each covers.
+	hd, vd := chromaDivisors(m.SubsampleRatio)
+	cols := make([]uint64, (b.Max.X-1)/hd-b.Min.X/hd+1)
+	for x := b.Min.X; x < b.Max.X; x++ {
+		cols[x/hd-b.Min.X/hd]++
+	}
+	rows := make([]uint64, (b.Max.Y-1)/vd-b.Min.Y/vd+1)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		rows[y/vd-b.Min.Y/vd]++
+	}
+	var cbSum, crSum uint64
+	for j, rw := range rows {
+		cb := m.Cb[j*m.CStride:][:len(cols)]
+		cr := m.Cr[j*m.CStride:][:len(cols)]
+		var cbRow, crRow uint64
+		for k, cw := range cols {
+			cbRow += cw * uint64(cb[k])
+			crRow += cw * uint64(cr[k])
+		}
+		cbSum += rw * cbRow
+		crSum += rw * crRow
+	}
+
+	n := float64(b.Dx()) * float64(b.Dy())
+	yy := float64(ySum) / n
+	cb := float64(cbSum)/n - 128
+	cr := float64(crSum)/n - 128
+	return [3]uint8{
+		clampChannel(yy + 91881.0/65536*cr),
+		clampChannel(yy - 22554.0/65536*cb - 46802.0/65536*cr),
+		clampChannel(yy + 116130.0/65536*cb),
+	}
+}
+
+// clampChannel rounds v to an 8-bit channel.
+func clampChannel(v float64) uint8 {
+	return uint8(math.Round(min(max(v, 0), 255)))
+}
+
+// sumGray sums the channels of m.
+func sumGray(m *image.Gray) [3]uint64 {
+	var v uint64
+	for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+		for _, p := range m.Pix[m.PixOffset(m.Rect.Min.X, y):][:m.Rect.Dx()] {
+			v += uint64(p)
+		}
+	}
+	return [3]uint64{v, v, v}
+}
+
+// sumAt sums the premultiplied channels of any image, at 255·255 full,
+// through readRow.
+func sumAt(img image.Image) [3]uint64 {
+	var sum [3]uint64
+	b := img.Bounds()
+	line := make([]uint32, 4*b.Dx())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		readRow(img, b.Min.X, y, line)
+		for i := 0; i < len(line); i += 4 {
+			sum[0] += uint64(line[i])
+			sum[1] += uint64(line[i+1])
+			sum[2] += uint64(line[i+2])
+		}
+	}
+	return sum
+}
@@ -0,0 +1,213 @@
+package pipeline
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/AnyUserName/tgimg-cli/internal/cache"
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+)
+
+// ─── synthetic corpus ────────────────────────────────────────
+
+// corpus lists the benchmark sources: camera-sized and web-sized photos,
+// UI art with and without alpha, some in subdirectories.
+var corpus = []struct {
+	path  string
+	w, h  int
+	alpha bool
+}{
+	{"photos/camera.jpg", 3000, 2000, false},
+	{"photos/landscape.jpg", 1920, 1080, false},
+	{"photos/portrait.jpg", 1080, 1350, false},
+	{"hero.jpg", 2560, 1440, false},
+	{"thumb.jpg", 320, 240, false},
+	{"icons/logo.png", 512, 512, true},
+	{"icons/badge.png", 128, 128, true},
+	{"banner.png", 1200, 400, false},
+}
+
+// makeSource returns a w×h image with smooth gradients and some texture,
+// so encoders do real work, and an alpha ramp when alpha is set.
+func makeSource(w, h int, alpha bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			a := uint8(255)
+			if alpha {
+				a = uint8(255 * x / w)
+			}
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(255*x/w) ^ uint8(x*y%7),
+				G: uint8(255*y/h) ^ uint8((x+y)%5),
+				B: uint8((x*3 + y*5) % 256),
+				A: a,
+			})
+		}
+	}
+	return img
+}
+
+var (
+	corpusOnce  sync.Once
+	corpusFiles [][]byte
+	corpusErr   error
+)
+
+// writeCorpus writes the corpus into a new temporary input directory,
+// encoding it once per test binary.
+func writeCorpus(b *testing.B) string {
+	b.Helper()
+	corpusOnce.Do(func() {
+		for _, c := range corpus {
+			var buf bytes.Buffer
+			img := makeSource(c.w, c.h, c.alpha)
+			if path.Ext(c.path) == ".png" {
+				corpusErr = png.Encode(&buf, img)
+			} else {
+				corpusErr = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+			}
+			if corpusErr != nil {
+				return
+			}
+			corpusFiles = append(corpusFiles, buf.Bytes())
+		}
+	})
+	if corpusErr != nil {
+		b.Fatal(corpusErr)
+	}
+	dir := b.TempDir()
+	for i, c := range corpus {
+		name := filepath.Join(dir, filepath.FromSlash(c.path))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(name, corpusFiles[i], 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// benchProfile is the default profile with the in-process encoders only,
+// so results do not depend on which of cwebp and avifenc are installed:
+// JPEG, plus PNG for sources with alpha.
+func benchProfile() profile.Profile {
+	prof := profile.Get("telegram-webview")
+	prof.Formats = []string{"jpeg"}
+	return prof
+}
+
+// ─── benchmarks ──────────────────────────────────────────────
+
+// benchRun builds the corpus b.N times with cfg, reporting images/s and
+// allocations per asset for the whole scan → decode → resize → encode →
+// manifest path.
+func benchRun(b *testing.B, cfg Config) {
+	cfg.InputDir = writeCorpus(b)
+	cfg.OutputDir = b.TempDir()
+	if cfg.Profile.Name == "" {
+		cfg.Profile = benchProfile()
+	}
+	run := func() {
+		if _, err := New(cfg).Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	run() // warm the pools and, if set, the cache
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		run()
+	}
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+
+	assets := float64(b.N * len(corpus))
+	b.ReportMetric(assets/b.Elapsed().Seconds(), "images/s")
+	b.ReportMetric(float64(after.Mallocs-before.Mallocs)/assets, "allocs/asset")
+	b.ReportMetric(float64(after.TotalAlloc-before.TotalAlloc)/assets, "B/asset")
+}
+
+func BenchmarkRun(b *testing.B) {
+	benchRun(b, Config{})
+}
+
+func BenchmarkRun_1Worker(b *testing.B) {
+	benchRun(b, Config{Workers: 1})
+}
+
+// BenchmarkRun_Cached measures an incremental build in which every
+// variant is served from the encode cache: scan, hash, decode for the
+// thumbhash and manifest.
+func BenchmarkRun_Cached(b *testing.B) {
+	c, err := cache.Open(b.TempDir())
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchRun(b, Config{Cache: c})
+}
+
+func BenchmarkScan(b *testing.B) {
+	dir := writeCorpus(b)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ScanImages(dir, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScanHashed(b *testing.B) {
+	dir := writeCorpus(b)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ScanImagesHashed(dir, nil, runtime.NumCPU()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecodeResize decodes the camera photo and renders the default
+// profile's widths from it, without encoding.
+func BenchmarkDecodeResize(b *testing.B) {
+	dir := writeCorpus(b)
+	prof := benchProfile()
+	srcs, err := ScanImages(filepath.Join(dir, "photos"), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var src Source
+	for _, s := range srcs {
+		if s.Key == "camera" {
+			src = s
+		}
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		si, err := decodeSource(src, pickScale(prof))
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, w := range prof.EffectiveWidths(si.width, si.height) {
+			h := prof.Height(si.width, si.height, w)
+			releaseImage(resize(si.img, si.img.Bounds(), w, h))
+		}
+		si.release()
+	}
+}
@@ -0,0 +1,88 @@
+package pipeline
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/AnyUserName/tgimg-cli/internal/s3"
+)
+
+// Bucket is an input in S3-compatible object storage: the objects under
+// Prefix, keyed by their path below it. Objects are streamed when a
+// source is decoded; nothing is synced to disk.
+type Bucket struct {
+	Client *s3.Client
+	Prefix string // "" or ending in "/", e.g. "images/"
+	URL    string // e.g. "s3://bucket/images/", for messages
+
+	// Context bounds every request; nil means context.Background().
+	Context context.Context
+}
+
+func (b *Bucket) ctx() context.Context {
+	if b.Context != nil {
+		return b.Context
+	}
+	return context.Background()
+}
+
+func (b *Bucket) Scan(ignore []string) ([]Source, error) {
+	objects, err := b.Client.ListObjects(b.ctx(), b.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	var sources []Source
+	for _, o := range objects {
+		rel := strings.TrimPrefix(o.Key, b.Prefix)
+		ext := strings.ToLower(path.Ext(rel))
+		if rel == "" || strings.HasSuffix(rel, "/") || !imageExtensions[ext] {
+			continue // folder markers and non-images
+		}
+		if ignoredObject(rel, ignore) {
+			continue
+		}
+		key, theme := splitTheme(strings.TrimSuffix(rel, path.Ext(rel)))
+		objectKey := o.Key
+		src := Source{
+			AbsPath: b.URL + rel,
+			RelPath: rel,
+			Key:     key,
+			Format:  sourceFormat(ext),
+			Size:    o.Size,
+			Theme:   theme,
+			ModTime: o.LastModified,
+			Open: func() (io.ReadCloser, error) {
+				return b.Client.Get(b.ctx(), objectKey)
+			},
+		}
+		if src.Size == 0 {
+			src.Unreadable = SkipEmptyFile // objects are not read during the scan
+		}
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
+// ignoredObject reports whether rel or one of its parent directories
+// matches an ignore pattern, as ScanImages skips ignored directories.
+func ignoredObject(rel string, ignore []string) bool {
+	for p := rel; p != "." && p != "/"; p = path.Dir(p) {
+		if ignored(p, ignore) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Bucket) ReadFile(name string) ([]byte, error) {
+	body, err := b.Client.Get(b.ctx(), b.Prefix+name)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func (b *Bucket) String() string { return b.URL }
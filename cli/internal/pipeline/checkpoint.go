@@ -0,0 +1,158 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+)
+
+// CheckpointFileName is the file Run periodically writes to the output
+// directory while processing, listing every finished source with its
+// asset. A build that crashes or is killed picks up from it on the next
+// run with the same settings. The caller removes it once the manifest is
+// written.
+const CheckpointFileName = ".tgimg-checkpoint.json"
+
+const checkpointVersion = 1
+
+type checkpoint struct {
+	Version     int                        `json:"version"`
+	Fingerprint string                     `json:"fingerprint"` // BuildConfig fingerprint of the interrupted build
+	InputDir    string                     `json:"input_dir"`
+	Force       bool                       `json:"force,omitempty"`
+	Done        map[string]checkpointEntry `json:"done"` // by input-relative source path; see Source.id
+}
+
+// checkpointEntry is one successfully processed source. Size and ModTime
+// identify the source file it was built from.
+type checkpointEntry struct {
+	Key     string           `json:"key"`
+	Theme   string           `json:"theme,omitempty"`
+	Size    int64            `json:"size"`
+	ModTime int64            `json:"mtime"` // UnixNano
+	Asset   manifest.Asset   `json:"asset"`
+	Skipped []SkippedVariant `json:"skipped,omitempty"`
+}
+
+// checkpointer accumulates finished sources and rewrites the checkpoint
+// file at most once per interval. It is safe for concurrent use.
+type checkpointer struct {
+	path     string
+	interval time.Duration
+
+	mu   sync.Mutex
+	cp   checkpoint
+	last time.Time
+}
+
+func newCheckpointer(path string, interval time.Duration, cp checkpoint) *checkpointer {
+	cp.Done = map[string]checkpointEntry{}
+	return &checkpointer{path: path, interval: interval, cp: cp, last: time.Now()}
+}
+
+// record adds a finished source and writes the checkpoint if the interval
+// has elapsed. Failed sources are not recorded, so a resumed build retries
+// them.
+func (c *checkpointer) record(src Source, r processResult) {
+	if r.err != nil {
+		return
+	}
+	size, mtime, err := src.version()
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cp.Done[src.id()] = checkpointEntry{
+		Key: r.key, Theme: r.theme,
+		Size: size, ModTime: mtime.UnixNano(),
+		Asset: r.asset, Skipped: r.skipped,
+	}
+	if time.Since(c.last) < c.interval {
+		return
+	}
+	c.last = time.Now()
+	if err := c.write(); err != nil {
+		logging.Warnf("checkpoint: %v", err)
+	}
+}
+
+// resume carries over the entry of a source a previous build finished.
+func (c *checkpointer) resume(id string, e checkpointEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cp.Done[id] = e
+}
+
+// write replaces the checkpoint file atomically; c.mu must be held.
+func (c *checkpointer) write() error {
+	data, err := json.Marshal(c.cp)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), CheckpointFileName+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	logging.Debugf("checkpoint: %d images done", len(c.cp.Done))
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// loadCheckpoint reads the checkpoint at path if it was written by a build
+// with the same settings (want's fingerprint, input dir and force flag).
+// A missing or mismatched checkpoint yields nil.
+func loadCheckpoint(path string, want checkpoint) *checkpoint {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logging.Warnf("checkpoint: %v", err)
+		}
+		return nil
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		logging.Warnf("checkpoint %s is unreadable, starting over: %v", path, err)
+		return nil
+	}
+	if cp.Version != checkpointVersion || cp.Fingerprint != want.Fingerprint ||
+		cp.InputDir != want.InputDir || cp.Force != want.Force {
+		logging.Debugf("checkpoint %s is from a build with other settings; ignoring it", path)
+		return nil
+	}
+	return &cp
+}
+
+// resumed returns the checkpointed result for src, if its source file is
+// unchanged and every variant file it lists is still in out.
+func (cp *checkpoint) resumed(src Source, out Output) (processResult, bool) {
+	e, ok := cp.Done[src.id()]
+	if !ok || e.Key != src.Key || e.Theme != src.Theme {
+		return processResult{}, false
+	}
+	size, mtime, err := src.version()
+	if err != nil || size != e.Size || mtime.UnixNano() != e.ModTime {
+		return processResult{}, false
+	}
+	for _, v := range e.Asset.Variants {
+		if ok, err := out.Exists(v.Path); !ok || err != nil {
+			return processResult{}, false
+		}
+	}
+	return processResult{key: e.Key, theme: e.Theme, recolor: src.Recolor, source: src.RelPath, asset: e.Asset, skipped: e.Skipped}, true
+}
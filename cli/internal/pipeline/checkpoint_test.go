@@ -0,0 +1,156 @@
+package pipeline
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+)
+
+// checkpointFixture writes a source file and its one variant, and returns
+// the source, the output and a finished result for it.
+func checkpointFixture(t *testing.T) (Source, OutDir, processResult) {
+	t.Helper()
+	in, out := t.TempDir(), t.TempDir()
+	path := filepath.Join(in, "a.png")
+	if err := os.WriteFile(path, []byte("source"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v := manifest.Variant{Format: "png", Width: 320, Height: 240, Path: "a.320.240.0123abcd.png"}
+	if err := os.WriteFile(filepath.Join(out, v.Path), []byte("variant"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src := Source{AbsPath: path, RelPath: "a.png", Key: "a", Format: "png", Size: 6}
+	res := processResult{key: "a", source: "a.png", asset: manifest.Asset{Variants: []manifest.Variant{v}}}
+	return src, OutDir(out), res
+}
+
+func testCheckpoint(inputDir string) checkpoint {
+	return checkpoint{Version: checkpointVersion, Fingerprint: "f1", InputDir: inputDir}
+}
+
+func TestLoadCheckpoint(t *testing.T) {
+	src, out, res := checkpointFixture(t)
+	path := filepath.Join(string(out), CheckpointFileName)
+	want := testCheckpoint(filepath.Dir(src.AbsPath))
+	c := newCheckpointer(path, 0, want)
+	c.record(src, res)
+
+	if cp := loadCheckpoint(path, want); cp == nil || len(cp.Done) != 1 {
+		t.Fatalf("same settings: %+v, want the recorded source", cp)
+	}
+	for name, mismatch := range map[string]func(*checkpoint){
+		"fingerprint": func(cp *checkpoint) { cp.Fingerprint = "f2" },
+		"input dir":   func(cp *checkpoint) { cp.InputDir += "-other" },
+		"force":       func(cp *checkpoint) { cp.Force = true },
+	} {
+		other := want
+		mismatch(&other)
+		if cp := loadCheckpoint(path, other); cp != nil {
+			t.Errorf("other %s: loaded %+v", name, cp)
+		}
+	}
+
+	newer := want
+	newer.Version++
+	newCheckpointer(path, 0, newer).record(src, res)
+	if cp := loadCheckpoint(path, want); cp != nil {
+		t.Errorf("other version: loaded %+v", cp)
+	}
+
+	if cp := loadCheckpoint(filepath.Join(string(out), "missing.json"), want); cp != nil {
+		t.Errorf("missing file: loaded %+v", cp)
+	}
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if cp := loadCheckpoint(path, want); cp != nil {
+		t.Errorf("damaged file: loaded %+v", cp)
+	}
+}
+
+func TestCheckpointResumed(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		change func(t *testing.T, src *Source, out OutDir, res processResult)
+		want   bool
+	}{
+		{"unchanged", func(*testing.T, *Source, OutDir, processResult) {}, true},
+		{"size changed", func(t *testing.T, src *Source, _ OutDir, _ processResult) {
+			fi, err := os.Stat(src.AbsPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(src.AbsPath, []byte("edited source"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			os.Chtimes(src.AbsPath, fi.ModTime(), fi.ModTime())
+		}, false},
+		{"mtime changed", func(t *testing.T, src *Source, _ OutDir, _ processResult) {
+			later := time.Now().Add(time.Hour)
+			if err := os.Chtimes(src.AbsPath, later, later); err != nil {
+				t.Fatal(err)
+			}
+		}, false},
+		{"variant missing", func(t *testing.T, _ *Source, out OutDir, res processResult) {
+			if err := os.Remove(filepath.Join(string(out), res.asset.Variants[0].Path)); err != nil {
+				t.Fatal(err)
+			}
+		}, false},
+		{"other key", func(_ *testing.T, src *Source, _ OutDir, _ processResult) { src.Key = "b" }, false},
+		{"other theme", func(_ *testing.T, src *Source, _ OutDir, _ processResult) { src.Theme = "dark" }, false},
+	} {
+		src, out, res := checkpointFixture(t)
+		path := filepath.Join(string(out), CheckpointFileName)
+		want := testCheckpoint(filepath.Dir(src.AbsPath))
+		newCheckpointer(path, 0, want).record(src, res)
+		cp := loadCheckpoint(path, want)
+		if cp == nil {
+			t.Fatalf("%s: checkpoint not loaded", tc.name)
+		}
+
+		tc.change(t, &src, out, res)
+		got, ok := cp.resumed(src, out)
+		if ok != tc.want {
+			t.Errorf("%s: resumed = %v, want %v", tc.name, ok, tc.want)
+		}
+		if ok && (got.key != "a" || got.source != "a.png" || len(got.asset.Variants) != 1) {
+			t.Errorf("%s: resumed %+v", tc.name, got)
+		}
+	}
+}
+
+func TestCheckpointRecordInterval(t *testing.T) {
+	src, out, res := checkpointFixture(t)
+	path := filepath.Join(string(out), CheckpointFileName)
+	c := newCheckpointer(path, time.Hour, testCheckpoint(filepath.Dir(src.AbsPath)))
+
+	c.record(src, res)
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("written before the interval elapsed: %v", err)
+	}
+	if len(c.cp.Done) != 1 {
+		t.Fatalf("%d sources recorded, want 1", len(c.cp.Done))
+	}
+
+	failed := res
+	failed.err = errors.New("encode failed")
+	other := src
+	other.RelPath, other.Key = "b.png", "b"
+	c.record(other, failed)
+	if _, ok := c.cp.Done["b.png"]; ok {
+		t.Error("a failed source was recorded")
+	}
+
+	c.last = time.Now().Add(-2 * time.Hour)
+	c.record(src, res)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("not written once the interval elapsed: %v", err)
+	}
+	if time.Since(c.last) > time.Minute {
+		t.Error("the write did not restart the interval")
+	}
+}
@@ -0,0 +1,263 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/AnyUserName/tgimg-cli/internal/colorspace"
+	"github.com/AnyUserName/tgimg-cli/internal/jpegdec"
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+)
+
+// jpegScales are the reduced JPEG decode scales, largest first.
+var jpegScales = []int{8, 4, 2}
+
+// sourceImage is a decoded source. A JPEG much larger than every variant
+// made from it is decoded at 1/2, 1/4 or 1/8 scale; width and height are
+// still the source's full size, which the manifest records and variants
+// and crops are planned from.
+type sourceImage struct {
+	img           image.Image
+	width, height int
+	scale         int    // 1, 2, 4 or 8
+	pix           []byte // pooled pixels of img, if any; see release
+	gamut         string // color space img was converted to sRGB from, if any
+}
+
+// release returns the pooled pixels of a JPEG source once every variant
+// is rendered. si must not be used afterwards.
+func (si sourceImage) release() {
+	if si.pix != nil {
+		putPix(si.pix)
+	}
+}
+
+// bounds returns the full-size bounds of the source.
+func (si sourceImage) bounds() image.Rectangle {
+	return image.Rect(0, 0, si.width, si.height)
+}
+
+// scaled maps r, in full-size source coordinates, onto img.
+func (si sourceImage) scaled(r image.Rectangle) image.Rectangle {
+	if si.scale <= 1 || r.Empty() {
+		return r
+	}
+	s := si.scale
+	r = image.Rect((r.Min.X+s/2)/s, (r.Min.Y+s/2)/s, (r.Max.X+s/2)/s, (r.Max.Y+s/2)/s)
+	return r.Intersect(si.img.Bounds())
+}
+
+// decodeScale returns the largest JPEG decode scale at which a w×h
+// source still has at least as many pixels as every variant and crop
+// prof makes from it, so no variant is resized up from a reduced decode.
+func decodeScale(prof profile.Profile, w, h int) int {
+	widths := prof.EffectiveWidths(w, h)
+	crops := prof.CropTargets(w, h)
+next:
+	for _, s := range jpegScales {
+		sw, sh := w/s, h/s // the decode rounds up; this errs low
+		for _, tw := range widths {
+			if tw > sw || prof.Height(w, h, tw) > sh {
+				continue next
+			}
+		}
+		for _, t := range crops {
+			if rw, rh := profile.FitBox(sw, sh, t.Width, t.Height); rw < t.Width || rh < t.Height {
+				continue next
+			}
+		}
+		return s
+	}
+	return 1
+}
+
+// peekReader is a reader image.Decode uses without buffering it.
+type peekReader interface {
+	io.Reader
+	Peek(int) ([]byte, error)
+}
+
+// maxHeader caps the bytes headReader keeps. ICC profiles precede the
+// image data but may follow a 64 KB EXIF thumbnail and as much XMP.
+const maxHeader = 256 << 10
+
+// headReader keeps the first bytes a decoder reads, so that the color
+// profile can be read from them after the decode.
+type headReader struct {
+	peekReader
+	head []byte
+}
+
+func (r *headReader) Read(p []byte) (int, error) {
+	n, err := r.peekReader.Read(p)
+	if keep := min(n, maxHeader-len(r.head)); keep > 0 {
+		r.head = append(r.head, p[:keep]...)
+	}
+	return n, err
+}
+
+// decodeSource opens and decodes a source image, converts it to sRGB if
+// it carries a wide-gamut color profile and applies its recolor rule, if
+// any. A JPEG is decoded at the scale pick returns for its full
+// size (see decodeScale), into pooled pixels; a nil pick decodes every
+// source at full size. Release the result when done.
+func decodeSource(src Source, pick func(w, h int) int) (sourceImage, error) {
+	f, err := src.open()
+	if err != nil {
+		return sourceImage{}, fmt.Errorf("open %s: %w", src.RelPath, err)
+	}
+	defer f.Close()
+
+	si := sourceImage{scale: 1}
+	pr, ok := f.(peekReader) // a mappedFile needs no buffer
+	if !ok {
+		pr = bufio.NewReader(f)
+	}
+	br := &headReader{peekReader: pr}
+	if magic, _ := br.Peek(2); pick != nil && string(magic) == "\xff\xd8" {
+		si.img, err = jpegdec.Decode(br, &jpegdec.Options{
+			Scale: func(w, h int) int {
+				si.width, si.height = w, h
+				si.scale = pick(w, h)
+				return si.scale
+			},
+			Alloc: func(n int) []byte {
+				si.pix = getPix(n)
+				return si.pix
+			},
+		})
+	} else {
+		si.img, _, err = image.Decode(br)
+	}
+	if err != nil {
+		si.release()
+		return sourceImage{}, fmt.Errorf("decode %s: %w", src.RelPath, err)
+	}
+	if m, ok := si.img.(*image.Paletted); ok {
+		si.img = gifScreen(m, br.head)
+	}
+	if si.scale == 1 {
+		si.width, si.height = si.img.Bounds().Dx(), si.img.Bounds().Dy()
+	}
+	if t, err := colorspace.FromHeader(br.head); err != nil {
+		logging.Warnf("%s: color profile: %v; colors are kept as they are", src.RelPath, err)
+	} else if t != nil {
+		logging.Debugf("%s: converting from %s to sRGB", src.RelPath, t.Name)
+		img := t.Convert(si.img)
+		si.release()
+		si.img, si.pix, si.gamut = img, nil, t.Name
+	}
+	if src.Recolor != nil {
+		img, err := recolor(si.img, *src.Recolor)
+		si.release()
+		if err != nil {
+			return sourceImage{}, fmt.Errorf("recolor %s@%s: %w", src.Key, src.Theme, err)
+		}
+		si.img, si.pix = img, nil
+	}
+	return si, nil
+}
+
+// DecodedFile is an image file decoded the way a build decodes it.
+type DecodedFile struct {
+	// Image is the decoded image: a GIF on its logical screen, converted
+	// to sRGB, and a JPEG possibly at a reduced scale.
+	Image image.Image
+	// Width and Height are the full size the manifest records.
+	Width, Height int
+	// Format is the format sniffed from the content (png, jpeg, gif, ...).
+	Format string
+}
+
+// DecodeFile decodes the image file at path as a build with prof does,
+// so that anything computed from the result, such as the thumbhash,
+// matches what the build writes to the manifest.
+func DecodeFile(path string, prof profile.Profile) (DecodedFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return DecodedFile{}, err
+	}
+	src := Source{
+		AbsPath: path,
+		RelPath: filepath.Base(path),
+		Format:  sourceFormat(strings.ToLower(filepath.Ext(path))),
+		Size:    info.Size(),
+	}
+	src.sniff()
+	switch src.Unreadable {
+	case SkipEmptyFile:
+		return DecodedFile{}, fmt.Errorf("%s: empty file", path)
+	case SkipNotImage:
+		return DecodedFile{}, fmt.Errorf("%s: not an image (unknown content)", path)
+	}
+	si, err := decodeSource(src, pickScale(prof))
+	if err != nil {
+		return DecodedFile{}, err
+	}
+	// si is not released: its pooled pixels, if any, stay with the
+	// returned image and are left to the garbage collector.
+	return DecodedFile{Image: si.img, Width: si.width, Height: si.height, Format: src.Format}, nil
+}
+
+// pickScale returns the pick function of decodeSource for a source built
+// with every one of profs: the smallest of their decode scales.
+func pickScale(profs ...profile.Profile) func(w, h int) int {
+	return func(w, h int) int {
+		scale := jpegScales[0]
+		for _, prof := range profs {
+			scale = min(scale, decodeScale(prof, w, h))
+		}
+		return scale
+	}
+}
+
+// gifScreen returns the first frame of a GIF, which image/gif returns at
+// its own bounds, on the GIF's logical screen, read from head. Browsers
+// show the screen outside the frame as transparent, so the canvas is too.
+// Other paletted images, and frames that fill the screen, are returned
+// as they are.
+func gifScreen(m *image.Paletted, head []byte) image.Image {
+	if len(head) < 10 || string(head[:4]) != "GIF8" {
+		return m
+	}
+	screen := image.Rect(0, 0, int(binary.LittleEndian.Uint16(head[6:])), int(binary.LittleEndian.Uint16(head[8:])))
+	if m.Rect == screen || !m.Rect.In(screen) { // image/gif rejects the latter
+		return m
+	}
+
+	transparent := -1
+	for i, c := range m.Palette {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			transparent = i
+			break
+		}
+	}
+	pal := m.Palette
+	if transparent < 0 && len(pal) < 256 {
+		transparent = len(pal)
+		pal = append(slices.Clip(pal), color.RGBA{})
+	}
+	if transparent < 0 { // a full palette without a transparent entry
+		canvas := image.NewNRGBA(screen)
+		draw.Draw(canvas, m.Rect, m, m.Rect.Min, draw.Src)
+		return canvas
+	}
+	canvas := image.NewPaletted(screen, pal)
+	for i := range canvas.Pix {
+		canvas.Pix[i] = uint8(transparent)
+	}
+	for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+		copy(canvas.Pix[canvas.PixOffset(m.Rect.Min.X, y):], m.Pix[m.PixOffset(m.Rect.Min.X, y):][:m.Rect.Dx()])
+	}
+	return canvas
+}
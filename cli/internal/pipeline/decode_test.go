@@ -0,0 +1,360 @@
+package pipeline
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+	"github.com/AnyUserName/tgimg-core/thumbhash"
+)
+
+// genericImage hides the concrete type of an image, so that resize and
+// computeAvgColor read it through At instead of their fast paths.
+type genericImage struct{ image.Image }
+
+// adam7 lists the x and y start and step of the seven Adam7 passes.
+var adam7 = [7][4]int{{0, 0, 8, 8}, {4, 0, 8, 8}, {0, 4, 4, 8}, {2, 0, 4, 4}, {0, 2, 2, 4}, {1, 0, 2, 2}, {0, 1, 1, 2}}
+
+// encodePNG writes a w×h PNG of color type ct at 8 or 16 bits per sample,
+// Adam7-interlaced if interlaced is set, which image/png cannot encode.
+// sample returns channel c of pixel (x, y); a paletted image gets a
+// 256-entry palette with partly transparent entries.
+func encodePNG(ct, depth byte, w, h int, interlaced bool, sample func(x, y, c int) uint16) []byte {
+	channels := map[byte]int{0: 1, 2: 3, 3: 1, 4: 2, 6: 4}[ct]
+	var raw []byte
+	pass := func(x0, y0, dx, dy int) {
+		for y := y0; y < h; y += dy {
+			if x0 >= w {
+				return
+			}
+			raw = append(raw, 0) // filter: none
+			for x := x0; x < w; x += dx {
+				for c := 0; c < channels; c++ {
+					if v := sample(x, y, c); depth == 16 {
+						raw = binary.BigEndian.AppendUint16(raw, v)
+					} else {
+						raw = append(raw, byte(v))
+					}
+				}
+			}
+		}
+	}
+	var ilace byte
+	if interlaced {
+		ilace = 1
+		for _, p := range adam7 {
+			pass(p[0], p[1], p[2], p[3])
+		}
+	} else {
+		pass(0, 0, 1, 1)
+	}
+
+	var buf bytes.Buffer
+	chunk := func(typ string, data []byte) {
+		c := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+		c = append(append(c, typ...), data...)
+		buf.Write(binary.BigEndian.AppendUint32(c, crc32.ChecksumIEEE(c[4:])))
+	}
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	ihdr := binary.BigEndian.AppendUint32(nil, uint32(w))
+	ihdr = binary.BigEndian.AppendUint32(ihdr, uint32(h))
+	chunk("IHDR", append(ihdr, depth, ct, 0, 0, ilace))
+	if ct == 3 {
+		var plte, trns []byte
+		for i := 0; i < 256; i++ {
+			plte = append(plte, byte(i), byte(255-i), byte(i*7))
+			trns = append(trns, byte(255-i%4*60))
+		}
+		chunk("PLTE", plte)
+		chunk("tRNS", trns)
+	}
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(raw)
+	zw.Close()
+	chunk("IDAT", z.Bytes())
+	chunk("IEND", nil)
+	return buf.Bytes()
+}
+
+// decodeFile writes data to a file and decodes it as a source, at the
+// JPEG scale pick returns.
+func decodeFile(t *testing.T, name string, data []byte, pick func(w, h int) int) sourceImage {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	si, err := decodeSource(Source{AbsPath: path, RelPath: name}, pick)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return si
+}
+
+// maxDiff returns the largest difference between the bytes of a and b.
+func maxDiff(a, b []byte) int {
+	d := 0
+	for i := range a {
+		d = max(d, int(a[i])-int(b[i]), int(b[i])-int(a[i]))
+	}
+	return d
+}
+
+// checkFastPaths checks that resize and computeAvgColor read img through
+// their fast paths as through At. At rounds 8-bit values through 16
+// bits, so results may differ by a level. A YCbCr image is compared with
+// its color.YCbCrToRGB conversion, which its fast path must reproduce
+// exactly.
+func checkFastPaths(t *testing.T, what string, img image.Image) {
+	t.Helper()
+	b := img.Bounds()
+	var ref image.Image = genericImage{img}
+	tolerance := 1
+	if m, ok := img.(*image.YCbCr); ok {
+		rgb := image.NewNRGBA(b)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				yi, ci := m.YOffset(x, y), m.COffset(x, y)
+				r, g, bl := color.YCbCrToRGB(m.Y[yi], m.Cb[ci], m.Cr[ci])
+				rgb.SetNRGBA(x, y, color.NRGBA{r, g, bl, 255})
+			}
+		}
+		ref, tolerance = rgb, 0
+	}
+	for _, size := range [][2]int{{b.Dx(), b.Dy()}, {(b.Dx() + 2) / 3, (b.Dy() + 1) / 2}} {
+		fast := resize(img, b, size[0], size[1])
+		slow := resize(ref, b, size[0], size[1])
+		if d := maxDiff(fast.Pix, slow.Pix); d > tolerance {
+			t.Errorf("%s: resize to %dx%d differs from the generic path by up to %d", what, size[0], size[1], d)
+		}
+		releaseImage(fast)
+		releaseImage(slow)
+	}
+	// The thumbhash YCbCr downscale skips the per-pixel clamp, so only
+	// the other fast paths match their generic path exactly.
+	if tolerance > 0 && !bytes.Equal(thumbhash.Encode(img), thumbhash.Encode(ref)) {
+		t.Errorf("%s: thumbhash differs from the generic path", what)
+	}
+	fast, slow := computeAvgColor(img), computeAvgColor(ref)
+	if d := maxDiff(fast[:], slow[:]); d > 1 {
+		t.Errorf("%s: average color %v, generic path %v", what, fast, slow)
+	}
+}
+
+// TestDecodeInterlacedPNG checks that Adam7 PNGs, which image/png fills
+// pass by pass, decode to the same image type and pixels as the same
+// PNG without interlacing, and that the fast paths read them correctly.
+func TestDecodeInterlacedPNG(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		ct, depth byte
+	}{
+		{"gray", 0, 8}, {"gray16", 0, 16}, {"rgb", 2, 8}, {"rgb16", 2, 16},
+		{"paletted", 3, 8}, {"gray-alpha", 4, 8}, {"rgba", 6, 8}, {"rgba16", 6, 16},
+	} {
+		for _, size := range [][2]int{{1, 1}, {5, 3}, {37, 29}} {
+			w, h := size[0], size[1]
+			what := fmt.Sprintf("%s %dx%d", tc.name, w, h)
+			sample := func(x, y, c int) uint16 {
+				v := uint16((x*67 + y*131 + c*89) % 256)
+				if c == 3 || tc.ct == 4 && c == 1 {
+					v = uint16(255 - (x*y)%256) // alpha
+				}
+				if tc.depth == 16 {
+					v = v<<8 | v ^ 0x5a
+				}
+				return v
+			}
+			plain := decodeFile(t, "plain.png", encodePNG(tc.ct, tc.depth, w, h, false, sample), nil)
+			ilace := decodeFile(t, "ilace.png", encodePNG(tc.ct, tc.depth, w, h, true, sample), nil)
+			if reflect.TypeOf(plain.img) != reflect.TypeOf(ilace.img) {
+				t.Errorf("%s: interlaced decodes to %T, plain to %T", what, ilace.img, plain.img)
+				continue
+			}
+			if !reflect.DeepEqual(plain.img, ilace.img) {
+				t.Errorf("%s: interlaced pixels differ", what)
+			}
+			checkFastPaths(t, what, ilace.img)
+		}
+	}
+}
+
+// opaquePixels returns the RGB values of an opaque image, row by row.
+// Padding past the bounds of a pooled decode is not compared.
+func opaquePixels(img image.Image) []byte {
+	b := img.Bounds()
+	var pix []byte
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			pix = append(pix, byte(r>>8), byte(g>>8), byte(bl>>8))
+		}
+	}
+	return pix
+}
+
+// TestDecodeProgressiveJPEG checks that progressive JPEGs decode at every
+// scale to the same pixels and strides as their baseline originals, from
+// which they were made losslessly with jpegtran.
+func TestDecodeProgressiveJPEG(t *testing.T) {
+	for _, name := range []string{"video-001", "video-001.q50.410", "video-001.q50.411", "video-001.q50.420",
+		"video-001.q50.422", "video-001.q50.440", "video-001.q50.444", "video-001.separate.dc.progression"} {
+		base, err := os.ReadFile(filepath.Join("..", "jpegdec", "testdata", name+".jpeg"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		prog, err := os.ReadFile(filepath.Join("..", "jpegdec", "testdata", name+".progressive.jpeg"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, scale := range []int{1, 2, 4, 8} {
+			what := fmt.Sprintf("%s 1/%d", name, scale)
+			pick := func(w, h int) int { return scale }
+			want := decodeFile(t, "base.jpg", base, pick)
+			got := decodeFile(t, "prog.jpg", prog, pick)
+			if got.width != 150 || got.height != 103 || got.scale != scale {
+				t.Errorf("%s: decoded as %dx%d at 1/%d", what, got.width, got.height, got.scale)
+			}
+			g, ok1 := got.img.(*image.YCbCr)
+			w, ok2 := want.img.(*image.YCbCr)
+			switch {
+			case !ok1 || !ok2:
+				t.Errorf("%s: progressive %T, baseline %T", what, got.img, want.img)
+			case g.Rect != w.Rect || g.SubsampleRatio != w.SubsampleRatio || g.YStride != w.YStride || g.CStride != w.CStride:
+				t.Errorf("%s: progressive %v %v strides %d/%d, baseline %v %v strides %d/%d", what,
+					g.Rect, g.SubsampleRatio, g.YStride, g.CStride, w.Rect, w.SubsampleRatio, w.YStride, w.CStride)
+			case !reflect.DeepEqual(opaquePixels(g), opaquePixels(w)):
+				t.Errorf("%s: progressive pixels differ from baseline", what)
+			case !bytes.Equal(thumbhash.Encode(g), thumbhash.Encode(w)):
+				t.Errorf("%s: progressive thumbhash differs from baseline", what)
+			default:
+				checkFastPaths(t, what, g)
+			}
+			got.release()
+			want.release()
+		}
+	}
+}
+
+// TestDecodeGIFScreen decodes GIFs whose first frame covers only part of
+// the logical screen, which browsers show as transparent around it.
+func TestDecodeGIFScreen(t *testing.T) {
+	opaque := color.Palette{color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}}
+	full := make(color.Palette, 256)
+	for i := range full {
+		full[i] = color.RGBA{uint8(i), 0, 0, 255}
+	}
+	withClear := color.Palette{color.RGBA{255, 0, 0, 255}, color.RGBA{}}
+	for _, tc := range []struct {
+		name  string
+		pal   color.Palette
+		frame image.Rectangle
+		want  string // image type
+	}{
+		{"opaque palette", opaque, image.Rect(2, 3, 6, 7), "*image.Paletted"},
+		{"full palette", full, image.Rect(2, 3, 6, 7), "*image.NRGBA"},
+		{"transparent entry", withClear, image.Rect(0, 0, 4, 4), "*image.Paletted"},
+		{"full screen", opaque, image.Rect(0, 0, 10, 8), "*image.Paletted"},
+	} {
+		frame := image.NewPaletted(tc.frame, tc.pal)
+		for i := range frame.Pix {
+			frame.Pix[i] = uint8(i % 2 * (len(tc.pal) - 1))
+		}
+		var buf bytes.Buffer
+		err := gif.EncodeAll(&buf, &gif.GIF{
+			Image: []*image.Paletted{frame}, Delay: []int{0},
+			Config: image.Config{ColorModel: tc.pal, Width: 10, Height: 8},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		si := decodeFile(t, "anim.gif", buf.Bytes(), nil)
+		if got := fmt.Sprintf("%T", si.img); got != tc.want {
+			t.Errorf("%s: decoded to %s, want %s", tc.name, got, tc.want)
+		}
+		if si.img.Bounds() != image.Rect(0, 0, 10, 8) || si.width != 10 || si.height != 8 {
+			t.Errorf("%s: bounds %v, %dx%d; want the 10x8 screen", tc.name, si.img.Bounds(), si.width, si.height)
+		}
+		wantAlpha := tc.frame.Dx() < 10 || len(tc.pal) == 2 && tc.pal[1] == color.RGBA{}
+		if got := thumbhash.HasAlpha(si.img); got != wantAlpha {
+			t.Errorf("%s: HasAlpha = %v, want %v", tc.name, got, wantAlpha)
+		}
+		x, y := tc.frame.Min.X, tc.frame.Min.Y
+		if r, _, _, a := si.img.At(x, y).RGBA(); r>>8 != uint32(color.RGBAModel.Convert(tc.pal[0]).(color.RGBA).R) || a != 0xffff {
+			t.Errorf("%s: frame pixel at %d,%d moved", tc.name, x, y)
+		}
+	}
+}
+
+// TestDecodeFileMatchesBuild checks that DecodeFile, which "tgimg
+// thumbhash" uses, sees a GIF frame on its screen and a large JPEG at its
+// reduced decode scale just as the build does.
+func TestDecodeFileMatchesBuild(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	pal := color.Palette{color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}}
+	frame := image.NewPaletted(image.Rect(100, 100, 200, 200), pal)
+	for i := range frame.Pix {
+		frame.Pix[i] = uint8(i % 2)
+	}
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &gif.GIF{
+		Image: []*image.Paletted{frame}, Delay: []int{0},
+		Config: image.Config{ColorModel: pal, Width: 400, Height: 300},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(in, "anim.gif"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	photo := image.NewNRGBA(image.Rect(0, 0, 3000, 2000))
+	for i := range photo.Pix {
+		photo.Pix[i] = uint8(i * 7 / 3)
+	}
+	buf.Reset()
+	if err := jpeg.Encode(&buf, photo, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(in, "photo.jpg"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	prof := profile.Get("telegram-webview")
+	prof.Formats = []string{"png"}
+	prof.Widths = []int{320}
+	prof.DPRs = []float64{1}
+	m, err := New(Config{InputDir: in, OutputDir: out, Profile: prof, Workers: 1}).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, name := range map[string]string{"anim": "anim.gif", "photo": "photo.jpg"} {
+		d, err := DecodeFile(filepath.Join(in, name), prof)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := m.Assets[key]
+		if d.Width != a.Original.Width || d.Height != a.Original.Height || d.Format != a.Original.Format {
+			t.Errorf("%s: decoded %dx%d %s, build recorded %dx%d %s", name,
+				d.Width, d.Height, d.Format, a.Original.Width, a.Original.Height, a.Original.Format)
+		}
+		if got := thumbhash.HasAlpha(d.Image); got != a.Original.HasAlpha {
+			t.Errorf("%s: has_alpha %v, build recorded %v", name, got, a.Original.HasAlpha)
+		}
+		if got := base64.StdEncoding.EncodeToString(thumbhash.Encode(d.Image)); got != a.ThumbHash {
+			t.Errorf("%s: thumbhash %s, build wrote %s", name, got, a.ThumbHash)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+)
+
+// FocusFile is the optional sidecar in the input directory that gives
+// crop variants a focal point per asset key, as fractions of the source
+// size from the top-left corner: {"covers/spring": [0.5, 0.3]}. Assets
+// without one are cropped by the profile's gravity.
+const FocusFile = "tgimg.focus.json"
+
+// LoadFocus reads the focal point sidecar from the input. A missing file is
+// not an error and yields an empty map.
+func LoadFocus(in Input) (map[string][2]float64, error) {
+	data, err := in.ReadFile(FocusFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string][2]float64{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	focus := map[string][2]float64{}
+	if err := json.Unmarshal(data, &focus); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", FocusFile, err)
+	}
+	for key, f := range focus {
+		if f[0] < 0 || f[0] > 1 || f[1] < 0 || f[1] > 1 {
+			return nil, fmt.Errorf("%s: focal point of %q must be within [0, 1], got [%g, %g]", FocusFile, key, f[0], f[1])
+		}
+	}
+	return focus, nil
+}
+
+// cropRect returns the region of img a crop variant of t shows: the
+// largest area with t's aspect ratio, centered on the asset's focal point
+// or else the profile's gravity.
+func cropRect(bounds image.Rectangle, t profile.CropTarget, key string, cfg Config) image.Rectangle {
+	fx, fy := cfg.Profile.Focus()
+	if f, ok := cfg.Focus[key]; ok {
+		fx, fy = f[0], f[1]
+	}
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	rw, rh := profile.FitBox(srcW, srcH, t.Width, t.Height)
+	x, y := profile.CropOrigin(srcW, srcH, rw, rh, fx, fy)
+	return image.Rect(x, y, x+rw, y+rh).Add(bounds.Min)
+}
+
+// cropRecord describes rect, a crop of bounds rendered with margin, for
+// the manifest.
+func cropRecord(t profile.CropTarget, rect, bounds image.Rectangle, margin float64) *manifest.Crop {
+	r := rect.Sub(bounds.Min)
+	return &manifest.Crop{Box: t.Box.String(), X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy(), Margin: margin}
+}
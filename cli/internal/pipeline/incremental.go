@@ -0,0 +1,44 @@
+package pipeline
+
+import (
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+)
+
+// selectChanged narrows sources to those affected by cfg.Changed and
+// returns the unchanged assets to carry over from cfg.Previous.
+//
+// A changed file dirties its whole asset key, so editing logo.png also
+// reprocesses logo@dark.png (renditions are attached to their base). Keys
+// the previous manifest lacks or records an error for are always
+// processed; keys no longer in the input are dropped by not being carried.
+func (p *Pipeline) selectChanged(sources []Source) ([]Source, map[string]manifest.Asset) {
+	changed := make(map[string]bool, len(p.cfg.Changed))
+	for _, rel := range p.cfg.Changed {
+		changed[rel] = true
+	}
+
+	dirty := map[string]bool{}
+	for _, s := range sources {
+		if changed[s.RelPath] {
+			dirty[s.Key] = true
+		} else if _, ok := p.cfg.Previous.Assets[s.Key]; !ok {
+			dirty[s.Key] = true
+		} else if _, failed := p.cfg.Previous.Errors[errorKey(s.Key, s.Theme)]; failed {
+			dirty[s.Key] = true
+		}
+	}
+
+	var selected []Source
+	carried := map[string]manifest.Asset{}
+	for _, s := range sources {
+		if dirty[s.Key] {
+			selected = append(selected, s)
+		} else {
+			carried[s.Key] = p.cfg.Previous.Assets[s.Key]
+		}
+	}
+	logging.Debugf("changed: %d of %d sources to process, %d assets carried over",
+		len(selected), len(sources), len(carried))
+	return selected, carried
+}
@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+)
+
+func TestSelectChanged(t *testing.T) {
+	sources := []Source{
+		{RelPath: "logo.png", Key: "logo"},
+		{RelPath: "logo@dark.png", Key: "logo", Theme: "dark"},
+		{RelPath: "photo.jpg", Key: "photo"},
+		{RelPath: "new.png", Key: "new"},
+		{RelPath: "broken.png", Key: "broken"},
+	}
+	prev := manifest.New("telegram-webview")
+	for _, key := range []string{"logo", "photo", "deleted"} {
+		prev.Assets[key] = manifest.Asset{ThumbHash: key}
+	}
+	prev.Assets["broken"] = manifest.Asset{ThumbHash: "broken"}
+	prev.Errors = map[string]manifest.AssetError{"broken": {Source: "broken.png", Error: "decode"}}
+
+	for _, tc := range []struct {
+		name     string
+		changed  []string
+		selected []string // RelPaths
+		carried  []string // keys
+	}{
+		{"nothing changed", []string{}, []string{"new.png", "broken.png"}, []string{"logo", "photo"}},
+		{"base dirties its theme", []string{"logo.png"}, []string{"logo.png", "logo@dark.png", "new.png", "broken.png"}, []string{"photo"}},
+		{"theme dirties its base", []string{"logo@dark.png"}, []string{"logo.png", "logo@dark.png", "new.png", "broken.png"}, []string{"photo"}},
+		{"deleted file", []string{"deleted.png", "photo.jpg"}, []string{"photo.jpg", "new.png", "broken.png"}, []string{"logo"}},
+	} {
+		p := New(Config{Profile: profile.Get("telegram-webview"), Changed: tc.changed, Previous: prev})
+		selected, carried := p.selectChanged(sources)
+		var rels []string
+		for _, s := range selected {
+			rels = append(rels, s.RelPath)
+		}
+		keys := make([]string, 0, len(carried))
+		for key := range carried {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		if !reflect.DeepEqual(rels, tc.selected) {
+			t.Errorf("%s: selected %v, want %v", tc.name, rels, tc.selected)
+		}
+		if !reflect.DeepEqual(keys, tc.carried) {
+			t.Errorf("%s: carried %v, want %v; deleted keys are dropped", tc.name, keys, tc.carried)
+		}
+	}
+}
+
+// TestPrepareChangedFingerprint checks that an incremental build falls
+// back to processing everything when the previous manifest was built with
+// other settings.
+func TestPrepareChangedFingerprint(t *testing.T) {
+	sources := []Source{{RelPath: "a.png", Key: "a"}, {RelPath: "b.png", Key: "b"}}
+	prev := manifest.New("telegram-webview")
+	prev.Assets["a"] = manifest.Asset{ThumbHash: "a"}
+	prev.Assets["b"] = manifest.Asset{ThumbHash: "b"}
+
+	cfg := Config{Profile: profile.Get("telegram-webview"), Changed: []string{"a.png"}, Previous: prev, OutputDir: t.TempDir()}
+	prev.Config = New(cfg).effectiveConfig()
+	for _, tc := range []struct {
+		name        string
+		fingerprint string
+		todo        []bool
+		carried     int
+	}{
+		{"same settings", prev.Config.Fingerprint, []bool{true, false}, 1},
+		{"other settings", "0000000000000000", []bool{true, true}, 0},
+	} {
+		bc := *prev.Config
+		bc.Fingerprint = tc.fingerprint
+		prev.Config = &bc
+		r, err := New(cfg).prepare(sources)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(r.todo, tc.todo) {
+			t.Errorf("%s: processing %v, want %v", tc.name, r.todo, tc.todo)
+		}
+		if len(r.carried) != tc.carried {
+			t.Errorf("%s: %d assets carried, want %d", tc.name, len(r.carried), tc.carried)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package pipeline
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Input is where a build reads its sources from: a local directory (Dir),
+// a bucket (Bucket), an archive file (Archive) or files a Telegram bot
+// received (Telegram).
+type Input interface {
+	// Scan lists the image sources, skipping paths that match an ignore
+	// pattern.
+	Scan(ignore []string) ([]Source, error)
+	// ReadFile reads a sidecar such as FocusFile at the input's root. A
+	// missing file yields an error matching os.ErrNotExist.
+	ReadFile(name string) ([]byte, error)
+	// String names the input in messages, e.g. "s3://bucket/images/".
+	String() string
+}
+
+// HashScanner is an Input that can hash its sources while it scans them,
+// setting Source.Hash with up to workers reads at once.
+type HashScanner interface {
+	ScanHashed(ignore []string, workers int) ([]Source, error)
+}
+
+// StreamScanner is an Input that can pass its sources on as it finds
+// them, in Scan's order, so a build starts on the first before the last
+// is found. An error from fn stops the scan and is returned.
+type StreamScanner interface {
+	ScanFunc(ignore []string, fn func(Source) error) error
+}
+
+// Dir is an input directory on the local filesystem.
+type Dir string
+
+func (d Dir) Scan(ignore []string) ([]Source, error) { return ScanImages(string(d), ignore) }
+
+func (d Dir) ScanFunc(ignore []string, fn func(Source) error) error {
+	return WalkImages(string(d), ignore, fn)
+}
+
+func (d Dir) ScanHashed(ignore []string, workers int) ([]Source, error) {
+	return ScanImagesHashed(string(d), ignore, workers)
+}
+
+func (d Dir) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), name))
+}
+
+func (d Dir) String() string { return string(d) }
+
+// Without returns d with the directories dirs, and everything below them,
+// left out of its scans: an output directory inside the input tree, whose
+// variants would otherwise be built again as sources. Directories outside
+// d, or d itself, are not left out; without any others d is returned.
+func (d Dir) Without(dirs ...string) Input {
+	var skip []string
+	for _, dir := range dirs {
+		if rel, ok := NestedDir(string(d), dir); ok && rel != "." {
+			skip = append(skip, rel)
+		}
+	}
+	if len(skip) == 0 {
+		return d
+	}
+	return dirWithout{d, skip}
+}
+
+// dirWithout is a Dir whose scans skip the directories at the
+// slash-separated paths skip.
+type dirWithout struct {
+	Dir
+	skip []string
+}
+
+func (d dirWithout) Scan(ignore []string) ([]Source, error) {
+	var sources []Source
+	err := d.ScanFunc(ignore, func(s Source) error {
+		sources = append(sources, s)
+		return nil
+	})
+	return sources, err
+}
+
+func (d dirWithout) ScanFunc(ignore []string, fn func(Source) error) error {
+	return walkImages(string(d.Dir), ignore, d.skip, fn)
+}
+
+func (d dirWithout) ScanHashed(ignore []string, workers int) ([]Source, error) {
+	return scanImagesHashed(string(d.Dir), ignore, d.skip, workers)
+}
+
+// NestedDir reports whether dir is root or inside it, and returns its
+// slash-separated path relative to root: "." for root itself. Symbolic
+// links are resolved, including those above a dir that does not exist
+// yet.
+func NestedDir(root, dir string) (string, bool) {
+	rel, err := filepath.Rel(realPath(root), realPath(dir))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// realPath returns p as an absolute path with symbolic links resolved in
+// the longest part of it that exists.
+func realPath(p string) string {
+	p = absDir(p)
+	var rest []string
+	for dir := p; ; {
+		if r, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(append([]string{r}, rest...)...)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return p
+		}
+		rest = append([]string{filepath.Base(dir)}, rest...)
+		dir = parent
+	}
+}
+
+// input returns the configured input, by default the InputDir directory.
+// A local directory leaves out OutputDir when it lies inside it.
+func (cfg Config) input() Input {
+	in := cfg.Input
+	if in == nil {
+		in = Dir(cfg.InputDir)
+	}
+	if d, ok := in.(Dir); ok && cfg.OutputDir != "" {
+		return d.Without(cfg.OutputDir)
+	}
+	return in
+}
+
+// open reads the source through Open, or from AbsPath, memory-mapped
+// when Config.Mmap marked it.
+func (src Source) open() (io.ReadCloser, error) {
+	if src.Open != nil {
+		return src.Open()
+	}
+	if src.mmap {
+		return openMapped(src.AbsPath)
+	}
+	return os.Open(src.AbsPath)
+}
+
+// version returns the size and modification time that identify the
+// source's current content for checkpoints.
+func (src Source) version() (int64, time.Time, error) {
+	if src.Open != nil {
+		return src.Size, src.ModTime, nil
+	}
+	info, err := os.Stat(src.AbsPath)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return info.Size(), info.ModTime(), nil
+}
@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+)
+
+func TestNestedDir(t *testing.T) {
+	root := t.TempDir()
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(root, link); err != nil {
+		t.Skip(err)
+	}
+	for _, tc := range []struct {
+		dir    string
+		rel    string
+		nested bool
+	}{
+		{root, ".", true},
+		{filepath.Join(root, "out"), "out", true}, // need not exist
+		{filepath.Join(root, "a", "b") + string(filepath.Separator), "a/b", true},
+		{filepath.Join(link, "out"), "out", true},
+		{filepath.Join(root, "..", "out"), "", false},
+		{filepath.Join(root+"x", "out"), "", false},
+	} {
+		rel, nested := NestedDir(root, tc.dir)
+		if rel != tc.rel || nested != tc.nested {
+			t.Errorf("NestedDir(%s) = %q, %v; want %q, %v", tc.dir, rel, nested, tc.rel, tc.nested)
+		}
+	}
+}
+
+// TestBuildSkipsNestedOutput builds twice into an output directory inside
+// the input, as --out ./images/tgimg_out would, and checks that the second
+// build does not take the first one's variants for sources.
+func TestBuildSkipsNestedOutput(t *testing.T) {
+	in := t.TempDir()
+	out := filepath.Join(in, "tgimg_out")
+	f, err := os.Create(filepath.Join(in, "a.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 8, 8)))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prof := profile.Get("telegram-webview")
+	prof.Formats = []string{"png"}
+	cfg := Config{InputDir: in, OutputDir: out, Profile: prof, Workers: 1}
+	for i := range 2 {
+		m, err := New(cfg).Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := m.Assets["a"]; !ok || len(m.Assets) != 1 {
+			t.Errorf("build %d: %d assets, want only a", i+1, len(m.Assets))
+		}
+	}
+
+	// Dir inputs passed in explicitly skip it too, on every kind of scan.
+	d := Dir(in).Without(out)
+	srcs, err := d.Scan(nil)
+	if err != nil || len(srcs) != 1 {
+		t.Errorf("Scan: %d sources, %v", len(srcs), err)
+	}
+	if srcs, err := d.(HashScanner).ScanHashed(nil, 2); err != nil || len(srcs) != 1 {
+		t.Errorf("ScanHashed: %d sources, %v", len(srcs), err)
+	}
+	if srcs, err := ScanImages(in, nil); err != nil || len(srcs) < 2 {
+		t.Errorf("ScanImages without exclusion: %d sources, %v; want the variants too", len(srcs), err)
+	}
+	if got := Dir(in).Without(in, t.TempDir()); got != Dir(in) {
+		t.Errorf("Without(root, outside dir) = %#v, want the Dir", got)
+	}
+}
@@ -0,0 +1,54 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// availableMemory returns the memory the process may still use: the
+// smaller of the cgroup limit of its container, if any, and MemAvailable
+// of /proc/meminfo. It is 0 when neither can be read.
+func availableMemory() int64 {
+	avail := meminfoAvailable()
+	for _, path := range []string{
+		"/sys/fs/cgroup/memory.max",                   // cgroup v2
+		"/sys/fs/cgroup/memory/memory.limit_in_bytes", // cgroup v1
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		// "max" (v2) or a huge number (v1) means no limit.
+		limit, err := strconv.ParseInt(string(bytes.TrimSpace(data)), 10, 64)
+		if err == nil && limit > 0 && limit < 1<<50 && (avail == 0 || limit < avail) {
+			avail = limit
+		}
+		break
+	}
+	return avail
+}
+
+// meminfoAvailable returns MemAvailable of /proc/meminfo in bytes, or 0.
+func meminfoAvailable() int64 {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// MemAvailable:   12345678 kB
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 3 && fields[0] == "MemAvailable:" && fields[2] == "kB" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0
+			}
+			return kb << 10
+		}
+	}
+	return 0
+}
@@ -0,0 +1,6 @@
+//go:build !linux
+
+package pipeline
+
+// availableMemory is unknown outside Linux, so Workers 0 means NumCPU.
+func availableMemory() int64 { return 0 }
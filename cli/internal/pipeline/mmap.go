@@ -0,0 +1,50 @@
+package pipeline
+
+import (
+	"bytes"
+	"io"
+)
+
+// mmapMinSize is the smallest source Config.Mmap maps; smaller files read
+// as cheaply as they map.
+const mmapMinSize = 4 << 20
+
+// markMmap makes every local source of mmapMinSize or more open as a
+// memory-mapped file.
+func markMmap(sources []Source) {
+	for i := range sources {
+		s := &sources[i]
+		s.mmap = s.Open == nil && s.Size >= mmapMinSize
+	}
+}
+
+// mappedFile reads a memory-mapped file. Decoders read it through Peek
+// and hashing through WriteTo without copying it into buffers of their
+// own; the page cache backs it, so the kernel can drop pages already read
+// under memory pressure.
+type mappedFile struct {
+	*bytes.Reader
+	data  []byte
+	unmap func([]byte) error
+}
+
+var _ io.WriterTo = (*mappedFile)(nil)
+
+// Peek returns the next n bytes without advancing, like bufio.Reader.Peek,
+// so image.Decode reads the mapping without wrapping it in a bufio.Reader.
+func (m *mappedFile) Peek(n int) ([]byte, error) {
+	pos := len(m.data) - m.Len()
+	if end := pos + n; end <= len(m.data) {
+		return m.data[pos:end], nil
+	}
+	return m.data[pos:], io.EOF
+}
+
+func (m *mappedFile) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	data := m.data
+	m.data, m.Reader = nil, bytes.NewReader(nil)
+	return m.unmap(data)
+}
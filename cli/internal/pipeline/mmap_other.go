@@ -0,0 +1,13 @@
+//go:build !unix
+
+package pipeline
+
+import (
+	"io"
+	"os"
+)
+
+// openMapped reads the file normally: memory-mapping is unix-only.
+func openMapped(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package pipeline
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"syscall"
+)
+
+// openMapped opens a local file memory-mapped, or read normally when it
+// is empty. The mapping outlives the file descriptor.
+func openMapped(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	size := info.Size()
+	if size == 0 || int64(int(size)) != size {
+		return f, nil
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	f.Close()
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: path, Err: err}
+	}
+	return &mappedFile{Reader: bytes.NewReader(data), data: data, unmap: syscall.Munmap}, nil
+}
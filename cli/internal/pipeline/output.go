@@ -0,0 +1,214 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/AnyUserName/tgimg-cli/internal/s3"
+)
+
+// Output is where a build writes variant files: a local directory
+// (OutDir), a bucket (BucketOutput), memory (MemOutput) or anything else
+// that stores files by path.
+type Output interface {
+	// WriteFile stores data at name, a slash-separated path relative to
+	// the output root, creating parent directories as needed.
+	WriteFile(name string, data []byte) error
+	// Exists reports whether name is stored, for resuming a checkpoint.
+	Exists(name string) (bool, error)
+	// String names the output in messages, e.g. "s3://bucket/assets/".
+	String() string
+}
+
+// BatchOutput is an Output that stores several files faster together
+// than one at a time. A build hands it the variants of each source at
+// once (see writeBatch).
+type BatchOutput interface {
+	Output
+	// WriteFiles stores every file like WriteFile, returning the first
+	// error.
+	WriteFiles(files []OutputFile) error
+}
+
+// OutputFile is a file for BatchOutput.WriteFiles.
+type OutputFile struct {
+	Name string // as for Output.WriteFile
+	Data []byte
+}
+
+// OutDir is an output directory on the local filesystem.
+type OutDir string
+
+func (d OutDir) WriteFile(name string, data []byte) error {
+	return writeLocal(filepath.Join(string(d), filepath.FromSlash(name)), data)
+}
+
+func (d OutDir) WriteFiles(files []OutputFile) error {
+	return writeConcurrently(files, d.WriteFile)
+}
+
+// writeLocal writes data to the file p, creating its directory only when
+// the file cannot be created without it, which saves a stat per file in
+// the common case of an existing directory.
+func writeLocal(p string, data []byte) error {
+	err := os.WriteFile(p, data, 0o644)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o644)
+}
+
+func (d OutDir) Exists(name string) (bool, error) {
+	_, err := os.Stat(filepath.Join(string(d), filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (d OutDir) String() string { return string(d) }
+
+// BucketOutput writes variants straight to S3-compatible object storage
+// under Prefix, without a local staging directory. Variant names are
+// content-addressed, so objects get CacheControl as is.
+type BucketOutput struct {
+	Client       *s3.Client
+	Prefix       string // "" or ending in "/", e.g. "assets/"
+	URL          string // e.g. "s3://bucket/assets/", for messages
+	CacheControl string // e.g. "public, max-age=31536000, immutable"
+
+	// Context bounds every request; nil means context.Background().
+	Context context.Context
+}
+
+func (b *BucketOutput) ctx() context.Context {
+	if b.Context != nil {
+		return b.Context
+	}
+	return context.Background()
+}
+
+func (b *BucketOutput) WriteFile(name string, data []byte) error {
+	return b.Client.Put(b.ctx(), b.Prefix+name, data, mimeType(name), b.CacheControl)
+}
+
+func (b *BucketOutput) WriteFiles(files []OutputFile) error {
+	return writeConcurrently(files, b.WriteFile)
+}
+
+func (b *BucketOutput) Exists(name string) (bool, error) {
+	err := b.Client.Head(b.ctx(), b.Prefix+name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *BucketOutput) String() string { return b.URL }
+
+// batchWriters bounds the files WriteFiles of OutDir and BucketOutput
+// writes at once. On a network filesystem each create and close is a
+// round trip, as each upload is, and concurrent writes overlap them.
+const batchWriters = 8
+
+// writeConcurrently writes files with write, batchWriters at a time,
+// returning the first error.
+func writeConcurrently(files []OutputFile, write func(name string, data []byte) error) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, batchWriters)
+	for _, f := range files {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := write(f.Name, f.Data); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("write %s: %w", f.Name, err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// mimeType returns the Content-Type for an output file name.
+func mimeType(name string) string {
+	if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// MemOutput keeps written files in memory, for embedders that hand
+// variants on themselves and for tests. It is safe for concurrent use.
+type MemOutput struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (m *MemOutput) WriteFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.files == nil {
+		m.files = map[string][]byte{}
+	}
+	m.files[name] = data
+	return nil
+}
+
+func (m *MemOutput) Exists(name string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.files[name]
+	return ok, nil
+}
+
+// ReadFile returns the data written to name.
+func (m *MemOutput) ReadFile(name string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.files[name]
+	return data, ok
+}
+
+// Names lists the written files in sorted order.
+func (m *MemOutput) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.files))
+	for name := range m.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *MemOutput) String() string { return "memory" }
+
+// output returns the configured output, by default the OutputDir
+// directory.
+func (cfg Config) output() Output {
+	if cfg.Output != nil {
+		return cfg.Output
+	}
+	return OutDir(absDir(cfg.OutputDir))
+}
@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Output file names are built from asset keys, which come from whatever
+// the input tree allows. A build on Linux must still produce a tree that
+// can be checked out, copied and served on Windows, so every segment is
+// made portable (see portableName). Keys themselves are left as they are.
+
+// reservedNames are the Windows device names, which no file or directory
+// may be called, with or without an extension.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM0": true, "COM1": true, "COM2": true, "COM3": true, "COM4": true,
+	"COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT0": true, "LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true,
+	"LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// portableName returns a file or directory name that Windows accepts for
+// name: characters it forbids become '_', a reserved device name before
+// the first '.' gets a '_' appended ("con.png" → "con_.png"), and so does
+// a trailing '.' or space, which Windows would strip.
+func portableName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	base, _, _ := strings.Cut(name, ".")
+	if reservedNames[strings.ToUpper(strings.TrimRight(base, " "))] {
+		name = base + "_" + name[len(base):]
+	}
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		name += "_"
+	}
+	return name
+}
+
+// keyDir returns the directory of an asset key's files relative to the
+// output root, slash-separated, with every segment portable: "" for a key
+// at the root.
+func keyDir(key string) string {
+	dir := path.Dir(key)
+	if dir == "." {
+		return ""
+	}
+	segs := strings.Split(dir, "/")
+	for i, s := range segs {
+		segs[i] = portableName(s)
+	}
+	return strings.Join(segs, "/")
+}
+
+// absDir returns dir as a clean absolute path with an upper-case drive
+// letter, so that c:\img and C:\img\ compare equal, or dir itself
+// if it is empty or the working directory is unknown. On Windows the os
+// package lifts the 260-character MAX_PATH limit only for absolute paths,
+// which deep trees need.
+func absDir(dir string) string {
+	if dir == "" {
+		return dir
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	if len(abs) >= 2 && abs[1] == ':' {
+		abs = strings.ToUpper(abs[:1]) + abs[1:]
+	}
+	return abs
+}
+
+// samePath reports whether two slash-separated relative paths name the
+// same file, ignoring case where the file system usually does.
+func samePath(a, b string) bool {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
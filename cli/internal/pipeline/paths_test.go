@@ -0,0 +1,107 @@
+package pipeline
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+)
+
+func TestPortableName(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"logo", "logo"},
+		{"logo@dark", "logo@dark"},
+		{"con", "con_"},
+		{"CON", "CON_"},
+		{"nul.crop", "nul_.crop"},
+		{"Com1", "Com1_"},
+		{"lpt9 ", "lpt9 _"},
+		{"console", "console"},
+		{"con@dark", "con@dark"},
+		{"aux.v2", "aux_.v2"},
+		{`a\b`, "a_b"},
+		{"what?", "what_"},
+		{`x:y*z|"<>`, "x_y_z____"},
+		{"tab\there", "tab_here"},
+		{"draft.", "draft._"},
+		{"draft ", "draft _"},
+		{"emoji-🙂", "emoji-🙂"},
+	} {
+		if got := portableName(tc.in); got != tc.want {
+			t.Errorf("portableName(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestKeyDir(t *testing.T) {
+	for _, tc := range []struct{ key, want string }{
+		{"logo", ""},
+		{"icons/logo", "icons"},
+		{"ui/con/star", "ui/con_"},
+		{"prn/aux/x", "prn_/aux_"},
+		{"old./x", "old._"},
+	} {
+		if got := keyDir(tc.key); got != tc.want {
+			t.Errorf("keyDir(%q) = %q, want %q", tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestAbsDir(t *testing.T) {
+	if got := absDir(""); got != "" {
+		t.Errorf(`absDir("") = %q`, got)
+	}
+	got := absDir("img/../img/")
+	if !filepath.IsAbs(got) || filepath.Base(got) != "img" {
+		t.Errorf("absDir = %q, want an absolute path ending in img", got)
+	}
+}
+
+// TestBuildPortablePaths builds sources whose names Windows reserves and
+// checks that the keys are kept and the variant paths are portable.
+func TestBuildPortablePaths(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	for _, rel := range []string{"con/aux.png", "icons/nul.png", "icons/star.png"} {
+		name := filepath.Join(in, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 8, 8)))
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prof := profile.Get("telegram-webview")
+	prof.Formats = []string{"png"}
+	m, err := New(Config{InputDir: in, OutputDir: out, Profile: prof, Workers: 1}).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"con/aux": "con_/aux_.", "icons/nul": "icons/nul_.", "icons/star": "icons/star."}
+	for key, prefix := range want {
+		a, ok := m.Assets[key]
+		if !ok {
+			t.Errorf("asset %q missing", key)
+			continue
+		}
+		for _, v := range a.Variants {
+			if !strings.HasPrefix(v.Path, prefix) {
+				t.Errorf("%s: variant path %q, want prefix %q", key, v.Path, prefix)
+			}
+			if _, err := os.Stat(filepath.Join(out, filepath.FromSlash(v.Path))); err != nil {
+				t.Errorf("%s: %v", key, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package pipeline
+
+import "testing"
+
+func TestAbsDirDriveLetter(t *testing.T) {
+	if got := absDir(`c:\img\assets\`); got != `C:\img\assets` {
+		t.Errorf(`absDir = %q, want C:\img\assets`, got)
+	}
+}
+
+func TestMatchPathBackslashPattern(t *testing.T) {
+	if !matchPath(`icons\**`, "icons/ui/star.png") {
+		t.Error(`icons\** does not match icons/ui/star.png`)
+	}
+	if !ignored("drafts/a.png", []string{`drafts\*`}) {
+		t.Error(`drafts\* does not ignore drafts/a.png`)
+	}
+}
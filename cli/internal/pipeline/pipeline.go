@@ -1,12 +1,19 @@
 package pipeline
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/AnyUserName/tgimg-cli/internal/cache"
 	"github.com/AnyUserName/tgimg-cli/internal/encoder"
+	"github.com/AnyUserName/tgimg-cli/internal/imgcdn"
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
 	"github.com/AnyUserName/tgimg-cli/internal/manifest"
 	"github.com/AnyUserName/tgimg-cli/internal/profile"
 )
@@ -15,110 +22,730 @@ import (
 // float32 workBuf: rgba(160KB) + cos(6.4KB) + ac(0.5KB) ≈ 167 KB.
 const PoolEntryKB = 167
 
+// Errors returned by Run, wrapped with details; test with errors.Is.
+var (
+	ErrNoImages  = errors.New("no images found")
+	ErrAllFailed = errors.New("all images failed to process")
+)
+
 // Config holds all parameters for a build pipeline run.
 type Config struct {
-	InputDir       string
-	OutputDir      string
-	Profile        profile.Profile
-	Workers        int
-	Verbose        bool
-	NoRegressSize  bool // skip variants larger than original
+	InputDir           string
+	Input              Input // where sources are read from; nil means Dir(InputDir)
+	OutputDir          string
+	Output             Output // where variants are written; nil means OutDir(OutputDir)
+	Profile            profile.Profile
+	Workers            int
+	EncoderConcurrency int                   // max concurrent cwebp/avifenc processes; 0 = bounded by Workers only
+	NoRegressSize      bool                  // skip variants larger than original
+	CopyOriginal       bool                  // copy the untouched source into the output as an "original" variant
+	Aliases            map[string]string     // logical name → asset key
+	Focus              map[string][2]float64 // asset key → crop focal point; see FocusFile
+	Overrides          []ProfileOverride     // per-glob profile changes, applied by the scanner
+	EmitDataURI        bool                  // store the decoded thumbhash as a PNG data URI per asset
+	BasePath           string                // manifest base_path; "./" if empty
+	Ignore             []string              // glob patterns of input paths to skip
+	Cache              *cache.Cache          // encode cache for incremental builds; nil disables it
+	Force              bool                  // re-encode everything; cache entries are rewritten, never read
+	Mmap               bool                  // memory-map large local sources instead of reading them; RunAll uses the first pipeline's
+	FreeMemory         bool                  // after Run, drop pooled buffers and return freed memory to the OS; RunAll uses the first pipeline's
+	UnicodeKeys        UnicodeKeys           // normalization form of asset keys; "" means NFC. RunAll uses the first pipeline's
+
+	// Changed, when non-nil, lists the input-relative (slash-separated)
+	// paths that changed since Previous was built. Only their assets are
+	// processed; every other asset is copied from Previous.
+	Changed  []string
+	Previous *manifest.Manifest
+
+	// CheckpointInterval, when positive, makes Run write finished sources
+	// to CheckpointFileName in OutputDir at most this often, and resume
+	// from that file when a previous run with the same settings was
+	// interrupted. The checkpoint is always a local file, even when
+	// Output is not.
+	CheckpointInterval time.Duration
+
+	// Progress, when set, is called from the workers after each source
+	// is processed: sources done so far out of total, the source's
+	// input-relative path and its error, if any. While a local input is
+	// still being scanned, total counts the sources found so far.
+	Progress func(done, total int, source string, err error)
+
+	// OnEncode, when set, is called from the workers after each variant
+	// encode, by Run and Render alike: the output format, the encode time
+	// and error, and whether the encode cache served it (elapsed is then
+	// zero).
+	OnEncode func(format string, elapsed time.Duration, cached bool, err error)
+
+	// Recolor generates theme renditions for sources without paired
+	// @theme files; see RecolorFile. RunAll uses the first pipeline's.
+	Recolor []RecolorRule
+
+	// CDN, when set, makes Run describe variants as transformation URLs
+	// of an image CDN instead of encoding them: variant paths are
+	// absolute URLs, base_path is empty and no variant files are written.
+	CDN imgcdn.Provider
+}
+
+func boxStrings(boxes []profile.Box) []string {
+	var out []string
+	for _, b := range boxes {
+		out = append(out, b.String())
+	}
+	return out
 }
 
 // Pipeline orchestrates image processing.
 type Pipeline struct {
 	cfg      Config
 	registry *encoder.Registry
+	slots    slots
+	report   Report
+}
+
+// slots is a counting semaphore of a pipeline's workers. RunAll holds one
+// per source it builds; processImage encodes on any left over.
+type slots chan struct{}
+
+func (s slots) acquire() { s <- struct{}{} }
+
+// tryAcquire takes a slot if one is free.
+func (s slots) tryAcquire() bool {
+	select {
+	case s <- struct{}{}:
+		return true
+	default:
+		return false
+	}
 }
 
+func (s slots) release() { <-s }
+
 // New creates a configured pipeline.
 func New(cfg Config) *Pipeline {
 	if cfg.Workers <= 0 {
-		cfg.Workers = runtime.NumCPU()
+		cfg.Workers = AutoWorkers(cfg.Profile)
 	}
+	registry := encoder.NewRegistry()
+	registry.SetSubprocessLimit(cfg.EncoderConcurrency)
+	growPixPool(cfg.Profile)
+	setResizeThreads(cfg.Workers)
 	return &Pipeline{
 		cfg:      cfg,
-		registry: encoder.NewRegistry(),
+		registry: registry,
+		slots:    make(slots, cfg.Workers),
 	}
 }
 
 // Run executes the full build pipeline and returns the manifest.
 func (p *Pipeline) Run() (*manifest.Manifest, error) {
+	ms, err := RunAll([]*Pipeline{p})
+	if err != nil {
+		return nil, err
+	}
+	return ms[0], nil
+}
+
+// needsHash reports whether any of pipes hashes its sources.
+func needsHash(pipes []*Pipeline) bool {
+	for _, p := range pipes {
+		if p.cfg.Cache != nil || p.cfg.CDN != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// RunAll runs several pipelines over the same input, e.g. one per
+// profile, scanning it once and decoding each source once for all of
+// them. The pipelines must share their input and Ignore; workers and encoder
+// limits are the first pipeline's. It returns the manifests in pipeline
+// order, or the first error.
+func RunAll(pipes []*Pipeline) ([]*manifest.Manifest, error) {
+	start := time.Now()
+	first := pipes[0]
+
 	// Log encoder availability.
-	if p.cfg.Verbose {
-		fmt.Fprintf(os.Stderr, "[tgimg] %s\n", p.registry.String())
+	logging.Debugf("%s", first.registry.String())
+
+	// Steps 1 and 2: Scan for images and process them, as they are found
+	// when the input and settings allow it.
+	var runs []*run
+	var scanDone time.Time
+	var err error
+	if sc, ok := first.cfg.input().(StreamScanner); ok && streamable(pipes) {
+		runs, scanDone, err = streamAll(pipes, sc)
+	} else {
+		runs, scanDone, err = scanAll(pipes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	processDone := time.Now()
+	if first.cfg.FreeMemory {
+		defer freeMemory()
 	}
 
-	// Step 1: Scan for images.
-	sources, err := ScanImages(p.cfg.InputDir)
+	// Step 3: Collect results into one manifest per pipeline.
+	ms := make([]*manifest.Manifest, len(pipes))
+	for i, r := range runs {
+		m, err := r.collect()
+		if err != nil {
+			return nil, r.p.wrap(len(pipes), err)
+		}
+		end := time.Now()
+		m.BuildInfo = &manifest.BuildInfo{
+			Workers:     first.cfg.Workers,
+			PoolEntryKB: PoolEntryKB,
+			DurationMS:  end.Sub(start).Milliseconds(),
+			Stages: &manifest.StageTimings{
+				ScanMS:    scanDone.Sub(start).Milliseconds(),
+				ProcessMS: processDone.Sub(scanDone).Milliseconds(),
+				CollectMS: end.Sub(processDone).Milliseconds(),
+			},
+			Encoders: first.registry.Versions(),
+			Host: &manifest.HostInfo{
+				GOOS:      runtime.GOOS,
+				GOARCH:    runtime.GOARCH,
+				NumCPU:    runtime.NumCPU(),
+				GoVersion: runtime.Version(),
+			},
+		}
+		ms[i] = m
+	}
+	return ms, nil
+}
+
+// streamable reports whether pipes can process sources as the scan finds
+// them. Generated theme renditions need the whole list to find the paired
+// @theme files, and an incremental build to find deleted ones.
+func streamable(pipes []*Pipeline) bool {
+	if len(pipes[0].cfg.Recolor) > 0 {
+		return false
+	}
+	for _, p := range pipes {
+		if p.cfg.Changed != nil && p.cfg.Previous != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// scanAll scans the whole input, then processes every source, decoding
+// each once for all pipes. It returns when the last source is processed,
+// with the time the scan finished.
+func scanAll(pipes []*Pipeline) ([]*run, time.Time, error) {
+	first := pipes[0]
+
+	// Cache keys and CDN names need the source hashes, so a local input
+	// takes them during the walk.
+	in := first.cfg.input()
+	var scanned []Source
+	var err error
+	if hs, ok := in.(HashScanner); ok && needsHash(pipes) {
+		scanned, err = hs.ScanHashed(first.cfg.Ignore, first.cfg.Workers)
+	} else {
+		scanned, err = in.Scan(first.cfg.Ignore)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("scan: %w", err)
+		return nil, time.Time{}, fmt.Errorf("scan: %w", err)
 	}
-	if len(sources) == 0 {
-		return nil, fmt.Errorf("no images found in %s", p.cfg.InputDir)
+	scanned, unreadable := splitUnreadable(scanned)
+	if len(scanned) == 0 {
+		return nil, time.Time{}, fmt.Errorf("%w in %s", ErrNoImages, in)
 	}
+	NormalizeKeys(scanned, first.cfg.UnicodeKeys)
+	scanned = addRecolored(scanned, first.cfg.Recolor)
+	if first.cfg.Mmap {
+		markMmap(scanned)
+	}
+	logging.Debugf("found %d images", len(scanned))
 
-	if p.cfg.Verbose {
-		fmt.Fprintf(os.Stderr, "[tgimg] found %d images\n", len(sources))
+	runs := make([]*run, len(pipes))
+	for i, p := range pipes {
+		if runs[i], err = p.prepare(scanned); err != nil {
+			return nil, time.Time{}, p.wrap(len(pipes), err)
+		}
+		runs[i].unreadable = unreadable
 	}
+	scanDone := time.Now()
 
-	// Step 2: Process images in parallel.
-	results := make([]processResult, len(sources))
 	var wg sync.WaitGroup
-	sem := make(chan struct{}, p.cfg.Workers)
+	needs := make([][]*run, len(scanned))
+	busy := 0
+	for i := range scanned {
+		for _, r := range runs {
+			if r.todo[i] {
+				needs[i] = append(needs[i], r)
+			}
+		}
+		if len(needs[i]) > 0 {
+			busy++
+		}
+	}
+	// A few sources leave workers idle; their resizes use the CPUs instead.
+	setResizeThreads(min(first.cfg.Workers, busy))
 
-	for i, src := range sources {
+	for i, src := range scanned {
+		if len(needs[i]) == 0 {
+			continue
+		}
 		wg.Add(1)
-		go func(idx int, s Source) {
+		go func() {
 			defer wg.Done()
-			sem <- struct{}{} // acquire
-			defer func() { <-sem }() // release
+			first.slots.acquire()
+			defer first.slots.release()
+			processSource(i, src, needs[i], first)
+		}()
+	}
+	wg.Wait()
+	return runs, scanDone, nil
+}
+
+// streamAll processes each source as the scan finds it, so the first
+// variants are encoded before a large tree is walked and only a worker's
+// worth of sources is pending at a time: the walk waits for a free
+// worker. Sources are hashed by the workers, not during the walk. It
+// returns when the last source is processed, with the time the walk
+// finished.
+func streamAll(pipes []*Pipeline, sc StreamScanner) ([]*run, time.Time, error) {
+	first := pipes[0]
+	runs := make([]*run, len(pipes))
+	for i, p := range pipes {
+		runs[i] = p.newRun()
+	}
+	// The number of sources is not known up front; resizes split the
+	// CPUs as for a full set of busy workers.
+	setResizeThreads(first.cfg.Workers)
 
-			if p.cfg.Verbose {
-				fmt.Fprintf(os.Stderr, "[tgimg] processing: %s\n", s.Key)
+	var wg sync.WaitGroup
+	n := 0
+	err := sc.ScanFunc(first.cfg.Ignore, func(src Source) error {
+		if src.Unreadable != "" {
+			u := src.unreadable()
+			for _, r := range runs {
+				r.unreadable = append(r.unreadable, u)
+			}
+			return nil
+		}
+		one := []Source{src}
+		NormalizeKeys(one, first.cfg.UnicodeKeys)
+		if first.cfg.Mmap {
+			markMmap(one)
+		}
+		src = one[0]
+		i := n
+		n++
+		var need []*run
+		for _, r := range runs {
+			todo, err := r.add(src)
+			if err != nil {
+				return r.p.wrap(len(pipes), err)
 			}
+			if todo {
+				need = append(need, r)
+			}
+		}
+		if len(need) == 0 {
+			return nil
+		}
+		first.slots.acquire()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer first.slots.release()
+			processSource(i, src, need, first)
+		}()
+		return nil
+	})
+	scanDone := time.Now()
+	wg.Wait()
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("scan: %w", err)
+	}
+	if n == 0 {
+		return nil, time.Time{}, fmt.Errorf("%w in %s", ErrNoImages, first.cfg.input())
+	}
+	logging.Debugf("found %d images", n)
+	for _, r := range runs {
+		if r.prev != nil {
+			logging.Infof("resuming interrupted build: %d of %d images already done", r.resumed, n)
+		}
+	}
+	return runs, scanDone, nil
+}
 
-			results[idx] = processImage(s, p.cfg, p.registry)
+// processSource decodes source i once and builds it for every run in
+// need. The caller holds a worker slot of first.
+func processSource(i int, src Source, need []*run, first *Pipeline) {
+	logging.Debugf("processing: %s", src.Key)
 
-			if p.cfg.Verbose && results[idx].err == nil {
-				fmt.Fprintf(os.Stderr, "[tgimg] done: %s (%d variants)\n",
-					s.Key, len(results[idx].asset.Variants))
+	profs := make([]profile.Profile, len(need))
+	for j, r := range need {
+		profs[j] = r.p.cfg.profileFor(r.source(i))
+	}
+	si, err := decodeSource(src, pickScale(profs...))
+	for _, r := range need {
+		r.process(i, si, err, first.registry, first.slots)
+	}
+	si.release()
+}
+
+// run is one pipeline's part of a RunAll. Its slices are indexed like
+// the scanned sources.
+type run struct {
+	p       *Pipeline
+	sources []Source        // scanned sources with the pipeline's overrides applied
+	inBuild []bool          // selected for this build: to process or resumed
+	todo    []bool          // to process
+	results []processResult // set for sources in the build
+	carried map[string]manifest.Asset
+	ckpt    *checkpointer
+	prev    *checkpoint // of the interrupted build being resumed, if any
+
+	// unreadable lists the scanned files that are no images, for the
+	// report.
+	unreadable []UnreadableSource
+
+	// mu guards the slices while a streamed scan appends to them (see
+	// add) and the workers read and fill them.
+	mu      sync.Mutex
+	total   int          // sources to process
+	resumed int          // sources taken from prev
+	done    atomic.Int32 // sources processed, for Config.Progress
+}
+
+// wrap prefixes err with the pipeline's profile when RunAll runs several.
+func (p *Pipeline) wrap(pipes int, err error) error {
+	if pipes == 1 {
+		return err
+	}
+	return fmt.Errorf("profile %s: %w", p.cfg.Profile.Name, err)
+}
+
+// prepare applies the pipeline's overrides to the scanned sources and
+// selects the ones it processes: all of them, or the changed ones for an
+// incremental build, minus those a checkpoint already finished.
+func (p *Pipeline) prepare(scanned []Source) (*run, error) {
+	sources := append([]Source(nil), scanned...)
+	if err := applyOverrides(sources, p.cfg.Profile, p.cfg.Overrides); err != nil {
+		return nil, fmt.Errorf("scan: %w", err)
+	}
+	r := p.newRun()
+	r.sources = sources
+	r.inBuild = make([]bool, len(sources))
+	r.todo = make([]bool, len(sources))
+	r.results = make([]processResult, len(sources))
+
+	selected := sources
+	if p.cfg.Changed != nil && p.cfg.Previous != nil {
+		prev := p.cfg.Previous.Config
+		if prev == nil || prev.Fingerprint != p.effectiveConfig().Fingerprint {
+			logging.Warnf("build settings differ from the previous manifest; processing every image")
+		} else {
+			selected, r.carried = p.selectChanged(sources)
+		}
+	}
+	chosen := make(map[string]bool, len(selected))
+	for _, s := range selected {
+		chosen[s.RelPath] = true
+	}
+	for i, s := range sources {
+		r.inBuild[i] = chosen[s.RelPath]
+		r.todo[i] = r.inBuild[i]
+	}
+
+	if r.prev != nil {
+		for i := range sources {
+			if r.inBuild[i] {
+				r.resume(i)
 			}
-		}(i, src)
+		}
+		logging.Infof("resuming interrupted build: %d of %d images already done", r.resumed, len(selected))
 	}
-	wg.Wait()
+	for _, todo := range r.todo {
+		if todo {
+			r.total++
+		}
+	}
+	return r, nil
+}
 
-	// Step 3: Collect results into manifest.
+// newRun starts the pipeline's part of a RunAll, with the checkpoint of
+// an interrupted build to resume from, if any.
+func (p *Pipeline) newRun() *run {
+	r := &run{p: p}
+	if p.cfg.CheckpointInterval > 0 {
+		want := checkpoint{
+			Version:     checkpointVersion,
+			Fingerprint: p.effectiveConfig().Fingerprint,
+			InputDir:    absDir(p.cfg.InputDir),
+			Force:       p.cfg.Force,
+		}
+		path := filepath.Join(p.cfg.OutputDir, CheckpointFileName)
+		r.ckpt = newCheckpointer(path, p.cfg.CheckpointInterval, want)
+		r.prev = loadCheckpoint(path, want)
+	}
+	return r
+}
+
+// resume takes the result of source i from the checkpoint if the
+// interrupted build finished it, so it is not processed again.
+func (r *run) resume(i int) {
+	src := r.sources[i]
+	res, ok := r.prev.resumed(src, r.p.cfg.output())
+	if !ok {
+		return
+	}
+	r.results[i] = res
+	r.ckpt.resume(src.id(), r.prev.Done[src.id()])
+	r.todo[i] = false
+	r.resumed++
+}
+
+// add appends a source a streamed scan found, with the pipeline's
+// overrides applied, and reports whether it is to be processed. Every
+// streamed source is in the build.
+func (r *run) add(src Source) (bool, error) {
+	one := []Source{src}
+	if err := applyOverrides(one, r.p.cfg.Profile, r.p.cfg.Overrides); err != nil {
+		return false, fmt.Errorf("scan: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := len(r.sources)
+	r.sources = append(r.sources, one[0])
+	r.inBuild = append(r.inBuild, true)
+	r.todo = append(r.todo, true)
+	r.results = append(r.results, processResult{})
+	if r.prev != nil {
+		r.resume(i)
+	}
+	if r.todo[i] {
+		r.total++
+	}
+	return r.todo[i], nil
+}
+
+// source returns source i with the pipeline's overrides applied.
+func (r *run) source(i int) Source {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sources[i]
+}
+
+// process builds source i from its decoded image, or records the decode
+// error.
+func (r *run) process(i int, si sourceImage, decodeErr error, registry *encoder.Registry, spare slots) {
+	r.mu.Lock()
+	src, total := r.sources[i], r.total
+	r.mu.Unlock()
+	var res processResult
+	if decodeErr != nil {
+		res = processResult{key: src.Key, theme: src.Theme, recolor: src.Recolor, source: src.RelPath, err: decodeErr}
+	} else {
+		res = processImage(src, si, r.p.cfg, registry, spare)
+	}
+	r.mu.Lock()
+	r.results[i] = res
+	r.mu.Unlock()
+	if r.ckpt != nil {
+		r.ckpt.record(src, res)
+	}
+	if res.err == nil {
+		logging.Debugf("done: %s (%d variants)", src.Key, len(res.asset.Variants))
+	}
+	if r.p.cfg.Progress != nil {
+		r.p.cfg.Progress(int(r.done.Add(1)), total, src.RelPath, res.err)
+	}
+}
+
+// collect assembles the manifest from the results and records the
+// pipeline's report. BuildInfo is left to the caller.
+func (r *run) collect() (*manifest.Manifest, error) {
+	p := r.p
 	m := manifest.New(p.cfg.Profile.Name)
+	if p.cfg.BasePath != "" {
+		m.BasePath = p.cfg.BasePath
+	}
+	if p.cfg.CDN != nil {
+		m.BasePath = "" // paths are URLs
+	}
 
-	var errs []error
-	var totalSkipped int
-	for _, r := range results {
-		if r.err != nil {
-			errs = append(errs, r.err)
+	var errs []*AssetError
+	var totalSkipped, built int
+	var themed []processResult
+	p.report = Report{Skipped: []SkippedVariant{}, Unreadable: r.unreadable, Errors: []*AssetError{}}
+	if p.report.Unreadable == nil {
+		p.report.Unreadable = []UnreadableSource{}
+	}
+	for i, res := range r.results {
+		if !r.inBuild[i] {
+			continue
+		}
+		built++
+		if res.err != nil {
+			errs = append(errs, &AssetError{Key: res.key, Theme: res.theme, Source: res.source, Err: res.err.Error()})
+			continue
+		}
+		p.report.Skipped = append(p.report.Skipped, res.skipped...)
+		for _, sk := range res.skipped {
+			if sk.Reason == SkipNoRegress {
+				totalSkipped++
+			}
+		}
+		if res.theme != "" {
+			themed = append(themed, res)
 			continue
 		}
-		m.Assets[r.key] = r.asset
-		totalSkipped += r.skippedRegress
+		m.Assets[res.key] = res.asset
 	}
+	errs = append(errs, attachThemes(m, themed)...)
+	p.report.Errors = append(p.report.Errors, errs...)
 
 	// Report errors but don't fail the entire build for partial failures.
 	if len(errs) > 0 {
+		m.Errors = make(map[string]manifest.AssetError, len(errs))
 		for _, e := range errs {
-			fmt.Fprintf(os.Stderr, "[tgimg] error: %v\n", e)
+			logging.Errorf("%v", e)
+			m.Errors[errorKey(e.Key, e.Theme)] = manifest.AssetError{Source: e.Source, Theme: e.Theme, Error: e.Err}
 		}
-		if len(errs) == len(sources) {
-			return nil, fmt.Errorf("all %d images failed to process", len(errs))
+		if len(errs) == built && len(r.carried) == 0 {
+			return nil, fmt.Errorf("%w (%d images)", ErrAllFailed, len(errs))
 		}
-		fmt.Fprintf(os.Stderr, "[tgimg] warning: %d of %d images had errors\n",
-			len(errs), len(sources))
+		logging.Warnf("%d of %d images had errors", len(errs), len(r.sources))
 	}
 
-	m.BuildInfo = &manifest.BuildInfo{
-		Workers:     p.cfg.Workers,
-		PoolEntryKB: PoolEntryKB,
+	for key, a := range r.carried {
+		m.Assets[key] = a
 	}
-	m.ComputeStats()
+
+	keys := make(map[string]bool, len(m.Assets))
+	for k := range m.Assets {
+		keys[k] = true
+	}
+	failed := failedKeys(r.unreadable)
+	for _, e := range errs {
+		if e.Theme == "" {
+			failed[e.Key] = true
+		}
+	}
+	var err error
+	m.Aliases, err = resolveAliases(p.cfg.Aliases, keys, failed)
+	if err != nil {
+		return nil, err
+	}
+
 	m.Stats.SkippedRegress = totalSkipped
+	m.ComputeStats()
+	m.Config = p.effectiveConfig()
 	return m, nil
 }
+
+// attachThemes groups themed results under their base asset's Themes map.
+// A "light" rendition without an unsuffixed base becomes the base itself;
+// any other rendition without a base is reported as an error.
+func attachThemes(m *manifest.Manifest, themed []processResult) []*AssetError {
+	sort.Slice(themed, func(i, j int) bool {
+		if themed[i].key != themed[j].key {
+			return themed[i].key < themed[j].key
+		}
+		if (themed[i].theme == "light") != (themed[j].theme == "light") {
+			return themed[i].theme == "light" // may become the base
+		}
+		return themed[i].theme < themed[j].theme
+	})
+
+	var errs []*AssetError
+	for _, r := range themed {
+		base, ok := m.Assets[r.key]
+		if !ok {
+			if r.theme == "light" {
+				m.Assets[r.key] = r.asset
+				continue
+			}
+			errs = append(errs, &AssetError{
+				Key: r.key, Theme: r.theme, Source: r.source,
+				Err: fmt.Sprintf("%s@%s: themed source has no base image (%s or %s@light)",
+					r.key, r.theme, r.key, r.key),
+			})
+			continue
+		}
+		if base.Themes == nil {
+			base.Themes = map[string]manifest.ThemedAsset{}
+		}
+		t := r.asset.Themed()
+		t.Recolor = r.recolor
+		base.Themes[r.theme] = t
+		m.Assets[r.key] = base
+	}
+	return errs
+}
+
+// effectiveConfig records the settings that shape the build output.
+func (p *Pipeline) effectiveConfig() *manifest.BuildConfig {
+	prof := p.cfg.Profile
+	c := &manifest.BuildConfig{
+		Widths:        append([]int{}, prof.Widths...), // never null, even for crop-only profiles
+		Formats:       append([]string(nil), prof.Formats...),
+		Quality:       prof.Quality,
+		Retina:        prof.HighDPR(),
+		DPRs:          append([]float64(nil), prof.DPRs...),
+		Descriptor:    prof.Descriptor,
+		NoRegressSize: p.cfg.NoRegressSize,
+		CopyOriginal:  p.cfg.CopyOriginal,
+		EmitDataURI:   p.cfg.EmitDataURI,
+		Ignore:        append([]string(nil), p.cfg.Ignore...),
+		MaxWidth:      prof.MaxWidth,
+		MinWidth:      prof.MinWidth,
+		Heights:       append([]int(nil), prof.Heights...),
+		Gravity:       prof.Gravity,
+		Margin:        prof.Margin,
+		Breakpoints:   prof.Breakpoints,
+
+		FormatMinWidths: prof.FormatMinWidths,
+	}
+	c.Crops = boxStrings(prof.Crops)
+	if e := encoder.EffectiveEffort(prof.Effort); e != encoder.EffortBalanced {
+		c.Effort = string(e)
+	}
+	if p.cfg.CDN != nil {
+		c.CDN = p.cfg.CDN.Name()
+	}
+	if p.cfg.UnicodeKeys == UnicodeKeysNone {
+		c.UnicodeKeys = string(UnicodeKeysNone)
+	}
+	c.Recolor = recolorConfig(p.cfg.Recolor)
+	if l := prof.Limits; l.Set() {
+		c.Limits = &manifest.Limits{MaxSide: l.MaxSide, ExactSide: l.ExactSide, MaxBytes: l.MaxBytes}
+	}
+	crops := len(prof.Crops) > 0
+	for _, o := range p.cfg.Overrides {
+		if c.Overrides == nil {
+			c.Overrides = map[string]manifest.ProfileOverride{}
+		}
+		c.Overrides[o.Pattern] = manifest.ProfileOverride{
+			Profile:     o.Base,
+			Widths:      o.Widths,
+			Formats:     o.Formats,
+			Quality:     o.Quality,
+			DPRs:        o.DPRs,
+			Descriptor:  o.Descriptor,
+			MaxWidth:    o.MaxWidth,
+			MinWidth:    o.MinWidth,
+			Heights:     o.Heights,
+			Crops:       boxStrings(o.Crops),
+			Gravity:     o.Gravity,
+			Margin:      o.Margin,
+			Breakpoints: o.Breakpoints,
+
+			FormatMinWidths: o.FormatMinWidths,
+			Effort:          string(o.Effort),
+		}
+		crops = crops || len(o.Crops) > 0 || o.Base != ""
+	}
+	if crops && len(p.cfg.Focus) > 0 {
+		c.Focus = p.cfg.Focus
+	}
+	c.ComputeFingerprint()
+	return c
+}
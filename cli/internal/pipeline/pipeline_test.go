@@ -0,0 +1,105 @@
+package pipeline
+
+import (
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+)
+
+// countingInput is a Dir whose sources count how often they are opened.
+// It is no StreamScanner, so RunAll scans it in full before processing.
+type countingInput struct {
+	dir   Dir
+	mu    sync.Mutex
+	opens map[string]int
+}
+
+func (in *countingInput) ReadFile(name string) ([]byte, error) { return in.dir.ReadFile(name) }
+func (in *countingInput) String() string                       { return in.dir.String() }
+
+func (in *countingInput) Scan(ignore []string) ([]Source, error) {
+	sources, err := in.dir.Scan(ignore)
+	for i := range sources {
+		path := sources[i].AbsPath
+		sources[i].Open = func() (io.ReadCloser, error) {
+			in.mu.Lock()
+			in.opens[path]++
+			in.mu.Unlock()
+			return os.Open(path)
+		}
+	}
+	return sources, err
+}
+
+// TestRunAllProfiles builds a small corpus with two profiles in one run:
+// each source is read and decoded once, and each profile writes its own
+// variants to its own directory.
+func TestRunAllProfiles(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	for _, name := range []string{"a.png", "b.png", "c.png"} {
+		f, err := os.Create(filepath.Join(in, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 800, 600)))
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	input := &countingInput{dir: Dir(in), opens: map[string]int{}}
+
+	minimal := profile.Get("minimal")
+	webview := profile.Get("telegram-webview")
+	webview.Widths = []int{200}
+	want := map[string][]int{"minimal": {320, 640}, "telegram-webview": {200}}
+	var pipes []*Pipeline
+	for _, prof := range []profile.Profile{minimal, webview} {
+		prof.Formats = []string{"png"}
+		prof.DPRs = []float64{1}
+		pipes = append(pipes, New(Config{Input: input, OutputDir: filepath.Join(out, prof.Name), Profile: prof, Workers: 1}))
+	}
+	ms, err := RunAll(pipes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(input.opens) != 3 {
+		t.Errorf("opened %d sources, want 3", len(input.opens))
+	}
+	for path, n := range input.opens {
+		if n != 1 {
+			t.Errorf("%s read %d times, want once for both profiles", filepath.Base(path), n)
+		}
+	}
+	if len(ms) != 2 {
+		t.Fatalf("%d manifests, want 2", len(ms))
+	}
+	for i, m := range ms {
+		name := pipes[i].cfg.Profile.Name
+		if m.Profile != name || len(m.Assets) != 3 {
+			t.Errorf("manifest %d: profile %s with %d assets, want %s with 3", i, m.Profile, len(m.Assets), name)
+		}
+		for key, a := range m.Assets {
+			var widths []int
+			for _, v := range a.Variants {
+				widths = append(widths, v.Width)
+				if _, err := os.Stat(filepath.Join(out, name, v.Path)); err != nil {
+					t.Errorf("%s: %v", name, err)
+				}
+			}
+			slices.Sort(widths)
+			if !reflect.DeepEqual(widths, want[name]) {
+				t.Errorf("%s %s: widths %v, want %v", name, key, widths, want[name])
+			}
+		}
+	}
+}
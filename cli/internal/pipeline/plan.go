@@ -0,0 +1,183 @@
+package pipeline
+
+import (
+	"fmt"
+	"image"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+)
+
+// PlannedVariant identifies one variant that can be rendered on demand.
+type PlannedVariant struct {
+	Source Source
+	Width  int
+	Height int
+	Format string
+	Crop   image.Rectangle // source region of a crop variant; empty for the whole source
+	Margin float64         // crop padding per side, see profile.Profile.Margin
+}
+
+// Plan scans and analyzes every source (dimensions, thumbhash, average
+// color) and lists the variants a build would produce, without encoding
+// any of them. Variant paths embed a hash of the source file instead of
+// the encoded output, so they change whenever the source changes.
+//
+// The returned map is keyed by variant path; see Render. Used by the dev
+// server, where encoding is deferred to the first request.
+func (p *Pipeline) Plan() (*manifest.Manifest, map[string]PlannedVariant, error) {
+	sources, unreadable, err := p.scan()
+	if err != nil {
+		return nil, nil, fmt.Errorf("scan: %w", err)
+	}
+
+	type planResult struct {
+		processResult
+		planned map[string]PlannedVariant
+	}
+	results := make([]planResult, len(sources))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, p.cfg.Workers)
+
+	for i, src := range sources {
+		wg.Add(1)
+		go func(idx int, s Source) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			r := planResult{processResult: processResult{key: s.Key, theme: s.Theme, recolor: s.Recolor}}
+			r.asset, r.planned, r.err = p.planSource(s)
+			results[idx] = r
+		}(i, src)
+	}
+	wg.Wait()
+
+	m := manifest.New(p.cfg.Profile.Name)
+	if p.cfg.BasePath != "" {
+		m.BasePath = p.cfg.BasePath
+	}
+	planned := map[string]PlannedVariant{}
+	var themed []processResult
+	failed := failedKeys(unreadable)
+	for _, r := range results {
+		if r.err != nil {
+			logging.Errorf("%v", r.err)
+			if r.theme == "" {
+				failed[r.key] = true
+			}
+			continue
+		}
+		for path, pv := range r.planned {
+			planned[path] = pv
+		}
+		if r.theme != "" {
+			themed = append(themed, r.processResult)
+			continue
+		}
+		m.Assets[r.key] = r.asset
+	}
+	for _, err := range attachThemes(m, themed) {
+		logging.Errorf("%v", err)
+	}
+
+	keys := make(map[string]bool, len(m.Assets))
+	for k := range m.Assets {
+		keys[k] = true
+	}
+	if m.Aliases, err = resolveAliases(p.cfg.Aliases, keys, failed); err != nil {
+		return nil, nil, err
+	}
+	m.ComputeStats()
+	m.Config = p.effectiveConfig()
+	return m, planned, nil
+}
+
+// planSource describes one source and lists its variants.
+func (p *Pipeline) planSource(src Source) (manifest.Asset, map[string]PlannedVariant, error) {
+	cfg := p.cfg
+	cfg.Profile = cfg.profileFor(src)
+
+	si, err := decodeSource(src, pickScale(cfg.Profile))
+	if err != nil {
+		return manifest.Asset{}, nil, err
+	}
+	defer si.release()
+	asset, err := describeSource(src, si, cfg)
+	if err != nil {
+		return asset, nil, err
+	}
+
+	srcHash, err := hashSource(src)
+	if err != nil {
+		return asset, nil, err
+	}
+
+	o := asset.Original
+	if err := checkLimits(cfg.Profile, o.Width, o.Height); err != nil {
+		return asset, nil, fmt.Errorf("%s: %w", src.RelPath, err)
+	}
+	dir := keyDir(src.Key)
+	planned := map[string]PlannedVariant{}
+	formats := p.registry.ResolveFormats(cfg.Profile.Formats, o.HasAlpha)
+	add := func(w, h int, crop image.Rectangle, v manifest.Variant) {
+		var margin float64
+		if v.Crop != nil {
+			margin = v.Crop.Margin
+		}
+		for _, format := range cfg.Profile.FormatsFor(formats, w) {
+			enc := p.registry.Get(format)
+			if enc == nil {
+				continue
+			}
+			fileName := fmt.Sprintf("%s.%d.%d.%s.%s",
+				src.variantStem(crop), w, h, srcHash[:8], enc.Extension())
+			relPath := path.Join(dir, fileName)
+
+			planned[relPath] = PlannedVariant{Source: src, Width: w, Height: h, Format: format, Crop: crop, Margin: margin}
+			v.Format = format
+			v.Width, v.Height = w, h
+			v.Hash = srcHash
+			v.Path = relPath
+			asset.Variants = append(asset.Variants, v)
+		}
+	}
+	for _, w := range cfg.Profile.EffectiveWidths(o.Width, o.Height) {
+		add(w, cfg.Profile.Height(o.Width, o.Height, w), image.Rectangle{}, manifest.Variant{
+			Density:    cfg.Profile.Density(w),
+			Breakpoint: cfg.Profile.Breakpoint(w),
+		})
+	}
+	bounds := si.bounds()
+	for _, t := range cfg.Profile.CropTargets(o.Width, o.Height) {
+		rect := cropRect(bounds, t, src.Key, cfg)
+		add(t.Width, t.Height, rect, manifest.Variant{Density: t.DPR, Crop: cropRecord(t, rect, bounds, cfg.Profile.Margin)})
+	}
+	return asset, planned, nil
+}
+
+// Render decodes, resizes and encodes one planned variant.
+func (p *Pipeline) Render(pv PlannedVariant) ([]byte, error) {
+	enc := p.registry.Get(pv.Format)
+	if enc == nil {
+		return nil, fmt.Errorf("no encoder for %s", pv.Format)
+	}
+	prof := p.cfg.profileFor(pv.Source)
+	si, err := decodeSource(pv.Source, pickScale(prof))
+	if err != nil {
+		return nil, err
+	}
+	resized := RenderVariant(si.img, si.scaled(pv.Crop), pv.Width, pv.Height, pv.Margin)
+	si.release()
+	defer releaseImage(resized)
+	data, _, err := fitBytes(pv.Format, prof.Quality, prof.Limits, func(q int) ([]byte, error) {
+		start := time.Now()
+		data, err := enc.Encode(resized, q, prof.Effort)
+		p.cfg.observeEncode(pv.Format, time.Since(start), false, err)
+		return data, err
+	})
+	return data, err
+}
@@ -0,0 +1,133 @@
+package pipeline
+
+import (
+	"image"
+	"math/bits"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+)
+
+// Pixel buffers for decoded sources and resized renditions are recycled
+// through size-classed sync.Pools, like the thumbhash workBuf, so a big
+// build does not allocate and collect a fresh multi-megabyte buffer per
+// source and variant. Size classes step by a quarter between powers of
+// two, so a pooled buffer wastes at most a quarter of its size.
+
+// minPooledPix is the smallest pooled buffer; smaller ones are cheap to
+// allocate.
+const minPooledPix = 64 << 10
+
+// pixPools holds one pool per size class (see pixClass).
+var pixPools [64 * 4]sync.Pool
+
+// maxPooledPix is the largest pooled buffer, raised by growPixPool to fit
+// the largest renditions of the profiles in use.
+var maxPooledPix atomic.Int64
+
+// growPixPool raises maxPooledPix to fit prof's widest variant: an NRGBA
+// square at twice its width, which also covers the sources a reduced
+// JPEG decode (see decodeScale) yields for it.
+func growPixPool(prof profile.Profile) {
+	widest := widestVariant(prof)
+	n := int64(4 * (2 * widest) * (2 * widest))
+	for {
+		cur := maxPooledPix.Load()
+		if n <= cur || maxPooledPix.CompareAndSwap(cur, n) {
+			return
+		}
+	}
+}
+
+// widestVariant returns the largest side, in pixels, of any variant or
+// crop prof makes.
+func widestVariant(prof profile.Profile) int {
+	widest := prof.MaxWidth
+	for _, w := range prof.Widths {
+		for _, d := range prof.EffectiveDPRs() {
+			widest = max(widest, int(float64(w)*d))
+		}
+	}
+	for _, c := range prof.Crops {
+		for _, d := range prof.EffectiveDPRs() {
+			widest = max(widest, int(float64(max(c.Width, c.Height))*d))
+		}
+	}
+	return widest
+}
+
+// pixClass returns the size class of an n-byte buffer and the capacity of
+// buffers in it, or -1 when n is not pooled.
+func pixClass(n int) (int, int) {
+	if n < minPooledPix || int64(n) > maxPooledPix.Load() {
+		return -1, n
+	}
+	k := bits.Len(uint(n - 1)) // 2^(k-1) < n <= 2^k
+	base := 1 << (k - 1)
+	step := base / 4
+	q := (n - base + step - 1) / step // 1..4
+	return k*4 + q - 1, base + q*step
+}
+
+// getPix returns a zeroed n-byte buffer, from the pool when one of its
+// size class is free.
+func getPix(n int) []byte {
+	class, size := pixClass(n)
+	if class < 0 {
+		return make([]byte, n)
+	}
+	if b, ok := pixPools[class].Get().(*[]byte); ok {
+		buf := (*b)[:n]
+		clear(buf)
+		return buf
+	}
+	return make([]byte, n, size)
+}
+
+// putPix returns b to the pool, in the largest size class it can serve,
+// so buffers allocated elsewhere are recycled too. b must not be used
+// afterwards.
+func putPix(b []byte) {
+	class, size := pixClass(cap(b))
+	if size > cap(b) {
+		class-- // the class below is smaller than cap(b)
+	}
+	if class < 0 || cap(b) < minPooledPix {
+		return
+	}
+	b = b[:cap(b)]
+	pixPools[class].Put(&b)
+}
+
+// trimPools drops every pooled buffer, so the garbage collector can free
+// them once no build holds them. A build running meanwhile just
+// allocates afresh.
+func trimPools() {
+	for i := range pixPools {
+		for pixPools[i].Get() != nil {
+		}
+	}
+}
+
+// freeMemory trims the pools and returns the freed memory to the OS, for
+// a process that keeps running between builds.
+func freeMemory() {
+	trimPools()
+	debug.FreeOSMemory()
+}
+
+// newPooledNRGBA returns a transparent w×h NRGBA image with pooled
+// pixels. Release it with releaseImage.
+func newPooledNRGBA(w, h int) *image.NRGBA {
+	return &image.NRGBA{Pix: getPix(4 * w * h), Stride: 4 * w, Rect: image.Rect(0, 0, w, h)}
+}
+
+// releaseImage returns the pixels of an NRGBA rendition to the pool once
+// it is encoded. img must not be used afterwards.
+func releaseImage(img image.Image) {
+	if m, ok := img.(*image.NRGBA); ok && m.Rect.Min == (image.Point{}) && len(m.Pix) == 4*m.Rect.Dx()*m.Rect.Dy() {
+		putPix(m.Pix)
+	}
+}
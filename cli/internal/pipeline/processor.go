@@ -2,176 +2,585 @@ package pipeline
 
 import (
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
+	"image/color"
+	"image/draw"
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
-	"os"
+	"io"
+	"math"
+	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/AnyUserName/tgimg-cli/internal/cache"
 	"github.com/AnyUserName/tgimg-cli/internal/encoder"
 	"github.com/AnyUserName/tgimg-cli/internal/hasher"
+	"github.com/AnyUserName/tgimg-cli/internal/imgcdn"
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
 	"github.com/AnyUserName/tgimg-cli/internal/manifest"
-	"github.com/AnyUserName/tgimg-cli/internal/thumbhash"
-	"github.com/disintegration/imaging"
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+	"github.com/AnyUserName/tgimg-core/thumbhash"
 
 	_ "golang.org/x/image/bmp"
 	_ "golang.org/x/image/tiff"
 	_ "golang.org/x/image/webp"
 )
 
+// placeholderSize is the longest side of build-time decoded placeholders.
+// 12 px keeps opaque data URIs around 300–400 bytes; browsers upscale it
+// into the same soft blur the runtime decoder produces.
+const placeholderSize = 12
+
 // processResult holds the result of processing a single source image.
 type processResult struct {
-	key            string
-	asset          manifest.Asset
-	err            error
-	skippedRegress int // variants skipped because larger than original
+	key     string
+	theme   string
+	recolor *manifest.Recolor // rule of a generated theme rendition
+	source  string            // path relative to the input directory
+	asset   manifest.Asset
+	err     error
+	skipped []SkippedVariant
 }
 
-// processImage handles a single source image: decode, thumbhash, resize, encode.
-func processImage(src Source, cfg Config, registry *encoder.Registry) processResult {
-	result := processResult{key: src.Key}
+// rendition is one w×h image an asset's variants are encoded from. crop
+// is the source region it shows, or empty for the whole source.
+type rendition struct {
+	w, h int
+	crop image.Rectangle
+	v    manifest.Variant // fields every format's variant shares
 
-	// Open and decode image.
-	f, err := os.Open(src.AbsPath)
-	if err != nil {
-		result.err = fmt.Errorf("open %s: %w", src.RelPath, err)
-		return result
+	once    sync.Once
+	resized image.Image
+	pending int32 // formats left to encode; see done
+}
+
+// render resizes the source for r on first use, so a rendition whose
+// every format is cached is never resized.
+func (r *rendition) render(si sourceImage) image.Image {
+	r.once.Do(func() {
+		var margin float64
+		if r.v.Crop != nil {
+			margin = r.v.Crop.Margin
+		}
+		r.resized = RenderVariant(si.img, si.scaled(r.crop), r.w, r.h, margin)
+	})
+	return r.resized
+}
+
+// done records that one of r's formats is encoded, releasing the resized
+// image after the last.
+func (r *rendition) done() {
+	if atomic.AddInt32(&r.pending, -1) == 0 && r.resized != nil {
+		releaseImage(r.resized)
 	}
-	defer f.Close()
+}
 
-	img, _, err := image.Decode(f)
+// processImage handles a single decoded source image: thumbhash, resize,
+// encode. Encodes also run on any of spare's slots that are free.
+func processImage(src Source, si sourceImage, cfg Config, registry *encoder.Registry, spare slots) processResult {
+	result := processResult{key: src.Key, theme: src.Theme, recolor: src.Recolor, source: src.RelPath}
+	cfg.Profile = cfg.profileFor(src)
+
+	var err error
+	result.asset, err = describeSource(src, si, cfg)
 	if err != nil {
-		result.err = fmt.Errorf("decode %s: %w", src.RelPath, err)
+		result.err = err
 		return result
 	}
+	origW := result.asset.Original.Width
+	origH := result.asset.Original.Height
+	hasAlpha := result.asset.Original.HasAlpha
 
-	bounds := img.Bounds()
-	origW := bounds.Dx()
-	origH := bounds.Dy()
-	hasAlpha := thumbhash.HasAlpha(img)
+	// Determine target widths.
+	widths := cfg.Profile.EffectiveWidths(origW, origH)
 
-	// Generate thumbhash.
-	hash := thumbhash.Encode(img)
-	thumbHashB64 := base64.StdEncoding.EncodeToString(hash)
+	// Determine output formats. A CDN encodes every format.
+	formats := registry.ResolveFormats(cfg.Profile.Formats, hasAlpha)
+	if cfg.CDN != nil {
+		formats = encoder.ResolveFormats(cfg.Profile.Formats, hasAlpha, func(f string) bool {
+			return slices.Contains(profile.Formats, f)
+		})
+	}
 
-	// Compute average color.
-	avg := computeAvgColor(img)
+	dir := keyDir(src.Key)
+	out := &writeBatch{out: cfg.output()}
 
-	// Fill original info.
-	result.asset = manifest.Asset{
-		Original: manifest.OriginalInfo{
-			Width:    origW,
-			Height:   origH,
-			Format:   src.Format,
-			Size:     src.Size,
-			HasAlpha: hasAlpha,
-		},
-		ThumbHash:   thumbHashB64,
-		AspectRatio: float64(origW) / float64(origH),
-		AvgColor:    &avg,
+	// Source hash for encode cache keys and CDN variant hashes.
+	var srcHash string
+	if cfg.Cache != nil || cfg.CDN != nil {
+		if srcHash, err = hashSource(src); err != nil {
+			result.err = err
+			return result
+		}
 	}
 
-	// Determine target widths.
-	widths := cfg.Profile.EffectiveWidths(origW)
+	// Check hard limits before writing anything, so a source that can't
+	// meet them fails as a whole.
+	if err := checkLimits(cfg.Profile, origW, origH); err != nil {
+		result.err = fmt.Errorf("%s: %w", src.RelPath, err)
+		return result
+	}
 
-	// Determine output formats.
-	formats := registry.ResolveFormats(cfg.Profile.Formats, hasAlpha)
+	// Plan the renditions: one per width, then one per crop target. Crop
+	// regions are in full-size coordinates.
+	var rends []*rendition
+	for _, w := range widths {
+		rends = append(rends, &rendition{
+			w: w, h: cfg.Profile.Height(origW, origH, w), // proportional height
+			v: manifest.Variant{Density: cfg.Profile.Density(w), Breakpoint: cfg.Profile.Breakpoint(w)},
+		})
+	}
+	bounds := si.bounds()
+	for _, t := range cfg.Profile.CropTargets(origW, origH) {
+		rect := cropRect(bounds, t, src.Key, cfg)
+		rends = append(rends, &rendition{
+			w: t.Width, h: t.Height, crop: rect,
+			v: manifest.Variant{Density: t.DPR, Crop: cropRecord(t, rect, bounds, cfg.Profile.Margin)},
+		})
+	}
 
-	// Ensure output subdirectory exists.
-	keyDir := filepath.Dir(src.Key)
-	if keyDir != "." {
-		os.MkdirAll(filepath.Join(cfg.OutputDir, keyDir), 0o755)
+	if cfg.CDN != nil { // a CDN renders every variant; nothing to encode
+		for _, r := range rends {
+			if r.v.Crop != nil && r.v.Crop.Margin > 0 {
+				result.err = fmt.Errorf("%s: profile %s: crop margin is not supported with --cdn", src.RelPath, cfg.Profile.Name)
+				return result
+			}
+			for _, format := range cfg.Profile.FormatsFor(formats, r.w) {
+				result.asset.Variants = append(result.asset.Variants, cdnVariant(src, bounds, r.w, r.h, r.crop, format, srcHash, r.v, cfg))
+			}
+		}
+		rends = nil
 	}
 
-	// Generate variants.
-	for _, w := range widths {
-		// Calculate proportional height.
-		h := int(float64(origH) * float64(w) / float64(origW))
-		if h < 1 {
-			h = 1
+	// encode encodes rendition r in one format, returning its variant or,
+	// when it is skipped, nil.
+	encode := func(r *rendition, format string, enc encoder.Encoder) (*manifest.Variant, *SkippedVariant, error) {
+		w, h, crop := r.w, r.h, r.crop
+
+		// Encode, or reuse a cached encode of the same source and
+		// settings, lowering quality as needed to fit Limits.MaxBytes.
+		var encodeMS int64
+		data, quality, err := fitBytes(format, cfg.Profile.Quality, cfg.Profile.Limits, func(q int) ([]byte, error) {
+			qcfg := cfg
+			qcfg.Profile.Quality = q
+			data, ms, err := encodeVariant(enc, func() image.Image { return r.render(si) }, w, h, crop, si, srcHash, qcfg)
+			encodeMS += ms
+			return data, err
+		})
+		if errors.Is(err, errOverLimit) {
+			return nil, nil, fmt.Errorf("%s: profile %s: %s %dx%d: %w", src.RelPath, cfg.Profile.Name, format, w, h, err)
+		}
+		if err != nil {
+			logging.Warnf("encode %s@%dx%d as %s: %v", src.Key, w, h, format, err)
+			return nil, &SkippedVariant{
+				Key: src.Key, Theme: src.Theme, Format: format, Width: w, Height: h,
+				Reason: SkipEncodeError, Error: err.Error(),
+			}, nil
 		}
 
-		// Resize.
-		resized := imaging.Resize(img, w, h, imaging.Lanczos)
+		// Skip variant if encoded size >= original (--no-regress-size).
+		if cfg.NoRegressSize && int64(len(data)) >= src.Size {
+			logging.Debugf("skip: %s@%dx%d %s — encoded %d >= original %d bytes",
+				src.Key, w, h, format, len(data), src.Size)
+			return nil, &SkippedVariant{
+				Key: src.Key, Theme: src.Theme, Format: format, Width: w, Height: h,
+				Reason: SkipNoRegress, EncodedBytes: int64(len(data)), OriginalBytes: src.Size,
+			}, nil
+		}
 
-		for _, format := range formats {
-			enc := registry.Get(format)
-			if enc == nil {
-				continue
-			}
+		// Content hash for filename.
+		contentHash := hasher.ContentHash(data, 16)
 
-			// Encode.
-			data, err := enc.Encode(resized, cfg.Profile.Quality)
-			if err != nil {
-				if cfg.Verbose {
-					fmt.Fprintf(os.Stderr, "[tgimg] warn: encode %s@%dx%d as %s: %v\n",
-						src.Key, w, h, format, err)
-				}
-				continue
-			}
+		// Build filename: key.w.h.hash.ext (key.crop.w.h.hash.ext for crops)
+		fileName := fmt.Sprintf("%s.%d.%d.%s.%s",
+			src.variantStem(crop), w, h, contentHash[:8], enc.Extension())
+		relPath := path.Join(dir, fileName)
 
-			// Skip variant if encoded size >= original (--no-regress-size).
-			if cfg.NoRegressSize && int64(len(data)) >= src.Size {
-				if cfg.Verbose {
-					fmt.Fprintf(os.Stderr, "[tgimg] skip: %s@%dx%d %s — encoded %d >= original %d bytes\n",
-						src.Key, w, h, format, len(data), src.Size)
-				}
-				result.skippedRegress++
-				continue
-			}
+		// Queue the file; the source's files are written together.
+		if err := out.add(relPath, data); err != nil {
+			return nil, nil, err
+		}
 
-			// Content hash for filename.
-			contentHash := hasher.ContentHash(data, 16)
+		if format == "png" {
+			quality = 0 // lossless, quality is ignored
+		}
 
-			// Build filename: key.w.h.hash.ext
-			fileName := fmt.Sprintf("%s.%d.%d.%s.%s",
-				filepath.Base(src.Key), w, h, contentHash[:8], enc.Extension())
-			relPath := filepath.ToSlash(filepath.Join(keyDir, fileName))
+		v := r.v
+		v.Format = format
+		v.Width, v.Height = w, h
+		v.Size = int64(len(data))
+		v.Hash = contentHash
+		v.Path = relPath
+		v.EncodeMS = encodeMS
+		v.Quality = quality
+		return &v, nil, nil
+	}
 
-			// Write file.
-			outPath := filepath.Join(cfg.OutputDir, relPath)
-			if err := os.WriteFile(outPath, data, 0o644); err != nil {
-				result.err = fmt.Errorf("write %s: %w", relPath, err)
-				return result
+	// Encode every rendition × format. A job runs on a worker slot other
+	// sources leave free, if any, so one huge source does not encode on a
+	// single core while the rest idle; otherwise it runs here. Results
+	// keep the job order.
+	type job struct {
+		r       *rendition
+		format  string
+		enc     encoder.Encoder
+		variant *manifest.Variant
+		skipped *SkippedVariant
+		err     error
+	}
+	var jobs []*job
+	for _, r := range rends {
+		for _, format := range cfg.Profile.FormatsFor(formats, r.w) {
+			if enc := registry.Get(format); enc != nil {
+				jobs = append(jobs, &job{r: r, format: format, enc: enc})
+				r.pending++
 			}
+		}
+	}
+	var wg sync.WaitGroup
+	for i, j := range jobs {
+		do := func() {
+			j.variant, j.skipped, j.err = encode(j.r, j.format, j.enc)
+			j.r.done()
+		}
+		if i < len(jobs)-1 && spare.tryAcquire() { // the last runs here while the rest finish
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer spare.release()
+				do()
+			}()
+			continue
+		}
+		do()
+	}
+	wg.Wait()
+	for _, j := range jobs {
+		switch {
+		case j.err != nil:
+			result.err = j.err
+			return result
+		case j.skipped != nil:
+			result.skipped = append(result.skipped, *j.skipped)
+		case j.variant != nil:
+			result.asset.Variants = append(result.asset.Variants, *j.variant)
+		}
+	}
 
-			result.asset.Variants = append(result.asset.Variants, manifest.Variant{
-				Format: format,
-				Width:  w,
-				Height: h,
-				Size:   int64(len(data)),
-				Hash:   contentHash,
-				Path:   relPath,
-			})
+	if cfg.CopyOriginal && src.Recolor == nil { // the original file is the base's
+		v, err := copyOriginal(src, origW, origH, dir, out)
+		if err != nil {
+			result.err = err
+			return result
 		}
+		result.asset.Variants = append(result.asset.Variants, v)
+	}
+	if err := out.flush(); err != nil {
+		result.err = err
+		return result
 	}
 
 	return result
 }
 
-// computeAvgColor calculates the average RGB color of an image.
-func computeAvgColor(img image.Image) [3]uint8 {
-	bounds := img.Bounds()
-	w := uint64(bounds.Dx())
-	h := uint64(bounds.Dy())
-	count := w * h
-	if count == 0 {
-		return [3]uint8{0, 0, 0}
+// cdnVariant describes one w×h rendition in format as a cfg.CDN URL. The
+// CDN renders it from the source, so its hash is the source's and its
+// size is unknown.
+func cdnVariant(src Source, bounds image.Rectangle, w, h int, crop image.Rectangle, format, srcHash string, v manifest.Variant, cfg Config) manifest.Variant {
+	quality := encoder.EffectiveQuality(cfg.Profile.Quality)
+	if format == "png" {
+		quality = 0 // lossless
 	}
-	var rSum, gSum, bSum uint64
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			r, g, b, _ := img.At(x, y).RGBA()
-			rSum += uint64(r >> 8)
-			gSum += uint64(g >> 8)
-			bSum += uint64(b >> 8)
+	if !crop.Empty() {
+		crop = crop.Sub(bounds.Min)
+	}
+	v.Format = format
+	v.Width, v.Height = w, h
+	v.Hash = srcHash
+	v.Quality = quality
+	v.Path = cfg.CDN.URL(imgcdn.Transform{
+		Source:       filepath.ToSlash(src.RelPath),
+		SourceWidth:  bounds.Dx(),
+		SourceHeight: bounds.Dy(),
+		Width:        w,
+		Height:       h,
+		Format:       format,
+		Quality:      quality,
+		Crop:         crop,
+	})
+	return v
+}
+
+// encodeVariant encodes one variant through cfg.Cache when it is set.
+// si is the decoded source resize works from. encodeMS is 0 for cache
+// hits.
+func encodeVariant(enc encoder.Encoder, resize func() image.Image, w, h int, crop image.Rectangle, si sourceImage, srcHash string, cfg Config) ([]byte, int64, error) {
+	var key string
+	if cfg.Cache != nil {
+		parts := []string{"v1", srcHash, strconv.Itoa(w), strconv.Itoa(h), enc.Format(),
+			strconv.Itoa(encoder.EffectiveQuality(cfg.Profile.Quality)), enc.Version(), resizeFilter}
+		if !crop.Empty() {
+			parts = append(parts, "crop", crop.String())
+			if cfg.Profile.Margin > 0 {
+				parts = append(parts, "margin", strconv.FormatFloat(cfg.Profile.Margin, 'g', -1, 64))
+			}
+		}
+		if e := encoder.EffectiveEffort(cfg.Profile.Effort); e != encoder.EffortBalanced {
+			parts = append(parts, "effort", string(e))
+		}
+		if si.scale > 1 {
+			parts = append(parts, "dct", strconv.Itoa(si.scale))
+		}
+		if si.gamut != "" {
+			parts = append(parts, "srgb-from", si.gamut)
+		}
+		key = cache.Key(parts...)
+		if !cfg.Force {
+			if data, ok := cfg.Cache.Get(key); ok {
+				cfg.observeEncode(enc.Format(), 0, true, nil)
+				return data, 0, nil
+			}
 		}
 	}
-	return [3]uint8{
-		uint8(rSum / count),
-		uint8(gSum / count),
-		uint8(bSum / count),
+
+	start := time.Now()
+	data, err := enc.Encode(resize(), cfg.Profile.Quality, cfg.Profile.Effort)
+	elapsed := time.Since(start)
+	cfg.observeEncode(enc.Format(), elapsed, false, err)
+	encodeMS := elapsed.Milliseconds()
+	if err != nil {
+		return nil, encodeMS, err
+	}
+	if cfg.Cache != nil {
+		if err := cfg.Cache.Put(key, data); err != nil {
+			logging.Warnf("cache: %v", err)
+		}
 	}
+	return data, encodeMS, nil
+}
+
+// observeEncode reports an encode to cfg.OnEncode, if set.
+func (cfg Config) observeEncode(format string, elapsed time.Duration, cached bool, err error) {
+	if cfg.OnEncode != nil {
+		cfg.OnEncode(format, elapsed, cached, err)
+	}
+}
+
+// checkLimits checks every variant size prof generates for a srcW×srcH
+// source against prof.Limits.
+func checkLimits(prof profile.Profile, srcW, srcH int) error {
+	if prof.Limits.MaxSide <= 0 {
+		return nil
+	}
+	for _, w := range prof.EffectiveWidths(srcW, srcH) {
+		if err := prof.Limits.CheckSize(w, prof.Height(srcW, srcH, w)); err != nil {
+			return fmt.Errorf("profile %s: %w", prof.Name, err)
+		}
+	}
+	for _, t := range prof.CropTargets(srcW, srcH) {
+		if err := prof.Limits.CheckSize(t.Width, t.Height); err != nil {
+			return fmt.Errorf("profile %s: crop %s: %w", prof.Name, t.Box, err)
+		}
+	}
+	return nil
+}
+
+// errOverLimit marks variants that cannot be encoded within
+// Limits.MaxBytes.
+var errOverLimit = errors.New("over the size limit")
+
+// fitBytes encodes through encode at quality. While the result exceeds
+// limits.MaxBytes, lossy formats are re-encoded 10 quality points lower,
+// down to profile.MinLimitQuality. It returns the data and the effective
+// quality used.
+func fitBytes(format string, quality int, limits profile.Limits, encode func(quality int) ([]byte, error)) ([]byte, int, error) {
+	q := encoder.EffectiveQuality(quality)
+	for {
+		data, err := encode(q)
+		if err != nil {
+			return nil, q, err
+		}
+		err = limits.CheckBytes(int64(len(data)))
+		if err == nil {
+			return data, q, nil
+		}
+		if format == "png" {
+			return nil, q, fmt.Errorf("%w: %v (lossless)", errOverLimit, err)
+		}
+		if q <= profile.MinLimitQuality {
+			return nil, q, fmt.Errorf("%w: %v at quality %d", errOverLimit, err, q)
+		}
+		q = max(q-10, profile.MinLimitQuality)
+	}
+}
+
+// RenderVariant resizes img, or its crop region when crop is not empty,
+// to w×h. A margin above 0 shrinks the result by that fraction of w×h on
+// each side and centers it on the region's average color, or on
+// transparency when the region has alpha.
+func RenderVariant(img image.Image, crop image.Rectangle, w, h int, margin float64) image.Image {
+	if crop.Empty() {
+		crop = img.Bounds()
+	}
+	if margin <= 0 {
+		return resize(img, crop, w, h)
+	}
+	region, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	})
+	if !ok {
+		copied := newPooledNRGBA(crop.Dx(), crop.Dy())
+		defer releaseImage(copied)
+		draw.Draw(copied, copied.Rect, img, crop.Min, draw.Src)
+		img, crop = copied, copied.Rect
+		region = copied
+	}
+	iw := max(1, int(math.Round(float64(w)*(1-2*margin))))
+	ih := max(1, int(math.Round(float64(h)*(1-2*margin))))
+	canvas := newPooledNRGBA(w, h) // transparent
+	if sub := region.SubImage(crop); !thumbhash.HasAlpha(sub) {
+		avg := computeAvgColor(sub)
+		fill := color.NRGBA{R: avg[0], G: avg[1], B: avg[2], A: 255}
+		draw.Draw(canvas, canvas.Rect, image.NewUniform(fill), image.Point{}, draw.Src)
+	}
+	inner := resize(img, crop, iw, ih)
+	at := image.Pt((w-iw)/2, (h-ih)/2)
+	draw.Draw(canvas, image.Rectangle{Min: at, Max: at.Add(inner.Rect.Size())}, inner, image.Point{}, draw.Src)
+	releaseImage(inner)
+	return canvas
+}
+
+// hashSource returns the content hash of a source file, reusing the hash
+// taken during the scan if there is one.
+func hashSource(src Source) (string, error) {
+	h := src.Hash
+	if h == "" {
+		f, err := src.open()
+		if err != nil {
+			return "", fmt.Errorf("open %s: %w", src.RelPath, err)
+		}
+		defer f.Close()
+		if h, err = hasher.ContentHashReader(f, 16); err != nil {
+			return "", fmt.Errorf("hash %s: %w", src.RelPath, err)
+		}
+	}
+	if src.Recolor != nil {
+		// A generated rendition has other pixels than its base file, so
+		// its cache keys and variant names must differ too.
+		rule, _ := json.Marshal(src.Recolor) // plain struct, cannot fail
+		h = hasher.ContentHash(append([]byte(h), rule...), 16)
+	}
+	return h, nil
+}
+
+// describeSource fills everything about an asset that does not depend on
+// encoding: original info, thumbhash, average color and placeholder.
+// Variants is initialized empty.
+func describeSource(src Source, si sourceImage, cfg Config) (manifest.Asset, error) {
+	img := si.img
+	origW := si.width
+	origH := si.height
+	hasAlpha := thumbhash.HasAlpha(img)
+
+	// Generate thumbhash. The ≤100 px thumbnail it hashed stands in for
+	// the full image in everything else derived from its colors.
+	hash, thumb := thumbhash.EncodeThumbnail(img)
+	thumbHashB64 := base64.StdEncoding.EncodeToString(hash)
+
+	// Compute average color.
+	var avg [3]uint8
+	if thumb != nil { // nil for an empty image
+		avg = computeAvgColor(thumb)
+	}
+
+	asset := manifest.Asset{
+		Original: manifest.OriginalInfo{
+			Width:    origW,
+			Height:   origH,
+			Format:   src.Format,
+			Size:     src.Size,
+			HasAlpha: hasAlpha,
+		},
+		ThumbHash:   thumbHashB64,
+		AspectRatio: float64(origW) / float64(origH),
+		AvgColor:    &avg,
+		Variants:    []manifest.Variant{}, // never null, even if every variant is skipped
+	}
+
+	if cfg.EmitDataURI {
+		uri, err := thumbhash.DataURI(hash, placeholderSize)
+		if err != nil {
+			return asset, fmt.Errorf("placeholder %s: %w", src.RelPath, err)
+		}
+		asset.Placeholder = uri
+	}
+
+	if cfg.Profile.UsesDensity() {
+		asset.Descriptor = profile.DescriptorDensity
+	}
+	return asset, nil
+}
+
+// fileStem is the base of every output filename for src: the last key
+// segment, plus "@theme" for themed sources (logo@dark.320.80.<hash>.webp),
+// made portable.
+func (src Source) fileStem() string {
+	stem := path.Base(src.Key)
+	if src.Theme != "" {
+		stem += "@" + src.Theme
+	}
+	return portableName(stem)
+}
+
+// variantStem is fileStem plus ".crop" for crop variants, which keeps a
+// crop apart from the resized variant of the same size.
+func (src Source) variantStem(crop image.Rectangle) string {
+	if crop.Empty() {
+		return src.fileStem()
+	}
+	return src.fileStem() + ".crop"
+}
+
+// copyOriginal writes the untouched source file to out under a
+// content-addressed name and returns its "original" variant.
+func copyOriginal(src Source, w, h int, dir string, out *writeBatch) (manifest.Variant, error) {
+	f, err := src.open()
+	if err != nil {
+		return manifest.Variant{}, fmt.Errorf("read original %s: %w", src.RelPath, err)
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return manifest.Variant{}, fmt.Errorf("read original %s: %w", src.RelPath, err)
+	}
+
+	contentHash := hasher.ContentHash(data, 16)
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(src.RelPath), "."))
+	fileName := fmt.Sprintf("%s.%d.%d.%s.%s",
+		src.fileStem(), w, h, contentHash[:8], ext)
+	relPath := path.Join(dir, fileName)
+
+	if err := out.add(relPath, data); err != nil {
+		return manifest.Variant{}, err
+	}
+
+	return manifest.Variant{
+		Format:   src.Format,
+		Width:    w,
+		Height:   h,
+		Size:     int64(len(data)),
+		Hash:     contentHash,
+		Path:     relPath,
+		Original: true,
+	}, nil
 }
@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+)
+
+// TestVariantHeightsMatchAspectRatio builds a source whose variant
+// heights have fractions above one half, which truncation got wrong, and
+// checks the manifest against aspect_ratio and the files written.
+func TestVariantHeightsMatchAspectRatio(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	f, err := os.Create(filepath.Join(in, "a.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 1000, 801)))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prof := profile.Get("telegram-webview")
+	prof.Formats = []string{"png"}
+	prof.Widths = []int{320, 640}
+	prof.DPRs = []float64{1}
+	m, err := New(Config{InputDir: in, OutputDir: out, Profile: prof, Workers: 1}).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := m.Assets["a"]
+	want := map[int]int{320: 256, 640: 513} // 256.32 and 512.64
+	if len(a.Variants) != len(want) {
+		t.Fatalf("%d variants, want %d", len(a.Variants), len(want))
+	}
+	for _, v := range a.Variants {
+		if v.Height != want[v.Width] || v.Height != int(math.Floor(float64(v.Width)/a.AspectRatio+0.5)) {
+			t.Errorf("width %d: height %d, want %d", v.Width, v.Height, want[v.Width])
+		}
+		f, err := os.Open(filepath.Join(out, v.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := png.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Width != v.Width || cfg.Height != v.Height {
+			t.Errorf("%s is %dx%d, manifest says %dx%d", v.Path, cfg.Width, cfg.Height, v.Width, v.Height)
+		}
+	}
+}
+
+// TestCopyOriginalStats checks that copied originals are written but left
+// out of the optimization stats.
+func TestCopyOriginalStats(t *testing.T) {
+	in := t.TempDir()
+	src := image.NewNRGBA(image.Rect(0, 0, 400, 300))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 13 / 7)
+	}
+	f, err := os.Create(filepath.Join(in, "a.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = png.Encode(f, src)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prof := profile.Get("telegram-webview")
+	prof.Formats = []string{"png"}
+	prof.Widths = []int{100, 200}
+	prof.DPRs = []float64{1}
+	var stats [2]manifest.Stats
+	for i, copyOriginal := range []bool{false, true} {
+		out := t.TempDir()
+		m, err := New(Config{InputDir: in, OutputDir: out, Profile: prof, Workers: 1, CopyOriginal: copyOriginal}).Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.ComputeStats()
+		stats[i] = m.Stats
+		var originals int
+		for _, v := range m.Assets["a"].Variants {
+			if !v.Original {
+				continue
+			}
+			originals++
+			if v.Size != m.Assets["a"].Original.Size {
+				t.Errorf("original variant is %d bytes, source %d", v.Size, m.Assets["a"].Original.Size)
+			}
+			if _, err := os.Stat(filepath.Join(out, v.Path)); err != nil {
+				t.Error(err)
+			}
+		}
+		if want := map[bool]int{false: 0, true: 1}[copyOriginal]; originals != want {
+			t.Errorf("copy original %v: %d original variants, want %d", copyOriginal, originals, want)
+		}
+	}
+	if stats[0] != stats[1] {
+		t.Errorf("stats with copied originals %+v, without %+v", stats[1], stats[0])
+	}
+	if stats[0].TotalVariants != 2 {
+		t.Errorf("%d variants, want 2", stats[0].TotalVariants)
+	}
+}
@@ -0,0 +1,251 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+)
+
+// RecolorFile is the optional sidecar in the input directory that
+// generates theme renditions for sources without a paired @theme file,
+// by glob and then theme:
+//
+//	{"icons/**": {"dark": {"invert": true}, "tinted": {"tint": "#2481cc"}}}
+//
+// A paired logo@dark.png always wins over a generated dark rendition.
+const RecolorFile = "tgimg.recolor.json"
+
+// RecolorRule generates the Theme rendition of sources whose
+// input-relative path matches Pattern (see ignored for the glob syntax).
+type RecolorRule struct {
+	Pattern string
+	Theme   string
+	manifest.Recolor
+}
+
+// LoadRecolor reads the recolor sidecar from the input, in the order
+// rules apply: shorter patterns first, so the most specific pattern
+// decides a theme. A missing file is not an error and yields no rules.
+func LoadRecolor(in Input) ([]RecolorRule, error) {
+	data, err := in.ReadFile(RecolorFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var byPattern map[string]map[string]manifest.Recolor
+	if err := json.Unmarshal(data, &byPattern); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", RecolorFile, err)
+	}
+	var rules []RecolorRule
+	for pattern, themes := range byPattern {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern %q: %w", RecolorFile, pattern, err)
+		}
+		for theme, rc := range themes {
+			if !slices.Contains(themeSuffixes, theme) {
+				return nil, fmt.Errorf("%s: %q: unknown theme %q: want %s",
+					RecolorFile, pattern, theme, strings.Join(themeSuffixes, ", "))
+			}
+			if _, err := newRecolorer(rc); err != nil {
+				return nil, fmt.Errorf("%s: %q %s: %w", RecolorFile, pattern, theme, err)
+			}
+			rules = append(rules, RecolorRule{Pattern: pattern, Theme: theme, Recolor: rc})
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if len(rules[i].Pattern) != len(rules[j].Pattern) {
+			return len(rules[i].Pattern) < len(rules[j].Pattern)
+		}
+		if rules[i].Pattern != rules[j].Pattern {
+			return rules[i].Pattern < rules[j].Pattern
+		}
+		return rules[i].Theme < rules[j].Theme
+	})
+	return rules, nil
+}
+
+// addRecolored appends a generated source for every theme the rules give
+// an unsuffixed source that has no paired file for it. Generated sources
+// share the base's file and carry the rule in Recolor.
+func addRecolored(sources []Source, rules []RecolorRule) []Source {
+	if len(rules) == 0 {
+		return sources
+	}
+	paired := map[string]bool{}
+	for _, s := range sources {
+		if s.Theme != "" {
+			paired[s.Key+"@"+s.Theme] = true
+		}
+	}
+	out := sources
+	for _, s := range sources {
+		if s.Theme != "" {
+			continue
+		}
+		chosen := map[string]manifest.Recolor{}
+		for _, r := range rules {
+			if matchPath(r.Pattern, s.RelPath) {
+				chosen[r.Theme] = r.Recolor
+			}
+		}
+		for _, theme := range themeSuffixes {
+			rc, ok := chosen[theme]
+			if !ok || paired[s.Key+"@"+theme] {
+				continue
+			}
+			g := s
+			g.Theme = theme
+			g.Recolor = &rc
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+// recolorConfig records rules for the manifest config, by pattern and
+// then theme.
+func recolorConfig(rules []RecolorRule) map[string]map[string]manifest.Recolor {
+	if len(rules) == 0 {
+		return nil
+	}
+	out := map[string]map[string]manifest.Recolor{}
+	for _, r := range rules {
+		if out[r.Pattern] == nil {
+			out[r.Pattern] = map[string]manifest.Recolor{}
+		}
+		out[r.Pattern][r.Theme] = r.Recolor
+	}
+	return out
+}
+
+// recolorer is a parsed manifest.Recolor.
+type recolorer struct {
+	invert    bool
+	tint      *color.NRGBA
+	replace   [][2]color.NRGBA // from, to
+	tolerance int
+}
+
+func newRecolorer(rc manifest.Recolor) (*recolorer, error) {
+	ops := 0
+	r := &recolorer{invert: rc.Invert, tolerance: rc.Tolerance}
+	if rc.Invert {
+		ops++
+	}
+	if rc.Tint != "" {
+		c, err := parseHexColor(rc.Tint)
+		if err != nil {
+			return nil, fmt.Errorf("tint: %w", err)
+		}
+		r.tint = &c
+		ops++
+	}
+	if len(rc.Replace) > 0 {
+		froms := make([]string, 0, len(rc.Replace))
+		for from := range rc.Replace {
+			froms = append(froms, from)
+		}
+		sort.Strings(froms)
+		for _, from := range froms {
+			f, err := parseHexColor(from)
+			if err != nil {
+				return nil, fmt.Errorf("replace: %w", err)
+			}
+			t, err := parseHexColor(rc.Replace[from])
+			if err != nil {
+				return nil, fmt.Errorf("replace %s: %w", from, err)
+			}
+			r.replace = append(r.replace, [2]color.NRGBA{f, t})
+		}
+		ops++
+	}
+	if ops != 1 {
+		return nil, fmt.Errorf("set exactly one of invert, tint or replace")
+	}
+	if rc.Tolerance < 0 || rc.Tolerance > 255 {
+		return nil, fmt.Errorf("tolerance %d out of range 0-255", rc.Tolerance)
+	}
+	if rc.Tolerance > 0 && len(rc.Replace) == 0 {
+		return nil, fmt.Errorf("tolerance only applies to replace")
+	}
+	return r, nil
+}
+
+// parseHexColor parses "#rrggbb" as an opaque color.
+func parseHexColor(s string) (color.NRGBA, error) {
+	hex, ok := strings.CutPrefix(s, "#")
+	if !ok || len(hex) != 6 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q: want #rrggbb", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q: want #rrggbb", s)
+	}
+	return color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+// recolor returns a copy of img with rc applied to every pixel. Alpha is
+// always kept, so transparent icons stay transparent.
+func recolor(img image.Image, rc manifest.Recolor) (image.Image, error) {
+	r, err := newRecolorer(rc)
+	if err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	out := image.NewNRGBA(b)
+	draw.Draw(out, b, img, b.Min, draw.Src)
+	pix := out.Pix
+	for i := 0; i+3 < len(pix); i += 4 {
+		c := color.NRGBA{R: pix[i], G: pix[i+1], B: pix[i+2], A: pix[i+3]}
+		c = r.apply(c)
+		pix[i], pix[i+1], pix[i+2] = c.R, c.G, c.B
+	}
+	return out, nil
+}
+
+func (r *recolorer) apply(c color.NRGBA) color.NRGBA {
+	switch {
+	case r.invert:
+		// Mirror HSL lightness: L' = 1-L keeps hue and saturation and
+		// shifts every channel by 1 - (max+min).
+		hi := max(c.R, c.G, c.B)
+		lo := min(c.R, c.G, c.B)
+		d := 255 - int(hi) - int(lo)
+		c.R, c.G, c.B = uint8(int(c.R)+d), uint8(int(c.G)+d), uint8(int(c.B)+d)
+	case r.tint != nil:
+		c.R, c.G, c.B = r.tint.R, r.tint.G, r.tint.B
+	default:
+		for _, p := range r.replace {
+			if near(c, p[0], r.tolerance) {
+				c.R, c.G, c.B = p[1].R, p[1].G, p[1].B
+				break
+			}
+		}
+	}
+	return c
+}
+
+// near reports whether a and b differ by at most tol in every color
+// channel.
+func near(a, b color.NRGBA, tol int) bool {
+	d := func(x, y uint8) int {
+		if x > y {
+			return int(x - y)
+		}
+		return int(y - x)
+	}
+	return d(a.R, b.R) <= tol && d(a.G, b.G) <= tol && d(a.B, b.B) <= tol
+}
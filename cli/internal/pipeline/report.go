@@ -0,0 +1,70 @@
+package pipeline
+
+// Reasons a variant was not written.
+const (
+	SkipNoRegress   = "no_regress_size" // encoded file was not smaller than the source
+	SkipEncodeError = "encode_error"    // the encoder failed
+)
+
+// Reasons a scanned file is not built.
+const (
+	SkipEmptyFile = "empty_file"   // the file has no content
+	SkipNotImage  = "not_an_image" // the content is in no known image format
+)
+
+// Report records per-asset outcomes of a Run that have no place in the
+// manifest: variants that were skipped, files that are no images and
+// sources that failed.
+type Report struct {
+	Skipped    []SkippedVariant   `json:"skipped"`
+	Unreadable []UnreadableSource `json:"unreadable"`
+	Errors     []*AssetError      `json:"errors"`
+}
+
+// UnreadableSource is a file with an image extension that the scan found
+// to be empty or no image, and the build skipped.
+type UnreadableSource struct {
+	Source string `json:"source"` // path relative to the input directory
+	Size   int64  `json:"size"`
+	Reason string `json:"reason"`
+
+	key string // the asset key the source would have had
+}
+
+// SkippedVariant is a planned variant that was not written.
+type SkippedVariant struct {
+	Key           string `json:"key"`
+	Theme         string `json:"theme,omitempty"`
+	Format        string `json:"format"`
+	Width         int    `json:"width"`
+	Height        int    `json:"height"`
+	Reason        string `json:"reason"`
+	EncodedBytes  int64  `json:"encoded_bytes,omitempty"`
+	OriginalBytes int64  `json:"original_bytes,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// AssetError is a source that could not be processed. The build keeps
+// going without it unless every source fails.
+type AssetError struct {
+	Key    string `json:"key"`
+	Theme  string `json:"theme,omitempty"`
+	Source string `json:"source,omitempty"` // path relative to the input directory
+	Err    string `json:"error"`
+}
+
+func (e *AssetError) Error() string { return e.Err }
+
+// errorKey is the key of a source's entry in Manifest.Errors: its asset
+// key, plus "@theme" for a theme rendition.
+func errorKey(key, theme string) string {
+	if theme != "" {
+		return key + "@" + theme
+	}
+	return key
+}
+
+// Report returns the outcomes of the last Run.
+func (p *Pipeline) Report() Report {
+	return p.report
+}
@@ -0,0 +1,442 @@
+package pipeline
+
+import (
+	"image"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/AnyUserName/tgimg-core/thumbhash"
+)
+
+// Resizing works like libvips' shrink-then-reduce:
+//   - An area (box) shrink by the largest integer factor that leaves at
+//     least a 2× reduction, computed once per box instead of once per
+//     filter tap, so downscaling a large source costs little more than
+//     reading it.
+//   - A separable Lanczos-3 pass for the rest, its support widened by the
+//     residual scale, with 14-bit fixed-point weights.
+//   - Source rows are read through per-type fast paths (NRGBA, RGBA,
+//     YCbCr, Gray) into premultiplied integers; no image.At in the hot
+//     path except for other image types.
+//   - Rows are split across goroutines when CPUs are idle (see
+//     resizeThreads).
+//
+// Premultiplied values are in units where 255·255 = 65025 is a full
+// channel, which NRGBA (c·a) and RGBA (c·255) pixels convert to exactly.
+
+// resizeFilter names the resampling in encode cache keys. Change it when
+// the output of resize changes.
+const resizeFilter = "area+lanczos3"
+
+const (
+	fullP       = 255 * 255 // a full premultiplied channel
+	maxAreaStep = 64        // keeps box sums of fullP values within uint32
+
+	// weightBits is the fixed-point precision of filter weights. Filtered
+	// sums of fullP values stay within int32: Lanczos-3 weights summing to
+	// 1<<weightBits have positive parts below 1.3<<weightBits.
+	weightBits = 14
+)
+
+// resizeThreads is the number of goroutines one resize splits its rows
+// over, set by New from the spare CPUs per build worker.
+var resizeThreads atomic.Int32
+
+// setResizeThreads sizes resizeThreads for workers parallel sources.
+func setResizeThreads(workers int) {
+	resizeThreads.Store(int32(max(1, runtime.GOMAXPROCS(0)/max(1, workers))))
+}
+
+// resize returns the r region of src scaled to w×h, in a pooled NRGBA
+// image; release it with releaseImage.
+func resize(src image.Image, r image.Rectangle, w, h int) *image.NRGBA {
+	dst := newPooledNRGBA(w, h)
+	sw, sh := r.Dx(), r.Dy()
+	if sw <= 0 || sh <= 0 || w <= 0 || h <= 0 {
+		return dst
+	}
+	kx, ky := areaStep(sw, w), areaStep(sh, h)
+	aw, ah := (sw+kx-1)/kx, (sh+ky-1)/ky // size after the area shrink
+	wx, wy := lanczosWeights(aw, w), lanczosWeights(ah, h)
+	// Opaque sources, such as every JPEG, skip alpha and premultiplying.
+	opaque := isOpaque(src)
+
+	// Pass 1: area shrink and horizontal filter into tmp, one shrunk row
+	// at a time. tmp rows are NRGBA, like the output.
+	tmp := newPooledNRGBA(w, ah)
+	defer releaseImage(tmp)
+	parallelRows(ah, func(y0, y1 int) {
+		line := make([]uint32, 4*sw)
+		acc := line
+		if kx > 1 || ky > 1 {
+			acc = make([]uint32, 4*aw)
+		}
+		for ay := y0; ay < y1; ay++ {
+			top := r.Min.Y + ay*ky
+			rows := min(ky, r.Max.Y-top)
+			if kx == 1 && ky == 1 {
+				readRow(src, r.Min.X, top, line)
+			} else {
+				clear(acc)
+				for y := top; y < top+rows; y++ {
+					readRow(src, r.Min.X, y, line)
+					boxAdd(line, acc, kx)
+				}
+				boxDivide(acc, sw, kx, rows)
+			}
+			filterRow(acc, tmp.Pix[ay*tmp.Stride:ay*tmp.Stride+4*w], wx, opaque)
+		}
+	})
+
+	// Pass 2: vertical filter from tmp into dst.
+	parallelRows(h, func(y0, y1 int) {
+		acc := make([]int32, 4*w)
+		for y := y0; y < y1; y++ {
+			start, taps := wy.taps(y)
+			filterColumns(tmp, start, taps, acc, dst.Pix[y*dst.Stride:y*dst.Stride+4*w], opaque)
+		}
+	})
+	return dst
+}
+
+// parallelRows calls fn on consecutive row ranges covering [0, n), on up
+// to resizeThreads goroutines.
+func parallelRows(n int, fn func(y0, y1 int)) {
+	threads := min(int(resizeThreads.Load()), n/16) // not worth it for a few rows
+	if threads <= 1 {
+		fn(0, n)
+		return
+	}
+	var wg sync.WaitGroup
+	per := (n + threads - 1) / threads
+	for y0 := 0; y0 < n; y0 += per {
+		wg.Add(1)
+		go func(y0, y1 int) {
+			defer wg.Done()
+			fn(y0, y1)
+		}(y0, min(y0+per, n))
+	}
+	wg.Wait()
+}
+
+// areaStep returns the box shrink factor for scaling n pixels to out: the
+// largest integer that leaves the Lanczos pass at least a 2× reduction.
+func areaStep(n, out int) int {
+	return max(1, min(maxAreaStep, n/out/2))
+}
+
+// boxAdd adds the premultiplied row line into acc, summing k pixels per
+// acc pixel.
+func boxAdd(line, acc []uint32, k int) {
+	if k == 1 {
+		for i, v := range line {
+			acc[i] += v
+		}
+		return
+	}
+	for i := 0; i < len(line); i += 4 {
+		o := (i / 4 / k) * 4
+		acc[o] += line[i]
+		acc[o+1] += line[i+1]
+		acc[o+2] += line[i+2]
+		acc[o+3] += line[i+3]
+	}
+}
+
+// boxDivide turns the sums in acc into means: each of its pixels sums k
+// columns of an n-pixel row (fewer for the last) over rows rows.
+func boxDivide(acc []uint32, n, k, rows int) {
+	if k == 1 && rows == 1 {
+		return
+	}
+	full := uint32(k * rows)
+	for i := 0; i < len(acc); i += 4 {
+		count := full
+		if last := n - (i/4)*k; last < k {
+			count = uint32(last * rows)
+		}
+		half := count / 2
+		acc[i] = (acc[i] + half) / count
+		acc[i+1] = (acc[i+1] + half) / count
+		acc[i+2] = (acc[i+2] + half) / count
+		acc[i+3] = (acc[i+3] + half) / count
+	}
+}
+
+// filterRow applies the horizontal weights wx to the premultiplied row
+// in and writes the result to out as NRGBA.
+func filterRow(in []uint32, out []byte, wx weights, opaque bool) {
+	if opaque {
+		for x := 0; x < len(out)/4; x++ {
+			start, taps := wx.taps(x)
+			var r, g, b int32
+			p := in[4*start:][:4*len(taps)]
+			for t, wt := range taps {
+				px := p[4*t : 4*t+4]
+				r += wt * int32(px[0])
+				g += wt * int32(px[1])
+				b += wt * int32(px[2])
+			}
+			storeNRGBA(out[4*x:4*x+4], r>>weightBits, g>>weightBits, b>>weightBits, fullP)
+		}
+		return
+	}
+	for x := 0; x < len(out)/4; x++ {
+		start, taps := wx.taps(x)
+		var r, g, b, a int32
+		p := in[4*start:][:4*len(taps)]
+		for t, wt := range taps {
+			px := p[4*t : 4*t+4]
+			r += wt * int32(px[0])
+			g += wt * int32(px[1])
+			b += wt * int32(px[2])
+			a += wt * int32(px[3])
+		}
+		storeNRGBA(out[4*x:4*x+4], r>>weightBits, g>>weightBits, b>>weightBits, a>>weightBits)
+	}
+}
+
+// filterColumns applies the vertical weights taps to rows start onwards
+// of the NRGBA tmp, and writes the result to out, using acc for sums.
+func filterColumns(tmp *image.NRGBA, start int, taps []int32, acc []int32, out []byte, opaque bool) {
+	clear(acc)
+	for t, wt := range taps {
+		row := tmp.Pix[(start+t)*tmp.Stride:][:len(acc)]
+		if opaque {
+			for i := 0; i+3 < len(row); i += 4 {
+				acc[i] += wt * int32(row[i])
+				acc[i+1] += wt * int32(row[i+1])
+				acc[i+2] += wt * int32(row[i+2])
+			}
+			continue
+		}
+		for i := 0; i+3 < len(row); i += 4 {
+			a := int32(row[i+3])
+			acc[i] += wt * (int32(row[i]) * a)
+			acc[i+1] += wt * (int32(row[i+1]) * a)
+			acc[i+2] += wt * (int32(row[i+2]) * a)
+			acc[i+3] += wt * (a * 255)
+		}
+	}
+	out = out[:len(acc)]
+	if opaque {
+		const half = 1 << (weightBits - 1)
+		for i := 0; i+3 < len(out); i += 4 {
+			out[i] = uint8(min(max((acc[i]+half)>>weightBits, 0), 255))
+			out[i+1] = uint8(min(max((acc[i+1]+half)>>weightBits, 0), 255))
+			out[i+2] = uint8(min(max((acc[i+2]+half)>>weightBits, 0), 255))
+			out[i+3] = 255
+		}
+		return
+	}
+	for i := 0; i+3 < len(out); i += 4 {
+		storeNRGBA(out[i:i+4], acc[i]>>weightBits, acc[i+1]>>weightBits, acc[i+2]>>weightBits, acc[i+3]>>weightBits)
+	}
+}
+
+// storeNRGBA clamps a premultiplied pixel, which filter overshoot can
+// push out of range, and stores it unpremultiplied.
+func storeNRGBA(out []byte, r, g, b, a int32) {
+	out = out[:4]
+	if a >= fullP { // opaque: a constant divisor, which compiles to a multiply
+		out[0] = uint8((min(max(r, 0), fullP) + 127) / 255)
+		out[1] = uint8((min(max(g, 0), fullP) + 127) / 255)
+		out[2] = uint8((min(max(b, 0), fullP) + 127) / 255)
+		out[3] = 255
+		return
+	}
+	a = max(a, 0)
+	if a == 0 {
+		out[0], out[1], out[2], out[3] = 0, 0, 0, 0
+		return
+	}
+	r = min(max(r, 0), a)
+	g = min(max(g, 0), a)
+	b = min(max(b, 0), a)
+	out[0] = uint8((r*255 + a/2) / a)
+	out[1] = uint8((g*255 + a/2) / a)
+	out[2] = uint8((b*255 + a/2) / a)
+	out[3] = uint8((a + 127) / 255)
+}
+
+// readRow reads len(line)/4 pixels of src's row y from column x0 into
+// line as premultiplied values.
+func readRow(src image.Image, x0, y int, line []uint32) {
+	n := len(line) / 4
+	switch m := src.(type) {
+	case *image.NRGBA:
+		p := m.Pix[m.PixOffset(x0, y):]
+		for i := 0; i < 4*n; i += 4 {
+			a := uint32(p[i+3])
+			line[i] = uint32(p[i]) * a
+			line[i+1] = uint32(p[i+1]) * a
+			line[i+2] = uint32(p[i+2]) * a
+			line[i+3] = a * 255
+		}
+	case *image.RGBA:
+		p := m.Pix[m.PixOffset(x0, y):]
+		for i := 0; i < 4*n; i += 4 {
+			line[i] = uint32(p[i]) * 255
+			line[i+1] = uint32(p[i+1]) * 255
+			line[i+2] = uint32(p[i+2]) * 255
+			line[i+3] = uint32(p[i+3]) * 255
+		}
+	case *image.YCbCr:
+		readYCbCrRow(m, x0, y, line)
+	case *image.Gray:
+		p := m.Pix[m.PixOffset(x0, y):]
+		for i := 0; i < n; i++ {
+			v := uint32(p[i]) * 255
+			line[4*i], line[4*i+1], line[4*i+2], line[4*i+3] = v, v, v, fullP
+		}
+	default:
+		readAtRow(src, x0, y, line)
+	}
+}
+
+// readAtRow is readRow for any image, through At.
+func readAtRow(src image.Image, x0, y int, line []uint32) {
+	for i := 0; i < len(line)/4; i++ {
+		r, g, b, a := src.At(x0+i, y).RGBA()
+		line[4*i] = (r*fullP + 32767) / 0xffff
+		line[4*i+1] = (g*fullP + 32767) / 0xffff
+		line[4*i+2] = (b*fullP + 32767) / 0xffff
+		line[4*i+3] = (a*fullP + 32767) / 0xffff
+	}
+}
+
+// readYCbCrRow is readRow for YCbCr images. It steps through the chroma
+// samples without a division per pixel and inlines color.YCbCrToRGB,
+// with identical results.
+func readYCbCrRow(m *image.YCbCr, x0, y int, line []uint32) {
+	if x0 < 0 { // chroma columns are uneven around 0
+		readAtRow(m, x0, y, line)
+		return
+	}
+	n := len(line) / 4
+	hd, _ := chromaDivisors(m.SubsampleRatio)
+	yp := m.Y[m.YOffset(x0, y):][:n]
+	ci := m.COffset(x0, y)
+	left := hd - x0%hd // pixels until the next chroma sample
+	for i, yv := range yp {
+		yy := int32(yv) * 0x10101
+		cb := int32(m.Cb[ci]) - 128
+		cr := int32(m.Cr[ci]) - 128
+		if left--; left == 0 {
+			ci++
+			left = hd
+		}
+		r := yy + 91881*cr
+		g := yy - 22554*cb - 46802*cr
+		b := yy + 116130*cb
+		line[4*i] = clampYCbCr(r) * 255
+		line[4*i+1] = clampYCbCr(g) * 255
+		line[4*i+2] = clampYCbCr(b) * 255
+		line[4*i+3] = fullP
+	}
+}
+
+// clampYCbCr returns the 8-bit channel of a 16.16 fixed-point value, as
+// color.YCbCrToRGB rounds it.
+func clampYCbCr(v int32) uint32 {
+	if uint32(v)&0xff000000 == 0 {
+		return uint32(v >> 16)
+	}
+	return uint32(^(v >> 31)) & 0xff
+}
+
+// chromaDivisors returns how many luma columns and rows share a chroma
+// sample.
+func chromaDivisors(ratio image.YCbCrSubsampleRatio) (int, int) {
+	switch ratio {
+	case image.YCbCrSubsampleRatio422:
+		return 2, 1
+	case image.YCbCrSubsampleRatio420:
+		return 2, 2
+	case image.YCbCrSubsampleRatio440:
+		return 1, 2
+	case image.YCbCrSubsampleRatio411:
+		return 4, 1
+	case image.YCbCrSubsampleRatio410:
+		return 4, 2
+	default:
+		return 1, 1
+	}
+}
+
+// weights are the fixed-point filter taps of every output pixel along
+// one axis: output i reads n inputs from start[i] with w[i*n:i*n+n].
+type weights struct {
+	start []int
+	n     int
+	w     []int32
+}
+
+// taps returns output i's first input and its weights.
+func (wt weights) taps(i int) (int, []int32) {
+	return wt.start[i], wt.w[i*wt.n : (i+1)*wt.n]
+}
+
+// lanczosWeights computes Lanczos-3 weights for scaling in pixels to out,
+// the support widened by the scale when reducing. Taps past the edges
+// are clamped to the edge pixel, and each output's weights sum to
+// 1<<weightBits exactly.
+func lanczosWeights(in, out int) weights {
+	scale := float64(in) / float64(out)
+	stretch := max(scale, 1)
+	support := 3 * stretch
+	n := min(int(math.Ceil(2*support)), in)
+	wt := weights{start: make([]int, out), n: n, w: make([]int32, out*n)}
+	fw := make([]float64, n)
+	for o := 0; o < out; o++ {
+		center := (float64(o)+0.5)*scale - 0.5
+		start := int(math.Floor(center-support)) + 1
+		start = min(max(start, 0), in-n)
+		wt.start[o] = start
+		var sum float64
+		for t := range fw {
+			fw[t] = lanczos3((float64(start+t) - center) / stretch)
+			sum += fw[t]
+		}
+		taps := wt.w[o*n : (o+1)*n]
+		var isum int32
+		best := 0
+		for t := range fw {
+			taps[t] = int32(math.Round(fw[t] / sum * (1 << weightBits)))
+			isum += taps[t]
+			if taps[t] > taps[best] {
+				best = t
+			}
+		}
+		taps[best] += 1<<weightBits - isum // rounding error onto the center
+	}
+	return wt
+}
+
+func lanczos3(x float64) float64 {
+	if x < 0 {
+		x = -x
+	}
+	if x >= 3 {
+		return 0
+	}
+	if x < 1e-9 {
+		return 1
+	}
+	px := math.Pi * x
+	return 3 * math.Sin(px) * math.Sin(px/3) / (px * px)
+}
+
+// isOpaque reports whether img has no transparent pixels. NRGBA and RGBA
+// pixels are scanned word-wide by thumbhash.HasAlpha rather than byte by
+// byte as their Opaque methods do.
+func isOpaque(img image.Image) bool {
+	switch img.(type) {
+	case *image.NRGBA, *image.RGBA:
+		return !thumbhash.HasAlpha(img)
+	}
+	o, ok := img.(interface{ Opaque() bool })
+	return ok && o.Opaque()
+}
@@ -0,0 +1,143 @@
+package pipeline
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// resizeCases are source and output widths covering an area shrink with
+// and without a Lanczos remainder, a plain Lanczos reduce, and upscales.
+var resizeCases = [][2]int{{640, 64}, {600, 100}, {210, 70}, {200, 100}, {100, 73}, {100, 100}, {50, 100}, {30, 97}}
+
+// resizeBoth calls fn with img and with img hidden behind genericImage,
+// so that the behaviour of both the fast paths and image.At is checked.
+func resizeBoth(img image.Image, fn func(what string, src image.Image)) {
+	fn(fmt.Sprintf("%T", img), img)
+	fn("generic", genericImage{img})
+}
+
+func TestResizeSize(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 300, 200))
+	for _, tc := range []struct {
+		crop image.Rectangle
+		w, h int
+	}{
+		{src.Rect, 150, 100},
+		{src.Rect, 1, 1},
+		{src.Rect, 301, 17},
+		{image.Rect(40, 30, 140, 90), 25, 15},
+		{image.Rect(40, 30, 140, 90), 640, 480},
+	} {
+		dst := resize(src, tc.crop, tc.w, tc.h)
+		if dst.Rect != image.Rect(0, 0, tc.w, tc.h) || dst.Stride != 4*tc.w || len(dst.Pix) != 4*tc.w*tc.h {
+			t.Errorf("%v to %dx%d: rect %v, stride %d, %d bytes", tc.crop, tc.w, tc.h, dst.Rect, dst.Stride, len(dst.Pix))
+		}
+		releaseImage(dst)
+	}
+}
+
+// TestResizeUniform checks that a uniform image stays exactly uniform at
+// every scale: the filter weights sum to one and nothing rings.
+func TestResizeUniform(t *testing.T) {
+	for _, c := range []color.NRGBA{{200, 100, 50, 255}, {10, 240, 130, 255}, {200, 100, 50, 128}, {255, 255, 255, 1}} {
+		src := image.NewNRGBA(image.Rect(0, 0, 640, 480))
+		for i := 0; i < len(src.Pix); i += 4 {
+			src.Pix[i], src.Pix[i+1], src.Pix[i+2], src.Pix[i+3] = c.R, c.G, c.B, c.A
+		}
+		resizeBoth(src, func(what string, img image.Image) {
+			for _, sz := range resizeCases {
+				r := image.Rect(0, 0, sz[0], sz[0]*3/4)
+				dst := resize(img, r, sz[1], sz[1]*3/4+1)
+				for i := 0; i < len(dst.Pix); i += 4 {
+					if got := (color.NRGBA{dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3]}); got != c {
+						t.Errorf("%s %v, %d to %d: pixel %d is %v", what, c, sz[0], sz[1], i/4, got)
+						break
+					}
+				}
+				releaseImage(dst)
+			}
+		})
+	}
+}
+
+// TestResizeStepEdge resizes a vertical black-to-white edge in the middle
+// of the image. A correctly centered filter keeps the output mirror
+// symmetric about the edge; a half-pixel shift breaks the symmetry.
+func TestResizeStepEdge(t *testing.T) {
+	for _, sz := range resizeCases {
+		sw, w := sz[0], sz[1]
+		if sw%2 != 0 || w%2 != 0 {
+			continue // the edge must fall between pixels on both sides
+		}
+		src := image.NewGray(image.Rect(0, 0, sw, 8))
+		for y := 0; y < 8; y++ {
+			for x := sw / 2; x < sw; x++ {
+				src.Pix[y*src.Stride+x] = 255
+			}
+		}
+		resizeBoth(src, func(what string, img image.Image) {
+			dst := resize(img, src.Rect, w, 4)
+			defer releaseImage(dst)
+			for y := 0; y < 4; y++ {
+				row := dst.Pix[y*dst.Stride:]
+				for x := 0; x < w/2; x++ {
+					left, right := int(row[4*x]), int(row[4*(w-1-x)])
+					if d := left + right - 255; d < -1 || d > 1 {
+						t.Fatalf("%s %d to %d: pixels %d and %d are %d and %d, not symmetric", what, sw, w, x, w-1-x, left, right)
+					}
+				}
+				if row[4*(w/2-1)] >= 128 || row[4*(w/2)] < 128 {
+					t.Fatalf("%s %d to %d: edge moved: %d, %d", what, sw, w, row[4*(w/2-1)], row[4*(w/2)])
+				}
+				if row[0] != 0 || row[4*(w-1)] != 255 {
+					t.Fatalf("%s %d to %d: far side changed: %d, %d", what, sw, w, row[0], row[4*(w-1)])
+				}
+			}
+		})
+	}
+}
+
+// TestResizeTransparentFringe resizes a red disc on transparent black.
+// Filtering in premultiplied alpha keeps the black of the transparent
+// pixels out of the disc's antialiased edge.
+func TestResizeTransparentFringe(t *testing.T) {
+	for _, sz := range resizeCases {
+		sw, w := sz[0], sz[1]
+		if sw == w {
+			continue // nothing is filtered
+		}
+		src := image.NewNRGBA(image.Rect(0, 0, sw, sw))
+		c, r2 := sw/2, sw*sw/9
+		for y := 0; y < sw; y++ {
+			for x := 0; x < sw; x++ {
+				if dx, dy := x-c, y-c; dx*dx+dy*dy <= r2 {
+					src.SetNRGBA(x, y, color.NRGBA{255, 0, 0, 255})
+				}
+			}
+		}
+		resizeBoth(src, func(what string, img image.Image) {
+			dst := resize(img, src.Rect, w, w)
+			defer releaseImage(dst)
+			partial := 0
+			for i := 0; i < len(dst.Pix); i += 4 {
+				p := dst.Pix[i : i+4]
+				if p[3] == 0 {
+					continue
+				}
+				if p[3] < 255 {
+					partial++
+				}
+				// Unpremultiplying rounds; the lower the alpha, the coarser.
+				tol := 2 + 255/int(p[3])
+				if 255-int(p[0]) > tol || int(p[1]) > tol || int(p[2]) > tol {
+					t.Fatalf("%s %d to %d: pixel %d is %v, want red", what, sw, w, i/4, p)
+				}
+			}
+			if partial == 0 {
+				t.Fatalf("%s %d to %d: no antialiased edge", what, sw, w)
+			}
+		})
+	}
+}
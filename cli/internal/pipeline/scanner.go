@@ -1,9 +1,22 @@
 package pipeline
 
 import (
+	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/AnyUserName/tgimg-cli/internal/hasher"
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+	"golang.org/x/text/unicode/norm"
 )
 
 // Source represents a discovered image file.
@@ -18,6 +31,51 @@ type Source struct {
 	Format string
 	// Size is the file size in bytes.
 	Size int64
+	// Theme is the color-scheme suffix of a themed source ("dark" for
+	// logo@dark.png), or empty. Themed sources share the Key of their base.
+	Theme string
+	// Recolor, when non-nil, marks a Theme rendition generated from the
+	// base source's file by a RecolorFile rule.
+	Recolor *manifest.Recolor
+	// Open, when set, reads a source that is not a local file, such as
+	// a bucket object; AbsPath then only names it in messages. ModTime
+	// and Size identify its version for checkpoints.
+	Open    func() (io.ReadCloser, error)
+	ModTime time.Time
+	// Profile, when non-nil, replaces Config.Profile for this source: the
+	// profile with every matching ProfileOverride applied.
+	Profile *profile.Profile
+	// Hash, when set, is the content hash of the file (16 hex chars of
+	// xxhash64), computed by ScanImagesHashed so that encode cache keys
+	// need no second read.
+	Hash string
+	// Unreadable is set by the scan for a file that is no image despite
+	// its extension: SkipEmptyFile or SkipNotImage. The build skips it.
+	Unreadable string
+
+	mmap bool // open memory-mapped; see markMmap
+}
+
+// ProfileOverride changes the profile of sources whose input-relative
+// path matches Pattern (see ignored for the glob syntax).
+type ProfileOverride struct {
+	Pattern string
+	profile.Override
+}
+
+// themeSuffixes are the recognized "@theme" filename suffixes: Telegram's
+// WebApp colorScheme values, plus "tinted" for icons painted in the
+// theme's accent color.
+var themeSuffixes = []string{"light", "dark", "tinted"}
+
+// splitTheme strips a recognized "@theme" suffix from an asset key.
+func splitTheme(key string) (string, string) {
+	for _, t := range themeSuffixes {
+		if base, ok := strings.CutSuffix(key, "@"+t); ok && base != "" && !strings.HasSuffix(base, "/") {
+			return base, t
+		}
+	}
+	return key, ""
 }
 
 // imageExtensions lists recognized image file extensions.
@@ -32,11 +90,215 @@ var imageExtensions = map[string]bool{
 	".tif":  true,
 }
 
-// ScanImages walks the input directory and returns all image sources.
-func ScanImages(inputDir string) ([]Source, error) {
+// ignored reports whether relPath (slash-separated) matches any ignore
+// pattern.
+func ignored(relPath string, patterns []string) bool {
+	for _, p := range patterns {
+		if matchPath(p, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath reports whether the slash-separated relPath matches a glob.
+// Segments match as in path.Match and a "**" segment matches any number
+// of directories, so "icons/**" covers everything below icons/. Patterns
+// without a slash also match the base name alone, so "*.psd" matches at
+// any depth while "drafts/*" only matches at the root. Both are compared
+// in NFC, whatever form the file system and the config use.
+func matchPath(pattern, relPath string) bool {
+	pattern = norm.NFC.String(filepath.ToSlash(pattern)) // icons\** from a Windows config
+	relPath = norm.NFC.String(relPath)
+	if matchSegments(strings.Split(pattern, "/"), strings.Split(relPath, "/")) {
+		return true
+	}
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(relPath))
+		return ok
+	}
+	return false
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// applyOverrides sets the Profile of every source matched by an override.
+// When several patterns match, all apply, longer (more specific) patterns
+// last, so they win for settings both change.
+func applyOverrides(sources []Source, base profile.Profile, overrides []ProfileOverride) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+	ordered := append([]ProfileOverride(nil), overrides...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if len(ordered[i].Pattern) != len(ordered[j].Pattern) {
+			return len(ordered[i].Pattern) < len(ordered[j].Pattern)
+		}
+		return ordered[i].Pattern < ordered[j].Pattern
+	})
+	for i := range sources {
+		p, matched := base, false
+		for _, o := range ordered {
+			if !matchPath(o.Pattern, sources[i].RelPath) {
+				continue
+			}
+			var err error
+			if p, err = o.Apply(p); err != nil {
+				return fmt.Errorf("override %q for %s: %w", o.Pattern, sources[i].RelPath, err)
+			}
+			matched = true
+		}
+		if matched {
+			sources[i].Profile = &p
+		}
+	}
+	return nil
+}
+
+// scan lists the sources of the build with their overrides applied.
+func (p *Pipeline) scan() ([]Source, []UnreadableSource, error) {
+	sources, err := p.cfg.input().Scan(p.cfg.Ignore)
+	if err != nil {
+		return nil, nil, err
+	}
+	sources, unreadable := splitUnreadable(sources)
+	NormalizeKeys(sources, p.cfg.UnicodeKeys)
+	sources = addRecolored(sources, p.cfg.Recolor)
+	if err := applyOverrides(sources, p.cfg.Profile, p.cfg.Overrides); err != nil {
+		return nil, nil, err
+	}
+	return sources, unreadable, nil
+}
+
+// id identifies src among the scanned sources: its input-relative path,
+// plus "@theme" for a generated rendition, which shares its base's file.
+func (src Source) id() string {
+	if src.Recolor != nil {
+		return src.RelPath + "@" + src.Theme
+	}
+	return src.RelPath
+}
+
+// profileFor returns the profile src is built with.
+func (cfg Config) profileFor(src Source) profile.Profile {
+	if src.Profile != nil {
+		return *src.Profile
+	}
+	return cfg.Profile
+}
+
+// ScanImages walks the input directory and returns all image sources,
+// skipping files and directories that match an ignore pattern.
+func ScanImages(inputDir string, ignore []string) ([]Source, error) {
+	var sources []Source
+	err := WalkImages(inputDir, ignore, func(s Source) error {
+		sources = append(sources, s)
+		return nil
+	})
+	return sources, err
+}
+
+// ScanImagesHashed is ScanImages that also sets the Hash of every source,
+// reading up to workers files at once while the walk goes on.
+func ScanImagesHashed(inputDir string, ignore []string, workers int) ([]Source, error) {
+	return scanImagesHashed(inputDir, ignore, nil, workers)
+}
+
+func scanImagesHashed(inputDir string, ignore, skip []string, workers int) ([]Source, error) {
+	type job struct {
+		i    int
+		path string
+	}
+	jobs := make(chan job, 4*workers)
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		hashes  = map[int]string{}
+		hashErr error
+	)
+	for range max(1, workers) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				h, err := hashFile(j.path)
+				mu.Lock()
+				if err != nil && hashErr == nil {
+					hashErr = err
+				}
+				hashes[j.i] = h
+				mu.Unlock()
+			}
+		}()
+	}
 	var sources []Source
+	err := walkImages(inputDir, ignore, skip, func(s Source) error {
+		if s.Unreadable == "" {
+			jobs <- job{len(sources), s.AbsPath}
+		}
+		sources = append(sources, s)
+		return nil
+	})
+	close(jobs)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	if hashErr != nil {
+		return nil, hashErr
+	}
+	for i := range sources {
+		sources[i].Hash = hashes[i]
+	}
+	return sources, nil
+}
 
-	err := filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
+// hashFile returns the content hash of a local file, as Source.Hash
+// records it.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h, err := hasher.ContentHashReader(f, 16)
+	if err != nil {
+		return "", fmt.Errorf("hash %s: %w", path, err)
+	}
+	return h, nil
+}
+
+// WalkImages walks the input directory like ScanImages, but passes each
+// source to fn as soon as it is found, in the same order, instead of
+// collecting them. An error from fn stops the walk and is returned.
+func WalkImages(inputDir string, ignore []string, fn func(Source) error) error {
+	return walkImages(inputDir, ignore, nil, fn)
+}
+
+// walkImages is WalkImages that also leaves out the directories at the
+// slash-separated paths skip, relative to inputDir.
+func walkImages(inputDir string, ignore, skip []string, fn func(Source) error) error {
+	inputDir = absDir(inputDir)
+	return filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -45,6 +307,11 @@ func ScanImages(inputDir string) ([]Source, error) {
 			if strings.HasPrefix(info.Name(), ".") && info.Name() != "." {
 				return filepath.SkipDir
 			}
+			if rel, err := filepath.Rel(inputDir, path); err == nil && rel != "." {
+				if rel = filepath.ToSlash(rel); ignored(rel, ignore) || slices.ContainsFunc(skip, func(s string) bool { return samePath(s, rel) }) {
+					return filepath.SkipDir
+				}
+			}
 			return nil
 		}
 
@@ -57,30 +324,124 @@ func ScanImages(inputDir string) ([]Source, error) {
 		if err != nil {
 			return err
 		}
+		if ignored(filepath.ToSlash(relPath), ignore) {
+			return nil
+		}
 
 		// Key: relative path without extension, using forward slashes.
 		key := strings.TrimSuffix(relPath, ext)
 		key = filepath.ToSlash(key)
+		key, theme := splitTheme(key)
 
-		// Normalize format name.
-		format := strings.TrimPrefix(ext, ".")
-		if format == "jpg" {
-			format = "jpeg"
-		}
-		if format == "tif" {
-			format = "tiff"
-		}
-
-		sources = append(sources, Source{
+		src := Source{
 			AbsPath: path,
 			RelPath: filepath.ToSlash(relPath),
 			Key:     key,
-			Format:  format,
+			Format:  sourceFormat(ext),
 			Size:    info.Size(),
-		})
-
-		return nil
+			Theme:   theme,
+		}
+		src.sniff()
+		return fn(src)
 	})
+}
 
-	return sources, err
+// magicNumbers lists the leading bytes of each format a source can be
+// decoded from; '?' matches any byte.
+var magicNumbers = []struct{ magic, format string }{
+	{"\x89PNG\r\n\x1a\n", "png"},
+	{"\xff\xd8", "jpeg"},
+	{"GIF87a", "gif"},
+	{"GIF89a", "gif"},
+	{"RIFF????WEBPVP8", "webp"},
+	{"BM", "bmp"},
+	{"II*\x00", "tiff"},
+	{"MM\x00*", "tiff"},
+}
+
+// sniffFormat returns the format head, the start of a file, is in, or ""
+// when it is no format a source can be decoded from.
+func sniffFormat(head []byte) string {
+next:
+	for _, m := range magicNumbers {
+		if len(head) < len(m.magic) {
+			continue
+		}
+		for i := 0; i < len(m.magic); i++ {
+			if m.magic[i] != '?' && m.magic[i] != head[i] {
+				continue next
+			}
+		}
+		return m.format
+	}
+	return ""
+}
+
+// sniff reads the start of the source to set Unreadable for an empty file
+// or one whose content is no image, and to correct Format for an image
+// saved under another format's extension. A source that cannot be opened
+// is left for the decode to report.
+func (src *Source) sniff() {
+	if src.Size == 0 {
+		src.Unreadable = SkipEmptyFile
+		return
+	}
+	f, err := src.open()
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	var head [16]byte
+	n, err := io.ReadFull(f, head[:])
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return
+	}
+	switch format := sniffFormat(head[:n]); format {
+	case "":
+		src.Unreadable = SkipNotImage
+	case src.Format:
+	default:
+		logging.Debugf("scan: %s is %s, not %s", src.RelPath, format, src.Format)
+		src.Format = format
+	}
+}
+
+// splitUnreadable removes the sources the scan marked Unreadable from
+// sources, logging a warning for each, and returns them as the report
+// lists them.
+func splitUnreadable(sources []Source) ([]Source, []UnreadableSource) {
+	var unreadable []UnreadableSource
+	kept := sources[:0]
+	for _, s := range sources {
+		if s.Unreadable == "" {
+			kept = append(kept, s)
+			continue
+		}
+		unreadable = append(unreadable, s.unreadable())
+	}
+	return kept, unreadable
+}
+
+// unreadable logs that the build skips src, which the scan marked
+// Unreadable, and returns its report entry.
+func (src Source) unreadable() UnreadableSource {
+	if src.Unreadable == SkipEmptyFile {
+		logging.Warnf("skipping %s: empty file", src.RelPath)
+	} else {
+		logging.Warnf("skipping %s: not a %s image (unknown content)", src.RelPath, src.Format)
+	}
+	return UnreadableSource{Source: src.RelPath, Size: src.Size, Reason: src.Unreadable, key: src.Key}
+}
+
+// sourceFormat normalizes a lowercase image extension (".jpg") to a
+// format name ("jpeg").
+func sourceFormat(ext string) string {
+	switch format := strings.TrimPrefix(ext, "."); format {
+	case "jpg":
+		return "jpeg"
+	case "tif":
+		return "tiff"
+	default:
+		return format
+	}
 }
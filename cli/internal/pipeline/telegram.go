@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/AnyUserName/tgimg-cli/internal/telegram"
+)
+
+// Telegram is an input of files a bot received, such as user-submitted
+// photos, named by file_id and downloaded through the Bot API. Each
+// becomes an asset keyed by its file_unique_id, which is stable across
+// bots and re-sends; aliases give them readable names.
+type Telegram struct {
+	Bot     *telegram.Bot
+	FileIDs []string
+
+	// Context bounds every request; nil means context.Background().
+	Context context.Context
+}
+
+func (t *Telegram) ctx() context.Context {
+	if t.Context != nil {
+		return t.Context
+	}
+	return context.Background()
+}
+
+// Scan resolves every file_id with getFile. Files whose path has no
+// image extension are skipped: Telegram names photos "photos/file_N.jpg"
+// and keeps the extension of documents.
+func (t *Telegram) Scan(ignore []string) ([]Source, error) {
+	var sources []Source
+	seen := map[string]bool{}
+	for _, id := range t.FileIDs {
+		f, err := t.Bot.GetFile(t.ctx(), id)
+		if err != nil {
+			return nil, fmt.Errorf("tg://%s: %w", id, err)
+		}
+		ext := strings.ToLower(path.Ext(f.FilePath))
+		if !imageExtensions[ext] || seen[f.FileUniqueID] {
+			continue
+		}
+		seen[f.FileUniqueID] = true
+		rel := f.FileUniqueID + ext
+		if ignored(rel, ignore) {
+			continue
+		}
+		filePath := f.FilePath
+		sources = append(sources, Source{
+			AbsPath: "tg://" + id,
+			RelPath: rel,
+			Key:     f.FileUniqueID,
+			Format:  sourceFormat(ext),
+			Size:    f.FileSize,
+			Open: func() (io.ReadCloser, error) {
+				return t.Bot.Download(t.ctx(), filePath)
+			},
+		})
+	}
+	return sources, nil
+}
+
+// ReadFile reports every sidecar as missing: a bot's files have no
+// directory to hold one.
+func (t *Telegram) ReadFile(name string) ([]byte, error) {
+	return nil, &fs.PathError{Op: "open", Path: "tg://" + name, Err: fs.ErrNotExist}
+}
+
+func (t *Telegram) String() string {
+	return "tg://" + strings.Join(t.FileIDs, ",")
+}
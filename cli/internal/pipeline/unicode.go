@@ -0,0 +1,42 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// UnicodeKeys selects the Unicode normalization form of asset keys. macOS
+// has long stored file names decomposed (NFD: "e" + U+0301), while Linux
+// and Windows keep what was typed, usually composed (NFC: U+00E9), so
+// the same checkout can yield two spellings of one key.
+type UnicodeKeys string
+
+const (
+	UnicodeKeysNFC  UnicodeKeys = "nfc"  // composed; the default
+	UnicodeKeysNone UnicodeKeys = "none" // keys keep the form of the file names
+)
+
+// ParseUnicodeKeys validates a --unicode-keys value; "" means
+// UnicodeKeysNFC.
+func ParseUnicodeKeys(s string) (UnicodeKeys, error) {
+	switch u := UnicodeKeys(s); u {
+	case "":
+		return UnicodeKeysNFC, nil
+	case UnicodeKeysNFC, UnicodeKeysNone:
+		return u, nil
+	}
+	return "", fmt.Errorf("invalid unicode keys %q: want nfc or none", s)
+}
+
+// NormalizeKeys converts the Key of every source to the form u, so that
+// content-addressed file names and manifest lookups do not depend on the
+// platform the file was created on.
+func NormalizeKeys(sources []Source, u UnicodeKeys) {
+	if u == UnicodeKeysNone {
+		return
+	}
+	for i := range sources {
+		sources[i].Key = norm.NFC.String(sources[i].Key)
+	}
+}
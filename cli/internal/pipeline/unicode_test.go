@@ -0,0 +1,48 @@
+package pipeline
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+)
+
+// TestBuildNFDKeys builds a source named in NFD, as macOS stores it, and
+// checks that its key is NFC unless normalization is off.
+func TestBuildNFDKeys(t *testing.T) {
+	const nfd, nfc = "cafe\u0301", "caf\u00e9"
+	in := t.TempDir()
+	f, err := os.Create(filepath.Join(in, nfd+".png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 8, 8)))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prof := profile.Get("telegram-webview")
+	prof.Formats = []string{"png"}
+	for _, tc := range []struct {
+		mode UnicodeKeys
+		key  string
+	}{{"", nfc}, {UnicodeKeysNFC, nfc}, {UnicodeKeysNone, nfd}} {
+		m, err := New(Config{InputDir: in, OutputDir: t.TempDir(), Profile: prof, Workers: 1, UnicodeKeys: tc.mode}).Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := m.Assets[tc.key]; !ok || len(m.Assets) != 1 {
+			t.Errorf("mode %q: %d assets, want only %+q", tc.mode, len(m.Assets), tc.key)
+		}
+	}
+}
+
+func TestMatchPathNFC(t *testing.T) {
+	if !matchPath("cafe\u0301/*", "caf\u00e9/x.png") || !matchPath("caf\u00e9/*", "cafe\u0301/x.png") {
+		t.Error("matchPath does not treat NFC and NFD names as equal")
+	}
+}
@@ -0,0 +1,53 @@
+package pipeline
+
+import (
+	"fmt"
+	"image"
+	"os"
+
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+)
+
+// ProcessFile builds a single image that is not part of the input
+// directory, such as an upload, as asset key. Its variants are written to
+// the output directory like a build's; overrides match key plus the
+// decoded format's extension. It returns the asset and the variants that
+// were skipped.
+func (p *Pipeline) ProcessFile(path, key string) (manifest.Asset, []SkippedVariant, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return manifest.Asset{}, nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return manifest.Asset{}, nil, err
+	}
+	_, format, err := image.DecodeConfig(f)
+	f.Close()
+	if err != nil {
+		return manifest.Asset{}, nil, fmt.Errorf("%s: unsupported or corrupt image: %w", key, err)
+	}
+
+	src := Source{
+		AbsPath: path,
+		RelPath: key + "." + format,
+		Key:     key,
+		Format:  format,
+		Size:    info.Size(),
+	}
+	sources := []Source{src}
+	if p.cfg.Mmap {
+		markMmap(sources)
+	}
+	if err := applyOverrides(sources, p.cfg.Profile, p.cfg.Overrides); err != nil {
+		return manifest.Asset{}, nil, err
+	}
+
+	si, err := decodeSource(sources[0], pickScale(p.cfg.profileFor(sources[0])))
+	if err != nil {
+		return manifest.Asset{}, nil, err
+	}
+	defer si.release()
+	r := processImage(sources[0], si, p.cfg, p.registry, p.slots)
+	return r.asset, r.skipped, r.err
+}
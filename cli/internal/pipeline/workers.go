@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"math"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+)
+
+// AutoWorkers returns the worker count a build with prof uses for
+// Workers 0: NumCPU, lowered so that every worker can hold a source as
+// large as the pools keep (see growPixPool) within the memory budget.
+// On a small container, NumCPU workers each decoding a camera photo
+// would exceed its limit.
+func AutoWorkers(prof profile.Profile) int {
+	n := runtime.NumCPU()
+	budget, per := memoryBudget(), workerMemory(prof)
+	if budget <= 0 || per <= 0 {
+		return n
+	}
+	fit := int(max(1, budget/per))
+	if fit < n {
+		logging.Debugf("workers: %d of %d CPUs fit a %d MB memory budget at %d MB each",
+			fit, n, budget>>20, per>>20)
+		return fit
+	}
+	return n
+}
+
+// workerMemory estimates the peak memory of one worker building prof: a
+// decoded source as large as the largest pooled buffer, plus the
+// renditions and encoder input made from it.
+func workerMemory(prof profile.Profile) int64 {
+	w := int64(widestVariant(prof))
+	src := 4 * (2 * w) * (2 * w)
+	return src + src/2
+}
+
+// memoryBudget returns the memory workers may use: three quarters of
+// GOMEMLIMIT when it is set, else of the memory available to the
+// process, leaving the rest for the garbage collector's headroom and
+// encoder processes. It is 0 when neither is known.
+func memoryBudget() int64 {
+	limit := debug.SetMemoryLimit(-1)
+	if limit == math.MaxInt64 {
+		limit = availableMemory()
+	}
+	return limit / 4 * 3
+}
@@ -0,0 +1,67 @@
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+)
+
+// maxBatchBytes bounds the variant data a writeBatch holds before it
+// writes: a few full assets, so memory stays bounded per worker.
+const maxBatchBytes = 16 << 20
+
+// writeBatch collects the variant files of one source and writes them
+// together when the source is done, or sooner once they reach
+// maxBatchBytes. A BatchOutput gets them in one WriteFiles call, any
+// other Output one WriteFile at a time. It is safe for concurrent use.
+type writeBatch struct {
+	out Output
+
+	mu    sync.Mutex
+	files []OutputFile
+	size  int
+}
+
+// add queues data for name, writing the batch if it is full.
+func (b *writeBatch) add(name string, data []byte) error {
+	b.mu.Lock()
+	b.files = append(b.files, OutputFile{Name: name, Data: data})
+	b.size += len(data)
+	if b.size < maxBatchBytes {
+		b.mu.Unlock()
+		return nil
+	}
+	files := b.take()
+	b.mu.Unlock()
+	return writeFiles(b.out, files)
+}
+
+// flush writes the queued files.
+func (b *writeBatch) flush() error {
+	b.mu.Lock()
+	files := b.take()
+	b.mu.Unlock()
+	return writeFiles(b.out, files)
+}
+
+// take empties the batch, returning its files; b.mu must be held.
+func (b *writeBatch) take() []OutputFile {
+	files := b.files
+	b.files, b.size = nil, 0
+	return files
+}
+
+// writeFiles stores files in out, all at once if it is a BatchOutput.
+func writeFiles(out Output, files []OutputFile) error {
+	if len(files) == 0 {
+		return nil
+	}
+	if bo, ok := out.(BatchOutput); ok {
+		return bo.WriteFiles(files)
+	}
+	for _, f := range files {
+		if err := out.WriteFile(f.Name, f.Data); err != nil {
+			return fmt.Errorf("write %s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package pipeline
+
+import (
+	"errors"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/AnyUserName/tgimg-cli/internal/profile"
+)
+
+// recordingOutput records what is written to it, one WriteFile at a
+// time, and fails writes of fail.
+type recordingOutput struct {
+	mu     sync.Mutex
+	fail   string
+	writes []string // names, in order
+}
+
+func (o *recordingOutput) WriteFile(name string, _ []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if name == o.fail {
+		return errors.New("disk full")
+	}
+	o.writes = append(o.writes, name)
+	return nil
+}
+
+func (o *recordingOutput) Exists(string) (bool, error) { return false, nil }
+func (o *recordingOutput) String() string              { return "recording" }
+
+// recordingBatchOutput is a recordingOutput that also takes batches.
+type recordingBatchOutput struct {
+	recordingOutput
+	batches [][]string // names per WriteFiles call
+}
+
+func (o *recordingBatchOutput) WriteFiles(files []OutputFile) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var names []string
+	for _, f := range files {
+		if f.Name == o.fail {
+			return errors.New("disk full")
+		}
+		names = append(names, f.Name)
+	}
+	o.batches = append(o.batches, names)
+	return nil
+}
+
+func TestWriteBatch(t *testing.T) {
+	names := []string{"a/a.png", "a/a.webp", "a/a.avif"}
+
+	plain := &recordingOutput{}
+	batch := &recordingBatchOutput{}
+	written := func() int { return len(plain.writes) + len(batch.writes) + len(batch.batches) }
+	for _, out := range []Output{plain, batch} {
+		before := written()
+		b := &writeBatch{out: out}
+		for _, name := range names {
+			if err := b.add(name, []byte("x")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if written() != before {
+			t.Fatalf("%T: files written before flush", out)
+		}
+		if err := b.flush(); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.flush(); err != nil { // nothing left to write
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(plain.writes, names) {
+		t.Errorf("Output: WriteFile %v, want %v", plain.writes, names)
+	}
+	if len(batch.writes) != 0 || !reflect.DeepEqual(batch.batches, [][]string{names}) {
+		t.Errorf("BatchOutput: WriteFile %v, WriteFiles %v; want one WriteFiles call with %v", batch.writes, batch.batches, names)
+	}
+}
+
+func TestWriteBatchFlushesWhenFull(t *testing.T) {
+	out := &recordingBatchOutput{}
+	b := &writeBatch{out: out}
+	half := make([]byte, maxBatchBytes/2)
+	for _, step := range []struct {
+		name string
+		want [][]string
+	}{
+		{"a.0", nil}, // under maxBatchBytes: queued
+		{"a.1", [][]string{{"a.0", "a.1"}}},
+		{"a.2", [][]string{{"a.0", "a.1"}}},
+	} {
+		if err := b.add(step.name, half); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out.batches, step.want) {
+			t.Errorf("after %s: WriteFiles %v, want %v", step.name, out.batches, step.want)
+		}
+	}
+	if b.size != maxBatchBytes/2 || len(b.files) != 1 {
+		t.Errorf("queued %d files, %d bytes after the threshold write", len(b.files), b.size)
+	}
+	if err := b.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"a.0", "a.1"}, {"a.2"}}; !reflect.DeepEqual(out.batches, want) {
+		t.Errorf("WriteFiles %v, want %v", out.batches, want)
+	}
+}
+
+func TestWriteBatchError(t *testing.T) {
+	plain := &recordingOutput{fail: "b"}
+	batch := &recordingBatchOutput{recordingOutput: recordingOutput{fail: "b"}}
+	for _, out := range []Output{plain, batch} {
+		b := &writeBatch{out: out}
+		for _, name := range []string{"a", "b", "c"} {
+			if err := b.add(name, []byte("x")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := b.flush(); err == nil || !strings.Contains(err.Error(), "disk full") {
+			t.Errorf("%T: flush error %v, want disk full", out, err)
+		}
+	}
+	if !reflect.DeepEqual(plain.writes, []string{"a"}) {
+		t.Errorf("Output: wrote %v past the failed file", plain.writes)
+	}
+	if len(batch.batches) != 0 {
+		t.Errorf("BatchOutput: recorded %v for a failed batch", batch.batches)
+	}
+}
+
+// TestBuildWritesNothingForFailedSource checks that the variants a source
+// encoded before it failed are never written.
+func TestBuildWritesNothingForFailedSource(t *testing.T) {
+	in := t.TempDir()
+	for name, w := range map[string]int{"small.png": 16, "big.png": 400} {
+		f, err := os.Create(filepath.Join(in, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = png.Encode(f, makeSource(w, w*3/4, false))
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// big's 16 px variant fits the limit and is encoded first; its 400 px
+	// one does not, so the source fails.
+	prof := profile.Get("telegram-webview")
+	prof.Formats = []string{"png"}
+	prof.DPRs = []float64{1}
+	prof.Widths = []int{16, 400}
+	prof.Limits.MaxBytes = 8 << 10
+	out := &recordingBatchOutput{}
+	m, err := New(Config{InputDir: in, OutputDir: t.TempDir(), Profile: prof, Workers: 1, Output: out}).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Errors["big"]; !ok {
+		t.Fatalf("errors %v, want big", m.Errors)
+	}
+	if len(out.writes) != 0 || len(out.batches) != 1 {
+		t.Fatalf("WriteFile %v, WriteFiles %v; want one WriteFiles call for small", out.writes, out.batches)
+	}
+	for _, name := range out.batches[0] {
+		if strings.Contains(name, "big") {
+			t.Errorf("wrote %s of the failed source", name)
+		}
+	}
+}
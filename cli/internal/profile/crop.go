@@ -0,0 +1,132 @@
+package profile
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Box is a fixed output size for crop variants, e.g. 1080×1920 story
+// covers or 200×200 avatars.
+type Box struct {
+	Width  int
+	Height int
+}
+
+// String formats the box as "WxH", the form used in configs and in the
+// manifest's crop.box.
+func (b Box) String() string {
+	return fmt.Sprintf("%dx%d", b.Width, b.Height)
+}
+
+// ParseBox parses "WxH" (also "W×H").
+func ParseBox(s string) (Box, error) {
+	ws, hs, ok := strings.Cut(strings.ReplaceAll(strings.ToLower(s), "×", "x"), "x")
+	if !ok {
+		return Box{}, fmt.Errorf("crop %q: want WxH", s)
+	}
+	w, errW := strconv.Atoi(strings.TrimSpace(ws))
+	h, errH := strconv.Atoi(strings.TrimSpace(hs))
+	if errW != nil || errH != nil || w <= 0 || h <= 0 {
+		return Box{}, fmt.Errorf("crop %q: want positive WxH", s)
+	}
+	return Box{Width: w, Height: h}, nil
+}
+
+// Crop gravities: where a crop sits in the source when the asset has no
+// focal point.
+var gravities = map[string][2]float64{
+	"":             {0.5, 0.5},
+	"center":       {0.5, 0.5},
+	"top":          {0.5, 0},
+	"bottom":       {0.5, 1},
+	"left":         {0, 0.5},
+	"right":        {1, 0.5},
+	"top-left":     {0, 0},
+	"top-right":    {1, 0},
+	"bottom-left":  {0, 1},
+	"bottom-right": {1, 1},
+}
+
+// GravityNames lists the accepted Gravity values.
+var GravityNames = []string{"center", "top", "bottom", "left", "right", "top-left", "top-right", "bottom-left", "bottom-right"}
+
+// ValidateGravity checks a Gravity value; empty means center.
+func ValidateGravity(g string) error {
+	if _, ok := gravities[g]; !ok {
+		return fmt.Errorf("invalid gravity %q: want one of %s", g, strings.Join(GravityNames, ", "))
+	}
+	return nil
+}
+
+// Focus returns the gravity as a focal point in fractions of the source
+// size (0,0 is the top-left corner).
+func (p Profile) Focus() (x, y float64) {
+	f := gravities[p.Gravity]
+	return f[0], f[1]
+}
+
+// CircleSafeMargin is the Margin at which a padded crop's corners touch
+// the box's inscribed circle: (1 − 1/√2) / 2.
+const CircleSafeMargin = 0.1464
+
+// ValidateMargin checks a Margin value.
+func ValidateMargin(m float64) error {
+	if m < 0 || m >= 0.5 || math.IsNaN(m) {
+		return fmt.Errorf("invalid margin %g: want a fraction in [0, 0.5)", m)
+	}
+	return nil
+}
+
+// CropTarget is one crop variant: Box scaled by DPR.
+type CropTarget struct {
+	Box    Box     // the profile box, at 1×
+	DPR    float64 // device pixel ratio
+	Width  int     // output width, Box.Width × DPR
+	Height int     // output height, Box.Height × DPR
+}
+
+// CropTargets returns every crop variant for a source of the given size:
+// each box at each DPR, skipping sizes the source cannot fill without
+// upscaling. Sources narrower than MinWidth get none.
+func (p Profile) CropTargets(originalWidth, originalHeight int) []CropTarget {
+	if p.MinWidth > 0 && originalWidth < p.MinWidth {
+		return nil // below MinWidth only the source-width variant is made
+	}
+	var result []CropTarget
+	for _, b := range p.Crops {
+		for _, d := range p.EffectiveDPRs() {
+			w := int(math.Round(float64(b.Width) * d))
+			h := int(math.Round(float64(b.Height) * d))
+			if w <= 0 || h <= 0 {
+				continue
+			}
+			if rw, rh := FitBox(originalWidth, originalHeight, w, h); rw < w || rh < h {
+				continue // don't upscale
+			}
+			result = append(result, CropTarget{Box: b, DPR: d, Width: w, Height: h})
+		}
+	}
+	return result
+}
+
+// FitBox returns the largest region of a srcW×srcH source with the aspect
+// ratio of w×h: the part of the source a crop to w×h keeps.
+func FitBox(srcW, srcH, w, h int) (int, int) {
+	if srcW*h > srcH*w { // source is wider: full height
+		return ScaleSide(srcH, w, h), srcH
+	}
+	return srcW, ScaleSide(srcW, h, w)
+}
+
+// CropOrigin positions a rw×rh region inside a srcW×srcH source so that it
+// is centered on the focal point (fx, fy), clamped to the source edges.
+func CropOrigin(srcW, srcH, rw, rh int, fx, fy float64) (int, int) {
+	clamp := func(v, hi int) int {
+		return max(0, min(v, hi))
+	}
+	x := int(math.Round(fx*float64(srcW) - float64(rw)/2))
+	y := int(math.Round(fy*float64(srcH) - float64(rh)/2))
+	return clamp(x, srcW-rw), clamp(y, srcH-rh)
+}
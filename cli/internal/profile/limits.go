@@ -0,0 +1,92 @@
+package profile
+
+import "fmt"
+
+// Limits are hard constraints on every variant of a profile, for targets
+// that reject files outside them. A source whose variants cannot meet
+// them fails with an error instead of producing files the target would
+// refuse.
+type Limits struct {
+	// MaxSide caps the longer side of every variant, in pixels. Widths
+	// that would exceed it are clamped like MaxWidth.
+	MaxSide int
+
+	// ExactSide requires the longer side to equal MaxSide, as Telegram
+	// stickers do: each source yields one size, fitted into a
+	// MaxSide×MaxSide square. Sources smaller than that fail.
+	ExactSide bool
+
+	// MaxBytes caps every encoded variant. Lossy formats are re-encoded
+	// at lower quality until they fit, down to MinLimitQuality.
+	MaxBytes int64
+}
+
+// MinLimitQuality is the lowest quality a variant is re-encoded at to
+// meet Limits.MaxBytes.
+const MinLimitQuality = 40
+
+// Set reports whether any limit is set.
+func (l Limits) Set() bool {
+	return l.MaxSide > 0 || l.MaxBytes > 0
+}
+
+// CheckSize checks a w×h variant against MaxSide and ExactSide.
+func (l Limits) CheckSize(w, h int) error {
+	if l.MaxSide <= 0 {
+		return nil
+	}
+	long := max(w, h)
+	if long > l.MaxSide {
+		return fmt.Errorf("%dx%d exceeds the %d px maximum side", w, h, l.MaxSide)
+	}
+	if l.ExactSide && long != l.MaxSide {
+		return fmt.Errorf("%dx%d: longer side must be exactly %d px; the source is too small to reach it without upscaling", w, h, l.MaxSide)
+	}
+	return nil
+}
+
+// CheckBytes checks an encoded variant against MaxBytes.
+func (l Limits) CheckBytes(n int64) error {
+	if l.MaxBytes > 0 && n > l.MaxBytes {
+		return fmt.Errorf("%d bytes exceeds the %d byte limit", n, l.MaxBytes)
+	}
+	return nil
+}
+
+// fitWidth returns the width at which a srcW×srcH source's longer side is
+// MaxSide, or 0 without MaxSide. For ExactSide it rounds, since Height
+// snaps the longer side; otherwise it rounds down so the height stays
+// within MaxSide.
+func (l Limits) fitWidth(srcW, srcH int) int {
+	if l.MaxSide <= 0 || srcW <= 0 || srcH <= 0 {
+		return 0
+	}
+	if srcW >= srcH {
+		return l.MaxSide
+	}
+	if l.ExactSide {
+		return max(1, ScaleSide(l.MaxSide, srcW, srcH))
+	}
+	return max(1, l.MaxSide*srcW/srcH)
+}
+
+// ScaleSide returns n·num/den rounded half up, computed exactly in
+// integers. Every proportional side goes through it: variant heights,
+// widths fitted to a height or MaxSide, and crop regions. A frontend that
+// lays out width / aspect_ratio and rounds gets the same number.
+func ScaleSide(n, num, den int) int {
+	if den <= 0 {
+		return 0
+	}
+	return int((2*int64(n)*int64(num) + int64(den)) / (2 * int64(den)))
+}
+
+// Height returns the height of a proportional variant of width w for a
+// srcW×srcH source. With ExactSide, a portrait source's fitted width gets
+// exactly MaxSide, which proportional rounding could miss by a pixel.
+func (p Profile) Height(srcW, srcH, w int) int {
+	if p.Limits.ExactSide && srcH > srcW && w == p.Limits.fitWidth(srcW, srcH) {
+		return p.Limits.MaxSide
+	}
+	return max(1, ScaleSide(w, srcH, srcW))
+}
@@ -0,0 +1,110 @@
+package profile
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Lint severities. Errors make the profile unusable; warnings flag
+// settings that work but are probably not what was meant.
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// MaxLintVariants is the number of variants per source above which Lint
+// warns that the profile's widths, DPRs and formats multiply out of hand.
+const MaxLintVariants = 40
+
+// Issue is one problem found by Lint.
+type Issue struct {
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// Lint checks the profile for errors and suspicious settings: duplicate
+// or unsorted widths, unknown or repeated formats, quality out of range
+// and DPR lists that multiply into too many variants per source.
+func (p Profile) Lint() []Issue {
+	var issues []Issue
+	add := func(severity, format string, args ...any) {
+		issues = append(issues, Issue{Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if err := p.Validate(); err != nil {
+		add(LintError, "%v", err)
+	}
+
+	if d := duplicates(p.Widths); len(d) > 0 {
+		add(LintWarning, "widths listed more than once: %v", d)
+	}
+	if !slices.IsSorted(p.Widths) {
+		add(LintWarning, "widths %v are not in ascending order", p.Widths)
+	}
+	if d := duplicates(p.Heights); len(d) > 0 {
+		add(LintWarning, "heights listed more than once: %v", d)
+	}
+	if d := duplicates(p.Formats); len(d) > 0 {
+		add(LintWarning, "formats listed more than once: %v", d)
+	}
+	if d := duplicates(p.DPRs); len(d) > 0 {
+		add(LintWarning, "dprs listed more than once: %v", d)
+	}
+	if !slices.IsSorted(p.DPRs) {
+		add(LintWarning, "dprs %v are not in ascending order", p.DPRs)
+	}
+	if p.MaxWidth > 0 {
+		for _, w := range p.Widths {
+			if w > p.MaxWidth {
+				add(LintWarning, "width %d is above max width %d and is clamped to it", w, p.MaxWidth)
+			}
+		}
+	}
+
+	if len(p.Formats) > 0 && len(p.FormatsFor(p.Formats, 1)) == 0 {
+		add(LintWarning, "format_min_widths covers every format; the narrowest variants get none")
+	}
+	for _, f := range Formats {
+		if _, ok := p.FormatMinWidths[f]; ok && !slices.Contains(p.Formats, f) {
+			add(LintWarning, "format_min_widths names %s, which the profile does not generate", f)
+		}
+	}
+	if p.MinWidth > 0 && p.MaxWidth > 0 && p.MinWidth > p.MaxWidth {
+		add(LintWarning, "min width %d is above max width %d", p.MinWidth, p.MaxWidth)
+	}
+	if n := p.MaxVariants(); n > MaxLintVariants {
+		add(LintWarning, "up to %d variants per source (%d sizes × %d formats); drop some widths, dprs or formats",
+			n, n/max(len(p.Formats), 1), len(p.Formats))
+	}
+	return issues
+}
+
+// MaxVariants returns the number of variants the profile generates for a
+// source large enough to need no upscaling limits.
+func (p Profile) MaxVariants() int {
+	const huge = math.MaxInt32 / MaxDPR
+	sizes := len(p.EffectiveWidths(huge, huge))
+	seen := map[Box]bool{}
+	for _, b := range p.Crops {
+		for _, d := range p.EffectiveDPRs() {
+			seen[Box{Width: int(math.Round(float64(b.Width) * d)), Height: int(math.Round(float64(b.Height) * d))}] = true
+		}
+	}
+	sizes += len(seen)
+	return sizes * len(p.Formats)
+}
+
+// duplicates returns the values that occur more than once in xs, in order
+// of their second occurrence.
+func duplicates[T comparable](xs []T) []T {
+	seen := map[T]int{}
+	var dups []T
+	for _, x := range xs {
+		seen[x]++
+		if seen[x] == 2 {
+			dups = append(dups, x)
+		}
+	}
+	return dups
+}
@@ -0,0 +1,99 @@
+package profile
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/AnyUserName/tgimg-cli/internal/encoder"
+)
+
+// Override changes some settings of a profile for a subset of sources,
+// e.g. PNG-only small widths for icons/**. Zero fields keep the
+// profile's value.
+type Override struct {
+	Base        string // start from this registered profile instead
+	Widths      []int
+	Formats     []string
+	Quality     int
+	DPRs        []float64
+	Descriptor  string
+	MaxWidth    int
+	MinWidth    int
+	Heights     []int
+	Crops       []Box
+	Gravity     string
+	Margin      float64
+	Breakpoints map[string]int
+
+	FormatMinWidths map[string]int
+	Effort          encoder.Effort
+}
+
+// Apply returns p with the override's settings merged in. Breakpoints
+// naming widths the override dropped are dropped too.
+func (o Override) Apply(p Profile) (Profile, error) {
+	if o.Base != "" {
+		base, ok := Lookup(o.Base)
+		if !ok {
+			return p, fmt.Errorf("unknown profile %q", o.Base)
+		}
+		p = base
+	}
+	if o.Widths != nil {
+		p = p.WithWidths(o.Widths)
+	}
+	if o.Formats != nil {
+		p.Formats = o.Formats
+	}
+	if o.Quality > 0 {
+		p.Quality = o.Quality
+	}
+	if o.DPRs != nil {
+		p.DPRs = o.DPRs
+	}
+	if o.Descriptor != "" {
+		p.Descriptor = o.Descriptor
+	}
+	if o.MaxWidth > 0 {
+		p.MaxWidth = o.MaxWidth
+	}
+	if o.MinWidth > 0 {
+		p.MinWidth = o.MinWidth
+	}
+	if o.Heights != nil {
+		p.Heights = o.Heights
+	}
+	if o.Crops != nil {
+		p.Crops = o.Crops
+	}
+	if o.Gravity != "" {
+		p.Gravity = o.Gravity
+	}
+	if o.Margin > 0 {
+		p.Margin = o.Margin
+	}
+	if o.Breakpoints != nil {
+		p.Breakpoints = o.Breakpoints
+	}
+	if o.FormatMinWidths != nil {
+		p.FormatMinWidths = o.FormatMinWidths
+	}
+	if o.Effort != "" {
+		p.Effort = o.Effort
+	}
+	return p, p.Validate()
+}
+
+// WithWidths returns p with its widths replaced, dropping the breakpoints
+// that named a width no longer in the list.
+func (p Profile) WithWidths(widths []int) Profile {
+	p.Widths = widths
+	kept := map[string]int{}
+	for name, w := range p.Breakpoints {
+		if slices.Contains(widths, w) {
+			kept[name] = w
+		}
+	}
+	p.Breakpoints = kept
+	return p
+}
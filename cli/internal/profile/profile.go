@@ -1,14 +1,86 @@
 package profile
 
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/AnyUserName/tgimg-cli/internal/encoder"
+)
+
+// Srcset descriptor kinds.
+const (
+	DescriptorWidth   = "w" // "480w, 960w" — fluid images sized by the container
+	DescriptorDensity = "x" // "1x, 2x" — fixed-size UI elements (avatars, buttons)
+)
+
 // Profile defines image processing parameters for a target platform.
 type Profile struct {
 	Name    string
 	Widths  []int    // target widths for resize
 	Formats []string // output formats in priority order
 	Quality int      // encoding quality 1-100
-	Retina  bool     // generate 2x variants for retina
+
+	// DPRs lists the device pixel ratios generated for every width:
+	// [1, 2] adds 2× widths for retina screens, [1, 2, 3] also covers
+	// 3× Android devices. Empty means [1].
+	DPRs []float64
+
+	// Descriptor selects width ("w", default) or density ("x") srcset
+	// descriptors. With "x", Widths[0] is the 1x size and every variant
+	// records its density relative to it.
+	Descriptor string
+
+	// MaxWidth clamps every generated width, high-DPR ones included.
+	// 0 means no cap.
+	MaxWidth int
+
+	// MinWidth is the source width below which only one variant, at the
+	// source's own width, is generated: small icons swept up with the
+	// rest don't get a ladder of near-identical sizes. 0 means no
+	// threshold.
+	MinWidth int
+
+	// Heights adds proportional variants of these heights, for slots
+	// sized by height rather than width.
+	Heights []int
+
+	// Crops adds variants cut to exactly these sizes, for fixed-dimension
+	// UI slots like story covers. The crop is centered on the asset's
+	// focal point, or placed by Gravity when it has none.
+	Crops   []Box
+	Gravity string // "center" (default), "top", "bottom-right", ...
+
+	// Margin pads crop variants: the crop is scaled to (1 − 2·Margin) of
+	// the box and centered on its average color. CircleSafeMargin fits
+	// the whole crop inside the box's inscribed circle, for avatars
+	// shown round.
+	Margin float64
+
+	// Breakpoints names some of Widths ("md" → 640). Variants at those
+	// widths carry the name in the manifest, so frontends can ask for
+	// "hero@md" instead of a pixel width that may change per profile.
+	Breakpoints map[string]int
+
+	// FormatMinWidths skips a format for variants narrower than its
+	// entry, e.g. {"avif": 200} where AVIF's container overhead loses to
+	// WebP on small images. The other formats still cover those widths.
+	FormatMinWidths map[string]int
+
+	// Limits are hard constraints every variant must meet; see Limits.
+	Limits Limits
+
+	// Effort trades encoding time for file size without touching
+	// quality: "fast" for dev builds, "max" for release. Empty means
+	// balanced.
+	Effort encoder.Effort
 }
 
+// Formats lists the output formats a profile may name.
+var Formats = []string{"avif", "webp", "jpeg", "png"}
+
 // Built-in profiles.
 var profiles = map[string]Profile{
 	"telegram-webview": {
@@ -16,24 +88,157 @@ var profiles = map[string]Profile{
 		Widths:  []int{320, 640, 960, 1280},
 		Formats: []string{"webp", "jpeg"}, // avif added when encoder available
 		Quality: 82,
-		Retina:  true,
+		DPRs:    []float64{1, 2},
+		Breakpoints: map[string]int{
+			"sm": 320, "md": 640, "lg": 960, "xl": 1280,
+		},
 	},
 	"telegram-webview-hq": {
 		Name:    "telegram-webview-hq",
 		Widths:  []int{320, 640, 960, 1280, 1920},
 		Formats: []string{"avif", "webp", "jpeg"},
 		Quality: 85,
-		Retina:  true,
+		DPRs:    []float64{1, 2},
+		Breakpoints: map[string]int{
+			"sm": 320, "md": 640, "lg": 960, "xl": 1280, "2xl": 1920,
+		},
+	},
+	// telegram-sticker meets Telegram's static sticker rules: WebP or
+	// PNG, one side exactly 512 px and the other at most 512, at most
+	// 512 KB.
+	"telegram-sticker": {
+		Name:    "telegram-sticker",
+		Widths:  []int{512},
+		Formats: []string{"webp", "png"},
+		Quality: 90,
+		Limits:  Limits{MaxSide: 512, ExactSide: true, MaxBytes: 512 << 10},
+	},
+	// og-image renders link-preview cards: the 1200×630 size Open Graph
+	// and Twitter cards expect, plus a 600×315 half size. Previews are
+	// shown small and recompressed by most crawlers, so quality is lower
+	// than for in-app images.
+	"og-image": {
+		Name:    "og-image",
+		Formats: []string{"jpeg", "webp"},
+		Quality: 80,
+		Crops:   []Box{{Width: 1200, Height: 630}, {Width: 600, Height: 315}},
+	},
+	// avatar renders 64 to 512 px square crops, covering 32 to 256 CSS
+	// px avatar slots at 2×. Set Margin (circle_safe in configs) when the UI
+	// masks them to a circle.
+	"avatar": {
+		Name:    "avatar",
+		Formats: []string{"webp", "jpeg"},
+		Quality: 82,
+		Crops:   []Box{{Width: 64, Height: 64}, {Width: 128, Height: 128}, {Width: 256, Height: 256}, {Width: 512, Height: 512}},
 	},
 	"minimal": {
 		Name:    "minimal",
 		Widths:  []int{320, 640},
 		Formats: []string{"webp", "jpeg"},
 		Quality: 78,
-		Retina:  false,
+		Breakpoints: map[string]int{
+			"sm": 320, "md": 640,
+		},
 	},
 }
 
+// builtin records the names of the built-in profiles, so user-defined
+// profiles that replace one can be told apart.
+var builtin = func() map[string]bool {
+	names := make(map[string]bool, len(profiles))
+	for name := range profiles {
+		names[name] = true
+	}
+	return names
+}()
+
+// Validate checks the profile's settings.
+func (p Profile) Validate() error {
+	if len(p.Widths) == 0 && len(p.Heights) == 0 && len(p.Crops) == 0 {
+		return fmt.Errorf("no widths, heights or crops")
+	}
+	for _, w := range p.Widths {
+		if w <= 0 {
+			return fmt.Errorf("invalid width %d", w)
+		}
+	}
+	if p.MinWidth < 0 {
+		return fmt.Errorf("min width %d must not be negative", p.MinWidth)
+	}
+	if len(p.Formats) == 0 {
+		return fmt.Errorf("no formats")
+	}
+	for _, f := range p.Formats {
+		if !slices.Contains(Formats, f) {
+			return fmt.Errorf("invalid format %q: want avif, webp, jpeg or png", f)
+		}
+	}
+	if p.Quality < 0 || p.Quality > 100 {
+		return fmt.Errorf("quality %d out of range 1-100", p.Quality)
+	}
+	if _, err := encoder.ParseEffort(string(p.Effort)); err != nil {
+		return err
+	}
+	if err := ValidateDPRs(p.DPRs); err != nil {
+		return err
+	}
+	for _, h := range p.Heights {
+		if h <= 0 {
+			return fmt.Errorf("invalid height %d", h)
+		}
+	}
+	for _, b := range p.Crops {
+		if b.Width <= 0 || b.Height <= 0 {
+			return fmt.Errorf("invalid crop %s", b)
+		}
+	}
+	if err := ValidateGravity(p.Gravity); err != nil {
+		return err
+	}
+	if err := ValidateMargin(p.Margin); err != nil {
+		return err
+	}
+	if err := ValidateFormatMinWidths(p.FormatMinWidths); err != nil {
+		return err
+	}
+	return ValidateBreakpoints(p.Breakpoints, p.Widths)
+}
+
+// Register adds a user-defined profile, replacing any profile of the same
+// name. It is not safe for concurrent use; register profiles at startup.
+func Register(p Profile) error {
+	if p.Name == "" {
+		return fmt.Errorf("profile has no name")
+	}
+	if err := p.Validate(); err != nil {
+		return fmt.Errorf("profile %q: %w", p.Name, err)
+	}
+	profiles[p.Name] = p
+	return nil
+}
+
+// Lookup returns the profile registered under name.
+func Lookup(name string) (Profile, bool) {
+	p, ok := profiles[name]
+	return p, ok
+}
+
+// IsBuiltin reports whether name is a built-in profile name.
+func IsBuiltin(name string) bool {
+	return builtin[name]
+}
+
+// Names returns every registered profile name, sorted.
+func Names() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Get returns a profile by name. Falls back to telegram-webview if unknown.
 func Get(name string) Profile {
 	if p, ok := profiles[name]; ok {
@@ -44,33 +249,195 @@ func Get(name string) Profile {
 	return p
 }
 
-// EffectiveWidths returns all widths including retina variants.
-func (p Profile) EffectiveWidths(originalWidth int) []int {
+// MaxDPR is the largest device pixel ratio a profile may request.
+const MaxDPR = 4
+
+// ValidateDPRs checks a device pixel ratio list.
+func ValidateDPRs(dprs []float64) error {
+	for _, d := range dprs {
+		if d <= 0 || d > MaxDPR || math.IsNaN(d) {
+			return fmt.Errorf("invalid DPR %g: want a ratio in (0, %d]", d, MaxDPR)
+		}
+	}
+	return nil
+}
+
+// ValidateFormatMinWidths checks per-format minimum widths.
+func ValidateFormatMinWidths(m map[string]int) error {
+	for f, w := range m {
+		if !slices.Contains(Formats, f) {
+			return fmt.Errorf("format_min_widths: invalid format %q: want avif, webp, jpeg or png", f)
+		}
+		if w < 0 {
+			return fmt.Errorf("format_min_widths: %s width %d must not be negative", f, w)
+		}
+	}
+	return nil
+}
+
+// FormatsFor returns the formats, in order, to encode a variant of width
+// w in: formats minus those whose FormatMinWidths entry is above w.
+func (p Profile) FormatsFor(formats []string, w int) []string {
+	if len(p.FormatMinWidths) == 0 {
+		return formats
+	}
+	out := make([]string, 0, len(formats))
+	for _, f := range formats {
+		if w >= p.FormatMinWidths[f] {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// EffectiveDPRs returns the profile's device pixel ratios, [1] if unset.
+func (p Profile) EffectiveDPRs() []float64 {
+	if len(p.DPRs) == 0 {
+		return []float64{1}
+	}
+	return p.DPRs
+}
+
+// HighDPR reports whether the profile generates widths above 1×.
+func (p Profile) HighDPR() bool {
+	for _, d := range p.DPRs {
+		if d > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveWidths returns every proportional width to generate for a
+// source of the given size: each profile width at each DPR, plus the
+// widths matching each profile height, without upscaling.
+func (p Profile) EffectiveWidths(originalWidth, originalHeight int) []int {
 	seen := map[int]bool{}
 	var result []int
 
+	// Clamp like MaxWidth to the width that fits Limits.MaxSide.
+	maxWidth := p.MaxWidth
+	if fw := p.Limits.fitWidth(originalWidth, originalHeight); fw > 0 && (maxWidth == 0 || fw < maxWidth) {
+		maxWidth = fw
+	}
+
+	if p.MinWidth > 0 && originalWidth > 0 && originalWidth < p.MinWidth {
+		if maxWidth > 0 && originalWidth > maxWidth {
+			return []int{maxWidth}
+		}
+		return []int{originalWidth}
+	}
+
 	for _, w := range p.Widths {
+		if maxWidth > 0 && w > maxWidth {
+			w = maxWidth
+		}
 		if w > originalWidth {
 			continue // don't upscale
 		}
-		if !seen[w] {
-			seen[w] = true
-			result = append(result, w)
+		for _, d := range p.EffectiveDPRs() {
+			dw := int(math.Round(float64(w) * d))
+			if d > 1 && maxWidth > 0 && dw > maxWidth {
+				continue
+			}
+			if dw <= 0 || dw > originalWidth || seen[dw] {
+				continue
+			}
+			seen[dw] = true
+			result = append(result, dw)
 		}
-		if p.Retina {
-			w2 := w * 2
-			if w2 <= originalWidth && !seen[w2] {
-				seen[w2] = true
-				result = append(result, w2)
+	}
+
+	for _, h := range p.Heights {
+		if originalHeight <= 0 {
+			break
+		}
+		for _, d := range p.EffectiveDPRs() {
+			dh := int(math.Round(float64(h) * d))
+			if dh > originalHeight {
+				continue // don't upscale
+			}
+			dw := ScaleSide(dh, originalWidth, originalHeight)
+			if maxWidth > 0 && dw > maxWidth || dw <= 0 || seen[dw] {
+				continue
 			}
+			seen[dw] = true
+			result = append(result, dw)
 		}
 	}
 
 	// Always include original width if not already present
 	// (for cases where original is smaller than smallest target).
-	if len(result) == 0 && originalWidth > 0 {
-		result = append(result, originalWidth)
+	// Crop-only profiles want their crops and nothing else.
+	if len(result) == 0 && originalWidth > 0 && (len(p.Widths) > 0 || len(p.Heights) > 0) {
+		w := originalWidth
+		if maxWidth > 0 && w > maxWidth {
+			w = maxWidth
+		}
+		result = append(result, w)
 	}
 
 	return result
 }
+
+// ValidateBreakpoints checks breakpoint names and that each names one of
+// widths.
+func ValidateBreakpoints(breakpoints map[string]int, widths []int) error {
+	for _, name := range BreakpointNames(breakpoints) {
+		w := breakpoints[name]
+		if name == "" || strings.ContainsAny(name, "@/ ") {
+			return fmt.Errorf("invalid breakpoint name %q", name)
+		}
+		if !slices.Contains(widths, w) {
+			return fmt.Errorf("breakpoint %s: width %d is not one of the profile widths", name, w)
+		}
+	}
+	return nil
+}
+
+// BreakpointNames returns the breakpoint names ordered by width, then name.
+func BreakpointNames(breakpoints map[string]int) []string {
+	names := make([]string, 0, len(breakpoints))
+	for name := range breakpoints {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		wi, wj := breakpoints[names[i]], breakpoints[names[j]]
+		if wi != wj {
+			return wi < wj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// Breakpoint returns the name of the breakpoint whose 1× variant has
+// width w, or "". Breakpoints above MaxWidth are clamped like their
+// widths; when several land on w, the narrowest wins.
+func (p Profile) Breakpoint(w int) string {
+	for _, name := range BreakpointNames(p.Breakpoints) {
+		bw := p.Breakpoints[name]
+		if p.MaxWidth > 0 && bw > p.MaxWidth {
+			bw = p.MaxWidth
+		}
+		if bw == w {
+			return name
+		}
+	}
+	return ""
+}
+
+// UsesDensity reports whether the profile emits density descriptors.
+func (p Profile) UsesDensity() bool {
+	return p.Descriptor == DescriptorDensity
+}
+
+// Density returns the pixel density of a variant of width w relative to
+// the profile's 1x width (Widths[0]), rounded to two decimals. It returns
+// 0 for width-descriptor profiles.
+func (p Profile) Density(w int) float64 {
+	if !p.UsesDensity() || len(p.Widths) == 0 || p.Widths[0] <= 0 {
+		return 0
+	}
+	return math.Round(float64(w)/float64(p.Widths[0])*100) / 100
+}
@@ -0,0 +1,373 @@
+package profile
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/AnyUserName/tgimg-cli/internal/encoder"
+)
+
+func TestEffectiveWidthsMaxWidth(t *testing.T) {
+	p := Get("telegram-webview") // 320, 640, 960, 1280 at 1× and 2×
+	p.MaxWidth = 960
+
+	got := p.EffectiveWidths(4000, 3000)
+	want := []int{320, 640, 960}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EffectiveWidths(4000) = %v, want %v", got, want)
+	}
+
+	// A source narrower than every width still gets one variant, capped.
+	p.Widths = []int{2000}
+	p.DPRs = nil
+	if got := p.EffectiveWidths(1500, 1000); !reflect.DeepEqual(got, []int{960}) {
+		t.Errorf("EffectiveWidths(1500) = %v, want [960]", got)
+	}
+}
+
+func TestEffectiveWidthsDPRs(t *testing.T) {
+	p := Profile{Widths: []int{320, 640}, DPRs: []float64{1, 1.5, 3}}
+
+	got := p.EffectiveWidths(4000, 3000)
+	want := []int{320, 480, 960, 640, 1920}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EffectiveWidths(4000) = %v, want %v", got, want)
+	}
+
+	// High-DPR widths never upscale the source.
+	if got := p.EffectiveWidths(1000, 1000); !reflect.DeepEqual(got, []int{320, 480, 960, 640}) {
+		t.Errorf("EffectiveWidths(1000) = %v, want [320 480 960 640]", got)
+	}
+}
+
+func TestValidateDPRs(t *testing.T) {
+	if err := ValidateDPRs([]float64{1, 1.5, 2, 3}); err != nil {
+		t.Errorf("ValidateDPRs: %v", err)
+	}
+	for _, bad := range [][]float64{{0}, {-1}, {5}} {
+		if err := ValidateDPRs(bad); err == nil {
+			t.Errorf("ValidateDPRs(%v) = nil, want error", bad)
+		}
+	}
+}
+
+func TestEffectiveWidthsHeights(t *testing.T) {
+	p := Profile{Widths: []int{320}, Heights: []int{100, 400}, DPRs: []float64{1, 2}}
+
+	// 2:1 source: height 100 is width 200, 2× is 400; height 400 is 800.
+	got := p.EffectiveWidths(1200, 600)
+	want := []int{320, 640, 200, 400, 800}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EffectiveWidths(1200, 600) = %v, want %v", got, want)
+	}
+}
+
+func TestCropTargets(t *testing.T) {
+	p := Profile{Crops: []Box{{200, 200}, {1080, 1920}}, DPRs: []float64{1, 2}}
+
+	// A 1600×900 source fills 200×200 and 400×400 but no story cover.
+	got := p.CropTargets(1600, 900)
+	want := []CropTarget{
+		{Box: Box{200, 200}, DPR: 1, Width: 200, Height: 200},
+		{Box: Box{200, 200}, DPR: 2, Width: 400, Height: 400},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CropTargets(1600, 900) = %v, want %v", got, want)
+	}
+}
+
+func TestCropGeometry(t *testing.T) {
+	if w, h := FitBox(1600, 900, 200, 200); w != 900 || h != 900 {
+		t.Errorf("FitBox square of 1600×900 = %dx%d, want 900x900", w, h)
+	}
+	if w, h := FitBox(1000, 1000, 1080, 1920); w != 563 || h != 1000 {
+		t.Errorf("FitBox 9:16 of 1000×1000 = %dx%d, want 563x1000", w, h)
+	}
+
+	cases := []struct {
+		fx, fy float64
+		x, y   int
+	}{
+		{0.5, 0.5, 350, 0}, // centered
+		{0, 0, 0, 0},       // clamped to the left edge
+		{1, 1, 700, 0},     // clamped to the right edge
+		{0.7, 0.5, 670, 0}, // around the focal point
+	}
+	for _, c := range cases {
+		if x, y := CropOrigin(1600, 900, 900, 900, c.fx, c.fy); x != c.x || y != c.y {
+			t.Errorf("CropOrigin(focus %g,%g) = %d,%d, want %d,%d", c.fx, c.fy, x, y, c.x, c.y)
+		}
+	}
+}
+
+func TestParseBox(t *testing.T) {
+	if b, err := ParseBox("1080×1920"); err != nil || b != (Box{1080, 1920}) {
+		t.Errorf("ParseBox(1080×1920) = %v, %v", b, err)
+	}
+	for _, bad := range []string{"1080", "0x10", "axb"} {
+		if _, err := ParseBox(bad); err == nil {
+			t.Errorf("ParseBox(%q) = nil error", bad)
+		}
+	}
+}
+
+func TestBreakpoint(t *testing.T) {
+	p := Profile{
+		Widths:      []int{320, 640, 960},
+		DPRs:        []float64{1, 2},
+		MaxWidth:    800,
+		Breakpoints: map[string]int{"sm": 320, "md": 640, "lg": 960},
+	}
+	// lg is clamped to 800; 1280 (md at 2×) has no name.
+	for w, want := range map[int]string{320: "sm", 640: "md", 800: "lg", 1280: "", 500: ""} {
+		if got := p.Breakpoint(w); got != want {
+			t.Errorf("Breakpoint(%d) = %q, want %q", w, got, want)
+		}
+	}
+}
+
+func TestValidateBreakpoints(t *testing.T) {
+	widths := []int{320, 640}
+	if err := ValidateBreakpoints(map[string]int{"sm": 320, "md": 640}, widths); err != nil {
+		t.Errorf("valid breakpoints: %v", err)
+	}
+	for _, bad := range []map[string]int{{"lg": 960}, {"m@d": 640}, {"": 320}} {
+		if err := ValidateBreakpoints(bad, widths); err == nil {
+			t.Errorf("ValidateBreakpoints(%v) = nil, want error", bad)
+		}
+	}
+}
+
+func TestOverrideApply(t *testing.T) {
+	base := Get("telegram-webview")
+	got, err := Override{Widths: []int{64, 640}, Formats: []string{"png"}}.Apply(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Widths, []int{64, 640}) || !reflect.DeepEqual(got.Formats, []string{"png"}) {
+		t.Errorf("widths/formats = %v/%v", got.Widths, got.Formats)
+	}
+	if got.Quality != base.Quality || !reflect.DeepEqual(got.DPRs, base.DPRs) {
+		t.Errorf("unset fields changed: quality %d, dprs %v", got.Quality, got.DPRs)
+	}
+	// Only the breakpoint naming a kept width survives.
+	if !reflect.DeepEqual(got.Breakpoints, map[string]int{"md": 640}) {
+		t.Errorf("breakpoints = %v", got.Breakpoints)
+	}
+
+	if _, err := (Override{Base: "no-such-profile"}).Apply(base); err == nil {
+		t.Error("unknown base profile: want error")
+	}
+	if _, err := (Override{Breakpoints: map[string]int{"xs": 10}}).Apply(base); err == nil {
+		t.Error("breakpoint outside widths: want error")
+	}
+}
+
+func TestLint(t *testing.T) {
+	for name := range builtin {
+		if issues := Get(name).Lint(); len(issues) > 0 {
+			t.Errorf("%s: unexpected issues %v", name, issues)
+		}
+	}
+
+	p := Profile{
+		Widths:  []int{640, 320, 640},
+		Formats: []string{"webp", "gif"},
+		Quality: 120,
+		DPRs:    []float64{1, 2},
+	}
+	var errs, warnings int
+	for _, issue := range p.Lint() {
+		switch issue.Severity {
+		case LintError:
+			errs++
+		case LintWarning:
+			warnings++
+		}
+	}
+	// Validate reports the first error only; the widths are both
+	// duplicated and unsorted.
+	if errs != 1 || warnings != 2 {
+		t.Errorf("got %d errors, %d warnings, want 1 and 2: %v", errs, warnings, p.Lint())
+	}
+
+	wide := Profile{
+		Widths:  []int{160, 320, 480, 640, 800, 960, 1120, 1280},
+		Formats: Formats,
+		DPRs:    []float64{1, 1.5, 2, 3},
+	}
+	if n := wide.MaxVariants(); n <= MaxLintVariants {
+		t.Fatalf("MaxVariants = %d, want above %d", n, MaxLintVariants)
+	}
+	if issues := wide.Lint(); len(issues) != 1 || issues[0].Severity != LintWarning {
+		t.Errorf("variant explosion: got %v, want one warning", issues)
+	}
+}
+
+func TestStickerLimits(t *testing.T) {
+	p := Get("telegram-sticker")
+	for _, tc := range []struct {
+		srcW, srcH int
+		w, h       int
+	}{
+		{1000, 800, 512, 410}, // landscape: width is the longer side; 409.6 rounds up
+		{600, 1000, 307, 512}, // portrait: clamped to the fitting width
+		{333, 1000, 170, 512}, // rounding would give 511; snapped to 512
+		{512, 512, 512, 512},
+	} {
+		widths := p.EffectiveWidths(tc.srcW, tc.srcH)
+		if len(widths) != 1 || widths[0] != tc.w {
+			t.Errorf("%dx%d: widths %v, want [%d]", tc.srcW, tc.srcH, widths, tc.w)
+			continue
+		}
+		if h := p.Height(tc.srcW, tc.srcH, tc.w); h != tc.h {
+			t.Errorf("%dx%d: height %d, want %d", tc.srcW, tc.srcH, h, tc.h)
+		}
+		if err := p.Limits.CheckSize(tc.w, tc.h); err != nil {
+			t.Errorf("%dx%d: %v", tc.srcW, tc.srcH, err)
+		}
+	}
+
+	// Too small to reach 512 without upscaling.
+	w := p.EffectiveWidths(300, 200)[0]
+	if err := p.Limits.CheckSize(w, p.Height(300, 200, w)); err == nil {
+		t.Error("300x200 source: want error")
+	}
+	if err := p.Limits.CheckBytes(512<<10 + 1); err == nil {
+		t.Error("over MaxBytes: want error")
+	}
+}
+
+func TestOGImageCrops(t *testing.T) {
+	p := Get("og-image")
+	var got []Box
+	for _, c := range p.CropTargets(2400, 1600) {
+		got = append(got, Box{c.Width, c.Height})
+	}
+	want := []Box{{1200, 630}, {600, 315}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("crops = %v, want %v", got, want)
+	}
+	if widths := p.EffectiveWidths(2400, 1600); len(widths) > 0 {
+		t.Errorf("crop-only profile: widths %v, want none", widths)
+	}
+	if got := p.CropTargets(1000, 600); len(got) != 1 || got[0].Box != want[1] {
+		t.Errorf("small source: crops = %v, want only the half size", got)
+	}
+}
+
+func TestAvatarMargin(t *testing.T) {
+	p := Get("avatar")
+	if got := p.CropTargets(600, 400); len(got) != 3 || got[2].Width != 256 {
+		t.Errorf("600x400 source: crops = %v, want 64x64 up to 256x256", got)
+	}
+	if got := p.CropTargets(1000, 1000); len(got) != 4 {
+		t.Errorf("1000x1000 source: %d crops, want 4", len(got))
+	}
+
+	// At the circle-safe margin the padded square's corners lie on the
+	// inscribed circle: half-diagonal of the inner square = radius.
+	inner := 1 - 2*CircleSafeMargin
+	if d := inner * math.Sqrt2; math.Abs(d-1) > 1e-3 {
+		t.Errorf("inner diagonal = %.4f of the box, want 1", d)
+	}
+	for _, m := range []float64{-0.1, 0.5, math.NaN()} {
+		if ValidateMargin(m) == nil {
+			t.Errorf("ValidateMargin(%g): want error", m)
+		}
+	}
+	o, err := Override{Margin: CircleSafeMargin}.Apply(p)
+	if err != nil || o.Margin != CircleSafeMargin {
+		t.Errorf("override margin: %v, %v", o.Margin, err)
+	}
+}
+
+func TestMinWidth(t *testing.T) {
+	p := Profile{Widths: []int{16, 32, 64, 128}, Formats: []string{"png"}, DPRs: []float64{1, 2}, MinWidth: 100}
+	if got := p.EffectiveWidths(48, 48); !reflect.DeepEqual(got, []int{48}) {
+		t.Errorf("48px source: widths %v, want [48]", got)
+	}
+	if got := p.EffectiveWidths(300, 300); !reflect.DeepEqual(got, []int{16, 32, 64, 128, 256}) {
+		t.Errorf("300px source: widths %v, want the full ladder", got)
+	}
+	p.Crops = []Box{{Width: 32, Height: 32}}
+	if got := p.CropTargets(48, 48); len(got) > 0 {
+		t.Errorf("48px source: crops %v, want none", got)
+	}
+}
+
+func TestFormatMinWidths(t *testing.T) {
+	p := Profile{Widths: []int{100, 400}, Formats: []string{"avif", "webp"}, DPRs: []float64{1},
+		FormatMinWidths: map[string]int{"avif": 200}}
+	if got := p.FormatsFor(p.Formats, 100); !reflect.DeepEqual(got, []string{"webp"}) {
+		t.Errorf("100px: formats %v, want [webp]", got)
+	}
+	if got := p.FormatsFor(p.Formats, 400); !reflect.DeepEqual(got, []string{"avif", "webp"}) {
+		t.Errorf("400px: formats %v, want both", got)
+	}
+	if err := ValidateFormatMinWidths(map[string]int{"gif": 100}); err == nil {
+		t.Error("unknown format: want error")
+	}
+	if err := ValidateFormatMinWidths(map[string]int{"avif": -1}); err == nil {
+		t.Error("negative width: want error")
+	}
+
+	p.FormatMinWidths = map[string]int{"avif": 200, "webp": 200, "png": 100}
+	var warnings int
+	for _, is := range p.Lint() {
+		if is.Severity == LintWarning {
+			warnings++
+		}
+	}
+	if warnings != 2 {
+		t.Errorf("lint: %d warnings, want 2 (every format covered, png not generated): %v", warnings, p.Lint())
+	}
+}
+
+func TestEffort(t *testing.T) {
+	p := Get("telegram-webview")
+	p.Effort = "slow"
+	if p.Validate() == nil {
+		t.Error("effort \"slow\": want error")
+	}
+	o, err := Override{Effort: encoder.EffortFast}.Apply(Get("telegram-webview"))
+	if err != nil || o.Effort != encoder.EffortFast {
+		t.Errorf("override effort: %q, %v", o.Effort, err)
+	}
+	if got := encoder.EffectiveEffort(""); got != encoder.EffortBalanced {
+		t.Errorf("default effort = %q, want balanced", got)
+	}
+}
+
+func TestScaleSide(t *testing.T) {
+	for _, tc := range []struct{ n, num, den, want int }{
+		{640, 801, 1000, 513}, // 512.64: truncation gave 512
+		{3, 1, 2, 2},          // ties round up
+		{5, 1, 2, 3},
+		{320, 667, 1001, 213},
+		{1 << 20, 1 << 20, 3, 366503875925}, // no float or int32 overflow
+		{10, 1, 0, 0},
+	} {
+		if got := ScaleSide(tc.n, tc.num, tc.den); got != tc.want {
+			t.Errorf("ScaleSide(%d, %d, %d) = %d, want %d", tc.n, tc.num, tc.den, got, tc.want)
+		}
+	}
+}
+
+// TestHeightMatchesAspectRatio checks that every variant height is the
+// one a frontend gets from width / aspect_ratio, rounded.
+func TestHeightMatchesAspectRatio(t *testing.T) {
+	p := Get("telegram-webview")
+	for srcW := 101; srcW <= 4000; srcW += 97 {
+		for srcH := 89; srcH <= 4000; srcH += 89 {
+			ratio := float64(srcW) / float64(srcH)
+			for _, w := range []int{16, 160, 320, 640, 960, 1280, 1920} {
+				want := max(1, int(math.Floor(float64(w)/ratio+0.5)))
+				if h := p.Height(srcW, srcH, w); h != want {
+					t.Fatalf("%dx%d at width %d: height %d, width / aspect_ratio rounds to %d", srcW, srcH, w, h, want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,262 @@
+// Package prom is a minimal Prometheus metrics registry: labeled counters
+// and histograms, and gauges read at scrape time, served in the text
+// exposition format (version 0.0.4) that every Prometheus-compatible
+// scraper reads.
+package prom
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are histogram upper bounds in seconds suited to encode
+// durations, from 5 ms to 30 s.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+// Registry holds metrics in registration order. It is safe for
+// concurrent use.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry { return &Registry{} }
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+func (r *Registry) add(m metric) {
+	r.mu.Lock()
+	r.metrics = append(r.metrics, m)
+	r.mu.Unlock()
+}
+
+// desc is the name, help and label names shared by every metric type.
+type desc struct {
+	name, help, kind string
+	labels           []string
+}
+
+func (d desc) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.kind)
+}
+
+// key joins label values into a map key; it panics on a wrong count,
+// which is a programming error.
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("prom: %s takes %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelPairs renders `a="x",b="y"` for the values in key, plus extra.
+func (d desc) labelPairs(key string, extra ...string) string {
+	var pairs []string
+	if len(d.labels) > 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			pairs = append(pairs, d.labels[i]+`="`+escapeLabel(v)+`"`)
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// series is a value per label combination, written in sorted order.
+type series struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func (s *series) add(v float64, labels []string) {
+	k := s.key(labels)
+	s.mu.Lock()
+	s.values[k] += v
+	s.mu.Unlock()
+}
+
+func (s *series) write(w *bufio.Writer) {
+	s.header(w)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.labels) == 0 && len(s.values) == 0 {
+		s.values[""] = 0 // an unlabeled metric always has its one series
+	}
+	for _, k := range sortedKeys(s.values) {
+		fmt.Fprintf(w, "%s%s %s\n", s.name, s.labelPairs(k), formatFloat(s.values[k]))
+	}
+}
+
+// Counter is a monotonically increasing value per label combination.
+type Counter struct{ s *series }
+
+// Counter registers a counter. By convention its name ends in "_total".
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	s := &series{desc: desc{name, help, "counter", labels}, values: map[string]float64{}}
+	r.add(s)
+	return &Counter{s}
+}
+
+// Inc adds 1 for the given label values.
+func (c *Counter) Inc(labels ...string) { c.s.add(1, labels) }
+
+// Add adds v, which must not be negative, for the given label values.
+func (c *Counter) Add(v float64, labels ...string) {
+	if v < 0 {
+		panic("prom: counter decreased")
+	}
+	c.s.add(v, labels)
+}
+
+// Histogram counts observations into cumulative buckets per label
+// combination, with their sum and count.
+type Histogram struct {
+	desc
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValues
+}
+
+type histogramValues struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// Histogram registers a histogram with the given ascending bucket upper
+// bounds; +Inf is implied.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic("prom: " + name + " buckets are not sorted")
+	}
+	h := &Histogram{desc: desc{name, help, "histogram", labels}, buckets: buckets, values: map[string]*histogramValues{}}
+	r.add(h)
+	return h
+}
+
+// Observe records v for the given label values.
+func (h *Histogram) Observe(v float64, labels ...string) {
+	k := h.key(labels)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hv := h.values[k]
+	if hv == nil {
+		hv = &histogramValues{counts: make([]uint64, len(h.buckets))}
+		h.values[k] = hv
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		hv.counts[i]++
+	}
+	hv.sum += v
+	hv.count++
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.header(w)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, k := range sortedKeys(h.values) {
+		hv := h.values[k]
+		var cum uint64
+		for i, ub := range h.buckets {
+			cum += hv.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(k, "le", formatFloat(ub)), cum)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(k, "le", "+Inf"), hv.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(k), formatFloat(hv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(k), hv.count)
+	}
+}
+
+// gaugeFunc is a gauge read at scrape time.
+type gaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+// GaugeFunc registers an unlabeled gauge whose value fn returns at each
+// scrape, e.g. the number of assets in a live manifest.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.add(&gaugeFunc{desc{name, help, "gauge", nil}, fn})
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	g.header(w)
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.fn()))
+}
+
+// WriteTo writes every metric in the text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP serves the metrics to a scraper.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
@@ -0,0 +1,58 @@
+package prom
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExposition(t *testing.T) {
+	r := NewRegistry()
+	images := r.Counter("tgimg_images_processed_total", "Images processed.", "status")
+	r.Counter("tgimg_builds_total", "Builds.") // never incremented
+	encode := r.Histogram("tgimg_encode_duration_seconds", "Encode time.", []float64{0.1, 1}, "format")
+	r.GaugeFunc("tgimg_assets", "Assets in the manifest.", func() float64 { return 7 })
+
+	images.Inc("ok")
+	images.Inc("ok")
+	images.Inc(`bad "quote"`)
+	encode.Observe(0.05, "webp")
+	encode.Observe(0.5, "webp")
+	encode.Observe(3, "webp")
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	want := `# HELP tgimg_images_processed_total Images processed.
+# TYPE tgimg_images_processed_total counter
+tgimg_images_processed_total{status="bad \"quote\""} 1
+tgimg_images_processed_total{status="ok"} 2
+# HELP tgimg_builds_total Builds.
+# TYPE tgimg_builds_total counter
+tgimg_builds_total 0
+# HELP tgimg_encode_duration_seconds Encode time.
+# TYPE tgimg_encode_duration_seconds histogram
+tgimg_encode_duration_seconds_bucket{format="webp",le="0.1"} 1
+tgimg_encode_duration_seconds_bucket{format="webp",le="1"} 2
+tgimg_encode_duration_seconds_bucket{format="webp",le="+Inf"} 3
+tgimg_encode_duration_seconds_sum{format="webp"} 3.55
+tgimg_encode_duration_seconds_count{format="webp"} 3
+# HELP tgimg_assets Assets in the manifest.
+# TYPE tgimg_assets gauge
+tgimg_assets 7
+`
+	if got := rec.Body.String(); got != want {
+		t.Errorf("exposition:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLabelCountPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for a missing label value")
+		}
+	}()
+	NewRegistry().Counter("c_total", "c", "status").Inc()
+}
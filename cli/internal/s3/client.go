@@ -0,0 +1,242 @@
+// Package s3 is a minimal client for S3-compatible object storage (AWS
+// S3, Cloudflare R2, MinIO, Google Cloud Storage's XML API, ...). It
+// implements only what `tgimg upload`, bucket inputs of `tgimg build` and
+// bucket outputs need, PutObject, GetObject, HeadObject and
+// ListObjectsV2, signed with AWS Signature V4, so the CLI does not pull
+// in a cloud SDK.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Client talks to one bucket.
+type Client struct {
+	// Endpoint is the service URL, e.g. "https://s3.eu-central-1.amazonaws.com"
+	// or "https://<account>.r2.cloudflarestorage.com". Empty means AWS S3
+	// in Region.
+	Endpoint string
+	Region   string
+	Bucket   string
+
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	// PathStyle addresses the bucket as endpoint/bucket/key instead of
+	// bucket.endpoint/key. MinIO and most self-hosted stores need it.
+	PathStyle bool
+
+	HTTP *http.Client
+}
+
+// CredentialsFromEnv fills credentials from the standard AWS_* variables.
+func (c *Client) CredentialsFromEnv() error {
+	c.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	c.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	c.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	if c.AccessKey == "" || c.SecretKey == "" {
+		return fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	return nil
+}
+
+// objectURL returns the URL of key (or of the bucket if key is empty).
+func (c *Client) objectURL(key string) (*url.URL, error) {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + c.Region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+	}
+	p := "/" + key
+	if c.PathStyle {
+		p = "/" + c.Bucket + p
+	} else {
+		u.Host = c.Bucket + "." + u.Host
+	}
+	u.Path = p
+	u.RawPath = escapePath(p)
+	return u, nil
+}
+
+func (c *Client) do(ctx context.Context, method string, u *url.URL, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.ContentLength = int64(len(body))
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		payloadHash = hexSHA256(body)
+	}
+	c.sign(req, payloadHash, time.Now())
+
+	hc := c.HTTP
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &ResponseError{
+			Method: method, Path: u.Path,
+			StatusCode: resp.StatusCode, Status: resp.Status,
+			Message: strings.TrimSpace(string(msg)),
+		}
+	}
+	return resp, nil
+}
+
+// ResponseError is a non-2xx response. A 404 matches fs.ErrNotExist.
+type ResponseError struct {
+	Method, Path string
+	StatusCode   int
+	Status       string
+	Message      string // start of the response body
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("%s %s: %s: %s", e.Method, e.Path, e.Status, e.Message)
+}
+
+func (e *ResponseError) Is(target error) bool {
+	return target == fs.ErrNotExist && e.StatusCode == http.StatusNotFound
+}
+
+// Put uploads body to key with the given Content-Type and Cache-Control.
+func (c *Client) Put(ctx context.Context, key string, body []byte, contentType, cacheControl string) error {
+	u, err := c.objectURL(key)
+	if err != nil {
+		return err
+	}
+	h := http.Header{}
+	h.Set("Content-Type", contentType)
+	if cacheControl != "" {
+		h.Set("Cache-Control", cacheControl)
+	}
+	resp, err := c.do(ctx, http.MethodPut, u, body, h)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get streams the object at key. The caller closes the body.
+func (c *Client) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	u, err := c.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, http.MethodGet, u, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Head checks that the object at key exists. A missing object yields an
+// error matching fs.ErrNotExist.
+func (c *Client) Head(ctx context.Context, key string) error {
+	u, err := c.objectURL(key)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodHead, u, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// List returns the ETag (without quotes) of every object under prefix.
+// For single-part uploads the ETag is the hex MD5 of the content.
+func (c *Client) List(ctx context.Context, prefix string) (map[string]string, error) {
+	objects, err := c.ListObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]string, len(objects))
+	for _, o := range objects {
+		out[o.Key] = o.ETag
+	}
+	return out, nil
+}
+
+// Object is one entry of a bucket listing.
+type Object struct {
+	Key          string
+	Size         int64
+	ETag         string // without quotes
+	LastModified time.Time
+}
+
+// ListObjects returns every object under prefix, in key order.
+func (c *Client) ListObjects(ctx context.Context, prefix string) ([]Object, error) {
+	var out []Object
+	token := ""
+	for {
+		u, err := c.objectURL("")
+		if err != nil {
+			return nil, err
+		}
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u.RawQuery = q.Encode()
+
+		resp, err := c.do(ctx, http.MethodGet, u, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				ETag         string    `xml:"ETag"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("parse list response: %w", err)
+		}
+		for _, o := range page.Contents {
+			out = append(out, Object{
+				Key:          o.Key,
+				Size:         o.Size,
+				ETag:         strings.Trim(o.ETag, `"`),
+				LastModified: o.LastModified,
+			})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return out, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
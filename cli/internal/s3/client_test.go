@@ -0,0 +1,63 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListObjectsAndGet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/bucket/" && r.URL.Query().Get("continuation-token") == "":
+			fmt.Fprint(w, `<ListBucketResult><Contents><Key>img/a.png</Key><Size>3</Size><ETag>"e1"</ETag>`+
+				`<LastModified>2025-01-15T12:00:00.000Z</LastModified></Contents>`+
+				`<IsTruncated>true</IsTruncated><NextContinuationToken>next</NextContinuationToken></ListBucketResult>`)
+		case r.URL.Path == "/bucket/":
+			fmt.Fprint(w, `<ListBucketResult><Contents><Key>img/b.jpg</Key><Size>5</Size><ETag>"e2"</ETag></Contents>`+
+				`<IsTruncated>false</IsTruncated></ListBucketResult>`)
+		case r.URL.Path == "/bucket/img/a.png":
+			fmt.Fprint(w, "png")
+		default:
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	c := &Client{Endpoint: srv.URL, Region: "us-east-1", Bucket: "bucket", PathStyle: true}
+	ctx := context.Background()
+
+	objects, err := c.ListObjects(ctx, "img/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 || objects[0].Key != "img/a.png" || objects[0].Size != 3 || objects[0].ETag != "e1" ||
+		objects[0].LastModified.Year() != 2025 || objects[1].Key != "img/b.jpg" {
+		t.Errorf("ListObjects = %+v", objects)
+	}
+
+	body, err := c.Get(ctx, "img/a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "png" {
+		t.Errorf("Get = %q", data)
+	}
+
+	if _, err := c.Get(ctx, "img/missing.png"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Get missing: err = %v, want fs.ErrNotExist", err)
+	}
+
+	if err := c.Head(ctx, "img/a.png"); err != nil {
+		t.Errorf("Head: %v", err)
+	}
+	if err := c.Head(ctx, "img/missing.png"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Head missing: err = %v, want fs.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,204 @@
+// Package telegram is a minimal Bot API client for uploading build
+// variants to Telegram's servers, reading back their file_ids and
+// downloading files by file_id.
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultAPIURL is the public Bot API server.
+const DefaultAPIURL = "https://api.telegram.org"
+
+// Bot calls Bot API methods with one token.
+type Bot struct {
+	Token  string
+	APIURL string // DefaultAPIURL if empty; set for a local Bot API server
+	HTTP   *http.Client
+
+	// MaxRetries bounds retries after HTTP 429 (flood control).
+	MaxRetries int
+}
+
+// File identifies an uploaded file. FileID is used to send or download
+// the file again; FileUniqueID is stable across bots.
+type File struct {
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	FileSize     int64  `json:"file_size"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	// FilePath is set by GetFile; Download fetches the file by it.
+	FilePath string `json:"file_path,omitempty"`
+}
+
+// APIError is an unsuccessful Bot API response.
+type APIError struct {
+	Code        int
+	Description string
+	RetryAfter  int
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("telegram: %d %s", e.Code, e.Description)
+}
+
+type response struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// SendDocument uploads data as a document. Telegram stores documents
+// byte-for-byte, so the file matches the local variant.
+func (b *Bot) SendDocument(ctx context.Context, chatID, name string, data []byte) (*File, error) {
+	var msg struct {
+		Document File `json:"document"`
+	}
+	if err := b.upload(ctx, "sendDocument", "document", chatID, name, data, &msg); err != nil {
+		return nil, err
+	}
+	return &msg.Document, nil
+}
+
+// SendPhoto uploads data as a photo. Telegram re-encodes photos into
+// several JPEG sizes; the largest one is returned.
+func (b *Bot) SendPhoto(ctx context.Context, chatID, name string, data []byte) (*File, error) {
+	var msg struct {
+		Photo []File `json:"photo"`
+	}
+	if err := b.upload(ctx, "sendPhoto", "photo", chatID, name, data, &msg); err != nil {
+		return nil, err
+	}
+	if len(msg.Photo) == 0 {
+		return nil, fmt.Errorf("telegram: sendPhoto returned no sizes")
+	}
+	best := msg.Photo[0]
+	for _, p := range msg.Photo[1:] {
+		if p.Width*p.Height > best.Width*best.Height {
+			best = p
+		}
+	}
+	return &best, nil
+}
+
+// GetFile resolves fileID to a File whose FilePath can be downloaded.
+// The Bot API only serves files of up to 20 MB this way, and the path
+// stays valid for at least an hour.
+func (b *Bot) GetFile(ctx context.Context, fileID string) (*File, error) {
+	body, err := json.Marshal(map[string]string{"file_id": fileID})
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	if err := b.call(ctx, "getFile", "application/json", body, &f); err != nil {
+		return nil, err
+	}
+	if f.FilePath == "" {
+		return nil, fmt.Errorf("telegram: getFile returned no file_path")
+	}
+	return &f, nil
+}
+
+// Download streams the file at filePath, as returned by GetFile. The
+// caller closes the body.
+func (b *Bot) Download(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	url := b.base() + "/file/bot" + b.Token + "/" + strings.TrimLeft(filePath, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("telegram: download: %s", strings.ReplaceAll(err.Error(), b.Token, "<token>"))
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("telegram: download %s: %s", filePath, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (b *Bot) base() string {
+	if b.APIURL == "" {
+		return DefaultAPIURL
+	}
+	return strings.TrimRight(b.APIURL, "/")
+}
+
+func (b *Bot) client() *http.Client {
+	if b.HTTP == nil {
+		return http.DefaultClient
+	}
+	return b.HTTP
+}
+
+// upload posts a multipart request, retrying on flood control.
+func (b *Bot) upload(ctx context.Context, method, field, chatID, name string, data []byte, out any) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("chat_id", chatID)
+	w.WriteField("disable_notification", "true")
+	part, err := w.CreateFormFile(field, name)
+	if err != nil {
+		return err
+	}
+	part.Write(data)
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := b.call(ctx, method, w.FormDataContentType(), body.Bytes(), out)
+		apiErr, ok := err.(*APIError)
+		if !ok || apiErr.RetryAfter == 0 || attempt >= b.MaxRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(apiErr.RetryAfter) * time.Second):
+		}
+	}
+}
+
+func (b *Bot) call(ctx context.Context, method, contentType string, body []byte, out any) error {
+	url := b.base() + "/bot" + b.Token + "/" + method
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := b.client().Do(req)
+	if err != nil {
+		// Never leak the token through the request URL in errors.
+		return fmt.Errorf("telegram: %s: %s", method, strings.ReplaceAll(err.Error(), b.Token, "<token>"))
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var r response
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return fmt.Errorf("telegram: %s: %s", method, resp.Status)
+	}
+	if !r.OK {
+		return &APIError{Code: r.ErrorCode, Description: r.Description, RetryAfter: r.Parameters.RetryAfter}
+	}
+	return json.Unmarshal(r.Result, out)
+}
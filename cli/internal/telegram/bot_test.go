@@ -0,0 +1,59 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetFileAndDownload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/botTOKEN/getFile":
+			var req struct {
+				FileID string `json:"file_id"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			if req.FileID != "AgAD" {
+				w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: invalid file_id"}`))
+				return
+			}
+			w.Write([]byte(`{"ok":true,"result":{"file_id":"AgAD","file_unique_id":"AQAD","file_size":4,"file_path":"photos/file_0.jpg"}}`))
+		case "/file/botTOKEN/photos/file_0.jpg":
+			w.Write([]byte("jpeg"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	bot := &Bot{Token: "TOKEN", APIURL: srv.URL}
+	ctx := context.Background()
+
+	f, err := bot.GetFile(ctx, "AgAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.FileUniqueID != "AQAD" || f.FilePath != "photos/file_0.jpg" {
+		t.Errorf("GetFile = %+v", f)
+	}
+	body, err := bot.Download(ctx, f.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "jpeg" {
+		t.Errorf("Download = %q", data)
+	}
+
+	if _, err := bot.GetFile(ctx, "nope"); err == nil || !strings.Contains(err.Error(), "invalid file_id") {
+		t.Errorf("GetFile(nope) err = %v", err)
+	}
+	if _, err := bot.Download(ctx, "photos/missing.jpg"); err == nil || strings.Contains(err.Error(), "TOKEN") {
+		t.Errorf("Download(missing) err = %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package tempfile
+
+import "os"
+
+// alive reports whether process pid exists. On Windows FindProcess fails
+// for a process that has exited; where it cannot tell, the process is
+// assumed alive and its directory kept.
+func alive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,12 @@
+//go:build unix
+
+package tempfile
+
+import "syscall"
+
+// alive reports whether process pid exists. EPERM means it does but
+// belongs to another user.
+func alive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
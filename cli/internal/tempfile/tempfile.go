@@ -0,0 +1,133 @@
+// Package tempfile keeps the temp files tgimg hands to external encoders
+// and tools in one directory per run, tgimg-<pid>-<random> under the
+// system temp directory. The directory is removed when the run ends, and
+// the next run removes those of runs that crashed or were killed, so
+// interrupted builds no longer leave their files behind forever.
+package tempfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+)
+
+// runPrefix starts the name of every run directory.
+const runPrefix = "tgimg-"
+
+// legacyAge is how old a loose tgimg_* file from a version before run
+// directories must be before it is removed; a younger one may belong to
+// an older tgimg that is still running.
+const legacyAge = 24 * time.Hour
+
+var (
+	mu      sync.Mutex
+	base    string // "" for os.TempDir()
+	dir     string // this run's directory, once created
+	created bool
+)
+
+// SetBase sets the directory run directories are created in. "" means
+// os.TempDir(), which honors $TMPDIR (%TMP% on Windows). Call it before
+// the first Create.
+func SetBase(path string) {
+	mu.Lock()
+	defer mu.Unlock()
+	base = path
+}
+
+// Create creates a new temp file in this run's directory, as
+// os.CreateTemp does. The first call creates the directory and removes
+// those left behind by runs that are gone.
+func Create(pattern string) (*os.File, error) {
+	d, err := runDir()
+	if err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(d, pattern)
+}
+
+// runDir returns this run's directory, creating it on first use.
+func runDir() (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if created {
+		return dir, nil
+	}
+	b := base
+	if b == "" {
+		b = os.TempDir()
+	}
+	if err := os.MkdirAll(b, 0o755); err != nil {
+		return "", fmt.Errorf("temp dir: %w", err)
+	}
+	sweep(b)
+	d, err := os.MkdirTemp(b, fmt.Sprintf("%s%d-*", runPrefix, os.Getpid()))
+	if err != nil {
+		return "", fmt.Errorf("temp dir: %w", err)
+	}
+	logging.Debugf("temp dir: %s", d)
+	dir, created = d, true
+	return dir, nil
+}
+
+// Cleanup removes this run's directory with everything left in it. Call
+// it once the command ends; a later Create starts a new directory.
+func Cleanup() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if !created {
+		return nil
+	}
+	created = false
+	return os.RemoveAll(dir)
+}
+
+// sweep removes the run directories in b whose process has exited, and
+// loose tgimg_* files older than legacyAge. Failures are only logged:
+// another user's leftovers in a shared temp directory are not ours to
+// remove.
+func sweep(b string) {
+	entries, err := os.ReadDir(b)
+	if err != nil {
+		logging.Debugf("temp dir: %v", err)
+		return
+	}
+	for _, e := range entries {
+		name := e.Name()
+		var stale bool
+		switch {
+		case e.IsDir() && strings.HasPrefix(name, runPrefix):
+			pid, ok := runPID(name)
+			// A directory with this process's PID is from an earlier
+			// process that had the same PID and is gone.
+			stale = ok && (pid == os.Getpid() || !alive(pid))
+		case e.Type().IsRegular() && strings.HasPrefix(name, "tgimg_"):
+			info, err := e.Info()
+			stale = err == nil && time.Since(info.ModTime()) > legacyAge
+		}
+		if !stale {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(b, name)); err != nil {
+			logging.Debugf("temp dir: %v", err)
+			continue
+		}
+		logging.Debugf("temp dir: removed %s left by an earlier run", name)
+	}
+}
+
+// runPID returns the process ID in a run directory's name.
+func runPID(name string) (int, bool) {
+	s, _, ok := strings.Cut(strings.TrimPrefix(name, runPrefix), "-")
+	if !ok {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(s)
+	return pid, err == nil && pid > 0
+}
@@ -0,0 +1,74 @@
+package tempfile
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// exitedPID returns the PID of a process that has exited.
+func exitedPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestCreateSweepsCrashedRuns(t *testing.T) {
+	b := t.TempDir()
+	SetBase(b)
+	defer SetBase("")
+
+	crashed := filepath.Join(b, fmt.Sprintf("%s%d-123", runPrefix, exitedPID(t)))
+	running := filepath.Join(b, fmt.Sprintf("%s%d-456", runPrefix, os.Getppid()))
+	oldLoose := filepath.Join(b, "tgimg_src_1_99.pam")
+	newLoose := filepath.Join(b, "tgimg_src_2_99.pam")
+	for _, d := range []string{crashed, running} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(d, "tgimg_dst_1.webp"), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{oldLoose, newLoose} {
+		if err := os.WriteFile(f, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * legacyAge)
+	if err := os.Chtimes(oldLoose, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Create("tgimg_src_*.pam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	run := filepath.Dir(f.Name())
+	if filepath.Dir(run) != b {
+		t.Errorf("temp file %s is not in a run directory under %s", f.Name(), b)
+	}
+	if pid, ok := runPID(filepath.Base(run)); !ok || pid != os.Getpid() {
+		t.Errorf("run directory %s does not carry PID %d", run, os.Getpid())
+	}
+
+	for path, want := range map[string]bool{crashed: false, running: true, oldLoose: false, newLoose: true} {
+		if _, err := os.Stat(path); (err == nil) != want {
+			t.Errorf("%s: exists %v, want %v", filepath.Base(path), err == nil, want)
+		}
+	}
+
+	if err := Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(run); !os.IsNotExist(err) {
+		t.Errorf("Cleanup left %s: %v", run, err)
+	}
+}
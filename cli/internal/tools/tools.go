@@ -0,0 +1,64 @@
+// Package tools locates the external encoders tgimg shells out to
+// (cwebp, avifenc): on PATH or in a per-user tool directory, for machines
+// where they cannot be installed system-wide.
+package tools
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// DirEnv overrides the tool directory.
+const DirEnv = "TGIMG_TOOLS_DIR"
+
+// Names lists the tools tgimg uses.
+var Names = []string{"cwebp", "avifenc"}
+
+// Dir returns the tool directory: $TGIMG_TOOLS_DIR, or tgimg-tools in
+// the per-user cache directory.
+func Dir() (string, error) {
+	if d := os.Getenv(DirEnv); d != "" {
+		return d, nil
+	}
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "tgimg-tools"), nil
+}
+
+// exeName returns the file name of tool on this OS.
+func exeName(tool string) string {
+	if runtime.GOOS == "windows" {
+		return tool + ".exe"
+	}
+	return tool
+}
+
+// LookPath finds tool on PATH or, failing that, in the tool directory.
+func LookPath(tool string) (string, error) {
+	p, err := exec.LookPath(tool)
+	if err == nil {
+		return p, nil
+	}
+	if p, ok := Installed(tool); ok {
+		return p, nil
+	}
+	return "", err
+}
+
+// Installed returns the path of tool in the tool directory, if it is
+// there.
+func Installed(tool string) (string, bool) {
+	dir, err := Dir()
+	if err != nil {
+		return "", false
+	}
+	p := filepath.Join(dir, exeName(tool))
+	if info, err := os.Stat(p); err != nil || info.IsDir() {
+		return "", false
+	}
+	return p, true
+}
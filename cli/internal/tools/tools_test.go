@@ -0,0 +1,23 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookPathFallsBackToToolDir(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(DirEnv, dir)
+	t.Setenv("PATH", t.TempDir())
+	if _, err := LookPath("cwebp"); err == nil {
+		t.Fatal("found cwebp in an empty PATH and tool dir")
+	}
+	want := filepath.Join(dir, exeName("cwebp"))
+	if err := os.WriteFile(want, nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := LookPath("cwebp"); err != nil || got != want {
+		t.Errorf("LookPath = %q, %v; want %q", got, err, want)
+	}
+}
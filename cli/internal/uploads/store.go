@@ -0,0 +1,188 @@
+// Package uploads builds images received over the network into an output
+// directory and keeps its manifest current. It backs "tgimg server" and
+// "tgimg grpc".
+package uploads
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AnyUserName/tgimg-cli/internal/hasher"
+	"github.com/AnyUserName/tgimg-cli/internal/logging"
+	"github.com/AnyUserName/tgimg-cli/internal/manifest"
+	"github.com/AnyUserName/tgimg-cli/internal/pipeline"
+	"github.com/AnyUserName/tgimg-cli/internal/tempfile"
+)
+
+var (
+	// ErrInvalidKey is returned by Add for keys CheckKey rejects.
+	ErrInvalidKey = errors.New("invalid key")
+	// ErrUnprocessable is returned by Add when the pipeline fails on the
+	// image: it is corrupt, in an unsupported format or over the
+	// profile's limits.
+	ErrUnprocessable = errors.New("unprocessable image")
+)
+
+// Store processes images with a pipeline whose output directory holds
+// the manifest, and merges them into it. mu guards the manifest, which
+// is saved after every image, and files.
+type Store struct {
+	p    *pipeline.Pipeline
+	save func(data []byte) error
+	sem  chan struct{} // bounds images being processed at once
+
+	mu       sync.RWMutex
+	manifest *manifest.Manifest
+	files    map[string]string // variant path → format, including replaced assets'
+}
+
+// Result is an asset as returned to clients: the manifest entry plus
+// base_path + path for every variant, in the order of AllVariants.
+type Result struct {
+	Key     string                    `json:"key"`
+	URLs    []string                  `json:"urls"`
+	Asset   manifest.Asset            `json:"asset"`
+	Skipped []pipeline.SkippedVariant `json:"skipped,omitempty"` // Add only
+}
+
+// New returns a store over m, the manifest of p's output directory.
+// Up to workers images are processed at once; save writes the
+// marshaled manifest after each one.
+func New(p *pipeline.Pipeline, m *manifest.Manifest, workers int, save func(data []byte) error) *Store {
+	if m.Assets == nil {
+		m.Assets = map[string]manifest.Asset{}
+	}
+	s := &Store{
+		p:        p,
+		save:     save,
+		sem:      make(chan struct{}, workers),
+		manifest: m,
+		files:    map[string]string{},
+	}
+	for _, a := range m.Assets {
+		s.addFiles(a)
+	}
+	return s
+}
+
+// addFiles indexes the variant files of a; the caller holds mu or owns s.
+func (s *Store) addFiles(a manifest.Asset) {
+	for _, v := range a.AllVariants() {
+		s.files[v.Path] = v.Format
+	}
+}
+
+// Len returns the number of assets in the manifest.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.manifest.Assets)
+}
+
+// Add processes the encoded image data as asset key, replacing any asset
+// with that key. An empty key stands for the content hash.
+func (s *Store) Add(data []byte, key string) (Result, error) {
+	start := time.Now()
+	if key == "" {
+		key = hasher.ContentHash(data, 16)
+	} else if err := CheckKey(key); err != nil {
+		return Result{}, err
+	}
+
+	tmp, err := tempfile.Create("tgimg_upload_*")
+	if err != nil {
+		return Result{}, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return Result{}, err
+	}
+
+	s.sem <- struct{}{}
+	asset, skipped, err := s.p.ProcessFile(tmp.Name(), key)
+	<-s.sem
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: %w", ErrUnprocessable, err)
+	}
+
+	s.mu.Lock()
+	s.manifest.Assets[key] = asset
+	delete(s.manifest.Errors, key)
+	s.addFiles(asset)
+	s.manifest.GeneratedAt = time.Now().UTC().Format(time.RFC3339)
+	out, err := manifest.Marshal(s.manifest, manifest.WriteOptions{})
+	if err == nil {
+		err = s.save(out)
+	}
+	base := s.manifest.BasePath
+	s.mu.Unlock()
+	if err != nil {
+		return Result{}, fmt.Errorf("write manifest: %w", err)
+	}
+
+	logging.Debugf("upload %s: %d variants in %s", key, len(asset.Variants), time.Since(start).Round(time.Millisecond))
+	return newResult(key, base, asset, skipped), nil
+}
+
+// Lookup resolves a key, alias or "key@theme"/"key@breakpoint" reference.
+func (s *Store) Lookup(ref string) (Result, bool) {
+	s.mu.RLock()
+	key, _, asset, ok := s.manifest.LookupRef(ref)
+	base := s.manifest.BasePath
+	s.mu.RUnlock()
+	if !ok {
+		return Result{}, false
+	}
+	return newResult(key, base, asset, nil), true
+}
+
+// File returns the format of the variant file at the slash-separated
+// path, relative to the output directory, and whether it is one.
+func (s *Store) File(rel string) (format string, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	format, ok = s.files[rel]
+	return format, ok
+}
+
+// ManifestJSON returns the manifest as JSON.
+func (s *Store) ManifestJSON() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return json.Marshal(s.manifest)
+}
+
+func newResult(key, base string, a manifest.Asset, skipped []pipeline.SkippedVariant) Result {
+	urls := []string{}
+	for _, v := range a.AllVariants() {
+		urls = append(urls, base+v.Path)
+	}
+	return Result{Key: key, URLs: urls, Asset: a, Skipped: skipped}
+}
+
+// CheckKey rejects keys that are not clean relative paths, or that use
+// "@", which marks themes and breakpoints in references.
+func CheckKey(key string) error {
+	if path.Clean(key) != key || path.IsAbs(key) || key == ".." || strings.HasPrefix(key, "../") {
+		return fmt.Errorf("%w %q: want a relative path like avatars/u123", ErrInvalidKey, key)
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if strings.HasPrefix(seg, ".") {
+			return fmt.Errorf("%w %q: segments must not start with \".\"", ErrInvalidKey, key)
+		}
+	}
+	if strings.ContainsAny(key, "@\\") {
+		return fmt.Errorf("%w %q: must not contain \"@\" or \"\\\"", ErrInvalidKey, key)
+	}
+	return nil
+}
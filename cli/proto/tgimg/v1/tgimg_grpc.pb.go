@@ -0,0 +1,220 @@
+// The tgimg gRPC API, served by "tgimg grpc". Messages mirror the
+// manifest schema (tgimg.manifest.json); see README.md for field meanings.
+//
+// Regenerate the Go code with "make proto".
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.3
+// source: tgimg/v1/tgimg.proto
+
+package tgimgv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Tgimg_ProcessImage_FullMethodName   = "/tgimg.v1.Tgimg/ProcessImage"
+	Tgimg_GetAsset_FullMethodName       = "/tgimg.v1.Tgimg/GetAsset"
+	Tgimg_BuildDirectory_FullMethodName = "/tgimg.v1.Tgimg/BuildDirectory"
+)
+
+// TgimgClient is the client API for Tgimg service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TgimgClient interface {
+	// ProcessImage builds one image into the server's output directory and
+	// merges it into the output manifest. An existing key is replaced.
+	ProcessImage(ctx context.Context, in *ProcessImageRequest, opts ...grpc.CallOption) (*AssetResult, error)
+	// GetAsset looks up an asset of the output manifest by key, alias or
+	// "key@theme" / "key@breakpoint" reference.
+	GetAsset(ctx context.Context, in *GetAssetRequest, opts ...grpc.CallOption) (*AssetResult, error)
+	// BuildDirectory runs "tgimg build" on a directory on the server's host,
+	// streaming one message per processed image and a final one with the
+	// written manifest.
+	BuildDirectory(ctx context.Context, in *BuildDirectoryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BuildProgress], error)
+}
+
+type tgimgClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTgimgClient(cc grpc.ClientConnInterface) TgimgClient {
+	return &tgimgClient{cc}
+}
+
+func (c *tgimgClient) ProcessImage(ctx context.Context, in *ProcessImageRequest, opts ...grpc.CallOption) (*AssetResult, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AssetResult)
+	err := c.cc.Invoke(ctx, Tgimg_ProcessImage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tgimgClient) GetAsset(ctx context.Context, in *GetAssetRequest, opts ...grpc.CallOption) (*AssetResult, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AssetResult)
+	err := c.cc.Invoke(ctx, Tgimg_GetAsset_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tgimgClient) BuildDirectory(ctx context.Context, in *BuildDirectoryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BuildProgress], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Tgimg_ServiceDesc.Streams[0], Tgimg_BuildDirectory_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[BuildDirectoryRequest, BuildProgress]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tgimg_BuildDirectoryClient = grpc.ServerStreamingClient[BuildProgress]
+
+// TgimgServer is the server API for Tgimg service.
+// All implementations must embed UnimplementedTgimgServer
+// for forward compatibility.
+type TgimgServer interface {
+	// ProcessImage builds one image into the server's output directory and
+	// merges it into the output manifest. An existing key is replaced.
+	ProcessImage(context.Context, *ProcessImageRequest) (*AssetResult, error)
+	// GetAsset looks up an asset of the output manifest by key, alias or
+	// "key@theme" / "key@breakpoint" reference.
+	GetAsset(context.Context, *GetAssetRequest) (*AssetResult, error)
+	// BuildDirectory runs "tgimg build" on a directory on the server's host,
+	// streaming one message per processed image and a final one with the
+	// written manifest.
+	BuildDirectory(*BuildDirectoryRequest, grpc.ServerStreamingServer[BuildProgress]) error
+	mustEmbedUnimplementedTgimgServer()
+}
+
+// UnimplementedTgimgServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTgimgServer struct{}
+
+func (UnimplementedTgimgServer) ProcessImage(context.Context, *ProcessImageRequest) (*AssetResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ProcessImage not implemented")
+}
+func (UnimplementedTgimgServer) GetAsset(context.Context, *GetAssetRequest) (*AssetResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAsset not implemented")
+}
+func (UnimplementedTgimgServer) BuildDirectory(*BuildDirectoryRequest, grpc.ServerStreamingServer[BuildProgress]) error {
+	return status.Errorf(codes.Unimplemented, "method BuildDirectory not implemented")
+}
+func (UnimplementedTgimgServer) mustEmbedUnimplementedTgimgServer() {}
+func (UnimplementedTgimgServer) testEmbeddedByValue()               {}
+
+// UnsafeTgimgServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TgimgServer will
+// result in compilation errors.
+type UnsafeTgimgServer interface {
+	mustEmbedUnimplementedTgimgServer()
+}
+
+func RegisterTgimgServer(s grpc.ServiceRegistrar, srv TgimgServer) {
+	// If the following call pancis, it indicates UnimplementedTgimgServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Tgimg_ServiceDesc, srv)
+}
+
+func _Tgimg_ProcessImage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ProcessImageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TgimgServer).ProcessImage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tgimg_ProcessImage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TgimgServer).ProcessImage(ctx, req.(*ProcessImageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tgimg_GetAsset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAssetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TgimgServer).GetAsset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tgimg_GetAsset_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TgimgServer).GetAsset(ctx, req.(*GetAssetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tgimg_BuildDirectory_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BuildDirectoryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TgimgServer).BuildDirectory(m, &grpc.GenericServerStream[BuildDirectoryRequest, BuildProgress]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tgimg_BuildDirectoryServer = grpc.ServerStreamingServer[BuildProgress]
+
+// Tgimg_ServiceDesc is the grpc.ServiceDesc for Tgimg service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Tgimg_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "tgimg.v1.Tgimg",
+	HandlerType: (*TgimgServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ProcessImage",
+			Handler:    _Tgimg_ProcessImage_Handler,
+		},
+		{
+			MethodName: "GetAsset",
+			Handler:    _Tgimg_GetAsset_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "BuildDirectory",
+			Handler:       _Tgimg_BuildDirectory_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "tgimg/v1/tgimg.proto",
+}
@@ -20,9 +20,17 @@
  * no blur/scale, double-rAF commit to avoid blink.
  */
 
-import React, { memo, useContext, useMemo, useRef } from 'react';
+import React, { memo, useContext, useEffect, useMemo, useRef, useState } from 'react';
 import type { CSSProperties } from 'react';
-import { ManifestContext, validateManifestVersion } from './manifest';
+import {
+  ManifestContext,
+  assetError,
+  lookupAsset,
+  parseAssetRef,
+  telegramColorScheme,
+  themedAsset,
+  validateManifestVersion,
+} from './manifest';
 import {
   CHROMA_DEFAULT,
   CHROMA_INSTANT,
@@ -32,19 +40,28 @@ import {
   isStaticAsset,
   resolveTransition,
 } from './transition';
+import { subscribeManifest } from './live-reload';
 import type { TgImgAsset, TgImgManifest, TgImgProps } from './types';
 import { useTgImg } from './use-tgimg';
+import { breakpointWidth } from './variant-select';
 
 // ─── Provider ─────────────────────────────────────────────────
 
 /**
  * Provider that supplies the tgimg manifest to all nested <TgImg /> components.
+ *
+ * With `liveReload` set to a `tgimg serve` URL (development only), the
+ * provider follows the dev server's manifest and re-renders images as
+ * sources change, without a page reload.
  */
 export function TgImgProvider({
   manifest,
+  liveReload,
   children,
 }: {
   manifest: TgImgManifest;
+  /** `tgimg serve` URL to follow, e.g. "http://127.0.0.1:8790/". */
+  liveReload?: string;
   children: React.ReactNode;
 }) {
   // One-time version check (warn, don't crash — forward compatibility).
@@ -55,8 +72,18 @@ export function TgImgProvider({
     if (err) console.warn(err);
   }
 
+  const [live, setLive] = useState<TgImgManifest | null>(null);
+  useEffect(() => {
+    if (!liveReload) return;
+    const unsubscribe = subscribeManifest(liveReload, (m) => setLive(m));
+    return () => {
+      unsubscribe();
+      setLive(null);
+    };
+  }, [liveReload]);
+
   return (
-    <ManifestContext.Provider value={manifest}>
+    <ManifestContext.Provider value={(liveReload && live) || manifest}>
       {children}
     </ManifestContext.Provider>
   );
@@ -107,7 +134,18 @@ export const TgImg = memo(function TgImg(
     return <img src="" alt={alt} className={className} style={style} />;
   }
 
-  const asset = manifest.assets[src];
+  const found = lookupAsset(manifest, src);
+  if (
+    !found &&
+    typeof globalThis !== 'undefined' &&
+    (globalThis as any).__DEV__ !== false
+  ) {
+    const failed = assetError(manifest, src);
+    if (failed) {
+      console.warn(`[tgimg] "${src}" failed to build: ${failed.error}`);
+    }
+  }
+  const asset = found && themedAsset(found, props.theme ?? telegramColorScheme());
   const baseUrl = props.baseUrl ?? manifest.base_path ?? './';
 
   // ── Static hot-path: bare <img>, no hooks beyond useContext ──
@@ -234,7 +272,13 @@ const TgImgFull = memo(function TgImgFull(
     onError,
   } = props;
 
-  const asset = manifest.assets[src];
+  const ref = parseAssetRef(manifest, src);
+  const asset = ref.asset && themedAsset(ref.asset, props.theme ?? telegramColorScheme());
+  const breakpoint = ref.breakpoint;
+  const slotWidth =
+    asset && breakpoint
+      ? breakpointWidth(asset.variants, breakpoint) ?? undefined
+      : undefined;
   const baseUrl = baseUrlProp ?? manifest.base_path ?? './';
 
   // ── Chroma selection (before useTgImg) ──
@@ -263,7 +307,14 @@ const TgImgFull = memo(function TgImgFull(
     containerWidth,
     aspectRatio: manifestRatio,
     onImgLoad,
-  } = useTgImg({ asset, priority, baseUrl, chroma: effectiveChroma, avgColor: adaptiveAvgColor });
+  } = useTgImg({
+    asset,
+    priority,
+    baseUrl,
+    chroma: effectiveChroma,
+    avgColor: adaptiveAvgColor,
+    slotWidth,
+  });
 
   // ── Aspect ratio ──
   const aspectRatio =
@@ -376,7 +427,7 @@ const TgImgFull = memo(function TgImgFull(
         <img
           src={imgSrc}
           srcSet={srcSet ?? undefined}
-          sizes={width ? `${width}px` : '100vw'}
+          sizes={width ?? slotWidth ? `${width ?? slotWidth}px` : '100vw'}
           alt={alt}
           loading={priority ? 'eager' : 'lazy'}
           decoding="async"
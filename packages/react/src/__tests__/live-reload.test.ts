@@ -0,0 +1,145 @@
+/**
+ * Live reload from `tgimg serve`.
+ *
+ * Verifies:
+ * - Relative base paths resolve against the dev server; absolute ones stay
+ * - Each "manifest" event fetches the live manifest
+ * - A slower fetch for an older generation never overwrites a newer one
+ * - Unsubscribing closes the stream and drops pending results
+ * - Without EventSource (SSR) subscribing is a no-op
+ */
+
+import { afterEach, describe, expect, it, vi } from 'vitest';
+import { resolveDevManifest, subscribeManifest } from '../live-reload';
+import type { TgImgManifest } from '../types';
+
+function makeManifest(overrides: Partial<TgImgManifest> = {}): TgImgManifest {
+  return {
+    version: 1,
+    generated_at: '2025-01-15T12:00:00Z',
+    profile: 'telegram-webview',
+    base_path: './',
+    assets: {},
+    stats: {
+      total_input_bytes: 0,
+      total_output_bytes: 0,
+      total_assets: 0,
+      total_variants: 0,
+    },
+    ...overrides,
+  };
+}
+
+class FakeEventSource {
+  static last: FakeEventSource | null = null;
+  listeners: Record<string, ((e: { data: string }) => void)[]> = {};
+  closed = false;
+  constructor(public url: string) {
+    FakeEventSource.last = this;
+  }
+  addEventListener(type: string, fn: (e: { data: string }) => void) {
+    (this.listeners[type] ??= []).push(fn);
+  }
+  emit(type: string, data: unknown) {
+    for (const fn of this.listeners[type] ?? []) fn({ data: JSON.stringify(data) });
+  }
+  close() {
+    this.closed = true;
+  }
+}
+
+/** fetch stub whose responses resolve when the test says so. */
+function deferredFetch() {
+  const pending: { url: string; resolve: (m: TgImgManifest) => void }[] = [];
+  const fn = vi.fn((url: string) =>
+    new Promise((resolve) => {
+      pending.push({ url, resolve: (m) => resolve({ ok: true, json: async () => m }) });
+    }),
+  );
+  return { fn, pending };
+}
+
+const flush = () => new Promise((r) => setTimeout(r, 0));
+
+afterEach(() => {
+  vi.unstubAllGlobals();
+  FakeEventSource.last = null;
+});
+
+describe('resolveDevManifest', () => {
+  it('resolves a relative base_path against the server', () => {
+    const m = resolveDevManifest(makeManifest(), 'http://127.0.0.1:8790');
+    expect(m.base_path).toBe('http://127.0.0.1:8790/');
+  });
+
+  it('keeps an absolute base_path', () => {
+    const m = makeManifest({ base_path: 'https://cdn.example.com/img/' });
+    expect(resolveDevManifest(m, 'http://127.0.0.1:8790/')).toBe(m);
+  });
+});
+
+describe('subscribeManifest', () => {
+  it('fetches the manifest on every event', async () => {
+    vi.stubGlobal('EventSource', FakeEventSource);
+    const { fn, pending } = deferredFetch();
+    vi.stubGlobal('fetch', fn);
+    const got: [TgImgManifest, number][] = [];
+    subscribeManifest('http://127.0.0.1:8790/', (m, e) => got.push([m, e.generation]));
+
+    const es = FakeEventSource.last!;
+    expect(es.url).toBe('http://127.0.0.1:8790/events');
+    es.emit('manifest', { generation: 1 });
+    expect(pending[0].url).toBe('http://127.0.0.1:8790/tgimg.manifest.json');
+    pending[0].resolve(makeManifest({ profile: 'first' }));
+    await flush();
+
+    es.emit('manifest', { generation: 2, changed: ['hero'] });
+    pending[1].resolve(makeManifest({ profile: 'second' }));
+    await flush();
+
+    expect(got.map(([m, g]) => [m.profile, g])).toEqual([['first', 1], ['second', 2]]);
+    expect(got[1][0].base_path).toBe('http://127.0.0.1:8790/');
+  });
+
+  it('ignores a stale fetch that finishes last', async () => {
+    vi.stubGlobal('EventSource', FakeEventSource);
+    const { fn, pending } = deferredFetch();
+    vi.stubGlobal('fetch', fn);
+    const got: string[] = [];
+    subscribeManifest('http://dev/', (m) => got.push(m.profile));
+
+    const es = FakeEventSource.last!;
+    es.emit('manifest', { generation: 1 });
+    es.emit('manifest', { generation: 2 });
+    pending[1].resolve(makeManifest({ profile: 'new' }));
+    await flush();
+    pending[0].resolve(makeManifest({ profile: 'old' }));
+    await flush();
+
+    expect(got).toEqual(['new']);
+  });
+
+  it('closes the stream on unsubscribe', async () => {
+    vi.stubGlobal('EventSource', FakeEventSource);
+    const { fn, pending } = deferredFetch();
+    vi.stubGlobal('fetch', fn);
+    const onManifest = vi.fn();
+    const unsubscribe = subscribeManifest('http://dev/', onManifest);
+
+    const es = FakeEventSource.last!;
+    es.emit('manifest', { generation: 1 });
+    unsubscribe();
+    pending[0].resolve(makeManifest());
+    await flush();
+
+    expect(es.closed).toBe(true);
+    expect(onManifest).not.toHaveBeenCalled();
+  });
+
+  it('is a no-op without EventSource', () => {
+    vi.stubGlobal('EventSource', undefined);
+    const unsubscribe = subscribeManifest('http://dev/', () => {});
+    expect(FakeEventSource.last).toBeNull();
+    unsubscribe();
+  });
+});
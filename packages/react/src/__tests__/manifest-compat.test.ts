@@ -9,7 +9,7 @@
  */
 
 import { describe, expect, it } from 'vitest';
-import { validateManifestVersion } from '../manifest';
+import { assetError, parseAssetRef, themedAsset, validateManifestVersion } from '../manifest';
 import type { TgImgManifest } from '../types';
 import { MANIFEST_VERSION_MIN, MANIFEST_VERSION_MAX } from '../types';
 
@@ -103,3 +103,84 @@ describe('manifest schema roundtrip', () => {
     expect(validateManifestVersion(parsed)).toBeNull();
   });
 });
+
+describe('asset references', () => {
+  const asset = {
+    original: { width: 800, height: 600, format: 'jpeg', size: 100000, has_alpha: false },
+    thumbhash: 'YJqGPQw7sFlslqhFafSE+Q6oJ1h2iA==',
+    aspect_ratio: 1.3333,
+    variants: [],
+  };
+  const m = makeManifest({
+    assets: { 'promo/banner': asset, 'icons/star@2x': asset },
+    aliases: { hero: 'promo/banner' },
+  });
+
+  it('splits a breakpoint suffix from keys and aliases', () => {
+    expect(parseAssetRef(m, 'promo/banner@md')).toEqual({ asset, breakpoint: 'md' });
+    expect(parseAssetRef(m, 'hero@lg')).toEqual({ asset, breakpoint: 'lg' });
+  });
+
+  it('prefers keys that contain "@"', () => {
+    expect(parseAssetRef(m, 'icons/star@2x')).toEqual({ asset });
+  });
+
+  it('returns no asset for unknown keys', () => {
+    expect(parseAssetRef(m, 'missing@md').asset).toBeUndefined();
+  });
+});
+
+describe('build errors', () => {
+  const failed = { source: 'promo/broken.png', error: 'decode: png: invalid format' };
+  const m = makeManifest({
+    aliases: { teaser: 'promo/broken' },
+    errors: { 'promo/broken': failed },
+  });
+
+  it('reports the recorded error of a key or alias', () => {
+    expect(parseAssetRef(m, 'promo/broken').asset).toBeUndefined();
+    expect(assetError(m, 'promo/broken')).toEqual(failed);
+    expect(assetError(m, 'teaser')).toEqual(failed);
+  });
+
+  it('reports nothing for unknown keys', () => {
+    expect(assetError(m, 'promo/typo')).toBeUndefined();
+    expect(assetError(makeManifest(), 'promo/broken')).toBeUndefined();
+  });
+});
+
+describe('theme renditions', () => {
+  const original = { width: 64, height: 64, format: 'png', size: 900, has_alpha: true };
+  const variant = (path: string) => ({ format: 'png', width: 64, height: 64, size: 400, hash: 'h', path });
+  const asset = {
+    original,
+    thumbhash: 'light',
+    aspect_ratio: 1,
+    variants: [variant('star.64.64.a.png')],
+    themes: {
+      dark: {
+        original,
+        thumbhash: 'dark',
+        aspect_ratio: 1,
+        variants: [variant('star@dark.64.64.b.png')],
+        recolor: { invert: true },
+      },
+    },
+  };
+
+  it('swaps in the rendition for a known theme', () => {
+    const dark = themedAsset(asset, 'dark');
+    expect(dark.thumbhash).toBe('dark');
+    expect(dark.variants[0]?.path).toBe('star@dark.64.64.b.png');
+    expect(dark.themes).toBe(asset.themes);
+  });
+
+  it('returns the same object for the same asset and theme', () => {
+    expect(themedAsset(asset, 'dark')).toBe(themedAsset(asset, 'dark'));
+  });
+
+  it('falls back to the asset itself', () => {
+    expect(themedAsset(asset, 'tinted')).toBe(asset);
+    expect(themedAsset(asset, undefined)).toBe(asset);
+  });
+});
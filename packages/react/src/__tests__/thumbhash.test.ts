@@ -11,7 +11,7 @@ const SAMPLE_HASH_B64 = 'YJqGPQw7sFlslqhFafSE+Q6oJ1h2iA==';
 
 // ── CROSS-LANG golden hashes from Go encoder (TestGoldenGenerate) ──
 // If you update the Go encoder, regenerate these with:
-//   cd cli && go test ./internal/thumbhash/ -run TestGoldenGenerate -v
+//   cd thumbhash && go test -run TestGoldenGenerate -v
 const GOLDEN_FIXTURES: Record<string, { hex: string; sum: number; pRaw: number; qRaw: number; pDC: number; qDC: number }> = {
   solid_red:   { hex: 'd5eb0307000078707876887797878788898778a88888778c8778888878787870978778709787', sum: 4634, pRaw: 47, qRaw: 62, pDC: 0.5161, qDC: 1.0 },
   solid_green: { hex: 'd50b001400008f78788a878758887877867777870886779f07', sum: 2432, pRaw: 47, qRaw: 0, pDC: 0.5161, qDC: -1.0 },
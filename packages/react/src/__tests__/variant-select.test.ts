@@ -1,6 +1,11 @@
 import { describe, expect, it } from 'vitest';
 import type { FormatSupport, TgImgVariant } from '../types';
-import { selectVariant, buildSrcSet } from '../variant-select';
+import {
+  selectVariant,
+  buildSrcSet,
+  findOriginal,
+  breakpointWidth,
+} from '../variant-select';
 
 // Helper to create test variants.
 function makeVariant(
@@ -125,6 +130,28 @@ describe('selectVariant', () => {
     expect(result!.variant.width).toBe(1280);
   });
 
+  it('prefers a smaller variant in another format when avif skips small widths', () => {
+    // format_min_widths: { avif: 400 } — no avif at 320.
+    const mixed = variants.filter((v) => !(v.format === 'avif' && v.width < 400));
+    const small = selectVariant({
+      variants: mixed,
+      containerWidth: 300,
+      dpr: 1,
+      formats: ALL_FORMATS,
+    });
+    expect(small!.format).toBe('webp');
+    expect(small!.variant.width).toBe(320);
+
+    const large = selectVariant({
+      variants: mixed,
+      containerWidth: 500,
+      dpr: 1,
+      formats: ALL_FORMATS,
+    });
+    expect(large!.format).toBe('avif');
+    expect(large!.variant.width).toBe(640);
+  });
+
   it('returns null for empty variants', () => {
     const result = selectVariant({
       variants: [],
@@ -190,4 +217,71 @@ describe('buildSrcSet', () => {
 
     expect(srcSet).toContain('/assets/test.');
   });
+
+  it('uses density descriptors when requested', () => {
+    const dense: TgImgVariant[] = [
+      { ...makeVariant('webp', 96, 96), density: 2 },
+      { ...makeVariant('webp', 48, 48), density: 1 },
+    ];
+    const srcSet = buildSrcSet(dense, NO_AVIF, './', 'x');
+
+    expect(srcSet).toBe('./test.48.48.hash.webp 1x, ./test.96.96.hash.webp 2x');
+  });
+});
+
+describe('original variants', () => {
+  const withOriginal: TgImgVariant[] = [
+    ...variants,
+    { ...makeVariant('jpeg', 4000, 2250), original: true },
+  ];
+
+  it('never selects the copied-through original', () => {
+    const result = selectVariant({
+      variants: withOriginal,
+      containerWidth: 3000,
+      dpr: 2,
+      formats: JPEG_ONLY,
+    });
+
+    expect(result!.variant.original).toBeUndefined();
+    expect(result!.variant.width).toBe(1280);
+  });
+
+  it('excludes the original from srcset', () => {
+    const srcSet = buildSrcSet(withOriginal, JPEG_ONLY, './');
+
+    expect(srcSet).not.toContain('4000w');
+  });
+
+  it('finds the original', () => {
+    expect(findOriginal(withOriginal)!.width).toBe(4000);
+    expect(findOriginal(variants)).toBeUndefined();
+  });
+});
+
+describe('breakpoints', () => {
+  const named: TgImgVariant[] = variants.map((v) =>
+    v.width === 640 ? { ...v, breakpoint: 'md' } : v,
+  );
+
+  it('resolves a breakpoint to its tagged width', () => {
+    expect(breakpointWidth(named, 'md')).toBe(640);
+  });
+
+  it('falls back to the widest variant when the breakpoint was not generated', () => {
+    expect(breakpointWidth(named, 'xl')).toBe(1280);
+    expect(breakpointWidth([], 'md')).toBeNull();
+  });
+
+  it('selects for the breakpoint width instead of the container', () => {
+    const result = selectVariant({
+      variants: named,
+      containerWidth: breakpointWidth(named, 'md')!,
+      dpr: 1,
+      formats: NO_AVIF,
+    });
+
+    expect(result!.variant.width).toBe(640);
+    expect(result!.variant.breakpoint).toBe('md');
+  });
 });
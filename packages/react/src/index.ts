@@ -5,10 +5,26 @@ export { TgImg, TgImgProvider } from './TgImg';
 
 // Hooks.
 export { useTgImg } from './use-tgimg';
-export { useManifest, useAsset, ManifestContext, validateManifestVersion } from './manifest';
+export {
+  useManifest,
+  useAsset,
+  lookupAsset,
+  parseAssetRef,
+  assetError,
+  themedAsset,
+  telegramColorScheme,
+  ManifestContext,
+  validateManifestVersion,
+} from './manifest';
 
 // Utilities.
-export { selectVariant, buildSrcSet } from './variant-select';
+export {
+  selectVariant,
+  buildSrcSet,
+  formatSrcSet,
+  findOriginal,
+  breakpointWidth,
+} from './variant-select';
 export {
   thumbHashToRGBA,
   thumbHashToDataURL,
@@ -34,13 +50,27 @@ export {
   CHROMA_INSTANT,
 } from './transition';
 export type { TransitionMode, ResolvedTransition } from './transition';
+export type { AssetRef } from './manifest';
+
+// Live reload (development).
+export { subscribeManifest, resolveDevManifest } from './live-reload';
+export type { ManifestEvent } from './live-reload';
 
 // Types.
 export type {
   TgImgManifest,
+  TgImgBuildInfo,
+  TgImgBuildConfig,
+  TgImgProfileOverride,
   TgImgAsset,
+  TgImgThemedAsset,
+  TgImgRecolor,
+  TgImgServerAsset,
   TgImgVariant,
+  TgImgCrop,
+  TgImgTelegramFile,
   TgImgStats,
+  TgImgAssetError,
   TgImgProps,
   ImageFormat,
   FormatSupport,
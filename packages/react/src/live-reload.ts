@@ -0,0 +1,76 @@
+/**
+ * Live reload from `tgimg serve`.
+ *
+ * The dev server streams a server-sent "manifest" event on /events when a
+ * client connects and after every rebuild. Each event triggers a fetch of
+ * the live manifest, whose relative base_path is resolved against the dev
+ * server so variant URLs keep working from the app's own origin. Changed
+ * sources get new variant paths, so swapping the manifest swaps images.
+ */
+
+import type { TgImgManifest } from './types';
+
+/** Data of a "manifest" event from `tgimg serve`. */
+export interface ManifestEvent {
+  /** Rebuild count, from 1. */
+  generation: number;
+  /** Asset keys added or modified by the rebuild. */
+  changed?: string[];
+  /** Asset keys removed by the rebuild. */
+  removed?: string[];
+}
+
+/**
+ * Resolve a dev server manifest's base_path against the server URL.
+ * Absolute base paths are kept.
+ */
+export function resolveDevManifest(manifest: TgImgManifest, serverUrl: string): TgImgManifest {
+  const base = new URL(manifest.base_path || './', withSlash(serverUrl)).href;
+  return base === manifest.base_path ? manifest : { ...manifest, base_path: base };
+}
+
+/**
+ * Subscribe to manifest changes of the `tgimg serve` instance at
+ * serverUrl (e.g. "http://127.0.0.1:8790/"). onManifest receives the
+ * current manifest on connect and the new one after every rebuild.
+ * Returns an unsubscribe function. Without EventSource (SSR, tests) it
+ * does nothing.
+ */
+export function subscribeManifest(
+  serverUrl: string,
+  onManifest: (manifest: TgImgManifest, event: ManifestEvent) => void,
+): () => void {
+  if (typeof EventSource === 'undefined') return () => {};
+  const base = withSlash(serverUrl);
+  const source = new EventSource(new URL('events', base).href);
+  let closed = false;
+  let latest = 0;
+
+  source.addEventListener('manifest', (e) => {
+    let event: ManifestEvent;
+    try {
+      event = JSON.parse((e as MessageEvent).data);
+    } catch {
+      return;
+    }
+    latest = event.generation;
+    fetch(new URL('tgimg.manifest.json', base).href, { cache: 'no-store' })
+      .then((res) => (res.ok ? res.json() : Promise.reject(new Error(`HTTP ${res.status}`))))
+      .then((manifest: TgImgManifest) => {
+        // A later rebuild may have finished first; keep the newest.
+        if (!closed && event.generation === latest) {
+          onManifest(resolveDevManifest(manifest, base), event);
+        }
+      })
+      .catch((err) => console.warn(`[tgimg] live reload: ${err}`));
+  });
+
+  return () => {
+    closed = true;
+    source.close();
+  };
+}
+
+function withSlash(url: string): string {
+  return url.endsWith('/') ? url : `${url}/`;
+}
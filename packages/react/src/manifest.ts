@@ -3,7 +3,7 @@
  */
 
 import { createContext, useContext } from 'react';
-import type { TgImgAsset, TgImgManifest } from './types';
+import type { TgImgAsset, TgImgAssetError, TgImgManifest } from './types';
 import { MANIFEST_VERSION_MIN, MANIFEST_VERSION_MAX } from './types';
 
 /** React context for the manifest data. */
@@ -29,7 +29,90 @@ export function useManifest(): TgImgManifest {
  */
 export function useAsset(key: string): TgImgAsset | undefined {
   const manifest = useManifest();
-  return manifest.assets[key];
+  return lookupAsset(manifest, key);
+}
+
+/**
+ * Look up an asset by key, following a manifest alias if the key is not
+ * an asset key itself. A trailing "@breakpoint" ("hero@md") is ignored;
+ * see parseAssetRef.
+ */
+export function lookupAsset(
+  manifest: TgImgManifest,
+  key: string,
+): TgImgAsset | undefined {
+  return parseAssetRef(manifest, key).asset;
+}
+
+/** An asset reference resolved by parseAssetRef. */
+export interface AssetRef {
+  asset: TgImgAsset | undefined;
+  /** Breakpoint name from a "key@name" reference. */
+  breakpoint?: string;
+}
+
+/**
+ * Resolve "key", "alias" or either with "@breakpoint". The whole string
+ * is tried first, since keys like "icon@2x" may contain "@".
+ */
+export function parseAssetRef(manifest: TgImgManifest, ref: string): AssetRef {
+  const direct = lookupKey(manifest, ref);
+  if (direct) return { asset: direct };
+  const at = ref.lastIndexOf('@');
+  if (at > 0) {
+    const asset = lookupKey(manifest, ref.slice(0, at));
+    if (asset) return { asset, breakpoint: ref.slice(at + 1) };
+  }
+  return { asset: undefined };
+}
+
+function lookupKey(manifest: TgImgManifest, key: string): TgImgAsset | undefined {
+  const asset = manifest.assets[key];
+  if (asset) return asset;
+  const target = manifest.aliases?.[key];
+  return target != null ? manifest.assets[target] : undefined;
+}
+
+/**
+ * The recorded build failure of the asset key or alias refers to, or
+ * undefined. Tells an asset that failed to build apart from a wrong key.
+ */
+export function assetError(manifest: TgImgManifest, key: string): TgImgAssetError | undefined {
+  if (!manifest.errors) return undefined;
+  return manifest.errors[key] ?? manifest.errors[manifest.aliases?.[key] ?? ''];
+}
+
+const themedCache = new WeakMap<TgImgAsset, Map<string, TgImgAsset>>();
+
+/**
+ * The rendition of asset for theme ("light", "dark", "tinted"): its
+ * `themes` entry in place of the asset's own fields, or the asset itself
+ * when it has none. Results are cached, so the same inputs return the
+ * same object and memoized selections stay stable.
+ */
+export function themedAsset(asset: TgImgAsset, theme: string | undefined): TgImgAsset {
+  const rendition = theme ? asset.themes?.[theme] : undefined;
+  if (!rendition) return asset;
+  let byTheme = themedCache.get(asset);
+  if (!byTheme) {
+    byTheme = new Map();
+    themedCache.set(asset, byTheme);
+  }
+  let out = byTheme.get(theme!);
+  if (!out) {
+    out = { ...asset, ...rendition };
+    byTheme.set(theme!, out);
+  }
+  return out;
+}
+
+/**
+ * Telegram WebApp `colorScheme` ("light" or "dark"), or undefined outside
+ * a Mini App. The default theme of `<TgImg>`.
+ */
+export function telegramColorScheme(): string | undefined {
+  if (typeof window === 'undefined') return undefined;
+  return (window as any).Telegram?.WebApp?.colorScheme;
 }
 
 /**
@@ -42,7 +125,7 @@ export function resolveAsset(
 ): TgImgAsset | undefined {
   const manifest = directManifest ?? contextManifest;
   if (!manifest) return undefined;
-  return manifest.assets[key];
+  return lookupAsset(manifest, key);
 }
 
 /**
@@ -9,9 +9,103 @@ export interface TgImgManifest {
   generated_at: string;
   profile: string;
   base_path: string;
-  build_info?: { workers: number; pool_entry_kb: number };
+  build_info?: TgImgBuildInfo;
+  /** Effective build configuration. Not used by the runtime. */
+  config?: TgImgBuildConfig;
   assets: Record<string, TgImgAsset>;
   stats: TgImgStats;
+  /** Logical name → asset key (e.g. "hero" → "banners/spring-2025"). */
+  aliases?: Record<string, string>;
+  /**
+   * Sources the build failed to process, by asset key ("key@theme" for a
+   * theme rendition). Their assets are missing from `assets`.
+   */
+  errors?: Record<string, TgImgAssetError>;
+}
+
+/** A source `tgimg build` could not process. */
+export interface TgImgAssetError {
+  /** Path relative to the build's input directory. */
+  source: string;
+  theme?: string;
+  error: string;
+}
+
+/** Build diagnostics recorded by the CLI. Not used by the runtime. */
+export interface TgImgBuildInfo {
+  workers: number;
+  pool_entry_kb: number;
+  tool_version?: string;
+  duration_ms?: number;
+  stages?: { scan_ms: number; process_ms: number; collect_ms: number };
+  encoders?: Record<string, string>;
+  host?: { goos: string; goarch: string; num_cpu: number; go_version: string };
+}
+
+/** Profile fields replaced for sources matching an override pattern. */
+export interface TgImgProfileOverride {
+  /** Profile used as the base before the other fields apply. */
+  profile?: string;
+  widths?: number[];
+  formats?: string[];
+  quality?: number;
+  dprs?: number[];
+  descriptor?: 'w' | 'x';
+  max_width?: number;
+  min_width?: number;
+  heights?: number[];
+  crops?: string[];
+  gravity?: string;
+  margin?: number;
+  breakpoints?: Record<string, number>;
+  format_min_widths?: Record<string, number>;
+  effort?: 'fast' | 'balanced' | 'max';
+}
+
+/** Effective configuration a build ran with (resolved profile + options). */
+export interface TgImgBuildConfig {
+  widths: number[];
+  formats: string[];
+  quality: number;
+  /** True when some DPR is above 1×. */
+  retina: boolean;
+  /** Device pixel ratios generated per width, e.g. [1, 2, 3]. */
+  dprs?: number[];
+  descriptor?: 'w' | 'x';
+  no_regress_size: boolean;
+  copy_original?: boolean;
+  emit_placeholder_datauri?: boolean;
+  ignore?: string[];
+  max_width?: number;
+  /** Sources narrower than this got a single variant at their own width. */
+  min_width?: number;
+  /** Target heights, generated as proportional widths. */
+  heights?: number[];
+  /** Fixed "WxH" crop boxes. */
+  crops?: string[];
+  /** Crop anchor for assets without a focal point; default "center". */
+  gravity?: string;
+  /** Crop padding per side, as a fraction of the box. */
+  margin?: number;
+  /** Crop focal points by asset key, as [x, y] fractions of the source. */
+  focus?: Record<string, [number, number]>;
+  /** Named profile widths, e.g. { md: 640 }. */
+  breakpoints?: Record<string, number>;
+  /** Narrowest variant width encoded per format, e.g. { avif: 200 }. */
+  format_min_widths?: Record<string, number>;
+  /** Encoding effort; absent for the default, balanced. */
+  effort?: 'fast' | 'max';
+  /** Hard per-variant constraints, e.g. Telegram sticker rules. */
+  limits?: { max_side?: number; exact_side?: boolean; max_bytes?: number };
+  /** Per-glob profile overrides, keyed by input path pattern. */
+  overrides?: Record<string, TgImgProfileOverride>;
+  /** Image CDN rendering the variants ("imgproxy", "cloudflare"). */
+  cdn?: string;
+  /** Present when asset keys kept the file names' Unicode form. */
+  unicode_keys?: 'none';
+  /** Recolor rules from tgimg.recolor.json, by glob and then theme. */
+  recolor?: Record<string, Record<string, TgImgRecolor>>;
+  fingerprint: string;
 }
 
 /** A single asset with its original info, thumbhash, and variants. */
@@ -27,7 +121,57 @@ export interface TgImgAsset {
   aspect_ratio: number;
   /** Average color of original [R, G, B] (0–255). Optional, set by CLI. */
   avg_color?: [number, number, number];
+  /**
+   * Thumbhash decoded at build time as a PNG data URI.
+   * Only present with `tgimg build --emit-placeholder-datauri`.
+   */
+  placeholder?: string;
+  /**
+   * Srcset descriptor kind. `"x"` means variants carry `density` and
+   * srcsets use `1x, 2x` (fixed-size UI). Absent means `"w"`.
+   */
+  descriptor?: 'w' | 'x';
+  variants: TgImgVariant[];
+  /**
+   * Theme renditions from `logo@dark.png`-style sources or recolor rules,
+   * keyed by theme: Telegram `colorScheme` ("light", "dark") or "tinted".
+   * The asset itself is the default. `<TgImg theme>` selects one.
+   */
+  themes?: Record<string, TgImgThemedAsset>;
+}
+
+/** One color-scheme rendition of an asset. */
+export interface TgImgThemedAsset {
+  original: TgImgAsset['original'];
+  thumbhash: string;
+  aspect_ratio: number;
+  avg_color?: [number, number, number];
+  placeholder?: string;
   variants: TgImgVariant[];
+  /** Rule that generated this rendition; absent for a paired source file. */
+  recolor?: TgImgRecolor;
+}
+
+/** A `tgimg.recolor.json` rule: exactly one of invert, tint or replace. */
+export interface TgImgRecolor {
+  /** Mirror lightness, keeping hue and alpha. */
+  invert?: boolean;
+  /** "#rrggbb" painted over every pixel, keeping alpha. */
+  tint?: string;
+  /** "#rrggbb" → "#rrggbb" color swaps. */
+  replace?: Record<string, string>;
+  /** Per-channel slack for replace matches. */
+  tolerance?: number;
+}
+
+/** Response of `tgimg server` for an uploaded or looked-up asset. */
+export interface TgImgServerAsset {
+  key: string;
+  /** base_path + path of each variant, including themed ones. */
+  urls: string[];
+  asset: TgImgAsset;
+  /** Variants an upload did not write, e.g. larger than the original. */
+  skipped?: { key: string; format: string; width: number; height: number; reason: string }[];
 }
 
 /** One encoded variant of an asset (specific format + dimensions). */
@@ -35,9 +179,59 @@ export interface TgImgVariant {
   format: string;  // "avif" | "webp" | "jpeg" | "png"
   width: number;
   height: number;
+  /** 0 for `tgimg build --cdn` variants, which are never encoded locally. */
   size: number;
   hash: string;
+  /** Relative to base_path, or an absolute image CDN URL with `--cdn`. */
   path: string;
+  /** Encoder wall time in ms (build diagnostics). */
+  encode_ms?: number;
+  /** Effective encoder quality; absent for lossless formats. */
+  quality?: number;
+  /** Pixel density (1, 2, …) for assets with `descriptor: "x"`. */
+  density?: number;
+  /**
+   * Profile breakpoint name ("md") of this width, set on the 1× variants
+   * of named widths. `<TgImg src="hero@md">` selects for that width.
+   */
+  breakpoint?: string;
+  /**
+   * Untouched source copied through by `tgimg build --copy-original`.
+   * Never selected for display; intended for downloads and zoom views.
+   */
+  original?: boolean;
+  /**
+   * Fixed-size crop for a profile box. Its aspect ratio differs from the
+   * asset's, so it is never part of responsive selection; pick it by box.
+   */
+  crop?: TgImgCrop;
+  /** Telegram-hosted copy recorded by `tgimg publish-telegram`. */
+  telegram?: TgImgTelegramFile;
+}
+
+/** The box a crop variant was made for and the source region it shows. */
+export interface TgImgCrop {
+  /** Profile box at 1×, e.g. "1080x1920". */
+  box: string;
+  /** Cropped region in source pixels. */
+  x: number;
+  y: number;
+  width: number;
+  height: number;
+  /** Fraction of the box padded on each side, e.g. 0.1464 for circle-safe avatars. */
+  margin?: number;
+}
+
+/**
+ * A variant uploaded through the Bot API. `file_id` is bot-specific and
+ * must be resolved to a download URL server-side (getFile needs the bot
+ * token), so apps reach it through their own proxy.
+ */
+export interface TgImgTelegramFile {
+  file_id: string;
+  file_unique_id: string;
+  /** "document" keeps the bytes; "photo" is re-encoded by Telegram. */
+  kind: 'document' | 'photo';
 }
 
 /** Build statistics. */
@@ -47,11 +241,17 @@ export interface TgImgStats {
   total_assets: number;
   total_variants: number;
   skipped_regress?: number;
+  /** Entries in the manifest's `errors`. */
+  failed_assets?: number;
 }
 
 /** Props for the <TgImg /> component. */
 export interface TgImgProps {
-  /** Asset key from manifest (e.g. "promo/banner"). */
+  /**
+   * Asset key from manifest (e.g. "promo/banner"). Append a profile
+   * breakpoint ("promo/banner@md") to select for that width instead of
+   * the measured container.
+   */
   src: string;
 
   /** Alt text for accessibility. */
@@ -105,6 +305,14 @@ export interface TgImgProps {
   /** Base URL prefix for asset paths. Default: manifest base_path. */
   baseUrl?: string;
 
+  /**
+   * Theme rendition to show: "light", "dark", "tinted" or any key of the
+   * asset's `themes`. Assets without that rendition show their default.
+   * Default: Telegram WebApp `colorScheme` inside a Mini App. Pass it
+   * explicitly to re-render on `themeChanged`.
+   */
+  theme?: string;
+
   /** Called when the full image has loaded and decoded. */
   onLoad?: () => void;
 
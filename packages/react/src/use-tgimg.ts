@@ -28,7 +28,7 @@ import {
 import { detectFormats, getFormatsSync } from './format-detect';
 import { base64ToUint8Array, thumbHashToDataURL } from './thumbhash';
 import type { FormatSupport, TgImgAsset } from './types';
-import { selectVariant } from './variant-select';
+import { formatSrcSet, selectVariant } from './variant-select';
 
 // SSR-safe useLayoutEffect: falls back to useEffect on the server.
 const useIsomorphicLayoutEffect =
@@ -42,6 +42,11 @@ export interface UseTgImgOptions {
   chroma?: number;
   /** Target avg_color from manifest — enables adaptive chroma + bias correction. */
   avgColor?: readonly number[];
+  /**
+   * Fixed layout width in CSS px (from a named breakpoint). Replaces the
+   * measured container width in variant selection.
+   */
+  slotWidth?: number;
 }
 
 export interface UseTgImgResult {
@@ -78,7 +83,7 @@ function ensureFormatDetection(
 // ─── hook ─────────────────────────────────────────────────────
 
 export function useTgImg(options: UseTgImgOptions): UseTgImgResult {
-  const { asset, priority, baseUrl, chroma, avgColor } = options;
+  const { asset, priority, baseUrl, chroma, avgColor, slotWidth } = options;
 
   // --- Format detection (one global probe, cached) ---
   const [formats, setFormats] = useState<FormatSupport | null>(getFormatsSync);
@@ -138,31 +143,31 @@ export function useTgImg(options: UseTgImgOptions): UseTgImgResult {
   const dpr =
     typeof window !== 'undefined' ? window.devicePixelRatio || 1 : 1;
 
+  const layoutWidth = slotWidth ?? containerWidth;
   const selection = useMemo(() => {
-    if (!asset || !formats || containerWidth <= 0) return null;
+    if (!asset || !formats || layoutWidth <= 0) return null;
     return selectVariant({
       variants: asset.variants,
-      containerWidth,
+      containerWidth: layoutWidth,
       dpr,
       formats,
     });
-  }, [asset, formats, containerWidth, dpr]);
+  }, [asset, formats, layoutWidth, dpr]);
 
   const imgSrc = useMemo(() => {
     if (!selection) return null;
     return `${baseUrl}${selection.variant.path}`;
   }, [selection, baseUrl]);
 
-  // srcset: all widths of the chosen format.
+  // srcset: all widths (or densities) of the chosen format.
   const srcSet = useMemo(() => {
     if (!asset || !selection) return null;
-    const fmt = selection.format;
-    const candidates = asset.variants.filter((v) => v.format === fmt);
-    if (candidates.length === 0) return null;
-    return candidates
-      .sort((a, b) => a.width - b.width)
-      .map((v) => `${baseUrl}${v.path} ${v.width}w`)
-      .join(', ');
+    return formatSrcSet(
+      asset.variants,
+      selection.format,
+      baseUrl,
+      asset.descriptor ?? 'w',
+    );
   }, [asset, selection, baseUrl]);
 
   // --- Loading state ---
@@ -3,9 +3,13 @@
  *
  * Given a container size, DPR, and supported formats — picks the
  * optimal image variant from the manifest. Prefers:
- *   1. Best supported format (avif > webp > jpeg > png)
- *   2. Smallest width >= required width
- *   3. Falls back to largest available if none is big enough
+ *   1. Smallest width >= required width in any supported format
+ *   2. Falls back to largest available if none is big enough
+ *   3. Best supported format at that width (avif > webp > jpeg > png)
+ *
+ * Formats usually share the same widths. When they don't (per-format
+ * minimum widths, size-regression skips), picking the width first keeps
+ * a small slot on a small WebP instead of a larger AVIF.
  */
 
 import type { FormatSupport, ImageFormat, TgImgVariant } from './types';
@@ -42,7 +46,8 @@ export interface SelectionResult {
  * Select the best variant for the current context.
  */
 export function selectVariant(input: SelectionInput): SelectionResult | null {
-  const { variants, containerWidth, dpr, formats } = input;
+  const { containerWidth, dpr, formats } = input;
+  const variants = input.variants.filter((v) => !v.original && !v.crop);
 
   if (variants.length === 0) return null;
 
@@ -50,28 +55,33 @@ export function selectVariant(input: SelectionInput): SelectionResult | null {
 
   // Determine best supported format.
   const formatOrder = getFormatOrder(formats);
-
-  // Try each format in priority order.
-  for (const format of formatOrder) {
-    const candidates = variants.filter((v) => v.format === format);
-    if (candidates.length === 0) continue;
-
-    // Sort by width ascending.
-    candidates.sort((a, b) => a.width - b.width);
-
-    // Find smallest variant >= required width.
-    let selected = candidates.find((v) => v.width >= requiredWidth);
-
-    // Fallback: use largest available.
-    if (!selected) {
-      selected = candidates[candidates.length - 1]!;
+  const candidates = variants.filter((v) => formatOrder.includes(v.format));
+
+  if (candidates.length > 0) {
+    // Smallest width >= required across supported formats, else the largest.
+    let width = -1;
+    let largest = 0;
+    for (const v of candidates) {
+      largest = Math.max(largest, v.width);
+      if (v.width >= requiredWidth && (width < 0 || v.width < width)) {
+        width = v.width;
+      }
+    }
+    if (width < 0) width = largest;
+
+    // Best format at that width.
+    for (const format of formatOrder) {
+      const selected = candidates.find(
+        (v) => v.format === format && v.width === width,
+      );
+      if (selected) {
+        return {
+          variant: selected,
+          format: format as ImageFormat,
+          requestedWidth: requiredWidth,
+        };
+      }
     }
-
-    return {
-      variant: selected,
-      format: format as ImageFormat,
-      requestedWidth: requiredWidth,
-    };
   }
 
   // Absolute fallback: pick the first variant.
@@ -82,6 +92,33 @@ export function selectVariant(input: SelectionInput): SelectionResult | null {
   };
 }
 
+/**
+ * Layout width in CSS px of a named breakpoint: the width of the variant
+ * tagged with it. When the source was too narrow for that breakpoint, the
+ * widest variant stands in. Returns null if the asset has no variants.
+ */
+export function breakpointWidth(
+  variants: TgImgVariant[],
+  name: string,
+): number | null {
+  const tagged = variants.find((v) => v.breakpoint === name);
+  if (tagged) return tagged.width;
+  let widest: number | null = null;
+  for (const v of variants) {
+    if (!v.original && !v.crop && (widest == null || v.width > widest)) {
+      widest = v.width;
+    }
+  }
+  return widest;
+}
+
+/**
+ * Find the copied-through original of an asset, if the build kept one.
+ */
+export function findOriginal(variants: TgImgVariant[]): TgImgVariant | undefined {
+  return variants.find((v) => v.original);
+}
+
 /**
  * Get formats in priority order, filtered by browser support.
  */
@@ -102,25 +139,48 @@ function getFormatOrder(formats: FormatSupport): string[] {
  * Compute the set of srcset entries for a given asset,
  * filtered by the best supported format.
  * Useful for generating <img srcset="...">.
+ *
+ * With `descriptor: "x"` entries use density descriptors (`1x, 2x`)
+ * instead of width descriptors (`320w, 640w`).
  */
 export function buildSrcSet(
   variants: TgImgVariant[],
   formats: FormatSupport,
   baseUrl: string,
+  descriptor: 'w' | 'x' = 'w',
 ): string | null {
   const formatOrder = getFormatOrder(formats);
 
   for (const format of formatOrder) {
-    const candidates = variants
-      .filter((v) => v.format === format)
-      .sort((a, b) => a.width - b.width);
-
-    if (candidates.length === 0) continue;
-
-    return candidates
-      .map((v) => `${baseUrl}${v.path} ${v.width}w`)
-      .join(', ');
+    const srcSet = formatSrcSet(variants, format, baseUrl, descriptor);
+    if (srcSet) return srcSet;
   }
 
   return null;
 }
+
+/**
+ * Build the srcset for one format. Returns null if the asset has no
+ * variants in that format. Copied-through originals and crops are never
+ * included.
+ */
+export function formatSrcSet(
+  variants: TgImgVariant[],
+  format: string,
+  baseUrl: string,
+  descriptor: 'w' | 'x' = 'w',
+): string | null {
+  const candidates = variants
+    .filter((v) => v.format === format && !v.original && !v.crop)
+    .sort((a, b) => a.width - b.width);
+
+  if (candidates.length === 0) return null;
+
+  return candidates
+    .map((v) =>
+      descriptor === 'x' && v.density
+        ? `${baseUrl}${v.path} ${v.density}x`
+        : `${baseUrl}${v.path} ${v.width}w`,
+    )
+    .join(', ');
+}
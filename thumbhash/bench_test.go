@@ -158,6 +158,18 @@ func BenchmarkEncode_Gray_512(b *testing.B) {
 	}
 }
 
+// HasAlpha on an opaque 4K image scans every pixel.
+func BenchmarkHasAlpha_Opaque_3840x2160(b *testing.B) {
+	img := makeNRGBA(3840, 2160)
+	b.SetBytes(int64(len(img.Pix)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if HasAlpha(img) {
+			b.Fatal("opaque image reported as having alpha")
+		}
+	}
+}
+
 // ─── determinism: concurrent ─────────────────────────────────
 
 func TestDeterminism_Concurrent(t *testing.T) {
@@ -0,0 +1,190 @@
+package thumbhash
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/png"
+	"math"
+)
+
+// DefaultDecodeSize is the longest side, in pixels, of decoded placeholders.
+// Matches the JS runtime decoder.
+const DefaultDecodeSize = 32
+
+// ErrInvalidHash is returned when a hash is truncated or its header is
+// inconsistent with its length.
+var ErrInvalidHash = errors.New("thumbhash: invalid hash")
+
+// Decode reconstructs a placeholder image from a hash produced by Encode.
+// The longest side of the result is maxDim pixels (DefaultDecodeSize if
+// maxDim <= 0); the other side follows the aspect ratio stored in the hash.
+//
+// The p/q grid is not stored in the header, so it is recovered from the
+// hash length: the three possible grids (3×1, 3×2, 3×3) differ by three
+// bytes each and are therefore unambiguous.
+func Decode(hash []byte, maxDim int) (*image.NRGBA, error) {
+	if maxDim <= 0 {
+		maxDim = DefaultDecodeSize
+	}
+	if len(hash) < 6 {
+		return nil, ErrInvalidHash
+	}
+
+	header := uint32(hash[0]) | uint32(hash[1])<<8 | uint32(hash[2])<<16 | uint32(hash[3])<<24
+	header2 := uint32(hash[4]) | uint32(hash[5])<<8
+
+	lDC := float64(header&63) / 63
+	pDC := float64((header>>6)&63)/31 - 1
+	qDC := float64((header>>12)&63)/31 - 1
+	lScale := float64((header>>18)&31) / 31
+	hasAlpha := (header>>23)&1 == 1
+	dimFlag := max1(int((header >> 24) & 15))
+	isLandscape := (header>>28)&1 == 1
+	pScale := float64(header2&63) / 63
+	qScale := float64((header2>>6)&63) / 63
+
+	lLimit := 7
+	acOff := 6
+	aDC, aScale := 1.0, 0.0
+	if hasAlpha {
+		if len(hash) < 8 {
+			return nil, ErrInvalidHash
+		}
+		lLimit = 5
+		acOff = 8
+		alphaHdr := uint32(hash[6]) | uint32(hash[7])<<8
+		aDC = float64(alphaHdr&15) / 15
+		aScale = float64((alphaHdr>>4)&15) / 15
+	}
+
+	lx, ly := dimFlag, lLimit
+	if isLandscape {
+		lx, ly = lLimit, dimFlag
+	}
+	lN := lx*ly - 1
+	aN := 0
+	if hasAlpha {
+		aN = lN // alpha grid uses the same 5-limit as luminance
+	}
+
+	// Recover the p/q grid from the hash length.
+	px, py := 0, 0
+	for short := 1; short <= 3; short++ {
+		pN := 3*short - 1
+		if acOff+(lN+2*pN+aN+1)/2 == len(hash) {
+			px, py = short, 3
+			if isLandscape {
+				px, py = 3, short
+			}
+			break
+		}
+	}
+	if px == 0 {
+		return nil, ErrInvalidHash
+	}
+
+	nib := 0
+	readAC := func(n int, scale float64) []float64 {
+		ac := make([]float64, n)
+		for i := range ac {
+			b := hash[acOff+nib/2]
+			if nib%2 == 1 {
+				b >>= 4
+			}
+			ac[i] = (float64(b&15)/15*2 - 1) * scale
+			nib++
+		}
+		return ac
+	}
+	lAC := readAC(lN, lScale)
+	pAC := readAC(px*py-1, pScale)
+	qAC := readAC(px*py-1, qScale)
+	var aAC []float64
+	if hasAlpha {
+		aAC = readAC(aN, aScale)
+	}
+
+	// Output size from the luminance grid ratio.
+	w, h := maxDim, maxDim
+	if isLandscape {
+		h = max1(int(math.Round(float64(maxDim*ly) / float64(lx))))
+	} else if lx < ly {
+		w = max1(int(math.Round(float64(maxDim*lx) / float64(ly))))
+	}
+
+	maxNx := imax(lx, px)
+	maxNy := imax(ly, py)
+	fx := make([]float64, maxNx)
+	fy := make([]float64, maxNy)
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for cy := range fy {
+			fy[cy] = math.Cos(math.Pi / float64(h) * float64(cy) * (float64(y) + 0.5))
+		}
+		for x := 0; x < w; x++ {
+			for cx := range fx {
+				fx[cx] = math.Cos(math.Pi / float64(w) * float64(cx) * (float64(x) + 0.5))
+			}
+
+			l := lDC + decodeChan(lAC, lx, ly, fx, fy)
+			p := pDC + decodeChan(pAC, px, py, fx, fy)
+			q := qDC + decodeChan(qAC, px, py, fx, fy)
+			a := aDC
+			if hasAlpha {
+				a += decodeChan(aAC, lx, ly, fx, fy)
+			}
+
+			// LPQ → RGB (inverse of assembleHash).
+			b := l - 2.0/3.0*p
+			r := (3*l - b + q) / 2
+			g := r - q
+
+			off := y*img.Stride + x*4
+			img.Pix[off] = toByte(r)
+			img.Pix[off+1] = toByte(g)
+			img.Pix[off+2] = toByte(b)
+			img.Pix[off+3] = toByte(a)
+		}
+	}
+	return img, nil
+}
+
+// decodeChan sums the AC contributions of one channel at a pixel, given
+// the pixel's cosine factors. The ×2 matches the reference decoder.
+func decodeChan(ac []float64, nx, ny int, fx, fy []float64) float64 {
+	var v float64
+	j := 0
+	for cy := 0; cy < ny; cy++ {
+		fy2 := fy[cy] * 2
+		for cx := 0; cx < nx; cx++ {
+			if cx == 0 && cy == 0 {
+				continue
+			}
+			v += ac[j] * fx[cx] * fy2
+			j++
+		}
+	}
+	return v
+}
+
+// DataURI decodes hash at maxDim and returns the placeholder as a
+// base64 PNG data URI suitable for an <img src> or CSS background.
+func DataURI(hash []byte, maxDim int) (string, error) {
+	img, err := Decode(hash, maxDim)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	enc := &png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func toByte(v float64) uint8 {
+	return uint8(math.Round(float64(clamp01f(float32(v))) * 255))
+}
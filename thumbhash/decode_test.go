@@ -0,0 +1,61 @@
+package thumbhash
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestDecode_SolidRoundtrip(t *testing.T) {
+	want := color.NRGBA{200, 80, 40, 255}
+	img, err := Decode(Encode(solidImg(64, 64, want)), 0)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != DefaultDecodeSize || b.Dy() != DefaultDecodeSize {
+		t.Fatalf("size: got %dx%d", b.Dx(), b.Dy())
+	}
+	got := img.NRGBAAt(16, 16)
+	for i, pair := range [][2]uint8{{got.R, want.R}, {got.G, want.G}, {got.B, want.B}, {got.A, want.A}} {
+		d := int(pair[0]) - int(pair[1])
+		if d < -12 || d > 12 {
+			t.Errorf("channel %d: got %d, want ≈%d", i, pair[0], pair[1])
+		}
+	}
+}
+
+func TestDecode_AllFixtures(t *testing.T) {
+	for i, img := range buildGoldenImages() {
+		name := goldenFixtures()[i].name
+		src := img.Bounds()
+		out, err := Decode(Encode(img), 0)
+		if err != nil {
+			t.Errorf("%s: decode: %v", name, err)
+			continue
+		}
+		b := out.Bounds()
+		if (src.Dx() > src.Dy()) != (b.Dx() > b.Dy()) && src.Dx() != src.Dy() {
+			t.Errorf("%s: orientation lost: src %dx%d, decoded %dx%d",
+				name, src.Dx(), src.Dy(), b.Dx(), b.Dy())
+		}
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	for _, h := range [][]byte{nil, {1, 2, 3}, Encode(gradientImg(64, 32))[:7]} {
+		if _, err := Decode(h, 0); err == nil {
+			t.Errorf("expected error for %x", h)
+		}
+	}
+}
+
+func TestDataURI(t *testing.T) {
+	uri, err := DataURI(Encode(gradientImg(320, 180)), 0)
+	if err != nil {
+		t.Fatalf("data uri: %v", err)
+	}
+	if !strings.HasPrefix(uri, "data:image/png;base64,") {
+		t.Errorf("unexpected prefix: %.40s", uri)
+	}
+	t.Logf("data uri: %d bytes", len(uri))
+}
@@ -0,0 +1,3 @@
+module github.com/AnyUserName/tgimg-core/thumbhash
+
+go 1.22
@@ -12,6 +12,7 @@
 package thumbhash
 
 import (
+	"encoding/binary"
 	"image"
 	"image/color"
 	"math"
@@ -57,10 +58,22 @@ var wbPool = sync.Pool{New: func() any { return new(workBuf) }}
 // Output: 20–35 bytes.  Deterministic for identical input.
 // Steady-state allocations: 1 per call (the returned []byte).
 func Encode(img image.Image) []byte {
+	hash, _ := encode(img, false)
+	return hash
+}
+
+// EncodeThumbnail is Encode that also returns the pixels it hashed: img
+// area-averaged to at most 100 px a side, as NRGBA.  Average colours and
+// other summaries computed from it skip another pass over img.
+func EncodeThumbnail(img image.Image) ([]byte, *image.NRGBA) {
+	return encode(img, true)
+}
+
+func encode(img image.Image, withThumb bool) ([]byte, *image.NRGBA) {
 	bounds := img.Bounds()
 	srcW, srcH := bounds.Dx(), bounds.Dy()
 	if srcW <= 0 || srcH <= 0 {
-		return nil
+		return nil, nil
 	}
 
 	dstW, dstH := thumbDims(srcW, srcH)
@@ -75,9 +88,17 @@ func Encode(img image.Image) []byte {
 		areaDownscale(img, bounds, srcW, srcH, dstW, dstH, wb.rgba[:n])
 	}
 
+	var thumb *image.NRGBA
+	if withThumb { // before assembleHash, which transforms rgba in place
+		thumb = image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+		for i, v := range wb.rgba[:n] {
+			thumb.Pix[i] = uint8(roundF(clamp01f(v) * 255))
+		}
+	}
+
 	hash := assembleHash(dstW, dstH, wb)
 	wbPool.Put(wb)
-	return hash
+	return hash, thumb
 }
 
 func thumbDims(srcW, srcH int) (int, int) {
@@ -786,35 +807,115 @@ func encodeChan(data []float32, chanOff, stride, w, h, nx, ny int,
 
 // HasAlpha reports whether any pixel has alpha < fully opaque.
 func HasAlpha(img image.Image) bool {
+	return AlphaBelow(img, 255)
+}
+
+// AlphaBelow reports whether any pixel's 8-bit alpha is below threshold,
+// e.g. to treat a nearly opaque image as opaque. NRGBA and RGBA pixels
+// are scanned sixteen at a time, returning at the first block with one.
+// Paletted pixels (GIF, PNG-8) are looked up in the palette's alpha.
+func AlphaBelow(img image.Image, threshold uint8) bool {
+	if threshold == 0 {
+		return false
+	}
+	var pix []byte
+	var stride int
 	switch src := img.(type) {
 	case *image.NRGBA:
-		for i := 3; i < len(src.Pix); i += 4 {
-			if src.Pix[i] < 255 {
-				return true
-			}
-		}
-		return false
+		pix, stride = src.Pix, src.Stride
 	case *image.RGBA:
-		for i := 3; i < len(src.Pix); i += 4 {
-			if src.Pix[i] < 255 {
-				return true
-			}
-		}
-		return false
+		pix, stride = src.Pix, src.Stride
 	case *image.YCbCr, *image.Gray:
 		return false
+	case *image.Paletted:
+		return palettedAlphaBelow(src, threshold)
 	default:
+		t := uint32(threshold) * 0x101
 		bounds := img.Bounds()
 		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 			for x := bounds.Min.X; x < bounds.Max.X; x++ {
 				_, _, _, a := img.At(x, y).RGBA()
-				if a < 65535 {
+				if a < t {
 					return true
 				}
 			}
 		}
 		return false
 	}
+
+	// Rows of a sub-image are scanned one by one; contiguous rows as one.
+	b := img.Bounds()
+	if b.Empty() {
+		return false
+	}
+	w := 4 * b.Dx()
+	if stride == w {
+		return alphaBelow(pix[:w*b.Dy()], threshold)
+	}
+	for y := 0; y < b.Dy(); y++ {
+		if alphaBelow(pix[y*stride:y*stride+w], threshold) {
+			return true
+		}
+	}
+	return false
+}
+
+// alphaBelow reports whether any 4-byte pixel in pix has its alpha (the
+// last byte) below t. Blocks of sixteen pixels are ANDed as 64-bit words:
+// when every alpha byte of the result is 0xff, the block is opaque and
+// cannot hold an alpha below t; only other blocks are checked byte-wise.
+func alphaBelow(pix []byte, t uint8) bool {
+	const opaque = 0xff000000_ff000000
+	i := 0
+	for ; i+64 <= len(pix); i += 64 {
+		p := pix[i : i+64 : i+64]
+		w := binary.LittleEndian.Uint64(p) & binary.LittleEndian.Uint64(p[8:]) &
+			binary.LittleEndian.Uint64(p[16:]) & binary.LittleEndian.Uint64(p[24:]) &
+			binary.LittleEndian.Uint64(p[32:]) & binary.LittleEndian.Uint64(p[40:]) &
+			binary.LittleEndian.Uint64(p[48:]) & binary.LittleEndian.Uint64(p[56:])
+		if w&opaque != opaque && anyAlphaBelow(p, t) {
+			return true
+		}
+	}
+	return anyAlphaBelow(pix[i:], t)
+}
+
+// palettedAlphaBelow is AlphaBelow for a paletted image: it finds the
+// palette entries with alpha below t and only scans the pixels when one
+// exists. Indices past the end of the palette count as opaque.
+func palettedAlphaBelow(m *image.Paletted, t uint8) bool {
+	var below [256]bool
+	found := false
+	for i, c := range m.Palette {
+		if c == nil {
+			continue
+		}
+		if _, _, _, a := c.RGBA(); a < uint32(t)*0x101 {
+			below[i], found = true, true
+		}
+	}
+	if !found {
+		return false
+	}
+	b := m.Rect
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := m.PixOffset(b.Min.X, y)
+		for _, p := range m.Pix[i : i+b.Dx()] {
+			if below[p] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func anyAlphaBelow(pix []byte, t uint8) bool {
+	for i := 3; i < len(pix); i += 4 {
+		if pix[i] < t {
+			return true
+		}
+	}
+	return false
 }
 
 // ImageToNRGBA converts any image to NRGBA format.
@@ -0,0 +1,229 @@
+package thumbhash
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestEncode_Deterministic(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(x * 8), G: uint8(y * 8), B: 128, A: 255,
+			})
+		}
+	}
+
+	h1 := Encode(img)
+	h2 := Encode(img)
+
+	if len(h1) == 0 {
+		t.Fatal("empty hash")
+	}
+	if len(h1) != len(h2) {
+		t.Fatalf("length mismatch: %d vs %d", len(h1), len(h2))
+	}
+	for i := range h1 {
+		if h1[i] != h2[i] {
+			t.Fatalf("byte %d differs: %02x vs %02x", i, h1[i], h2[i])
+		}
+	}
+}
+
+func TestEncode_SizeRange(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: uint8((x + y) % 256), G: uint8((x * 2) % 256),
+				B: uint8((y * 3) % 256), A: 255,
+			})
+		}
+	}
+
+	hash := Encode(img)
+	if len(hash) < 5 || len(hash) > 60 {
+		t.Errorf("unexpected hash size: %d bytes", len(hash))
+	}
+}
+
+func TestEncodeThumbnail(t *testing.T) {
+	img := image.NewYCbCr(image.Rect(0, 0, 400, 300), image.YCbCrSubsampleRatio420)
+	for i := range img.Y {
+		img.Y[i] = 180
+	}
+	for i := range img.Cb {
+		img.Cb[i], img.Cr[i] = 100, 160
+	}
+
+	hash, thumb := EncodeThumbnail(img)
+	if want := Encode(img); string(hash) != string(want) {
+		t.Fatalf("hash differs from Encode: %x vs %x", hash, want)
+	}
+	if got := thumb.Bounds().Size(); got != image.Pt(100, 75) {
+		t.Fatalf("thumbnail size %v, want 100x75", got)
+	}
+	r, g, b, _ := img.At(7, 7).RGBA()
+	want := color.NRGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: 255}
+	for _, p := range []image.Point{{0, 0}, {50, 37}, {99, 74}} {
+		if got := thumb.NRGBAAt(p.X, p.Y); !near(got, want) {
+			t.Errorf("thumbnail at %v = %v, want %v", p, got, want)
+		}
+	}
+}
+
+// near reports whether a and b differ by at most the LUT conversion's
+// rounding in each channel.
+func near(a, b color.NRGBA) bool {
+	d := func(x, y uint8) bool { return x-y <= 1 || y-x <= 1 }
+	return d(a.R, b.R) && d(a.G, b.G) && d(a.B, b.B) && a.A == b.A
+}
+
+func TestHasAlpha_Opaque(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: 255, G: 0, B: 0, A: 255})
+		}
+	}
+	if HasAlpha(img) {
+		t.Error("opaque image reported as having alpha")
+	}
+}
+
+func TestHasAlpha_Transparent(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: 255, G: 0, B: 0, A: 128})
+		}
+	}
+	if !HasAlpha(img) {
+		t.Error("transparent image not detected")
+	}
+}
+
+func TestHasAlpha_RGBA(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: 128, G: 0, B: 0, A: 128})
+		}
+	}
+	if !HasAlpha(img) {
+		t.Error("RGBA with alpha not detected")
+	}
+}
+
+func TestHasAlpha_YCbCr(t *testing.T) {
+	img := image.NewYCbCr(image.Rect(0, 0, 8, 8), image.YCbCrSubsampleRatio420)
+	if HasAlpha(img) {
+		t.Error("YCbCr should never report alpha")
+	}
+}
+
+func TestHasAlpha_Gray(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+	if HasAlpha(img) {
+		t.Error("Gray should never report alpha")
+	}
+}
+
+func TestHasAlpha_EveryPosition(t *testing.T) {
+	// Odd widths leave a tail after the 8-pixel blocks.
+	for _, w := range []int{1, 7, 8, 9, 33} {
+		img := makeNRGBA(w, 3)
+		if HasAlpha(img) {
+			t.Fatalf("%dx3: opaque image reported as having alpha", w)
+		}
+		for i := 3; i < len(img.Pix); i += 4 {
+			img.Pix[i] = 254
+			if !HasAlpha(img) {
+				t.Fatalf("%dx3: alpha of pixel %d not detected", w, i/4)
+			}
+			img.Pix[i] = 255
+		}
+	}
+}
+
+func TestHasAlpha_SubImage(t *testing.T) {
+	img := makeNRGBA(16, 16)
+	img.SetNRGBA(0, 0, color.NRGBA{A: 0})
+	sub := img.SubImage(image.Rect(4, 4, 12, 12))
+	if HasAlpha(sub) {
+		t.Error("alpha outside the sub-image reported")
+	}
+	img.SetNRGBA(11, 11, color.NRGBA{A: 0})
+	if !HasAlpha(sub) {
+		t.Error("alpha inside the sub-image not detected")
+	}
+}
+
+func TestHasAlpha_Paletted(t *testing.T) {
+	// A GIF palette: the transparent index decodes as color.RGBA{}.
+	pal := color.Palette{color.RGBA{255, 0, 0, 255}, color.RGBA{}, color.NRGBA{0, 0, 255, 100}}
+	img := image.NewPaletted(image.Rect(0, 0, 9, 9), pal)
+	if HasAlpha(img) {
+		t.Error("paletted image with unused transparent entries reported as having alpha")
+	}
+	img.SetColorIndex(7, 7, 1)
+	if !HasAlpha(img) {
+		t.Error("transparent palette entry not detected")
+	}
+	if HasAlpha(img.SubImage(image.Rect(0, 0, 5, 5))) {
+		t.Error("alpha outside the sub-image reported")
+	}
+	img.SetColorIndex(7, 7, 2)
+	if !AlphaBelow(img, 101) || AlphaBelow(img, 100) {
+		t.Error("AlphaBelow threshold on a translucent entry")
+	}
+	img.SetColorIndex(7, 7, 200) // past the palette
+	if HasAlpha(img) {
+		t.Error("out-of-palette index reported as transparent")
+	}
+	if HasAlpha(image.NewPaletted(image.Rect(0, 0, 2, 2), nil)) {
+		t.Error("empty palette reported as having alpha")
+	}
+}
+
+func TestAlphaBelow(t *testing.T) {
+	img := makeNRGBA(10, 10)
+	img.SetNRGBA(5, 5, color.NRGBA{A: 250})
+	if !AlphaBelow(img, 255) || !AlphaBelow(img, 251) {
+		t.Error("alpha 250 not below 251")
+	}
+	if AlphaBelow(img, 250) || AlphaBelow(img, 0) {
+		t.Error("alpha 250 reported below 250")
+	}
+	gray := image.NewGray16(image.Rect(0, 0, 2, 2))
+	if AlphaBelow(gray, 255) {
+		t.Error("Gray16 reported as having alpha")
+	}
+	alpha := image.NewAlpha(image.Rect(0, 0, 2, 2))
+	for i := range alpha.Pix {
+		alpha.Pix[i] = 255
+	}
+	alpha.SetAlpha(1, 1, color.Alpha{A: 200})
+	if !AlphaBelow(alpha, 201) || AlphaBelow(alpha, 200) {
+		t.Error("Alpha image threshold not applied")
+	}
+}
+
+// Legacy benchmark (kept for backwards-compatibility in reporting).
+func BenchmarkEncode(b *testing.B) {
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(x), G: uint8(y), B: uint8((x + y) / 2), A: 255,
+			})
+		}
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = Encode(img)
+	}
+}